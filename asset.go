@@ -2,6 +2,10 @@ package sabakan
 
 import "time"
 
+// MaxAssetVersions is the maximum number of versions of an asset,
+// including the current one, kept by sabakan.
+const MaxAssetVersions = 5
+
 // Asset represents an asset.
 type Asset struct {
 	Name        string            `json:"name"`
@@ -10,9 +14,26 @@ type Asset struct {
 	Date        time.Time         `json:"date"`
 	Size        int64             `json:"size"`
 	Sha256      string            `json:"sha256"`
+	Uploader    string            `json:"uploader"`
 	URLs        []string          `json:"urls"`
 	Exists      bool              `json:"exists"`
 	Options     map[string]string `json:"options"`
+
+	// History is the list of previous versions.
+	// The most recently replaced version comes last.
+	History []*AssetVersion `json:"history,omitempty"`
+}
+
+// AssetVersion represents a version of an asset.
+type AssetVersion struct {
+	ID          int               `json:"id,string"`
+	ContentType string            `json:"content-type"`
+	Date        time.Time         `json:"date"`
+	Size        int64             `json:"size"`
+	Sha256      string            `json:"sha256"`
+	Uploader    string            `json:"uploader"`
+	URLs        []string          `json:"urls"`
+	Options     map[string]string `json:"options"`
 }
 
 // AssetStatus is the status of an asset.
@@ -20,3 +41,116 @@ type AssetStatus struct {
 	Status int `json:"status"`
 	ID     int `json:"id,string"`
 }
+
+func (a *Asset) current() *AssetVersion {
+	return &AssetVersion{
+		ID:          a.ID,
+		ContentType: a.ContentType,
+		Date:        a.Date,
+		Size:        a.Size,
+		Sha256:      a.Sha256,
+		Uploader:    a.Uploader,
+		URLs:        a.URLs,
+		Options:     a.Options,
+	}
+}
+
+func (a *Asset) setCurrent(v *AssetVersion) {
+	a.ID = v.ID
+	a.ContentType = v.ContentType
+	a.Date = v.Date
+	a.Size = v.Size
+	a.Sha256 = v.Sha256
+	a.Uploader = v.Uploader
+	a.URLs = v.URLs
+	a.Options = v.Options
+}
+
+// AppendHistory makes a the successor of prev.  The history of prev is
+// copied to a, and prev itself is appended as the latest previous version.
+//
+// If the number of versions exceeds MaxAssetVersions, the oldest versions
+// will be discarded.  IDs of discarded versions are returned.
+func (a *Asset) AppendHistory(prev *Asset) []int {
+	history := make([]*AssetVersion, 0, len(prev.History)+1)
+	history = append(history, prev.History...)
+	history = append(history, prev.current())
+
+	var dels []int
+	if n := len(history) - MaxAssetVersions + 1; n > 0 {
+		for _, v := range history[:n] {
+			dels = append(dels, v.ID)
+		}
+		history = history[n:]
+	}
+	a.History = history
+	return dels
+}
+
+// Rollback makes the version of id current.  The current version is
+// appended to the history as the latest previous version.
+//
+// Date is set to now so that HTTP clients do not keep cached contents
+// of the replaced version.
+//
+// If no previous version has id, this returns ErrNotFound.
+func (a *Asset) Rollback(id int, now time.Time) error {
+	for i, v := range a.History {
+		if v.ID != id {
+			continue
+		}
+
+		history := make([]*AssetVersion, 0, len(a.History))
+		history = append(history, a.History[:i]...)
+		history = append(history, a.History[i+1:]...)
+		history = append(history, a.current())
+
+		a.setCurrent(v)
+		a.Date = now.UTC()
+		a.History = history
+		return nil
+	}
+
+	return ErrNotFound
+}
+
+// Version returns a copy of a whose current version is that of id.
+// The returned asset has no history.
+//
+// If no version has id, this returns nil.
+func (a *Asset) Version(id int) *Asset {
+	ret := *a
+	ret.History = nil
+	if id == a.ID {
+		return &ret
+	}
+
+	for _, v := range a.History {
+		if v.ID == id {
+			ret.setCurrent(v)
+			return &ret
+		}
+	}
+	return nil
+}
+
+// Versions returns all versions of the asset.  The current version comes
+// first, and the others follow in the reverse order of the history.
+func (a *Asset) Versions() []*AssetVersion {
+	ret := make([]*AssetVersion, 0, len(a.History)+1)
+	ret = append(ret, a.current())
+	for i := len(a.History) - 1; i >= 0; i-- {
+		ret = append(ret, a.History[i])
+	}
+	return ret
+}
+
+// IDs returns IDs of all versions of the asset.
+func (a *Asset) IDs() []int {
+	ids := make([]int, 0, len(a.History)+1)
+	ids = append(ids, a.ID)
+	for _, v := range a.History {
+		ids = append(ids, v.ID)
+	}
+	return ids
+}
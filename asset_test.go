@@ -0,0 +1,82 @@
+package sabakan
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testAssetAppendHistory(t *testing.T) {
+	t.Parallel()
+
+	a := &Asset{Name: "foo", ID: 1}
+	for id := 2; id <= MaxAssetVersions; id++ {
+		next := &Asset{Name: "foo", ID: id}
+		dels := next.AppendHistory(a)
+		if len(dels) != 0 {
+			t.Error("no versions should be discarded:", dels)
+		}
+		a = next
+	}
+
+	expected := []int{5, 1, 2, 3, 4}
+	if !reflect.DeepEqual(a.IDs(), expected) {
+		t.Error("unexpected IDs:", a.IDs())
+	}
+
+	next := &Asset{Name: "foo", ID: 6}
+	dels := next.AppendHistory(a)
+	if !reflect.DeepEqual(dels, []int{1}) {
+		t.Error("the oldest version should be discarded:", dels)
+	}
+	if len(a.History) != MaxAssetVersions-1 {
+		t.Error("prev should not be modified:", len(a.History))
+	}
+
+	var ids []int
+	for _, v := range next.Versions() {
+		ids = append(ids, v.ID)
+	}
+	if !reflect.DeepEqual(ids, []int{6, 5, 4, 3, 2}) {
+		t.Error("unexpected versions:", ids)
+	}
+}
+
+func testAssetRollback(t *testing.T) {
+	t.Parallel()
+
+	date := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	a := &Asset{Name: "foo", ID: 1, Sha256: "aaa", Uploader: "user1", Date: date}
+	b := &Asset{Name: "foo", ID: 2, Sha256: "bbb", Uploader: "user2", Date: date}
+	b.AppendHistory(a)
+
+	err := b.Rollback(3, time.Now())
+	if err != ErrNotFound {
+		t.Error("unknown version should not be found:", err)
+	}
+
+	now := time.Now()
+	err = b.Rollback(1, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.ID != 1 || b.Sha256 != "aaa" || b.Uploader != "user1" || !b.Date.Equal(now) {
+		t.Errorf("unexpected current version: %#v", b)
+	}
+	if len(b.History) != 1 || b.History[0].ID != 2 || b.History[0].Sha256 != "bbb" {
+		t.Error("replaced version should be in the history:", b.History)
+	}
+
+	v := b.Version(2)
+	if v == nil || v.Name != "foo" || v.ID != 2 || v.Sha256 != "bbb" || v.History != nil {
+		t.Errorf("unexpected version: %#v", v)
+	}
+	if b.Version(3) != nil {
+		t.Error("unknown version should be nil")
+	}
+}
+
+func TestAsset(t *testing.T) {
+	t.Run("AppendHistory", testAssetAppendHistory)
+	t.Run("Rollback", testAssetRollback)
+}
@@ -2,6 +2,7 @@ package sabakan
 
 import (
 	"context"
+	"errors"
 	"time"
 )
 
@@ -10,14 +11,19 @@ type AuditCategory string
 
 // Audit categories.
 const (
-	AuditAssets   = AuditCategory("assets")
-	AuditCrypts   = AuditCategory("crypts")
-	AuditDHCP     = AuditCategory("dhcp")
-	AuditIgnition = AuditCategory("ignition")
-	AuditImage    = AuditCategory("image")
-	AuditIPAM     = AuditCategory("ipam")
-	AuditIPXE     = AuditCategory("ipxe")
-	AuditMachines = AuditCategory("machines")
+	AuditAssets      = AuditCategory("assets")
+	AuditBackup      = AuditCategory("backup")
+	AuditCrypts      = AuditCategory("crypts")
+	AuditCryptPolicy = AuditCategory("crypt-policy")
+	AuditDHCP        = AuditCategory("dhcp")
+	AuditIgnition    = AuditCategory("ignition")
+	AuditImage       = AuditCategory("image")
+	AuditIPAM        = AuditCategory("ipam")
+	AuditIPXE        = AuditCategory("ipxe")
+	AuditLogs        = AuditCategory("logs")
+	AuditMachines    = AuditCategory("machines")
+	AuditSwitches    = AuditCategory("switches")
+	AuditWebhooks    = AuditCategory("webhooks")
 )
 
 // AuditLog represents an audit log entry.
@@ -31,6 +37,12 @@ type AuditLog struct {
 	Instance  string        `json:"instance"`
 	Action    string        `json:"action"`
 	Detail    string        `json:"detail"`
+
+	// Seq is the position in the hash chain starting from 1.
+	// Zero means the entry was recorded before the hash chain was introduced.
+	Seq      uint64 `json:"seq,omitempty"`
+	PrevHash string `json:"prev,omitempty"`
+	Hash     string `json:"hash,omitempty"`
 }
 
 // AuditContextKey is the type of context keys for audit.
@@ -43,6 +55,14 @@ const (
 	AuditKeyHost = AuditContextKey("host")
 )
 
+// AuditUser returns the user name stored in ctx with AuditKeyUser.
+func AuditUser(ctx context.Context) string {
+	if v := ctx.Value(AuditKeyUser); v != nil {
+		return v.(string)
+	}
+	return ""
+}
+
 // NewAuditLog creates an audit log entry and initializes it.
 func NewAuditLog(ctx context.Context, ts time.Time, rev int64, cat AuditCategory,
 	instance, action, detail string) *AuditLog {
@@ -50,9 +70,7 @@ func NewAuditLog(ctx context.Context, ts time.Time, rev int64, cat AuditCategory
 	a := new(AuditLog)
 	a.Timestamp = ts.UTC()
 	a.Revision = rev
-	if v := ctx.Value(AuditKeyUser); v != nil {
-		a.User = v.(string)
-	}
+	a.User = AuditUser(ctx)
 	if v := ctx.Value(AuditKeyIP); v != nil {
 		a.IP = v.(string)
 	}
@@ -66,3 +84,67 @@ func NewAuditLog(ctx context.Context, ts time.Time, rev int64, cat AuditCategory
 
 	return a
 }
+
+// Orders of audit log queries.
+const (
+	LogOrderAsc  = "asc"
+	LogOrderDesc = "desc"
+)
+
+// LogQuery is a query for audit logs.  Zero values match any logs.
+type LogQuery struct {
+	// Since and Until specify the date range.  The date of Until is not included.
+	Since time.Time
+	Until time.Time
+
+	Category AuditCategory
+	Instance string
+	Action   string
+	User     string
+	IP       string
+
+	// Limit is the maximum number of logs.  Zero means no limit.
+	Limit int
+
+	// Order is either LogOrderAsc or LogOrderDesc.  Empty means ascending.
+	Order string
+}
+
+// Validate validates the query.
+func (q *LogQuery) Validate() error {
+	if q.Limit < 0 {
+		return errors.New("limit must not be negative")
+	}
+	switch q.Order {
+	case "", LogOrderAsc, LogOrderDesc:
+	default:
+		return errors.New("invalid order: " + q.Order)
+	}
+	return nil
+}
+
+// Match returns true if the log matches all non-empty fields other than
+// the date range.
+func (q *LogQuery) Match(a *AuditLog) bool {
+	if q.Category != "" && q.Category != a.Category {
+		return false
+	}
+	if q.Instance != "" && q.Instance != a.Instance {
+		return false
+	}
+	if q.Action != "" && q.Action != a.Action {
+		return false
+	}
+	if q.User != "" && q.User != a.User {
+		return false
+	}
+	if q.IP != "" && q.IP != a.IP {
+		return false
+	}
+	return true
+}
+
+// HasFilters returns true if the query has filters on log fields.
+func (q *LogQuery) HasFilters() bool {
+	return q.Category != "" || q.Instance != "" || q.Action != "" || q.User != "" || q.IP != ""
+}
@@ -0,0 +1,216 @@
+package sabakan
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ComputeHash returns the hash of the audit log entry.
+//
+// The hash is hex-encoded SHA-256 of PrevHash, a newline, and the JSON
+// encoding of the entry without Hash.  As PrevHash is the hash of the
+// previous entry, entries form a hash chain in the order of Seq.
+func (a *AuditLog) ComputeHash() (string, error) {
+	copied := *a
+	copied.Hash = ""
+	data, err := json.Marshal(&copied)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	h.Write([]byte(a.PrevHash))
+	h.Write([]byte{'\n'})
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// AuditCheckpoint records the hash of an audit log entry in the chain.
+//
+// Checkpoints anchor the chain when older entries are removed by compaction.
+type AuditCheckpoint struct {
+	Seq       uint64    `json:"seq"`
+	Hash      string    `json:"hash"`
+	Timestamp time.Time `json:"ts"`
+
+	// Signature is the Ed25519 signature of SignedData.  Empty if not signed.
+	Signature []byte `json:"signature,omitempty"`
+}
+
+// SignedData returns the data to be signed.
+func (c *AuditCheckpoint) SignedData() []byte {
+	return []byte(fmt.Sprintf("sabakan-audit-checkpoint\n%d\n%s\n%s",
+		c.Seq, c.Hash, c.Timestamp.UTC().Format(time.RFC3339Nano)))
+}
+
+// Sign signs the checkpoint with key.
+func (c *AuditCheckpoint) Sign(key ed25519.PrivateKey) {
+	c.Signature = ed25519.Sign(key, c.SignedData())
+}
+
+// VerifySignature returns true if the checkpoint is signed with the key for pub.
+func (c *AuditCheckpoint) VerifySignature(pub ed25519.PublicKey) bool {
+	return len(c.Signature) == ed25519.SignatureSize && ed25519.Verify(pub, c.SignedData(), c.Signature)
+}
+
+// AuditChain is the state of the audit log hash chain.
+type AuditChain struct {
+	// Head is the last entry in the chain.  This is not signed.
+	Head *AuditCheckpoint `json:"head,omitempty"`
+
+	// Checkpoints are sorted by Seq.
+	Checkpoints []*AuditCheckpoint `json:"checkpoints"`
+}
+
+// AuditVerifyResult is the result of VerifyAuditChain.
+type AuditVerifyResult struct {
+	// Verified is the number of entries verified.
+	Verified int `json:"verified"`
+
+	// Unchained is the number of entries recorded before the hash chain was introduced.
+	Unchained int `json:"unchained"`
+
+	// Anchored is true if the first entry is linked to the beginning of
+	// the chain or to a checkpoint.
+	Anchored bool `json:"anchored"`
+
+	// Errors describe gaps and modifications.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// OK returns true if no errors are found.
+func (r *AuditVerifyResult) OK() bool {
+	return len(r.Errors) == 0
+}
+
+func (r *AuditVerifyResult) errorf(format string, args ...interface{}) {
+	r.Errors = append(r.Errors, fmt.Sprintf(format, args...))
+}
+
+// unanchored reports the oldest entry a that is not linked to the chain.
+// Entries after the newest valid checkpoint before a are missing.
+func (r *AuditVerifyResult) unanchored(a *AuditLog, sorted []*AuditCheckpoint, valid map[uint64]*AuditCheckpoint) {
+	var below *AuditCheckpoint
+	for _, c := range sorted {
+		if c.Seq < a.Seq && valid[c.Seq] == c {
+			below = c
+		}
+	}
+
+	var from uint64 = 1
+	if below != nil {
+		from = below.Seq + 1
+	}
+	if from == a.Seq-1 {
+		r.errorf("entry %d is missing", from)
+		return
+	}
+	r.errorf("entries %d to %d are missing", from, a.Seq-1)
+}
+
+// VerifyAuditChain verifies the hash chain of audit log entries.
+//
+// logs must be consecutive entries without filters in the order of keys.
+// Unchained entries are accepted only before the first chained entry
+// because the chain was introduced after them.  If anchored is true,
+// logs must include the oldest entry, which must be linked to the beginning
+// of the chain or to the checkpoint just before it.  If complete is true,
+// logs must include the last entry in the chain.  If pub is not nil,
+// signatures of checkpoints are verified.
+func VerifyAuditChain(logs []*AuditLog, chain *AuditChain, pub ed25519.PublicKey, anchored, complete bool) *AuditVerifyResult {
+	r := new(AuditVerifyResult)
+
+	var entries []*AuditLog
+	for _, a := range logs {
+		if a.Seq == 0 && len(entries) > 0 {
+			r.errorf("unchained entry is found after entry %d", entries[len(entries)-1].Seq)
+			continue
+		}
+		if a.Seq == 0 {
+			r.Unchained++
+			continue
+		}
+		entries = append(entries, a)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Seq < entries[j].Seq
+	})
+
+	checkpoints := make(map[uint64]*AuditCheckpoint)
+	for _, c := range chain.Checkpoints {
+		if pub != nil && !c.VerifySignature(pub) {
+			r.errorf("invalid signature of checkpoint %d", c.Seq)
+			continue
+		}
+		checkpoints[c.Seq] = c
+	}
+
+	var prev *AuditLog
+	for _, a := range entries {
+		hash, err := a.ComputeHash()
+		if err != nil {
+			r.errorf("entry %d: %v", a.Seq, err)
+			continue
+		}
+		if hash != a.Hash {
+			r.errorf("entry %d is modified", a.Seq)
+		}
+
+		switch {
+		case prev == nil:
+			if a.Seq == 1 {
+				r.Anchored = true
+				if a.PrevHash != "" {
+					r.errorf("entry 1 has a previous hash")
+				}
+			} else if c, ok := checkpoints[a.Seq-1]; ok {
+				r.Anchored = true
+				if a.PrevHash != c.Hash {
+					r.errorf("entry %d does not match checkpoint %d", a.Seq, c.Seq)
+				}
+			}
+			if anchored && !r.Anchored {
+				r.unanchored(a, chain.Checkpoints, checkpoints)
+			}
+		case a.Seq == prev.Seq:
+			r.errorf("entry %d is duplicated", a.Seq)
+		case a.Seq == prev.Seq+2:
+			r.errorf("entry %d is missing", prev.Seq+1)
+		case a.Seq != prev.Seq+1:
+			r.errorf("entries %d to %d are missing", prev.Seq+1, a.Seq-1)
+		case a.PrevHash != prev.Hash:
+			r.errorf("entry %d is not linked to entry %d", a.Seq, prev.Seq)
+		}
+
+		if c, ok := checkpoints[a.Seq]; ok && c.Hash != a.Hash {
+			r.errorf("entry %d does not match checkpoint %d", a.Seq, c.Seq)
+		}
+
+		r.Verified++
+		prev = a
+	}
+
+	if !complete {
+		return r
+	}
+
+	var last uint64
+	if prev != nil {
+		last = prev.Seq
+	}
+	for _, c := range chain.Checkpoints {
+		if c.Seq > last {
+			r.errorf("entries after %d are missing: checkpoint %d exists", last, c.Seq)
+			break
+		}
+	}
+	if chain.Head != nil && chain.Head.Seq > last {
+		r.errorf("entries after %d are missing: the chain continues to %d", last, chain.Head.Seq)
+	}
+	return r
+}
@@ -0,0 +1,138 @@
+package sabakan
+
+import (
+	"crypto/ed25519"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testAuditChainLogs(t *testing.T, n int) []*AuditLog {
+	ts := time.Date(2026, 10, 19, 1, 2, 3, 0, time.UTC)
+	var logs []*AuditLog
+	var prev string
+	for i := 1; i <= n; i++ {
+		a := &AuditLog{
+			Timestamp: ts.Add(time.Duration(i) * time.Minute),
+			Revision:  int64(100 + i),
+			Category:  AuditMachines,
+			Instance:  "1234abcd",
+			Action:    "put",
+			Seq:       uint64(i),
+			PrevHash:  prev,
+		}
+		hash, err := a.ComputeHash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.Hash = hash
+		prev = hash
+		logs = append(logs, a)
+	}
+	return logs
+}
+
+func testAuditCheckpoint(a *AuditLog, key ed25519.PrivateKey) *AuditCheckpoint {
+	c := &AuditCheckpoint{Seq: a.Seq, Hash: a.Hash, Timestamp: a.Timestamp}
+	if key != nil {
+		c.Sign(key)
+	}
+	return c
+}
+
+func TestVerifyAuditChain(t *testing.T) {
+	t.Parallel()
+
+	pub, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logs := testAuditChainLogs(t, 5)
+	chain := &AuditChain{
+		Head:        testAuditCheckpoint(logs[4], nil),
+		Checkpoints: []*AuditCheckpoint{testAuditCheckpoint(logs[1], key)},
+	}
+
+	r := VerifyAuditChain(append([]*AuditLog{{Action: "legacy"}}, logs...), chain, pub, true, true)
+	if !r.OK() || r.Verified != 5 || r.Unchained != 1 || !r.Anchored {
+		t.Error("chain should be verified:", r)
+	}
+
+	// the order of chained logs does not matter
+	reversed := []*AuditLog{logs[4], logs[3], logs[2], logs[1], logs[0]}
+	r = VerifyAuditChain(reversed, chain, pub, true, true)
+	if !r.OK() {
+		t.Error("chain should be verified:", r.Errors)
+	}
+
+	// anchored by the checkpoint after compaction
+	r = VerifyAuditChain(logs[2:], chain, pub, true, true)
+	if !r.OK() || !r.Anchored || r.Verified != 3 {
+		t.Error("chain should be anchored by the checkpoint:", r)
+	}
+
+	// logs in a date range need not be anchored
+	r = VerifyAuditChain(logs[3:], chain, pub, false, false)
+	if !r.OK() || r.Anchored {
+		t.Error("chain should not be anchored:", r)
+	}
+
+	// rewriting the first entry after the checkpoint breaks the link
+	rewrittenFirst := testAuditChainLogs(t, 5)[2:]
+	rewrittenFirst[0].Detail = "rewritten"
+	rewrittenFirst[0].Hash, _ = rewrittenFirst[0].ComputeHash()
+	r = VerifyAuditChain(rewrittenFirst, chain, pub, true, true)
+	if r.OK() || r.Errors[0] != "entry 4 is not linked to entry 3" {
+		t.Error("rewriting the first entry should be detected:", r.Errors)
+	}
+
+	cases := []struct {
+		name     string
+		logs     []*AuditLog
+		chain    *AuditChain
+		anchored bool
+		complete bool
+		expected string
+	}{
+		{"gap", []*AuditLog{logs[0], logs[1], logs[3], logs[4]}, chain, true, true, "entry 3 is missing"},
+		{"gaps", []*AuditLog{logs[0], logs[4]}, chain, true, true, "entries 2 to 4 are missing"},
+		{"duplicate", []*AuditLog{logs[0], logs[1], logs[1], logs[2], logs[3], logs[4]}, chain, true, true, "entry 2 is duplicated"},
+		{"truncated", logs[:3], chain, true, true, "entries after 3 are missing"},
+		{"truncated-checkpoint", logs[:1], &AuditChain{Checkpoints: chain.Checkpoints}, true, true, "checkpoint 2 exists"},
+		{"bad-signature", logs, &AuditChain{Checkpoints: []*AuditCheckpoint{testAuditCheckpoint(logs[1], nil)}}, true, true, "invalid signature of checkpoint 2"},
+		{"front-truncated", logs[3:], chain, true, true, "entry 3 is missing"},
+		{"front-truncated-all", logs[4:], chain, true, false, "entries 3 to 4 are missing"},
+		{"front-truncated-no-checkpoint", logs[3:], &AuditChain{}, true, false, "entries 1 to 3 are missing"},
+		{"inserted-unchained", []*AuditLog{logs[0], logs[1], {Action: "forged"}, logs[2], logs[3], logs[4]}, chain, true, true, "unchained entry is found after entry 2"},
+		{"inserted-unchained-dated", []*AuditLog{logs[3], {Action: "forged"}, logs[4]}, chain, false, false, "unchained entry is found after entry 4"},
+	}
+	for _, c := range cases {
+		r := VerifyAuditChain(c.logs, c.chain, pub, c.anchored, c.complete)
+		if r.OK() || !strings.Contains(strings.Join(r.Errors, "\n"), c.expected) {
+			t.Error("unexpected result for", c.name, r.Errors)
+		}
+	}
+
+	// modification
+	modified := testAuditChainLogs(t, 5)
+	modified[2].Detail = "modified"
+	r = VerifyAuditChain(modified, chain, pub, true, true)
+	if r.OK() || r.Errors[0] != "entry 3 is modified" {
+		t.Error("modification should be detected:", r.Errors)
+	}
+
+	// rewriting the whole chain does not match signed checkpoints
+	rewritten := testAuditChainLogs(t, 5)
+	rewritten[0].Detail = "rewritten"
+	prev := ""
+	for _, a := range rewritten {
+		a.PrevHash = prev
+		a.Hash, _ = a.ComputeHash()
+		prev = a.Hash
+	}
+	r = VerifyAuditChain(rewritten, chain, pub, true, true)
+	if r.OK() || r.Errors[0] != "entry 2 does not match checkpoint 2" {
+		t.Error("rewriting should be detected:", r.Errors)
+	}
+}
@@ -0,0 +1,129 @@
+package sabakan
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// AuditChange is a change of a value in a JSON document.
+//
+// Path is a JSON Pointer (RFC 6901) to the value.  Old is absent if the
+// value is added, and New is absent if the value is removed.
+type AuditChange struct {
+	Path string          `json:"path"`
+	Old  json.RawMessage `json:"old,omitempty"`
+	New  json.RawMessage `json:"new,omitempty"`
+}
+
+// DiffJSON returns changes from old to new JSON documents.
+// nil means the document does not exist.
+//
+// Objects are compared recursively.  Other values including arrays
+// are compared as a whole.
+func DiffJSON(old, new []byte) ([]AuditChange, error) {
+	var o, n interface{}
+	if old != nil {
+		if err := unmarshalNumber(old, &o); err != nil {
+			return nil, err
+		}
+	}
+	if new != nil {
+		if err := unmarshalNumber(new, &n); err != nil {
+			return nil, err
+		}
+	}
+
+	changes := []AuditChange{}
+	err := diffValue(&changes, "", o, old != nil, n, new != nil)
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+func unmarshalNumber(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+func diffValue(changes *[]AuditChange, path string, o interface{}, hasOld bool, n interface{}, hasNew bool) error {
+	om, oIsMap := o.(map[string]interface{})
+	nm, nIsMap := n.(map[string]interface{})
+	if hasOld && hasNew && oIsMap && nIsMap {
+		keys := make([]string, 0, len(om)+len(nm))
+		for k := range om {
+			keys = append(keys, k)
+		}
+		for k := range nm {
+			if _, ok := om[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			ov, hasOV := om[k]
+			nv, hasNV := nm[k]
+			err := diffValue(changes, path+"/"+pointerEscaper.Replace(k), ov, hasOV, nv, hasNV)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if hasOld == hasNew && reflect.DeepEqual(o, n) {
+		return nil
+	}
+
+	c := AuditChange{Path: path}
+	if hasOld {
+		data, err := json.Marshal(o)
+		if err != nil {
+			return err
+		}
+		c.Old = data
+	}
+	if hasNew {
+		data, err := json.Marshal(n)
+		if err != nil {
+			return err
+		}
+		c.New = data
+	}
+	*changes = append(*changes, c)
+	return nil
+}
+
+// AuditDiff returns the audit log detail describing changes from
+// old to new JSON documents.  nil means the document does not exist.
+func AuditDiff(old, new []byte) (string, error) {
+	changes, err := DiffJSON(old, new)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// ParseAuditDiff parses the detail of an audit log entry made by AuditDiff.
+// It returns false if the detail is not a diff.
+func ParseAuditDiff(detail string) ([]AuditChange, bool) {
+	if !strings.HasPrefix(detail, "[") {
+		return nil, false
+	}
+	var changes []AuditChange
+	if err := json.Unmarshal([]byte(detail), &changes); err != nil {
+		return nil, false
+	}
+	return changes, true
+}
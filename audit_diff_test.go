@@ -0,0 +1,101 @@
+package sabakan
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDiffJSON(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		old      string
+		new      string
+		expected []AuditChange
+	}{
+		{
+			name:     "same",
+			old:      `{"a":1,"b":{"c":"x"}}`,
+			new:      `{"b":{"c":"x"},"a":1}`,
+			expected: []AuditChange{},
+		},
+		{
+			name: "modify",
+			old:  `{"a":1,"b":{"c":"x","d":[1,2]}}`,
+			new:  `{"a":2,"b":{"c":"x","d":[1,3]}}`,
+			expected: []AuditChange{
+				{Path: "/a", Old: json.RawMessage(`1`), New: json.RawMessage(`2`)},
+				{Path: "/b/d", Old: json.RawMessage(`[1,2]`), New: json.RawMessage(`[1,3]`)},
+			},
+		},
+		{
+			name: "add and remove",
+			old:  `{"labels":{"a/b":"x","c~d":"y"}}`,
+			new:  `{"labels":{"c~d":"y","e":"z"}}`,
+			expected: []AuditChange{
+				{Path: "/labels/a~1b", Old: json.RawMessage(`"x"`)},
+				{Path: "/labels/e", New: json.RawMessage(`"z"`)},
+			},
+		},
+		{
+			name: "null",
+			old:  `{"labels":null}`,
+			new:  `{"labels":{"a":"x"}}`,
+			expected: []AuditChange{
+				{Path: "/labels", Old: json.RawMessage(`null`), New: json.RawMessage(`{"a":"x"}`)},
+			},
+		},
+		{
+			name: "create",
+			new:  `{"a":1}`,
+			expected: []AuditChange{
+				{Path: "", New: json.RawMessage(`{"a":1}`)},
+			},
+		},
+		{
+			name: "delete",
+			old:  `{"a":1}`,
+			expected: []AuditChange{
+				{Path: "", Old: json.RawMessage(`{"a":1}`)},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			var old, new []byte
+			if c.old != "" {
+				old = []byte(c.old)
+			}
+			if c.new != "" {
+				new = []byte(c.new)
+			}
+
+			detail, err := AuditDiff(old, new)
+			if err != nil {
+				t.Fatal(err)
+			}
+			changes, ok := ParseAuditDiff(detail)
+			if !ok {
+				t.Fatal("failed to parse diff:", detail)
+			}
+			if changes == nil {
+				changes = []AuditChange{}
+			}
+			if !cmp.Equal(changes, c.expected) {
+				t.Error("unexpected changes:", cmp.Diff(changes, c.expected))
+			}
+		})
+	}
+
+	if _, ok := ParseAuditDiff("label/value"); ok {
+		t.Error("plain detail should not be parsed as diff")
+	}
+	if _, err := DiffJSON([]byte("{"), nil); err == nil {
+		t.Error("invalid JSON should be an error")
+	}
+}
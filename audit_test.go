@@ -0,0 +1,48 @@
+package sabakan
+
+import "testing"
+
+func TestLogQuery(t *testing.T) {
+	t.Parallel()
+
+	a := &AuditLog{
+		User:     "alice",
+		IP:       "10.0.0.1",
+		Category: AuditMachines,
+		Instance: "1234",
+		Action:   "state",
+	}
+
+	cases := []struct {
+		q        LogQuery
+		expected bool
+	}{
+		{LogQuery{}, true},
+		{LogQuery{Category: AuditMachines, Instance: "1234"}, true},
+		{LogQuery{Category: AuditCrypts}, false},
+		{LogQuery{Instance: "5678"}, false},
+		{LogQuery{Action: "state", User: "alice", IP: "10.0.0.1"}, true},
+		{LogQuery{Action: "delete"}, false},
+		{LogQuery{User: "bob"}, false},
+		{LogQuery{IP: "10.0.0.2"}, false},
+	}
+	for _, c := range cases {
+		if c.q.Match(a) != c.expected {
+			t.Error("unexpected result:", c.q, !c.expected)
+		}
+		if c.q.HasFilters() != (c.q != LogQuery{}) {
+			t.Error("wrong HasFilters:", c.q)
+		}
+	}
+
+	for _, q := range []LogQuery{{}, {Limit: 10, Order: LogOrderAsc}, {Order: LogOrderDesc}} {
+		if err := q.Validate(); err != nil {
+			t.Error("query should be valid:", q, err)
+		}
+	}
+	for _, q := range []LogQuery{{Limit: -1}, {Order: "random"}} {
+		if err := q.Validate(); err == nil {
+			t.Error("query should be invalid:", q)
+		}
+	}
+}
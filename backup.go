@@ -0,0 +1,586 @@
+package sabakan
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BackupFormatVersion is the version of the backup archive format.
+const BackupFormatVersion = 1
+
+// Modes to handle disk encryption keys in backups.
+const (
+	BackupKeysExclude   = "exclude"
+	BackupKeysPlain     = "plain"
+	BackupKeysEncrypted = "encrypted"
+)
+
+// Names of members in backup archives.
+const (
+	backupHeaderFile    = "backup.json"
+	backupStateFile     = "state.json"
+	backupCryptKeysFile = "crypt-keys.json"
+	backupAssetsDir     = "assets/"
+	backupImagesDir     = "images/"
+)
+
+// Parameters to derive a key from a passphrase.
+const (
+	backupKDF           = "pbkdf2-sha256"
+	backupKDFIterations = 600000
+	backupSaltSize      = 16
+)
+
+// BackupOptions is a set of options for backups.
+type BackupOptions struct {
+	// CryptKeys is one of BackupKeysExclude, BackupKeysPlain, or
+	// BackupKeysEncrypted.  Empty means BackupKeysExclude.
+	CryptKeys string
+
+	// Passphrase is used to encrypt keys with BackupKeysEncrypted.
+	Passphrase string
+}
+
+// Validate validates the options.
+func (o *BackupOptions) Validate() error {
+	switch o.CryptKeys {
+	case "", BackupKeysExclude, BackupKeysPlain:
+	case BackupKeysEncrypted:
+		if o.Passphrase == "" {
+			return errors.New("passphrase is required to encrypt keys")
+		}
+	default:
+		return errors.New("invalid crypt-keys: " + o.CryptKeys)
+	}
+	return nil
+}
+
+// BackupHeader is the first member of a backup archive.
+type BackupHeader struct {
+	Version   int       `json:"version"`
+	Schema    string    `json:"schema"`
+	CreatedAt time.Time `json:"created-at"`
+	CryptKeys string    `json:"crypt-keys"`
+}
+
+// BackupCryptPolicy is a disk encryption policy in a backup.
+type BackupCryptPolicy struct {
+	Kind   string       `json:"kind"`
+	Name   string       `json:"name"`
+	Policy *CryptPolicy `json:"policy"`
+}
+
+// BackupCryptKey is a disk encryption key in a backup.
+type BackupCryptKey struct {
+	Serial    string    `json:"serial"`
+	Path      string    `json:"path"`
+	Key       []byte    `json:"key"`
+	CreatedAt time.Time `json:"created-at"`
+}
+
+// BackupState is a snapshot of the state of sabakan.
+//
+// Audit logs, webhooks, and DHCP leases are not included.
+type BackupState struct {
+	IPAM          *IPAMConfig                             `json:"ipam,omitempty"`
+	DHCP          *DHCPConfig                             `json:"dhcp,omitempty"`
+	Machines      []*Machine                              `json:"machines"`
+	KernelParams  map[string]string                       `json:"kernel-params"`
+	Ignitions     map[string]map[string]*IgnitionTemplate `json:"ignitions"`
+	CryptPolicies []*BackupCryptPolicy                    `json:"crypt-policies"`
+	Switches      []*Switch                               `json:"switches"`
+
+	// Assets and Images are the meta data of the contents.
+	Assets []*Asset              `json:"assets"`
+	Images map[string]ImageIndex `json:"images"`
+
+	// CryptKeys are stored separately from the state in archives.
+	CryptKeys []*BackupCryptKey `json:"-"`
+}
+
+// validate checks the references in the state.
+func (s *BackupState) validate() error {
+	serials := make(map[string]bool)
+	for _, m := range s.Machines {
+		if m.Spec.Serial == "" {
+			return errors.New("machine without serial")
+		}
+		if serials[m.Spec.Serial] {
+			return errors.New("duplicate machine: " + m.Spec.Serial)
+		}
+		serials[m.Spec.Serial] = true
+	}
+	for _, k := range s.CryptKeys {
+		if !serials[k.Serial] {
+			return errors.New("encryption key for unknown machine: " + k.Serial)
+		}
+	}
+	for _, p := range s.CryptPolicies {
+		if p.Policy == nil {
+			return errors.New("empty crypt policy: " + path.Join(p.Kind, p.Name))
+		}
+	}
+	return nil
+}
+
+// encryptedCryptKeys is the format of encrypted keys in archives.
+type encryptedCryptKeys struct {
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Data       []byte `json:"data"`
+}
+
+func backupAEAD(passphrase string, salt []byte, iter int) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, iter, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func encryptCryptKeys(keys []*BackupCryptKey, passphrase string) ([]byte, error) {
+	data, err := json.Marshal(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, backupSaltSize)
+	_, err = rand.Read(salt)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := backupAEAD(passphrase, salt, backupKDFIterations)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(encryptedCryptKeys{
+		KDF:        backupKDF,
+		Iterations: backupKDFIterations,
+		Salt:       salt,
+		Nonce:      nonce,
+		Data:       aead.Seal(nil, nonce, data, nil),
+	})
+}
+
+func decryptCryptKeys(data []byte, passphrase string) ([]*BackupCryptKey, error) {
+	var enc encryptedCryptKeys
+	err := json.Unmarshal(data, &enc)
+	if err != nil {
+		return nil, err
+	}
+	if enc.KDF != backupKDF || enc.Iterations <= 0 {
+		return nil, badBackup("unsupported key derivation: %s", enc.KDF)
+	}
+
+	aead, err := backupAEAD(passphrase, enc.Salt, enc.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	if len(enc.Nonce) != aead.NonceSize() {
+		return nil, badBackup("invalid nonce")
+	}
+	plain, err := aead.Open(nil, enc.Nonce, enc.Data, nil)
+	if err != nil {
+		return nil, badBackup("wrong passphrase")
+	}
+
+	var keys []*BackupCryptKey
+	err = json.Unmarshal(plain, &keys)
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// backupError is an error for a broken or incompatible backup archive.
+// errors.Is(err, ErrBadRequest) is true for backupError.
+type backupError string
+
+func (e backupError) Error() string {
+	return "invalid backup: " + string(e)
+}
+
+func (e backupError) Unwrap() error {
+	return ErrBadRequest
+}
+
+func badBackup(format string, args ...interface{}) error {
+	return backupError(fmt.Sprintf(format, args...))
+}
+
+func writeTarFile(tw *tar.Writer, name string, size int64, r io.Reader) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0600,
+		Size:    size,
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.CopyN(tw, r, size)
+	return err
+}
+
+func writeTarJSON(tw *tar.Writer, name string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return writeTarFile(tw, name, int64(len(data)), bytes.NewReader(data))
+}
+
+// backupAssetHandler writes the contents of an asset to a backup archive.
+type backupAssetHandler struct {
+	ctx   context.Context
+	tw    *tar.Writer
+	asset *Asset
+	err   error
+}
+
+func (h *backupAssetHandler) write(size int64, r io.Reader) {
+	hash := sha256.New()
+	err := writeTarFile(h.tw, backupAssetsDir+strconv.Itoa(h.asset.ID), size, io.TeeReader(r, hash))
+	if err != nil {
+		h.err = err
+		return
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != h.asset.Sha256 {
+		h.err = fmt.Errorf("asset %s was modified during backup", h.asset.Name)
+	}
+}
+
+func (h *backupAssetHandler) ServeContent(asset *Asset, content io.ReadSeeker) {
+	size, err := content.Seek(0, io.SeekEnd)
+	if err != nil {
+		h.err = err
+		return
+	}
+	_, err = content.Seek(0, io.SeekStart)
+	if err != nil {
+		h.err = err
+		return
+	}
+	h.write(size, content)
+}
+
+func (h *backupAssetHandler) Redirect(url string) {
+	req, err := http.NewRequestWithContext(h.ctx, http.MethodGet, url, nil)
+	if err != nil {
+		h.err = err
+		return
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		h.err = err
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		h.err = fmt.Errorf("failed to download asset %s: %s", h.asset.Name, resp.Status)
+		return
+	}
+	if resp.ContentLength < 0 {
+		h.err = fmt.Errorf("failed to download asset %s: unknown size", h.asset.Name)
+		return
+	}
+	h.write(resp.ContentLength, resp.Body)
+}
+
+func backupImage(ctx context.Context, m Model, tw *tar.Writer, osName, id string) error {
+	// the size of the image archive is needed before writing it
+	f, err := os.CreateTemp("", "sabakan-backup-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		f.Close()
+		os.Remove(f.Name())
+	}()
+
+	err = m.Image.Download(ctx, osName, id, f)
+	if err != nil {
+		return err
+	}
+	size, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	return writeTarFile(tw, backupImagesDir+path.Join(osName, id)+".tar", size, f)
+}
+
+// WriteBackup writes a backup archive of the state of m to w.
+//
+// The archive is a tar file consisting of the header, the state in JSON,
+// disk encryption keys, and the contents of assets and images.
+func WriteBackup(ctx context.Context, m Model, opts *BackupOptions, w io.Writer) error {
+	err := opts.Validate()
+	if err != nil {
+		return err
+	}
+	mode := opts.CryptKeys
+	if mode == "" {
+		mode = BackupKeysExclude
+	}
+
+	state, err := m.Backup.Dump(ctx)
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(w)
+	err = writeTarJSON(tw, backupHeaderFile, &BackupHeader{
+		Version:   BackupFormatVersion,
+		Schema:    SchemaVersion,
+		CreatedAt: time.Now().UTC(),
+		CryptKeys: mode,
+	})
+	if err != nil {
+		return err
+	}
+	err = writeTarJSON(tw, backupStateFile, state)
+	if err != nil {
+		return err
+	}
+
+	switch mode {
+	case BackupKeysPlain:
+		err = writeTarJSON(tw, backupCryptKeysFile, state.CryptKeys)
+	case BackupKeysEncrypted:
+		var data []byte
+		data, err = encryptCryptKeys(state.CryptKeys, opts.Passphrase)
+		if err != nil {
+			return err
+		}
+		err = writeTarFile(tw, backupCryptKeysFile, int64(len(data)), bytes.NewReader(data))
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, a := range state.Assets {
+		h := &backupAssetHandler{ctx: ctx, tw: tw, asset: a}
+		err = m.Asset.Get(ctx, a.Name, h)
+		if err == nil {
+			err = h.err
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for os, index := range state.Images {
+		for _, img := range index {
+			err = backupImage(ctx, m, tw, os, img.ID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return tw.Close()
+}
+
+// RestoreBackup restores the state of m from a backup archive.
+//
+// m must be empty; otherwise, this returns ErrConflicted.  If the archive
+// is broken or incompatible, this returns an error wrapping ErrBadRequest.
+// passphrase is used to decrypt encrypted disk encryption keys.
+//
+// If this fails after the state is loaded, the loaded state and uploaded
+// assets and images are removed so that the restore can be retried.
+func RestoreBackup(ctx context.Context, m Model, r io.Reader, passphrase string) error {
+	tr := tar.NewReader(r)
+	next := func() (*tar.Header, error) {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, badBackup("unexpected end of archive")
+		}
+		if err != nil {
+			return nil, badBackup("%v", err)
+		}
+		return hdr, nil
+	}
+	readJSON := func(name string, v interface{}) error {
+		hdr, err := next()
+		if err != nil {
+			return err
+		}
+		if hdr.Name != name {
+			return badBackup("%s is expected, but got %s", name, hdr.Name)
+		}
+		err = json.NewDecoder(tr).Decode(v)
+		if err != nil {
+			return badBackup("%s: %v", name, err)
+		}
+		return nil
+	}
+
+	header := new(BackupHeader)
+	err := readJSON(backupHeaderFile, header)
+	if err != nil {
+		return err
+	}
+	if header.Version != BackupFormatVersion {
+		return badBackup("unsupported format version %d", header.Version)
+	}
+	if header.Schema != SchemaVersion {
+		return badBackup("schema version %s does not match %s", header.Schema, SchemaVersion)
+	}
+
+	state := new(BackupState)
+	err = readJSON(backupStateFile, state)
+	if err != nil {
+		return err
+	}
+
+	switch header.CryptKeys {
+	case BackupKeysExclude:
+	case BackupKeysPlain:
+		err = readJSON(backupCryptKeysFile, &state.CryptKeys)
+		if err != nil {
+			return err
+		}
+	case BackupKeysEncrypted:
+		if passphrase == "" {
+			return badBackup("passphrase is required to decrypt keys")
+		}
+		var data json.RawMessage
+		err = readJSON(backupCryptKeysFile, &data)
+		if err != nil {
+			return err
+		}
+		state.CryptKeys, err = decryptCryptKeys(data, passphrase)
+		if err != nil {
+			return err
+		}
+	default:
+		return badBackup("unknown crypt-keys mode %s", header.CryptKeys)
+	}
+
+	err = state.validate()
+	if err != nil {
+		return badBackup("%v", err)
+	}
+
+	assets := make(map[string]*Asset)
+	for _, a := range state.Assets {
+		assets[backupAssetsDir+strconv.Itoa(a.ID)] = a
+	}
+	images := make(map[string]bool)
+	for os, index := range state.Images {
+		for _, img := range index {
+			images[backupImagesDir+path.Join(os, img.ID)+".tar"] = true
+		}
+	}
+
+	err = m.Backup.Load(ctx, state)
+	if err != nil {
+		return err
+	}
+
+	uploaded, err := restoreContents(ctx, m, tr, assets, images)
+	if err != nil {
+		uerr := undoRestore(ctx, m, state, uploaded)
+		if uerr != nil {
+			return fmt.Errorf("%w; failed to undo the restore: %v", err, uerr)
+		}
+		return err
+	}
+	return nil
+}
+
+// restoreContents uploads the contents of assets and images in the rest of
+// the archive.  This returns the names of uploaded assets even if it fails.
+func restoreContents(ctx context.Context, m Model, tr *tar.Reader,
+	assets map[string]*Asset, images map[string]bool) ([]string, error) {
+
+	var uploaded []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return uploaded, badBackup("%v", err)
+		}
+
+		switch {
+		case assets[hdr.Name] != nil:
+			a := assets[hdr.Name]
+			csum, err := hex.DecodeString(a.Sha256)
+			if err != nil {
+				return uploaded, badBackup("invalid checksum of asset %s", a.Name)
+			}
+			_, err = m.Asset.Put(ctx, a.Name, a.ContentType, csum, a.Options, tr)
+			if err != nil {
+				return uploaded, err
+			}
+			uploaded = append(uploaded, a.Name)
+			delete(assets, hdr.Name)
+		case images[hdr.Name]:
+			name := strings.TrimSuffix(hdr.Name[len(backupImagesDir):], ".tar")
+			os, id := path.Split(name)
+			err = m.Image.Upload(ctx, path.Clean(os), id, tr)
+			if err != nil {
+				return uploaded, err
+			}
+			delete(images, hdr.Name)
+		default:
+			return uploaded, badBackup("unexpected member %s", hdr.Name)
+		}
+	}
+
+	if len(assets) > 0 || len(images) > 0 {
+		return uploaded, badBackup("%d assets and %d images are missing", len(assets), len(images))
+	}
+	return uploaded, nil
+}
+
+// undoRestore removes the state loaded from a backup and the uploaded
+// assets and images.
+func undoRestore(ctx context.Context, m Model, state *BackupState, assets []string) error {
+	// undo even if the request is canceled.
+	ctx = context.WithoutCancel(ctx)
+	for _, name := range assets {
+		err := m.Asset.Delete(ctx, name)
+		if err != nil && err != ErrNotFound {
+			return err
+		}
+	}
+	return m.Backup.Unload(ctx, state)
+}
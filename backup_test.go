@@ -0,0 +1,95 @@
+package sabakan
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBackupOptions(t *testing.T) {
+	t.Parallel()
+
+	valids := []BackupOptions{
+		{},
+		{CryptKeys: BackupKeysExclude},
+		{CryptKeys: BackupKeysPlain},
+		{CryptKeys: BackupKeysEncrypted, Passphrase: "secret"},
+	}
+	for _, o := range valids {
+		if err := o.Validate(); err != nil {
+			t.Errorf("%#v should be valid: %v", o, err)
+		}
+	}
+
+	invalids := []BackupOptions{
+		{CryptKeys: BackupKeysEncrypted},
+		{CryptKeys: "foo"},
+	}
+	for _, o := range invalids {
+		if err := o.Validate(); err == nil {
+			t.Errorf("%#v should be invalid", o)
+		}
+	}
+}
+
+func TestBackupCryptKeys(t *testing.T) {
+	t.Parallel()
+
+	keys := []*BackupCryptKey{
+		{Serial: "1234", Path: "disk1", Key: []byte("key1"), CreatedAt: time.Now().UTC()},
+	}
+	data, err := encryptCryptKeys(keys, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("disk1")) {
+		t.Error("keys are not encrypted")
+	}
+
+	decrypted, err := decryptCryptKeys(data, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decrypted) != 1 || decrypted[0].Serial != "1234" || string(decrypted[0].Key) != "key1" {
+		t.Error("unexpected keys:", decrypted)
+	}
+
+	_, err = decryptCryptKeys(data, "wrong")
+	if !errors.Is(err, ErrBadRequest) {
+		t.Error("wrong passphrase should be rejected:", err)
+	}
+}
+
+func TestRestoreBackupHeader(t *testing.T) {
+	t.Parallel()
+
+	archive := func(h *BackupHeader) *bytes.Buffer {
+		buf := new(bytes.Buffer)
+		tw := tar.NewWriter(buf)
+		err := writeTarJSON(tw, backupHeaderFile, h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = tw.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return buf
+	}
+
+	// these are rejected before the model is used
+	headers := []*BackupHeader{
+		{Version: BackupFormatVersion + 1, Schema: SchemaVersion},
+		{Version: BackupFormatVersion, Schema: "1"},
+		{Version: BackupFormatVersion, Schema: SchemaVersion},
+	}
+	for _, h := range headers {
+		err := RestoreBackup(context.Background(), Model{}, archive(h), "")
+		if !errors.Is(err, ErrBadRequest) {
+			t.Errorf("%#v should be rejected: %v", h, err)
+		}
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"os"
 	"path"
+	"strconv"
 
 	"github.com/cybozu-go/sabakan/v3"
 )
@@ -99,3 +100,25 @@ func (c *Client) AssetsUpload(ctx context.Context, name, filename string, meta m
 func (c *Client) AssetsDelete(ctx context.Context, name string) error {
 	return c.sendRequest(ctx, "DELETE", path.Join("assets", name), nil)
 }
+
+// AssetsRollback makes a previous version of an asset current
+func (c *Client) AssetsRollback(ctx context.Context, name string, id int) (*sabakan.AssetStatus, error) {
+	req := c.newRequest(ctx, "PUT", path.Join("assets", name, "rollback"), nil)
+	q := req.URL.Query()
+	q.Set("version", strconv.Itoa(id))
+	req.URL.RawQuery = q.Encode()
+
+	resp, status := c.do(req)
+	if status != nil {
+		return nil, status
+	}
+	defer resp.Body.Close()
+
+	var result sabakan.AssetStatus
+	err := json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
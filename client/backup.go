@@ -0,0 +1,46 @@
+package client
+
+import (
+	"context"
+	"io"
+
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+// Backup retrieves a backup archive of sabakan and writes it to w.
+func (c *Client) Backup(ctx context.Context, opts *sabakan.BackupOptions, w io.Writer) error {
+	req := c.newRequest(ctx, "GET", "backup", nil)
+	if opts.CryptKeys != "" {
+		q := req.URL.Query()
+		q.Set("crypt-keys", opts.CryptKeys)
+		req.URL.RawQuery = q.Encode()
+	}
+	if opts.Passphrase != "" {
+		req.Header.Set("X-Sabakan-Backup-Passphrase", opts.Passphrase)
+	}
+
+	resp, status := c.do(req)
+	if status != nil {
+		return status
+	}
+	defer resp.Body.Close()
+
+	_, err := io.Copy(w, resp.Body)
+	return err
+}
+
+// Restore restores sabakan from a backup archive read from r.
+// passphrase is used to decrypt disk encryption keys in the archive.
+func (c *Client) Restore(ctx context.Context, r io.Reader, passphrase string) error {
+	req := c.newRequest(ctx, "PUT", "backup", r)
+	if passphrase != "" {
+		req.Header.Set("X-Sabakan-Backup-Passphrase", passphrase)
+	}
+
+	resp, status := c.do(req)
+	if status != nil {
+		return status
+	}
+	resp.Body.Close()
+	return nil
+}
@@ -3,7 +3,9 @@ package client
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -19,6 +21,9 @@ type Client struct {
 	url      *url.URL
 	http     *http.Client
 	username string
+	token    string
+
+	cryptToken string
 }
 
 // NewClient returns new client
@@ -42,6 +47,38 @@ func NewClient(endpoint string, http *http.Client) (*Client, error) {
 	return client, nil
 }
 
+// SetToken sets the bearer token to authenticate the client.
+func (c *Client) SetToken(token string) {
+	c.token = token
+}
+
+// SetCryptToken sets the per-machine token to retrieve disk encryption keys.
+func (c *Client) SetCryptToken(token string) {
+	c.cryptToken = token
+}
+
+// NewTLSConfig returns TLS configurations to connect to sabakan HTTPS server.
+// If certFile and keyFile are not empty, the client certificate is presented
+// to the server to authenticate the client.
+func NewTLSConfig(certFile, keyFile string, insecure bool) (*tls.Config, error) {
+	cfg := &tls.Config{
+		InsecureSkipVerify: insecure,
+	}
+	if certFile == "" && keyFile == "" {
+		return cfg, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("both client certificate and key must be specified")
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Certificates = []tls.Certificate{cert}
+	return cfg, nil
+}
+
 // newRequest creates a new http.Request whose context is set to ctx.
 // path will be prefixed by "/api/v1".
 func (c *Client) newRequest(ctx context.Context, method, p string, body io.Reader) *http.Request {
@@ -49,6 +86,12 @@ func (c *Client) newRequest(ctx context.Context, method, p string, body io.Reade
 	u.Path = path.Join(u.Path, "/api/v1", p)
 	r, _ := http.NewRequest(method, u.String(), body)
 	r.Header.Set("X-Sabakan-User", c.username)
+	if c.token != "" {
+		r.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if c.cryptToken != "" {
+		r.Header.Set("X-Sabakan-Crypt-Token", c.cryptToken)
+	}
 	return r.WithContext(ctx)
 }
 
@@ -0,0 +1,39 @@
+package client
+
+import (
+	"context"
+	"path"
+
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+// CryptPoliciesGet gets the disk encryption policy for a role or a machine.
+// kind is either sabakan.CryptPolicyRole or sabakan.CryptPolicyMachine.
+func (c *Client) CryptPoliciesGet(ctx context.Context, kind, name string) (*sabakan.CryptPolicy, error) {
+	policy := new(sabakan.CryptPolicy)
+	err := c.getJSON(ctx, path.Join("crypt-policies", kind, name), nil, policy)
+	if err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// CryptPoliciesSet sets the disk encryption policy for a role or a machine.
+func (c *Client) CryptPoliciesSet(ctx context.Context, kind, name string, policy *sabakan.CryptPolicy) error {
+	return c.sendRequestWithJSON(ctx, "PUT", path.Join("crypt-policies", kind, name), policy)
+}
+
+// CryptPoliciesDelete deletes the disk encryption policy for a role or a machine.
+func (c *Client) CryptPoliciesDelete(ctx context.Context, kind, name string) error {
+	return c.sendRequest(ctx, "DELETE", path.Join("crypt-policies", kind, name), nil)
+}
+
+// CryptPoliciesResolve gets the disk encryption policy applied to the machine.
+func (c *Client) CryptPoliciesResolve(ctx context.Context, serial string) (*sabakan.CryptPolicy, error) {
+	policy := new(sabakan.CryptPolicy)
+	err := c.getJSON(ctx, path.Join("crypt-policies", "effective", serial), nil, policy)
+	if err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"context"
 	"path"
+
+	"github.com/cybozu-go/sabakan/v3"
 )
 
 // CryptsGet gets an encryption key from sabakan server.
@@ -21,3 +23,14 @@ func (c *Client) CryptsPut(ctx context.Context, serial, device string, key []byt
 func (c *Client) CryptsDelete(ctx context.Context, serial string) error {
 	return c.sendRequest(ctx, "DELETE", path.Join("crypts", serial), nil)
 }
+
+// CryptsList lists meta data of encryption keys of the machine specified by serial.
+// If serial is empty, this lists keys of all machines.
+func (c *Client) CryptsList(ctx context.Context, serial string) ([]*sabakan.EncryptionKeyInfo, error) {
+	var infos []*sabakan.EncryptionKeyInfo
+	err := c.getJSON(ctx, path.Join("crypts", serial), nil, &infos)
+	if err != nil {
+		return nil, err
+	}
+	return infos, nil
+}
@@ -20,3 +20,13 @@ func (c *Client) DHCPConfigGet(ctx context.Context) (*sabakan.DHCPConfig, error)
 func (c *Client) DHCPConfigSet(ctx context.Context, conf *sabakan.DHCPConfig) error {
 	return c.sendRequestWithJSON(ctx, "PUT", "config/dhcp", conf)
 }
+
+// DHCPTrace retrieves recent DHCP transactions of a MAC address
+func (c *Client) DHCPTrace(ctx context.Context, mac string) ([]*sabakan.DHCPTrace, error) {
+	var traces []*sabakan.DHCPTrace
+	err := c.getJSON(ctx, "dhcp/debug/"+mac, nil, &traces)
+	if err != nil {
+		return nil, err
+	}
+	return traces, nil
+}
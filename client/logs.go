@@ -3,18 +3,36 @@ package client
 import (
 	"context"
 	"io"
-	"time"
+	"strconv"
+
+	"github.com/cybozu-go/sabakan/v3"
 )
 
-// LogsGet retrieves audit logs.
-func (c *Client) LogsGet(ctx context.Context, since, until time.Time, w io.Writer) error {
+// LogsGet retrieves audit logs matching lq.
+func (c *Client) LogsGet(ctx context.Context, lq *sabakan.LogQuery, w io.Writer) error {
 	req := c.newRequest(ctx, "GET", "logs", nil)
 	q := req.URL.Query()
-	if !since.IsZero() {
-		q.Set("since", since.UTC().Format("20060102"))
+	if !lq.Since.IsZero() {
+		q.Set("since", lq.Since.UTC().Format("20060102"))
+	}
+	if !lq.Until.IsZero() {
+		q.Set("until", lq.Until.UTC().Format("20060102"))
+	}
+	params := map[string]string{
+		"category": string(lq.Category),
+		"instance": lq.Instance,
+		"action":   lq.Action,
+		"user":     lq.User,
+		"ip":       lq.IP,
+		"order":    lq.Order,
+	}
+	for k, v := range params {
+		if len(v) > 0 {
+			q.Set(k, v)
+		}
 	}
-	if !until.IsZero() {
-		q.Set("until", until.UTC().Format("20060102"))
+	if lq.Limit > 0 {
+		q.Set("limit", strconv.Itoa(lq.Limit))
 	}
 	req.URL.RawQuery = q.Encode()
 
@@ -30,3 +48,13 @@ func (c *Client) LogsGet(ctx context.Context, since, until time.Time, w io.Write
 	}
 	return nil
 }
+
+// LogsChain retrieves the state of the hash chain of audit logs.
+func (c *Client) LogsChain(ctx context.Context) (*sabakan.AuditChain, error) {
+	chain := new(sabakan.AuditChain)
+	err := c.getJSON(ctx, "logs/chain", nil, chain)
+	if err != nil {
+		return nil, err
+	}
+	return chain, nil
+}
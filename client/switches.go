@@ -0,0 +1,37 @@
+package client
+
+import (
+	"context"
+
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+// SwitchesList lists all registered switches
+func (c *Client) SwitchesList(ctx context.Context) ([]*sabakan.Switch, error) {
+	var switches []*sabakan.Switch
+	err := c.getJSON(ctx, "switches", nil, &switches)
+	if err != nil {
+		return nil, err
+	}
+	return switches, nil
+}
+
+// SwitchesGet gets a switch identified by its MAC address
+func (c *Client) SwitchesGet(ctx context.Context, mac string) (*sabakan.Switch, error) {
+	sw := new(sabakan.Switch)
+	err := c.getJSON(ctx, "switches/"+mac, nil, sw)
+	if err != nil {
+		return nil, err
+	}
+	return sw, nil
+}
+
+// SwitchesSet registers or updates a switch
+func (c *Client) SwitchesSet(ctx context.Context, sw *sabakan.Switch) error {
+	return c.sendRequestWithJSON(ctx, "PUT", "switches/"+sw.MAC, sw)
+}
+
+// SwitchesDelete deletes a switch identified by its MAC address
+func (c *Client) SwitchesDelete(ctx context.Context, mac string) error {
+	return c.sendRequest(ctx, "DELETE", "switches/"+mac, nil)
+}
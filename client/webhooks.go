@@ -0,0 +1,37 @@
+package client
+
+import (
+	"context"
+
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+// WebhooksList lists all webhooks
+func (c *Client) WebhooksList(ctx context.Context) ([]*sabakan.Webhook, error) {
+	var hooks []*sabakan.Webhook
+	err := c.getJSON(ctx, "webhooks", nil, &hooks)
+	if err != nil {
+		return nil, err
+	}
+	return hooks, nil
+}
+
+// WebhooksGet gets a webhook identified by its name
+func (c *Client) WebhooksGet(ctx context.Context, name string) (*sabakan.Webhook, error) {
+	hook := new(sabakan.Webhook)
+	err := c.getJSON(ctx, "webhooks/"+name, nil, hook)
+	if err != nil {
+		return nil, err
+	}
+	return hook, nil
+}
+
+// WebhooksSet registers or updates a webhook
+func (c *Client) WebhooksSet(ctx context.Context, hook *sabakan.Webhook) error {
+	return c.sendRequestWithJSON(ctx, "PUT", "webhooks/"+hook.Name, hook)
+}
+
+// WebhooksDelete deletes a webhook identified by its name
+func (c *Client) WebhooksDelete(ctx context.Context, name string) error {
+	return c.sendRequest(ctx, "DELETE", "webhooks/"+name, nil)
+}
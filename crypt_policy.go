@@ -0,0 +1,134 @@
+package sabakan
+
+import (
+	"errors"
+	"path/filepath"
+	"regexp"
+)
+
+// Kinds of targets of disk encryption policies.
+const (
+	CryptPolicyRole    = "role"
+	CryptPolicyMachine = "machine"
+)
+
+var reValidCipher = regexp.MustCompile(`^[a-zA-Z0-9:()_-]+$`)
+
+// IsValidCryptPolicyKind returns true if kind is a valid target kind of
+// disk encryption policies.
+func IsValidCryptPolicyKind(kind string) bool {
+	return kind == CryptPolicyRole || kind == CryptPolicyMachine
+}
+
+// CryptPolicy is a disk encryption policy for sabakan-cryptsetup.
+//
+// Zero values of Cipher and KeySize mean the defaults of sabakan-cryptsetup.
+type CryptPolicy struct {
+	// Disks selects disks to be encrypted.  If empty, all disks are selected.
+	Disks []DiskSelector `json:"disks,omitempty"`
+
+	// Cipher is the cipher specification for dm-crypt.
+	Cipher string `json:"cipher,omitempty"`
+
+	// KeySize is the key size in bits.
+	KeySize int `json:"keysize,omitempty"`
+
+	// RequireTPM refuses to setup disks without TPM 2.0.
+	RequireTPM bool `json:"require-tpm,omitempty"`
+
+	// FormatNonEmpty allows to format disks having data but no meta data.
+	// If nil, such disks are formatted as when no policy is defined.
+	FormatNonEmpty *bool `json:"format-non-empty,omitempty"`
+}
+
+// DiskSelector selects disks.  A disk is selected if it matches all
+// the non-empty fields.
+type DiskSelector struct {
+	// Path is a glob pattern for names in /dev/disk/by-path.
+	Path string `json:"path,omitempty"`
+
+	// Model is a glob pattern for the model name of the disk.
+	Model string `json:"model,omitempty"`
+
+	// MinSize is the minimum size of the disk in bytes.
+	MinSize int64 `json:"min-size,omitempty"`
+
+	// MaxSize is the maximum size of the disk in bytes.
+	MaxSize int64 `json:"max-size,omitempty"`
+}
+
+// Validate validates the policy.
+func (p *CryptPolicy) Validate() error {
+	for i := range p.Disks {
+		err := p.Disks[i].validate()
+		if err != nil {
+			return err
+		}
+	}
+	if p.Cipher != "" && !reValidCipher.MatchString(p.Cipher) {
+		return errors.New("invalid cipher: " + p.Cipher)
+	}
+	if p.KeySize < 0 || p.KeySize%8 != 0 {
+		return errors.New("key size must be multiple of 8")
+	}
+	return nil
+}
+
+// SelectsDisk returns true if the policy selects a disk.
+// paths are names of the disk in /dev/disk/by-path.
+func (p *CryptPolicy) SelectsDisk(paths []string, model string, size int64) bool {
+	if len(p.Disks) == 0 {
+		return true
+	}
+	for i := range p.Disks {
+		if p.Disks[i].Match(paths, model, size) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *DiskSelector) validate() error {
+	for _, pat := range []string{s.Path, s.Model} {
+		_, err := filepath.Match(pat, "")
+		if err != nil {
+			return errors.New("invalid pattern: " + pat)
+		}
+	}
+	if s.MinSize < 0 || s.MaxSize < 0 {
+		return errors.New("disk size must not be negative")
+	}
+	if s.MaxSize != 0 && s.MinSize > s.MaxSize {
+		return errors.New("min-size is larger than max-size")
+	}
+	return nil
+}
+
+// Match returns true if the disk matches the selector.
+// paths are names of the disk in /dev/disk/by-path.
+func (s *DiskSelector) Match(paths []string, model string, size int64) bool {
+	if s.Path != "" {
+		var found bool
+		for _, p := range paths {
+			if ok, _ := filepath.Match(s.Path, p); ok {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if s.Model != "" {
+		if ok, _ := filepath.Match(s.Model, model); !ok {
+			return false
+		}
+	}
+	if size < s.MinSize {
+		return false
+	}
+	if s.MaxSize != 0 && size > s.MaxSize {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,76 @@
+package sabakan
+
+import "testing"
+
+func TestCryptPolicyValidate(t *testing.T) {
+	t.Parallel()
+
+	valid := []CryptPolicy{
+		{},
+		{Cipher: "aes-xts-plain64", KeySize: 512, RequireTPM: true},
+		{Disks: []DiskSelector{{Path: "pci-*-nvme-*"}, {Model: "SAMSUNG *", MinSize: 1 << 40}}},
+		{Disks: []DiskSelector{{MinSize: 1 << 30, MaxSize: 1 << 30}}},
+	}
+	for _, p := range valid {
+		if err := p.Validate(); err != nil {
+			t.Error("policy should be valid:", p, err)
+		}
+	}
+
+	invalid := []CryptPolicy{
+		{Cipher: "aes xts"},
+		{KeySize: 500},
+		{KeySize: -8},
+		{Disks: []DiskSelector{{Path: "[pci"}}},
+		{Disks: []DiskSelector{{Model: "[a-"}}},
+		{Disks: []DiskSelector{{MinSize: -1}}},
+		{Disks: []DiskSelector{{MinSize: 2, MaxSize: 1}}},
+	}
+	for _, p := range invalid {
+		if err := p.Validate(); err == nil {
+			t.Error("policy should be invalid:", p)
+		}
+	}
+}
+
+func TestCryptPolicySelectsDisk(t *testing.T) {
+	t.Parallel()
+
+	paths := []string{"pci-0000:00:1f.2-ata-1", "pci-0000:00:1f.2-ata-1.0"}
+	model := "SAMSUNG MZ7LH960"
+	const size = 960 << 30
+
+	p := &CryptPolicy{}
+	if !p.SelectsDisk(paths, model, size) {
+		t.Error("empty policy should select all disks")
+	}
+
+	cases := []struct {
+		sel      DiskSelector
+		expected bool
+	}{
+		{DiskSelector{Path: "pci-*-ata-1"}, true},
+		{DiskSelector{Path: "pci-*-nvme-*"}, false},
+		{DiskSelector{Model: "SAMSUNG *"}, true},
+		{DiskSelector{Model: "INTEL *"}, false},
+		{DiskSelector{MinSize: 500 << 30}, true},
+		{DiskSelector{MinSize: 1 << 40}, false},
+		{DiskSelector{MaxSize: 1 << 40}, true},
+		{DiskSelector{MaxSize: 500 << 30}, false},
+		{DiskSelector{Path: "pci-*-ata-1", Model: "INTEL *"}, false},
+	}
+	for _, c := range cases {
+		p := &CryptPolicy{Disks: []DiskSelector{c.sel}}
+		if p.SelectsDisk(paths, model, size) != c.expected {
+			t.Error("unexpected result:", c.sel, !c.expected)
+		}
+	}
+
+	p = &CryptPolicy{Disks: []DiskSelector{{Model: "INTEL *"}, {Path: "pci-*-ata-1"}}}
+	if !p.SelectsDisk(paths, model, size) {
+		t.Error("disk should be selected by the second selector")
+	}
+	if p.SelectsDisk(nil, model, size) {
+		t.Error("disk without paths should not be selected")
+	}
+}
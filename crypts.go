@@ -0,0 +1,17 @@
+package sabakan
+
+import "time"
+
+// EncryptionKeyInfo is the meta data of a disk encryption key.
+// This does not contain the key itself.
+type EncryptionKeyInfo struct {
+	Serial string `json:"serial"`
+	Path   string `json:"path"`
+
+	// CreatedAt is the time when the key was stored.
+	// This is zero for keys stored by older sabakan.
+	CreatedAt time.Time `json:"created-at"`
+
+	// Revision is the etcd revision when the key was stored.
+	Revision int64 `json:"revision"`
+}
@@ -18,6 +18,22 @@ type DHCPConfig struct {
 	GatewayOffset uint `json:"gateway-offset"`
 }
 
+// DHCPTrace is a record of a DHCP packet received by sabakan and
+// how it was handled.  This is kept in memory for debugging.
+type DHCPTrace struct {
+	Timestamp     time.Time              `json:"ts"`
+	Interface     string                 `json:"intf"`
+	Type          string                 `json:"type"`
+	TransactionID uint32                 `json:"xid"`
+	RelayAddr     string                 `json:"giaddr,omitempty"`
+	Options       map[string]interface{} `json:"options,omitempty"`
+	ReplyType     string                 `json:"reply-type,omitempty"`
+	YourAddr      string                 `json:"yiaddr,omitempty"`
+	BootFilename  string                 `json:"boot-filename,omitempty"`
+	ReplyOptions  map[string]interface{} `json:"reply-options,omitempty"`
+	Error         string                 `json:"error,omitempty"`
+}
+
 // LeaseDuration returns lease duration for IP addreses.
 func (c *DHCPConfig) LeaseDuration() time.Duration {
 	if c.LeaseMinutes == 0 {
@@ -0,0 +1,196 @@
+package dhcpd
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/cybozu-go/log"
+	"github.com/cybozu-go/sabakan/v3"
+	"github.com/cybozu-go/sabakan/v3/metrics"
+	"go.universe.tf/netboot/dhcp4"
+)
+
+// DefaultBootLoopWindowMinutes is the default window to count boot attempts.
+const DefaultBootLoopWindowMinutes = 30
+
+// BootLoopConfig is a set of parameters to detect machines that
+// repeatedly PXE-boot without becoming healthy.
+type BootLoopConfig struct {
+	// MaxBoots is the maximum number of boot attempts (DHCPDISCOVER) allowed
+	// in WindowMinutes.  Zero disables the detection.
+	MaxBoots uint `json:"max-boots"`
+
+	// WindowMinutes is the length of the sliding window in minutes.
+	// Default is DefaultBootLoopWindowMinutes.
+	WindowMinutes uint `json:"window-minutes,omitempty"`
+}
+
+// BootLoopHandler is a Handler that counts boot attempts of machines.
+//
+// When a machine sends more than MaxBoots DHCPDISCOVER in the window
+// without reaching healthy state, it is labeled with sabakan.LabelBootLoop
+// and marked as unhealthy.  DHCPDISCOVER from labeled machines are dropped
+// until the label is removed.
+type BootLoopHandler struct {
+	Handler Handler
+	Machine sabakan.MachineModel
+
+	maxBoots uint
+	window   time.Duration
+
+	mu        sync.Mutex
+	attempts  map[string][]time.Time
+	lastSweep time.Time
+}
+
+// NewBootLoopHandler creates a BootLoopHandler that wraps h.
+func NewBootLoopHandler(h Handler, cfg *BootLoopConfig, machine sabakan.MachineModel) (*BootLoopHandler, error) {
+	if cfg.MaxBoots == 0 {
+		return nil, errors.New("max-boots must be positive")
+	}
+	if machine == nil {
+		return nil, errors.New("boot-loop detection requires machine model")
+	}
+
+	minutes := cfg.WindowMinutes
+	if minutes == 0 {
+		minutes = DefaultBootLoopWindowMinutes
+	}
+
+	return &BootLoopHandler{
+		Handler:  h,
+		Machine:  machine,
+		maxBoots: cfg.MaxBoots,
+		window:   time.Duration(minutes) * time.Minute,
+		attempts: make(map[string][]time.Time),
+	}, nil
+}
+
+// record records a boot attempt of mac at now, and returns the number
+// of attempts made after since.
+func (h *BootLoopHandler) record(mac string, now, since time.Time) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	windowStart := now.Add(-h.window)
+
+	// attempts of other machines are swept once in a window
+	// not to scan all of them for every packet.
+	if now.Sub(h.lastSweep) >= h.window {
+		for k, v := range h.attempts {
+			if len(v) > 0 && v[len(v)-1].Before(windowStart) {
+				delete(h.attempts, k)
+			}
+		}
+		h.lastSweep = now
+	}
+
+	if since.Before(windowStart) {
+		since = windowStart
+	}
+
+	var ts []time.Time
+	for _, t := range h.attempts[mac] {
+		if t.After(since) {
+			ts = append(ts, t)
+		}
+	}
+	ts = append(ts, now)
+	h.attempts[mac] = ts
+
+	return len(ts)
+}
+
+func (h *BootLoopHandler) reset(mac string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.attempts, mac)
+}
+
+func (h *BootLoopHandler) findMachine(ctx context.Context, pkt *dhcp4.Packet) *sabakan.Machine {
+	machines, err := h.Machine.Query(ctx, sabakan.Query{"mac": pkt.HardwareAddr.String()})
+	if err != nil {
+		log.Error("dhcp: failed to look up machines", addPacketLog(pkt, map[string]interface{}{
+			log.FnError: err.Error(),
+		}))
+		return nil
+	}
+	if len(machines) != 1 {
+		return nil
+	}
+	return machines[0]
+}
+
+func (h *BootLoopHandler) quarantine(ctx context.Context, pkt *dhcp4.Packet, m *sabakan.Machine, attempts int, now time.Time) {
+	serial := m.Spec.Serial
+	fields := addPacketLog(pkt, map[string]interface{}{
+		"serial":   serial,
+		"attempts": attempts,
+		"state":    m.Status.State.String(),
+	})
+	log.Warn("dhcp: boot loop detected", fields)
+	metrics.BootLoopDetectedTotal.Inc()
+
+	err := h.Machine.PutLabel(ctx, serial, sabakan.LabelBootLoop, now.UTC().Format(sabakan.BootLoopLabelFormat))
+	if err != nil {
+		fields[log.FnError] = err.Error()
+		log.Error("dhcp: failed to label machine", fields)
+		return
+	}
+
+	switch m.Status.State {
+	case sabakan.StateUnhealthy:
+		return
+	case sabakan.StateUpdating, sabakan.StateRetiring, sabakan.StateRetired:
+		// these machines cannot be unhealthy; the label tells the loop.
+		log.Info("dhcp: machine state is kept", fields)
+		return
+	}
+	err = h.Machine.SetState(ctx, serial, sabakan.StateUnhealthy)
+	if err != nil {
+		fields[log.FnError] = err.Error()
+		log.Warn("dhcp: failed to mark machine as unhealthy", fields)
+	}
+}
+
+// ServeDHCP implements Handler interface
+func (h *BootLoopHandler) ServeDHCP(ctx context.Context, pkt *dhcp4.Packet, intf Interface) (*dhcp4.Packet, error) {
+	if pkt.Type != dhcp4.MsgDiscover {
+		return h.Handler.ServeDHCP(ctx, pkt, intf)
+	}
+
+	m := h.findMachine(ctx, pkt)
+	if m == nil {
+		return h.Handler.ServeDHCP(ctx, pkt, intf)
+	}
+
+	serial := m.Spec.Serial
+	mac := pkt.HardwareAddr.String()
+	if _, ok := m.Spec.Labels[sabakan.LabelBootLoop]; ok {
+		log.Info("dhcp: ignored quarantined machine", addPacketLog(pkt, map[string]interface{}{
+			"serial": serial,
+		}))
+		h.reset(mac)
+		return nil, errQuarantined
+	}
+
+	// boot attempts before the machine became healthy are not counted.
+	var since time.Time
+	if m.Status.State == sabakan.StateHealthy {
+		since = m.Status.Timestamp
+	}
+
+	now := time.Now()
+	attempts := h.record(mac, now, since)
+
+	if uint(attempts) > h.maxBoots {
+		h.quarantine(ctx, pkt, m, attempts, now)
+		h.reset(mac)
+		return nil, errQuarantined
+	}
+
+	return h.Handler.ServeDHCP(ctx, pkt, intf)
+}
@@ -0,0 +1,199 @@
+package dhcpd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cybozu-go/sabakan/v3"
+	"go.universe.tf/netboot/dhcp4"
+)
+
+func testBootLoopRecord(t *testing.T) {
+	t.Parallel()
+
+	h, err := NewBootLoopHandler(nil, &BootLoopConfig{MaxBoots: 2, WindowMinutes: 10}, testNewHandler(26, 1, 0).Machine)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	mac := "00:11:22:33:44:55"
+	if n := h.record(mac, now, time.Time{}); n != 1 {
+		t.Error("unexpected attempts:", n)
+	}
+	if n := h.record(mac, now.Add(time.Minute), time.Time{}); n != 2 {
+		t.Error("unexpected attempts:", n)
+	}
+	if n := h.record(mac, now.Add(2*time.Minute), now.Add(90*time.Second)); n != 1 {
+		t.Error("attempts before since should not be counted:", n)
+	}
+	if n := h.record(mac, now.Add(20*time.Minute), time.Time{}); n != 1 {
+		t.Error("attempts out of the window should not be counted:", n)
+	}
+
+	h.record("00:11:22:33:44:66", now.Add(20*time.Minute), time.Time{})
+	h.record(mac, now.Add(40*time.Minute), time.Time{})
+	if len(h.attempts) != 1 {
+		t.Error("stale attempts should be swept:", len(h.attempts))
+	}
+
+	h.record("00:11:22:33:44:77", now.Add(41*time.Minute), time.Time{})
+	h.record(mac, now.Add(45*time.Minute), time.Time{})
+	if len(h.attempts) != 2 {
+		t.Error("attempts should be swept once in a window:", len(h.attempts))
+	}
+	h.record(mac, now.Add(55*time.Minute), time.Time{})
+	if len(h.attempts) != 1 {
+		t.Error("stale attempts should be swept:", len(h.attempts))
+	}
+
+	_, err = NewBootLoopHandler(nil, &BootLoopConfig{}, testNewHandler(26, 1, 0).Machine)
+	if err == nil {
+		t.Error("zero max-boots should be rejected")
+	}
+}
+
+func testBootLoopQuarantine(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	h := testNewHandler(26, 1, 0)
+	err := h.Machine.Register(ctx, []*sabakan.Machine{
+		sabakan.NewMachine(sabakan.MachineSpec{
+			Serial:       "1234",
+			MACAddresses: []string{"00:11:22:33:44:55"},
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = h.Machine.SetState(ctx, "1234", sabakan.StateHealthy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bh, err := NewBootLoopHandler(h, &BootLoopConfig{MaxBoots: 2}, h.Machine)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	intf := testInterface()
+	for i := 0; i < 2; i++ {
+		resp, err := bh.ServeDHCP(ctx, testPolicyPacket("00:11:22:33:44:55", ""), intf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Type != dhcp4.MsgOffer {
+			t.Error("unexpected response type:", resp.Type)
+		}
+	}
+
+	// packets from unknown machines are not counted
+	for i := 0; i < 3; i++ {
+		_, err := bh.ServeDHCP(ctx, testPolicyPacket("00:11:22:33:44:66", ""), intf)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = bh.ServeDHCP(ctx, testPolicyPacket("00:11:22:33:44:55", ""), intf)
+	if err != errQuarantined {
+		t.Error("unexpected error:", err)
+	}
+
+	m, err := h.Machine.Get(ctx, "1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Status.State != sabakan.StateUnhealthy {
+		t.Error("machine should be unhealthy:", m.Status.State)
+	}
+	if _, ok := m.Spec.Labels[sabakan.LabelBootLoop]; !ok {
+		t.Error("machine should be labeled:", m.Spec.Labels)
+	}
+
+	_, err = bh.ServeDHCP(ctx, testPolicyPacket("00:11:22:33:44:55", ""), intf)
+	if err != errQuarantined {
+		t.Error("quarantined machine should be ignored:", err)
+	}
+
+	err = h.Machine.DeleteLabel(ctx, "1234", sabakan.LabelBootLoop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = bh.ServeDHCP(ctx, testPolicyPacket("00:11:22:33:44:55", ""), intf)
+	if err != nil {
+		t.Error("released machine should be served:", err)
+	}
+}
+
+func testBootLoopQuarantineStates(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	h := testNewHandler(26, 1, 0)
+	err := h.Machine.Register(ctx, []*sabakan.Machine{
+		sabakan.NewMachine(sabakan.MachineSpec{
+			Serial:       "1234",
+			MACAddresses: []string{"00:11:22:33:44:55"},
+		}),
+		sabakan.NewMachine(sabakan.MachineSpec{
+			Serial:       "5678",
+			MACAddresses: []string{"00:11:22:33:44:66"},
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, state := range []sabakan.MachineState{sabakan.StateHealthy, sabakan.StateUpdating} {
+		err = h.Machine.SetState(ctx, "5678", state)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bh, err := NewBootLoopHandler(h, &BootLoopConfig{MaxBoots: 2}, h.Machine)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		serial   string
+		mac      string
+		expected sabakan.MachineState
+	}{
+		{"1234", "00:11:22:33:44:55", sabakan.StateUnhealthy},
+		{"5678", "00:11:22:33:44:66", sabakan.StateUpdating},
+	}
+	intf := testInterface()
+	for _, tc := range testCases {
+		for i := 0; i < 2; i++ {
+			_, err := bh.ServeDHCP(ctx, testPolicyPacket(tc.mac, ""), intf)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		_, err = bh.ServeDHCP(ctx, testPolicyPacket(tc.mac, ""), intf)
+		if err != errQuarantined {
+			t.Error("unexpected error:", err)
+		}
+
+		m, err := h.Machine.Get(ctx, tc.serial)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Status.State != tc.expected {
+			t.Errorf("machine %s should be %s: %s", tc.serial, tc.expected, m.Status.State)
+		}
+		if _, ok := m.Spec.Labels[sabakan.LabelBootLoop]; !ok {
+			t.Errorf("machine %s should be labeled: %v", tc.serial, m.Spec.Labels)
+		}
+	}
+}
+
+func TestBootLoop(t *testing.T) {
+	t.Run("Record", testBootLoopRecord)
+	t.Run("Quarantine", testBootLoopQuarantine)
+	t.Run("QuarantineStates", testBootLoopQuarantineStates)
+}
@@ -7,9 +7,20 @@ import (
 	"time"
 
 	"github.com/cybozu-go/log"
+	"github.com/cybozu-go/sabakan/v3"
 	"go.universe.tf/netboot/dhcp4"
 )
 
+// ztpVendorClasses is a list of prefixes of vendor class identifiers
+// sent by network operating systems that support zero-touch provisioning.
+var ztpVendorClasses = []string{
+	"Arista",
+	"Cisco",
+	"cumulus-linux",
+	"Juniper",
+	"SONiC",
+}
+
 func isUEFIHTTPBoot(pkt *dhcp4.Packet) bool {
 	// RFC4578: Client System Architecture Type
 	// Option 93 is a list of uint16 values
@@ -54,6 +65,61 @@ func isIPXEBoot(pkt *dhcp4.Packet) bool {
 	return ucls == "iPXE"
 }
 
+func isONIEBoot(pkt *dhcp4.Packet) bool {
+	// ONIE sends "onie_vendor:<platform>" as the vendor class identifier.
+	vcls, err := pkt.Options.String(dhcp4.OptVendorIdentifier)
+	if err != nil {
+		return false
+	}
+
+	return strings.HasPrefix(vcls, "onie_vendor:")
+}
+
+func isZTPBoot(pkt *dhcp4.Packet) bool {
+	vcls, err := pkt.Options.String(dhcp4.OptVendorIdentifier)
+	if err != nil {
+		return false
+	}
+
+	for _, prefix := range ztpVendorClasses {
+		if strings.HasPrefix(vcls, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// addZTPOptions adds options for registered switches.
+//
+// ONIE is given the installer URL by Default URL (114, RFC3679).
+// Other switches are given the ZTP script URL by Bootfile name (67).
+func (h DHCPHandler) addZTPOptions(ctx context.Context, pkt *dhcp4.Packet, opts dhcp4.Options) error {
+	onie := isONIEBoot(pkt)
+	if !onie && !isZTPBoot(pkt) {
+		return nil
+	}
+
+	mac := pkt.HardwareAddr.String()
+	sw, err := h.Switch.Get(ctx, mac)
+	if err == sabakan.ErrNotFound {
+		log.Info("dhcp: ignored ZTP request from unknown switch", addPacketLog(pkt, nil))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case onie && sw.Installer != "":
+		log.Info("dhcp: requested ONIE installer", addPacketLog(pkt, nil))
+		opts[114] = []byte(h.makeBootAPIURL("ztp/" + mac + "/installer"))
+	case !onie && sw.Script != "":
+		log.Info("dhcp: requested ZTP script", addPacketLog(pkt, nil))
+		opts[67] = []byte(h.makeBootAPIURL("ztp/" + mac + "/script"))
+	}
+	return nil
+}
+
 func (h DHCPHandler) handleDiscover(ctx context.Context, pkt *dhcp4.Packet, intf Interface) (*dhcp4.Packet, error) {
 	serverAddr, err := getIPv4AddrForInterface(intf)
 	if err != nil {
@@ -106,5 +172,11 @@ func (h DHCPHandler) handleDiscover(ctx context.Context, pkt *dhcp4.Packet, intf
 		resp.BootFilename = h.makeBootAPIURL("coreos/ipxe")
 	}
 
+	// Switch zero-touch provisioning
+	err = h.addZTPOptions(ctx, pkt, opts)
+	if err != nil {
+		return nil, err
+	}
+
 	return resp, nil
 }
@@ -6,6 +6,7 @@ import (
 	"net"
 	"testing"
 
+	"github.com/cybozu-go/sabakan/v3"
 	"go.universe.tf/netboot/dhcp4"
 )
 
@@ -153,9 +154,57 @@ func testDiscoverIPXE(t *testing.T) {
 
 }
 
+func testDiscoverZTP(t *testing.T) {
+	t.Parallel()
+
+	h := testNewHandler(26, 1, 0)
+	err := h.Switch.Put(context.Background(), &sabakan.Switch{
+		MAC:       "01:02:03:04:05:06",
+		Installer: "onie-installer.bin",
+		Script:    "ztp.sh",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	intf := testInterface()
+	cases := []struct {
+		vendor string
+		option dhcp4.Option
+		url    string
+	}{
+		{"onie_vendor:x86_64-accton_as7712_32x-r0", 114, "http://10.69.0.195:10080/api/v1/boot/ztp/01:02:03:04:05:06/installer"},
+		{"SONiC.202305", 67, "http://10.69.0.195:10080/api/v1/boot/ztp/01:02:03:04:05:06/script"},
+	}
+	for _, c := range cases {
+		pkt := testDiscoverPacket()
+		pkt.Options[dhcp4.OptVendorIdentifier] = []byte(c.vendor)
+
+		resp, err := h.handleDiscover(context.Background(), pkt, intf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(resp.Options[c.option]) != c.url {
+			t.Error("wrong URL for", c.vendor, string(resp.Options[c.option]))
+		}
+	}
+
+	pkt := testDiscoverPacket()
+	pkt.HardwareAddr = []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x07}
+	pkt.Options[dhcp4.OptVendorIdentifier] = []byte("onie_vendor:x86_64-accton_as7712_32x-r0")
+	resp, err := h.handleDiscover(context.Background(), pkt, intf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := resp.Options[114]; ok {
+		t.Error("unknown switch should not be given installer URL")
+	}
+}
+
 func TestDiscover(t *testing.T) {
 	t.Run("Direct", testDiscoverDirect)
 	t.Run("Relayed", testDiscoverRelayed)
 	t.Run("HTTPBoot", testDiscoverHTTPBoot)
 	t.Run("iPXE", testDiscoverIPXE)
+	t.Run("ZTP", testDiscoverZTP)
 }
@@ -7,4 +7,12 @@ var (
 	errNotChosen      = errors.New("not chosen")
 	errNoRecord       = errors.New("no record of the client")
 	errNoAction       = errors.New("no need to reply")
+	errPolicyDenied   = errors.New("denied by policy")
+	errQuarantined    = errors.New("quarantined machine")
 )
+
+// IsNoAction returns true if err returned from Handler.ServeDHCP means
+// that the packet has been handled successfully and needs no reply.
+func IsNoAction(err error) bool {
+	return err == errNoAction
+}
@@ -71,12 +71,17 @@ func getPacketLog(pkt *dhcp4.Packet, intf *net.Interface) map[string]interface{}
 }
 
 func getOptionsLog(pkt *dhcp4.Packet) map[string]interface{} {
-	optLog := make(map[string]interface{})
-
+	optLog := decodeOptions(pkt.Options)
 	optLog["xid"] = binary.BigEndian.Uint32(pkt.TransactionID)
+	return optLog
+}
+
+// decodeOptions decodes options into a map keyed by optionLogKey.
+func decodeOptions(options dhcp4.Options) map[string]interface{} {
+	optLog := make(map[string]interface{})
 
 	var opts []int
-	for n := range pkt.Options {
+	for n := range options {
 		opts = append(opts, int(n))
 	}
 	sort.Ints(opts)
@@ -86,40 +91,40 @@ func getOptionsLog(pkt *dhcp4.Packet) map[string]interface{} {
 		var err error
 		switch targetOpt {
 		case dhcp4.OptSubnetMask:
-			mask, err := pkt.Options.IPMask(targetOpt)
+			mask, err := options.IPMask(targetOpt)
 			if err != nil {
 				continue
 			}
 			ones, _ := mask.Size()
 			out = fmt.Sprintf("/%d", ones)
 		case dhcp4.OptBroadcastAddr, dhcp4.OptNTPServers, dhcp4.OptServerIdentifier:
-			out, err = pkt.Options.IP(targetOpt)
+			out, err = options.IP(targetOpt)
 			if err != nil {
 				continue
 			}
 		case dhcp4.OptRouters, dhcp4.OptDNSServers:
-			out, err = pkt.Options.IPs(targetOpt)
+			out, err = options.IPs(targetOpt)
 			if err != nil {
 				continue
 			}
 		case dhcp4.OptLeaseTime, dhcp4.OptRenewalTime, dhcp4.OptRebindingTime:
-			out, err = pkt.Options.Uint32(targetOpt)
+			out, err = options.Uint32(targetOpt)
 			if err != nil {
 				continue
 			}
 		case dhcp4.OptTimeOffset:
-			out, err = pkt.Options.Int32(targetOpt)
+			out, err = options.Int32(targetOpt)
 			if err != nil {
 				continue
 			}
 		case dhcp4.OptBootFileSize, dhcp4.OptMaximumMessageSize:
-			out, err = pkt.Options.Uint16(targetOpt)
+			out, err = options.Uint16(targetOpt)
 			if err != nil {
 				continue
 			}
 		default:
 			// TODO: escape non-ASCII string
-			out, err = pkt.Options.String(targetOpt)
+			out, err = options.String(targetOpt)
 			if err != nil {
 				continue
 			}
@@ -0,0 +1,260 @@
+package dhcpd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cybozu-go/log"
+	"github.com/cybozu-go/sabakan/v3"
+	"github.com/cybozu-go/sabakan/v3/metrics"
+	"go.universe.tf/netboot/dhcp4"
+)
+
+// DefaultRateLimitSeconds is the default window of the per-MAC rate limit.
+const DefaultRateLimitSeconds = 60
+
+// Reasons of dropped packets.  These are used as a label of metrics.
+const (
+	dropDeniedOUI          = "denied-oui"
+	dropNotAllowedOUI      = "not-allowed-oui"
+	dropDeniedVendorClass  = "denied-vendor-class"
+	dropNotAllowedVendor   = "not-allowed-vendor-class"
+	dropUnknownMachine     = "unknown-machine"
+	dropRateLimited        = "rate-limited"
+	dropMachineLookupError = "machine-lookup-error"
+)
+
+// PolicyConfig is a set of rules to decide whether DHCP packets from
+// a client should be served or not.
+//
+// An empty PolicyConfig allows everything.
+type PolicyConfig struct {
+	// AllowOUIs is a list of OUIs (the first 3 octets of MAC addresses).
+	// If not empty, packets from other OUIs are dropped.
+	AllowOUIs []string `json:"allow-ouis,omitempty"`
+
+	// DenyOUIs is a list of OUIs whose packets are dropped.
+	DenyOUIs []string `json:"deny-ouis,omitempty"`
+
+	// AllowVendorClasses is a list of prefixes of vendor class identifiers (option 60).
+	// If not empty, packets without matching vendor class are dropped.
+	AllowVendorClasses []string `json:"allow-vendor-classes,omitempty"`
+
+	// DenyVendorClasses is a list of prefixes of vendor class identifiers
+	// whose packets are dropped.
+	DenyVendorClasses []string `json:"deny-vendor-classes,omitempty"`
+
+	// KnownMachinesOnly restricts clients to MAC addresses of registered machines.
+	KnownMachinesOnly bool `json:"known-machines-only,omitempty"`
+
+	// RateLimitPackets is the maximum number of packets accepted from a MAC
+	// address in RateLimitSeconds.  Zero disables rate limiting.
+	RateLimitPackets uint `json:"rate-limit-packets,omitempty"`
+
+	// RateLimitSeconds is the window of rate limiting.
+	// Default is DefaultRateLimitSeconds.
+	RateLimitSeconds uint `json:"rate-limit-seconds,omitempty"`
+}
+
+func parseOUI(s string) ([3]byte, error) {
+	var oui [3]byte
+
+	hw, err := net.ParseMAC(s + ":00:00:00")
+	if err != nil {
+		hw, err = net.ParseMAC(s + "-00-00-00")
+	}
+	if err != nil || len(hw) != 6 {
+		return oui, errors.New("invalid OUI: " + s)
+	}
+	copy(oui[:], hw[:3])
+	return oui, nil
+}
+
+func parseOUIs(ouis []string) (map[[3]byte]bool, error) {
+	if len(ouis) == 0 {
+		return nil, nil
+	}
+
+	ret := make(map[[3]byte]bool)
+	for _, s := range ouis {
+		oui, err := parseOUI(s)
+		if err != nil {
+			return nil, err
+		}
+		ret[oui] = true
+	}
+	return ret, nil
+}
+
+// rateLimiter counts packets per MAC address in fixed windows.
+type rateLimiter struct {
+	mu        sync.Mutex
+	limit     uint
+	window    time.Duration
+	counts    map[string]*rateWindow
+	lastSweep time.Time
+}
+
+type rateWindow struct {
+	start time.Time
+	count uint
+}
+
+func newRateLimiter(limit uint, window time.Duration) *rateLimiter {
+	return &rateLimiter{
+		limit:  limit,
+		window: window,
+		counts: make(map[string]*rateWindow),
+	}
+}
+
+// allow returns true if a packet from mac at now is within the limit.
+func (r *rateLimiter) allow(mac string, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if now.Sub(r.lastSweep) > r.window {
+		for k, v := range r.counts {
+			if now.Sub(v.start) > r.window {
+				delete(r.counts, k)
+			}
+		}
+		r.lastSweep = now
+	}
+
+	w, ok := r.counts[mac]
+	if !ok || now.Sub(w.start) > r.window {
+		r.counts[mac] = &rateWindow{start: now, count: 1}
+		return true
+	}
+
+	w.count++
+	return w.count <= r.limit
+}
+
+// PolicyHandler is a Handler that drops DHCP packets that are not allowed
+// by the policy before passing them to the underlying Handler.
+type PolicyHandler struct {
+	Handler Handler
+	Machine sabakan.MachineModel
+
+	allowOUIs         map[[3]byte]bool
+	denyOUIs          map[[3]byte]bool
+	allowVendors      []string
+	denyVendors       []string
+	knownMachinesOnly bool
+	limiter           *rateLimiter
+}
+
+// NewPolicyHandler creates a PolicyHandler that wraps h.
+//
+// machine is used to look up registered machines when
+// cfg.KnownMachinesOnly is true.
+func NewPolicyHandler(h Handler, cfg *PolicyConfig, machine sabakan.MachineModel) (*PolicyHandler, error) {
+	allowOUIs, err := parseOUIs(cfg.AllowOUIs)
+	if err != nil {
+		return nil, err
+	}
+	denyOUIs, err := parseOUIs(cfg.DenyOUIs)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.KnownMachinesOnly && machine == nil {
+		return nil, errors.New("known-machines-only requires machine model")
+	}
+
+	ph := &PolicyHandler{
+		Handler:           h,
+		Machine:           machine,
+		allowOUIs:         allowOUIs,
+		denyOUIs:          denyOUIs,
+		allowVendors:      cfg.AllowVendorClasses,
+		denyVendors:       cfg.DenyVendorClasses,
+		knownMachinesOnly: cfg.KnownMachinesOnly,
+	}
+
+	if cfg.RateLimitPackets > 0 {
+		secs := cfg.RateLimitSeconds
+		if secs == 0 {
+			secs = DefaultRateLimitSeconds
+		}
+		ph.limiter = newRateLimiter(cfg.RateLimitPackets, time.Duration(secs)*time.Second)
+	}
+
+	return ph, nil
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// check returns a non-empty reason if pkt should be dropped.
+func (h *PolicyHandler) check(ctx context.Context, pkt *dhcp4.Packet) string {
+	if len(pkt.HardwareAddr) >= 3 {
+		var oui [3]byte
+		copy(oui[:], pkt.HardwareAddr[:3])
+		if h.denyOUIs[oui] {
+			return dropDeniedOUI
+		}
+		if h.allowOUIs != nil && !h.allowOUIs[oui] {
+			return dropNotAllowedOUI
+		}
+	} else if h.allowOUIs != nil {
+		return dropNotAllowedOUI
+	}
+
+	if len(h.allowVendors) > 0 || len(h.denyVendors) > 0 {
+		vcls, _ := pkt.Options.String(dhcp4.OptVendorIdentifier)
+		if hasAnyPrefix(vcls, h.denyVendors) {
+			return dropDeniedVendorClass
+		}
+		if len(h.allowVendors) > 0 && !hasAnyPrefix(vcls, h.allowVendors) {
+			return dropNotAllowedVendor
+		}
+	}
+
+	// rate limit before looking up machines so that floods do not reach the model.
+	mac := pkt.HardwareAddr.String()
+	if h.limiter != nil && !h.limiter.allow(mac, time.Now()) {
+		return dropRateLimited
+	}
+
+	if h.knownMachinesOnly {
+		machines, err := h.Machine.Query(ctx, sabakan.Query{"mac": mac})
+		if err != nil {
+			log.Error("dhcp: failed to look up machines", addPacketLog(pkt, map[string]interface{}{
+				log.FnError: err.Error(),
+			}))
+			return dropMachineLookupError
+		}
+		if len(machines) == 0 {
+			return dropUnknownMachine
+		}
+	}
+
+	return ""
+}
+
+// ServeDHCP implements Handler interface
+func (h *PolicyHandler) ServeDHCP(ctx context.Context, pkt *dhcp4.Packet, intf Interface) (*dhcp4.Packet, error) {
+	reason := h.check(ctx, pkt)
+	if reason == "" {
+		return h.Handler.ServeDHCP(ctx, pkt, intf)
+	}
+
+	log.Info("dhcp: dropped by policy", addPacketLog(pkt, map[string]interface{}{
+		"reason": reason,
+		"type":   pkt.Type.String(),
+	}))
+	metrics.DHCPPolicyDroppedTotal.WithLabelValues(reason).Inc()
+	return nil, errPolicyDenied
+}
@@ -0,0 +1,191 @@
+package dhcpd
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cybozu-go/sabakan/v3"
+	"go.universe.tf/netboot/dhcp4"
+)
+
+func testPolicyPacket(mac string, vendor string) *dhcp4.Packet {
+	pkt := testDiscoverPacket()
+	hw, _ := net.ParseMAC(mac)
+	pkt.HardwareAddr = hw
+	if vendor != "" {
+		pkt.Options[dhcp4.OptVendorIdentifier] = []byte(vendor)
+	}
+	return pkt
+}
+
+func testPolicyOUI(t *testing.T) {
+	t.Parallel()
+
+	h := testNewHandler(26, 1, 0)
+	ph, err := NewPolicyHandler(h, &PolicyConfig{
+		AllowOUIs: []string{"00:11:22", "aa-bb-cc"},
+		DenyOUIs:  []string{"00:11:22"},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		mac    string
+		reason string
+	}{
+		{"aa:bb:cc:00:00:01", ""},
+		{"00:11:22:00:00:01", dropDeniedOUI},
+		{"12:34:56:00:00:01", dropNotAllowedOUI},
+	}
+	for _, c := range cases {
+		reason := ph.check(context.Background(), testPolicyPacket(c.mac, ""))
+		if reason != c.reason {
+			t.Error("unexpected reason for", c.mac, reason, c.reason)
+		}
+	}
+
+	_, err = NewPolicyHandler(h, &PolicyConfig{AllowOUIs: []string{"00:11"}}, nil)
+	if err == nil {
+		t.Error("invalid OUI should be rejected")
+	}
+}
+
+func testPolicyVendorClass(t *testing.T) {
+	t.Parallel()
+
+	h := testNewHandler(26, 1, 0)
+	ph, err := NewPolicyHandler(h, &PolicyConfig{
+		AllowVendorClasses: []string{"PXEClient", "HTTPClient"},
+		DenyVendorClasses:  []string{"PXEClient:Arch:00000"},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		vendor string
+		reason string
+	}{
+		{"HTTPClient:Arch:00016", ""},
+		{"PXEClient:Arch:00007", ""},
+		{"PXEClient:Arch:00000:UNDI:002001", dropDeniedVendorClass},
+		{"MSFT 5.0", dropNotAllowedVendor},
+		{"", dropNotAllowedVendor},
+	}
+	for _, c := range cases {
+		reason := ph.check(context.Background(), testPolicyPacket("00:11:22:33:44:55", c.vendor))
+		if reason != c.reason {
+			t.Error("unexpected reason for", c.vendor, reason, c.reason)
+		}
+	}
+}
+
+func testPolicyKnownMachines(t *testing.T) {
+	t.Parallel()
+
+	h := testNewHandler(26, 1, 0)
+	err := h.Machine.Register(context.Background(), []*sabakan.Machine{
+		sabakan.NewMachine(sabakan.MachineSpec{
+			Serial:       "1234",
+			MACAddresses: []string{"00:11:22:33:44:55"},
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = NewPolicyHandler(h, &PolicyConfig{KnownMachinesOnly: true}, nil)
+	if err == nil {
+		t.Error("known-machines-only without machine model should be rejected")
+	}
+
+	ph, err := NewPolicyHandler(h, &PolicyConfig{KnownMachinesOnly: true}, h.Machine)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	intf := testInterface()
+	resp, err := ph.ServeDHCP(context.Background(), testPolicyPacket("00:11:22:33:44:55", ""), intf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Type != dhcp4.MsgOffer {
+		t.Error("unexpected response type:", resp.Type)
+	}
+
+	resp, err = ph.ServeDHCP(context.Background(), testPolicyPacket("00:11:22:33:44:66", ""), intf)
+	if err != errPolicyDenied {
+		t.Error("unexpected error:", err)
+	}
+	if resp != nil {
+		t.Error("packet from unknown machine should be dropped")
+	}
+}
+
+func testPolicyRateLimit(t *testing.T) {
+	t.Parallel()
+
+	rl := newRateLimiter(2, time.Minute)
+	now := time.Now()
+
+	if !rl.allow("00:11:22:33:44:55", now) {
+		t.Error("1st packet should be allowed")
+	}
+	if !rl.allow("00:11:22:33:44:55", now.Add(time.Second)) {
+		t.Error("2nd packet should be allowed")
+	}
+	if rl.allow("00:11:22:33:44:55", now.Add(2*time.Second)) {
+		t.Error("3rd packet should be rate limited")
+	}
+	if !rl.allow("00:11:22:33:44:66", now.Add(2*time.Second)) {
+		t.Error("packet from another MAC should be allowed")
+	}
+	if !rl.allow("00:11:22:33:44:55", now.Add(2*time.Minute)) {
+		t.Error("packet in the next window should be allowed")
+	}
+	if len(rl.counts) != 1 {
+		t.Error("stale windows should be swept:", len(rl.counts))
+	}
+}
+
+type countingMachineModel struct {
+	sabakan.MachineModel
+	queries int
+}
+
+func (m *countingMachineModel) Query(ctx context.Context, q sabakan.Query) ([]*sabakan.Machine, error) {
+	m.queries++
+	return m.MachineModel.Query(ctx, q)
+}
+
+func testPolicyRateLimitBeforeLookup(t *testing.T) {
+	t.Parallel()
+
+	h := testNewHandler(26, 1, 0)
+	machine := &countingMachineModel{MachineModel: h.Machine}
+	ph, err := NewPolicyHandler(h, &PolicyConfig{
+		KnownMachinesOnly: true,
+		RateLimitPackets:  2,
+	}, machine)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		ph.check(context.Background(), testPolicyPacket("00:11:22:33:44:66", ""))
+	}
+	if machine.queries != 2 {
+		t.Error("rate limited packets should not look up machines:", machine.queries)
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	t.Run("OUI", testPolicyOUI)
+	t.Run("VendorClass", testPolicyVendorClass)
+	t.Run("KnownMachines", testPolicyKnownMachines)
+	t.Run("RateLimit", testPolicyRateLimit)
+	t.Run("RateLimitBeforeLookup", testPolicyRateLimitBeforeLookup)
+}
@@ -12,6 +12,9 @@ import (
 type Server struct {
 	Handler Handler
 	Conn    *dhcp4.Conn
+
+	// Trace records transactions if not nil.
+	Trace *TraceBuffer
 }
 
 // Serve runs until context is canceled.
@@ -45,11 +48,14 @@ func (s Server) Serve(ctx context.Context) error {
 
 		env.Go(func(ctx context.Context) error {
 			resp, err := s.Handler.ServeDHCP(ctx, pkt, wrappedIntf)
+			if s.Trace != nil {
+				s.Trace.Record(pkt, intf.Name, resp, err)
+			}
 			switch err {
 			case errNotChosen, errNoRecord, errNoAction:
 				// do nothing
 				return nil
-			case errUnknownMsgType:
+			case errUnknownMsgType, errPolicyDenied, errQuarantined:
 				// already logged
 				return nil
 			case nil:
@@ -0,0 +1,148 @@
+package dhcpd
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/cybozu-go/sabakan/v3"
+	"go.universe.tf/netboot/dhcp4"
+)
+
+// Default sizes of TraceBuffer.
+const (
+	DefaultTraceEntries = 32
+	DefaultTraceClients = 4096
+)
+
+type traceRing struct {
+	entries []*sabakan.DHCPTrace
+	next    int
+	updated time.Time
+}
+
+func (r *traceRing) add(t *sabakan.DHCPTrace) {
+	if len(r.entries) < cap(r.entries) {
+		r.entries = append(r.entries, t)
+	} else {
+		r.entries[r.next] = t
+	}
+	r.next = (r.next + 1) % cap(r.entries)
+	r.updated = t.Timestamp
+}
+
+// list returns entries from the oldest to the newest.
+func (r *traceRing) list() []*sabakan.DHCPTrace {
+	ret := make([]*sabakan.DHCPTrace, 0, len(r.entries))
+	if len(r.entries) == cap(r.entries) {
+		ret = append(ret, r.entries[r.next:]...)
+		ret = append(ret, r.entries[:r.next]...)
+	} else {
+		ret = append(ret, r.entries...)
+	}
+	return ret
+}
+
+// TraceBuffer keeps recent DHCP transactions per MAC address in memory.
+//
+// The number of entries per MAC address and the number of MAC addresses
+// are bounded.  When the number of MAC addresses exceeds the limit,
+// the least recently updated MAC address is evicted.
+type TraceBuffer struct {
+	entries int
+	clients int
+
+	mu    sync.Mutex
+	rings map[string]*traceRing
+}
+
+// NewTraceBuffer creates a TraceBuffer that keeps at most entries
+// transactions for each of at most clients MAC addresses.
+func NewTraceBuffer(entries, clients int) *TraceBuffer {
+	if entries <= 0 {
+		entries = DefaultTraceEntries
+	}
+	if clients <= 0 {
+		clients = DefaultTraceClients
+	}
+	return &TraceBuffer{
+		entries: entries,
+		clients: clients,
+		rings:   make(map[string]*traceRing),
+	}
+}
+
+func newTrace(pkt *dhcp4.Packet, intfName string, resp *dhcp4.Packet, err error) *sabakan.DHCPTrace {
+	t := &sabakan.DHCPTrace{
+		Timestamp: time.Now().UTC(),
+		Interface: intfName,
+		Type:      pkt.Type.String(),
+		Options:   decodeOptions(pkt.Options),
+	}
+	if len(pkt.TransactionID) == 4 {
+		t.TransactionID = binary.BigEndian.Uint32(pkt.TransactionID)
+	}
+	if len(pkt.RelayAddr) > 0 && !pkt.RelayAddr.Equal(net.IPv4zero) {
+		t.RelayAddr = pkt.RelayAddr.String()
+	}
+	if err != nil {
+		t.Error = err.Error()
+		return t
+	}
+	if resp == nil {
+		return t
+	}
+
+	t.ReplyType = resp.Type.String()
+	if len(resp.YourAddr) > 0 && !resp.YourAddr.Equal(net.IPv4zero) {
+		t.YourAddr = resp.YourAddr.String()
+	}
+	t.BootFilename = resp.BootFilename
+	t.ReplyOptions = decodeOptions(resp.Options)
+	return t
+}
+
+// Record records a transaction.  resp and err are the results of
+// Handler.ServeDHCP for pkt.
+func (b *TraceBuffer) Record(pkt *dhcp4.Packet, intfName string, resp *dhcp4.Packet, err error) {
+	t := newTrace(pkt, intfName, resp, err)
+	mac := pkt.HardwareAddr.String()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	r, ok := b.rings[mac]
+	if !ok {
+		if len(b.rings) >= b.clients {
+			b.evict()
+		}
+		r = &traceRing{entries: make([]*sabakan.DHCPTrace, 0, b.entries)}
+		b.rings[mac] = r
+	}
+	r.add(t)
+}
+
+func (b *TraceBuffer) evict() {
+	var oldest string
+	var oldestTime time.Time
+	for mac, r := range b.rings {
+		if oldest == "" || r.updated.Before(oldestTime) {
+			oldest = mac
+			oldestTime = r.updated
+		}
+	}
+	delete(b.rings, oldest)
+}
+
+// Get returns recorded transactions of mac from the oldest to the newest.
+func (b *TraceBuffer) Get(mac net.HardwareAddr) []*sabakan.DHCPTrace {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	r, ok := b.rings[mac.String()]
+	if !ok {
+		return []*sabakan.DHCPTrace{}
+	}
+	return r.list()
+}
@@ -0,0 +1,58 @@
+package dhcpd
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"go.universe.tf/netboot/dhcp4"
+)
+
+func TestTraceBuffer(t *testing.T) {
+	t.Parallel()
+
+	h := testNewHandler(26, 1, 0)
+	intf := testInterface()
+	b := NewTraceBuffer(2, 2)
+
+	for i := 0; i < 3; i++ {
+		pkt := testDiscoverPacket()
+		pkt.TransactionID = []byte{0, 0, 0, byte(i)}
+		pkt.RelayAddr = []byte{10, 69, 0, 129}
+		pkt.Options[dhcp4.OptVendorIdentifier] = []byte("PXEClient")
+		resp, err := h.ServeDHCP(context.Background(), pkt, intf)
+		b.Record(pkt, intf.Name(), resp, err)
+	}
+
+	traces := b.Get(testDiscoverPacket().HardwareAddr)
+	if len(traces) != 2 {
+		t.Fatal("wrong number of traces:", len(traces))
+	}
+	if traces[0].TransactionID != 1 || traces[1].TransactionID != 2 {
+		t.Error("traces should be ordered from the oldest:", traces[0].TransactionID, traces[1].TransactionID)
+	}
+	tr := traces[1]
+	if tr.Type != "DHCPDISCOVER" || tr.ReplyType != "DHCPOFFER" {
+		t.Error("wrong types:", tr.Type, tr.ReplyType)
+	}
+	if tr.RelayAddr != "10.69.0.129" || tr.YourAddr != "10.69.0.160" {
+		t.Error("wrong addresses:", tr.RelayAddr, tr.YourAddr)
+	}
+	if tr.Options[optionLogKey(dhcp4.OptVendorIdentifier)] != "PXEClient" {
+		t.Error("wrong options:", tr.Options)
+	}
+
+	for _, mac := range []string{"00:11:22:33:44:55", "00:11:22:33:44:66"} {
+		pkt := testDiscoverPacket()
+		pkt.HardwareAddr, _ = net.ParseMAC(mac)
+		b.Record(pkt, intf.Name(), nil, errNoAction)
+	}
+	if len(b.Get(testDiscoverPacket().HardwareAddr)) != 0 {
+		t.Error("the least recently updated client should be evicted")
+	}
+	hw, _ := net.ParseMAC("00:11:22:33:44:66")
+	traces = b.Get(hw)
+	if len(traces) != 1 || traces[0].Error != errNoAction.Error() {
+		t.Error("wrong traces:", traces)
+	}
+}
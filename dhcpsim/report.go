@@ -0,0 +1,166 @@
+package dhcpsim
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Operations measured by the simulator.
+const (
+	OpDiscover = "discover"
+	OpRequest  = "request"
+	OpRenew    = "renew"
+	OpRelease  = "release"
+	OpIPXE     = "ipxe"
+	OpIgnition = "ignition"
+	OpKernel   = "kernel"
+)
+
+var opOrder = []string{OpDiscover, OpRequest, OpRenew, OpRelease, OpIPXE, OpIgnition, OpKernel}
+
+// OpStats is the statistics of an operation.
+type OpStats struct {
+	Count  int           `json:"count"`
+	Errors int           `json:"errors"`
+	P50    time.Duration `json:"p50"`
+	P90    time.Duration `json:"p90"`
+	P99    time.Duration `json:"p99"`
+	Max    time.Duration `json:"max"`
+
+	latencies []time.Duration
+}
+
+// percentile returns p-th percentile of sorted durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(float64(len(sorted))*p+0.999999) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
+
+func (s *OpStats) summarize() {
+	sort.Slice(s.latencies, func(i, j int) bool {
+		return s.latencies[i] < s.latencies[j]
+	})
+	s.P50 = percentile(s.latencies, 0.50)
+	s.P90 = percentile(s.latencies, 0.90)
+	s.P99 = percentile(s.latencies, 0.99)
+	if len(s.latencies) > 0 {
+		s.Max = s.latencies[len(s.latencies)-1]
+	}
+}
+
+// Conflict is a lease conflict, i.e. an address acknowledged to
+// a client while another client holds it.
+type Conflict struct {
+	IP     string `json:"ip"`
+	Holder string `json:"holder"`
+	MAC    string `json:"mac"`
+}
+
+// Report is the result of a simulation.
+type Report struct {
+	Clients   int                 `json:"clients"`
+	Duration  time.Duration       `json:"duration"`
+	Ops       map[string]*OpStats `json:"ops"`
+	Conflicts []Conflict          `json:"conflicts"`
+}
+
+// Write writes a human readable report to w.
+func (r *Report) Write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "clients: %d, duration: %s\n\n", r.Clients, r.Duration)
+	fmt.Fprintln(tw, "OP\tCOUNT\tERRORS\tP50\tP90\tP99\tMAX")
+	for _, op := range opOrder {
+		s, ok := r.Ops[op]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\t%s\t%s\n", op, s.Count, s.Errors, s.P50, s.P90, s.P99, s.Max)
+	}
+	fmt.Fprintf(tw, "\nconflicts: %d\n", len(r.Conflicts))
+	for _, c := range r.Conflicts {
+		fmt.Fprintf(tw, "  %s: held by %s, acknowledged to %s\n", c.IP, c.Holder, c.MAC)
+	}
+	return tw.Flush()
+}
+
+// recorder collects results from concurrent clients.
+type recorder struct {
+	mu        sync.Mutex
+	ops       map[string]*OpStats
+	leases    map[string]string
+	conflicts []Conflict
+}
+
+func newRecorder() *recorder {
+	return &recorder{
+		ops:    make(map[string]*OpStats),
+		leases: make(map[string]string),
+	}
+}
+
+func (r *recorder) record(op string, d time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.ops[op]
+	if !ok {
+		s = new(OpStats)
+		r.ops[op] = s
+	}
+	s.Count++
+	if err != nil {
+		s.Errors++
+		return
+	}
+	s.latencies = append(s.latencies, d)
+}
+
+func (r *recorder) acquire(ip net.IP, mac string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := ip.String()
+	if holder, ok := r.leases[key]; ok && holder != mac {
+		r.conflicts = append(r.conflicts, Conflict{IP: key, Holder: holder, MAC: mac})
+	}
+	r.leases[key] = mac
+}
+
+func (r *recorder) release(ip net.IP, mac string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := ip.String()
+	if r.leases[key] == mac {
+		delete(r.leases, key)
+	}
+}
+
+func (r *recorder) report(clients int, d time.Duration) *Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, s := range r.ops {
+		s.summarize()
+	}
+	return &Report{
+		Clients:   clients,
+		Duration:  d,
+		Ops:       r.ops,
+		Conflicts: r.conflicts,
+	}
+}
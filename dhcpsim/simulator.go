@@ -0,0 +1,257 @@
+// Package dhcpsim implements DHCP clients simulating a boot storm.
+//
+// Each simulated client has a distinct MAC address and a relay address,
+// and runs DISCOVER, REQUEST, and optionally RENEW and RELEASE against
+// a Transport.  Clients can also fetch the iPXE script, ignition, and
+// kernel over HTTP as real machines do.
+package dhcpsim
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sync"
+	"time"
+
+	"go.universe.tf/netboot/dhcp4"
+)
+
+var reIgnitionID = regexp.MustCompile(`(?m)^set ignition-id (\S+)$`)
+
+// Simulator runs simulated DHCP clients.
+type Simulator struct {
+	// Transport is used to send DHCP packets.
+	Transport Transport
+
+	// Clients is the number of simulated clients.
+	Clients int
+
+	// Concurrency is the number of clients running at once.
+	// Zero means all clients run at once.
+	Concurrency int
+
+	// BaseMAC is the MAC address of the first client.
+	// Following clients have sequential MAC addresses.
+	BaseMAC net.HardwareAddr
+
+	// RelayAddrs is a list of relay addresses assigned to clients in turn.
+	RelayAddrs []net.IP
+
+	// Renew makes clients renew their leases.
+	Renew bool
+
+	// Release makes clients release their leases at the end.
+	Release bool
+
+	// IPXE makes clients request iPXE boot.
+	IPXE bool
+
+	// HTTPClient is used to fetch boot files if not nil.
+	// This requires IPXE.
+	HTTPClient *http.Client
+
+	// Serials is a list of machine serials assigned to clients in turn.
+	// Clients having a serial fetch ignition and kernel.
+	Serials []string
+}
+
+// clientMAC returns the MAC address of idx-th client.
+func (s *Simulator) clientMAC(idx int) net.HardwareAddr {
+	var buf [8]byte
+	copy(buf[2:], s.BaseMAC)
+	n := binary.BigEndian.Uint64(buf[:]) + uint64(idx)
+	binary.BigEndian.PutUint64(buf[:], n)
+	return net.HardwareAddr(buf[2:])
+}
+
+func (s *Simulator) newPacket(typ dhcp4.MessageType, mac net.HardwareAddr, relay net.IP) *dhcp4.Packet {
+	xid := make([]byte, 4)
+	binary.BigEndian.PutUint32(xid, rand.Uint32())
+
+	pkt := &dhcp4.Packet{
+		Type:          typ,
+		TransactionID: xid,
+		HardwareAddr:  mac,
+		ClientAddr:    net.IPv4zero,
+		YourAddr:      net.IPv4zero,
+		ServerAddr:    net.IPv4zero,
+		RelayAddr:     relay,
+		Options:       make(dhcp4.Options),
+	}
+	pkt.Options[dhcp4.OptVendorIdentifier] = []byte("PXEClient:Arch:00007:UNDI:003016")
+	if s.IPXE {
+		pkt.Options[77] = []byte("iPXE")
+	}
+	return pkt
+}
+
+func (s *Simulator) exchange(ctx context.Context, rec *recorder, op string, pkt *dhcp4.Packet, expect dhcp4.MessageType) (*dhcp4.Packet, error) {
+	start := time.Now()
+	resp, err := s.Transport.Exchange(ctx, pkt)
+	if err == nil && pkt.Type != dhcp4.MsgRelease {
+		if resp == nil {
+			err = errors.New("no reply")
+		} else if resp.Type != expect {
+			err = fmt.Errorf("unexpected reply: %s", resp.Type)
+		}
+	}
+	rec.record(op, time.Since(start), err)
+	return resp, err
+}
+
+func (s *Simulator) runClient(ctx context.Context, rec *recorder, idx int) {
+	mac := s.clientMAC(idx)
+	relay := net.IPv4zero
+	if len(s.RelayAddrs) > 0 {
+		relay = s.RelayAddrs[idx%len(s.RelayAddrs)]
+	}
+
+	offer, err := s.exchange(ctx, rec, OpDiscover, s.newPacket(dhcp4.MsgDiscover, mac, relay), dhcp4.MsgOffer)
+	if err != nil {
+		return
+	}
+	serverID, err := offer.Options.IP(dhcp4.OptServerIdentifier)
+	if err != nil {
+		rec.record(OpRequest, 0, err)
+		return
+	}
+
+	req := s.newPacket(dhcp4.MsgRequest, mac, relay)
+	req.Options[dhcp4.OptServerIdentifier] = serverID.To4()
+	req.Options[dhcp4.OptRequestedIP] = offer.YourAddr.To4()
+	ack, err := s.exchange(ctx, rec, OpRequest, req, dhcp4.MsgAck)
+	if err != nil {
+		return
+	}
+	ip := ack.YourAddr
+	rec.acquire(ip, mac.String())
+
+	if s.HTTPClient != nil && ack.BootFilename != "" {
+		var serial string
+		if len(s.Serials) > 0 {
+			serial = s.Serials[idx%len(s.Serials)]
+		}
+		s.fetchBootFiles(ctx, rec, ack.BootFilename, serial)
+	}
+
+	if s.Renew {
+		renew := s.newPacket(dhcp4.MsgRequest, mac, relay)
+		renew.ClientAddr = ip
+		s.exchange(ctx, rec, OpRenew, renew, dhcp4.MsgAck)
+	}
+
+	if s.Release {
+		release := s.newPacket(dhcp4.MsgRelease, mac, relay)
+		release.ClientAddr = ip
+		release.Options[dhcp4.OptServerIdentifier] = serverID.To4()
+		_, err = s.exchange(ctx, rec, OpRelease, release, 0)
+		if err == nil {
+			rec.release(ip, mac.String())
+		}
+	}
+}
+
+func (s *Simulator) get(ctx context.Context, rec *recorder, op, u string) ([]byte, error) {
+	start := time.Now()
+	data, err := func() ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := s.HTTPClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			io.Copy(io.Discard, resp.Body)
+			return nil, fmt.Errorf("%s: %s", u, resp.Status)
+		}
+		if op == OpKernel {
+			_, err = io.Copy(io.Discard, resp.Body)
+			return nil, err
+		}
+		return io.ReadAll(resp.Body)
+	}()
+	rec.record(op, time.Since(start), err)
+	return data, err
+}
+
+// fetchBootFiles fetches files as iPXE does with the boot filename.
+func (s *Simulator) fetchBootFiles(ctx context.Context, rec *recorder, bootFilename, serial string) {
+	_, err := s.get(ctx, rec, OpIPXE, bootFilename)
+	if err != nil || serial == "" {
+		return
+	}
+
+	base, err := url.Parse(bootFilename)
+	if err != nil {
+		return
+	}
+	base.Path = "/api/v1/boot/coreos/ipxe/" + serial
+	script, err := s.get(ctx, rec, OpIPXE, base.String())
+	if err != nil {
+		return
+	}
+
+	m := reIgnitionID.FindSubmatch(script)
+	if m == nil {
+		rec.record(OpIgnition, 0, errors.New("no ignition-id in iPXE script"))
+		return
+	}
+	base.Path = "/api/v1/boot/ignitions/" + serial + "/" + string(m[1])
+	_, err = s.get(ctx, rec, OpIgnition, base.String())
+	if err != nil {
+		return
+	}
+
+	base.Path = "/api/v1/boot/coreos/kernel"
+	s.get(ctx, rec, OpKernel, base.String())
+}
+
+// Run runs all clients and returns the report.
+func (s *Simulator) Run(ctx context.Context) (*Report, error) {
+	if s.Clients <= 0 {
+		return nil, errors.New("no clients")
+	}
+	if len(s.BaseMAC) != 6 {
+		return nil, errors.New("invalid base MAC address")
+	}
+	concurrency := s.Concurrency
+	if concurrency <= 0 || concurrency > s.Clients {
+		concurrency = s.Clients
+	}
+
+	rec := newRecorder()
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	start := time.Now()
+	for i := 0; i < s.Clients; i++ {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return nil, ctx.Err()
+		}
+		wg.Add(1)
+		go func(idx int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			s.runClient(ctx, rec, idx)
+		}(i)
+	}
+	wg.Wait()
+
+	return rec.report(s.Clients, time.Since(start)), nil
+}
@@ -0,0 +1,174 @@
+package dhcpsim
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cybozu-go/sabakan/v3"
+	"github.com/cybozu-go/sabakan/v3/dhcpd"
+	"github.com/cybozu-go/sabakan/v3/models/mock"
+	"github.com/cybozu-go/sabakan/v3/web"
+)
+
+type testInterface struct{}
+
+func (testInterface) Addrs() ([]net.Addr, error) {
+	_, ipnet, _ := net.ParseCIDR("10.69.1.3/26")
+	ipnet.IP = net.ParseIP("10.69.1.3")
+	return []net.Addr{ipnet}, nil
+}
+
+func (testInterface) Name() string {
+	return "test0"
+}
+
+func testNewModel(t *testing.T) sabakan.Model {
+	m := mock.NewModel()
+	err := m.IPAM.PutConfig(context.Background(), &sabakan.IPAMConfig{
+		MaxNodesInRack:    28,
+		NodeIPv4Pool:      "10.69.0.0/20",
+		NodeRangeSize:     6,
+		NodeRangeMask:     26,
+		NodeIPPerNode:     3,
+		NodeIndexOffset:   3,
+		NodeGatewayOffset: 1,
+		BMCIPv4Pool:       "10.72.16.0/20",
+		BMCIPv4Offset:     "0.0.1.0",
+		BMCRangeSize:      5,
+		BMCRangeMask:      20,
+		BMCGatewayOffset:  1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.DHCP.PutConfig(context.Background(), &sabakan.DHCPConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func testSimulatorLeases(t *testing.T) {
+	t.Parallel()
+
+	m := testNewModel(t)
+	u, _ := url.Parse("http://10.69.0.195:10080")
+	baseMAC, _ := net.ParseMAC("02:00:00:00:00:fe")
+	sim := &Simulator{
+		Transport: HandlerTransport{
+			Handler:   dhcpd.DHCPHandler{Model: m, MyURL: u},
+			Interface: testInterface{},
+		},
+		Clients:     20,
+		Concurrency: 5,
+		BaseMAC:     baseMAC,
+		Renew:       true,
+		Release:     true,
+	}
+
+	if mac := sim.clientMAC(3).String(); mac != "02:00:00:00:01:01" {
+		t.Error("wrong MAC address:", mac)
+	}
+
+	report, err := sim.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, op := range []string{OpDiscover, OpRequest, OpRenew, OpRelease} {
+		s := report.Ops[op]
+		if s == nil || s.Count != 20 || s.Errors != 0 {
+			t.Errorf("wrong stats for %s: %#v", op, s)
+		}
+	}
+	if len(report.Conflicts) != 0 {
+		t.Error("unexpected conflicts:", report.Conflicts)
+	}
+
+	buf := new(bytes.Buffer)
+	err = report.Write(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "conflicts: 0") {
+		t.Error("wrong report:", buf.String())
+	}
+}
+
+func testSimulatorHTTP(t *testing.T) {
+	t.Parallel()
+
+	m := testNewModel(t)
+	ts := httptest.NewUnstartedServer(nil)
+	u, _ := url.Parse("http://" + ts.Listener.Addr().String())
+	ts.Config.Handler = web.NewServer(m, "", "", u, u, nil, false, nil, false)
+	ts.Start()
+	defer ts.Close()
+
+	baseMAC, _ := net.ParseMAC("02:00:00:00:00:00")
+	sim := &Simulator{
+		Transport: HandlerTransport{
+			Handler:   dhcpd.DHCPHandler{Model: m, MyURL: u},
+			Interface: testInterface{},
+		},
+		Clients:    3,
+		BaseMAC:    baseMAC,
+		IPXE:       true,
+		HTTPClient: &http.Client{Timeout: 5 * time.Second},
+	}
+
+	report, err := sim.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := report.Ops[OpIPXE]
+	if s == nil || s.Count != 3 || s.Errors != 0 {
+		t.Errorf("wrong stats for ipxe: %#v", s)
+	}
+}
+
+func testSimulatorConflicts(t *testing.T) {
+	t.Parallel()
+
+	rec := newRecorder()
+	ip := net.ParseIP("10.69.0.10")
+	rec.acquire(ip, "02:00:00:00:00:01")
+	rec.acquire(ip, "02:00:00:00:00:01")
+	rec.acquire(ip, "02:00:00:00:00:02")
+	rec.release(ip, "02:00:00:00:00:02")
+	rec.acquire(ip, "02:00:00:00:00:03")
+
+	report := rec.report(3, time.Second)
+	if len(report.Conflicts) != 1 {
+		t.Fatal("wrong conflicts:", report.Conflicts)
+	}
+	if report.Conflicts[0].Holder != "02:00:00:00:00:01" || report.Conflicts[0].MAC != "02:00:00:00:00:02" {
+		t.Error("wrong conflict:", report.Conflicts[0])
+	}
+}
+
+func testPercentile(t *testing.T) {
+	t.Parallel()
+
+	s := new(OpStats)
+	for i := 100; i > 0; i-- {
+		s.latencies = append(s.latencies, time.Duration(i)*time.Millisecond)
+	}
+	s.summarize()
+	if s.P50 != 50*time.Millisecond || s.P90 != 90*time.Millisecond || s.P99 != 99*time.Millisecond || s.Max != 100*time.Millisecond {
+		t.Errorf("wrong percentiles: %#v", s)
+	}
+}
+
+func TestSimulator(t *testing.T) {
+	t.Run("Leases", testSimulatorLeases)
+	t.Run("HTTP", testSimulatorHTTP)
+	t.Run("Conflicts", testSimulatorConflicts)
+	t.Run("Percentile", testPercentile)
+}
@@ -0,0 +1,169 @@
+package dhcpsim
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/cybozu-go/log"
+	"github.com/cybozu-go/sabakan/v3/dhcpd"
+	"go.universe.tf/netboot/dhcp4"
+)
+
+// DefaultTimeout is the default timeout to wait for a reply.
+const DefaultTimeout = 5 * time.Second
+
+// Transport sends a DHCP packet to the server.
+type Transport interface {
+	// Exchange sends pkt and returns the reply.
+	// For DHCPRELEASE, this returns nil without waiting for a reply.
+	Exchange(ctx context.Context, pkt *dhcp4.Packet) (*dhcp4.Packet, error)
+}
+
+// HandlerTransport is a Transport that calls dhcpd.Handler directly.
+type HandlerTransport struct {
+	Handler   dhcpd.Handler
+	Interface dhcpd.Interface
+}
+
+// Exchange implements Transport.
+func (t HandlerTransport) Exchange(ctx context.Context, pkt *dhcp4.Packet) (*dhcp4.Packet, error) {
+	resp, err := t.Handler.ServeDHCP(ctx, pkt, t.Interface)
+	if dhcpd.IsNoAction(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if pkt.Type == dhcp4.MsgRelease {
+		return nil, nil
+	}
+	return resp, nil
+}
+
+type replyKey struct {
+	xid uint32
+	mac string
+}
+
+// SocketTransport is a Transport that sends packets to a DHCP server
+// over UDP as a relay agent.
+//
+// The server sends replies to the relay address of the packets, so the
+// relay addresses must be assigned to the host running the simulator.
+type SocketTransport struct {
+	conn    *net.UDPConn
+	server  *net.UDPAddr
+	timeout time.Duration
+
+	mu      sync.Mutex
+	waiting map[replyKey]chan *dhcp4.Packet
+}
+
+// NewSocketTransport creates a SocketTransport that listens on listen
+// and sends packets to server.
+func NewSocketTransport(listen, server string, timeout time.Duration) (*SocketTransport, error) {
+	laddr, err := net.ResolveUDPAddr("udp4", listen)
+	if err != nil {
+		return nil, err
+	}
+	saddr, err := net.ResolveUDPAddr("udp4", server)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp4", laddr)
+	if err != nil {
+		return nil, err
+	}
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	return &SocketTransport{
+		conn:    conn,
+		server:  saddr,
+		timeout: timeout,
+		waiting: make(map[replyKey]chan *dhcp4.Packet),
+	}, nil
+}
+
+// Run receives replies until ctx is canceled.
+func (t *SocketTransport) Run(ctx context.Context) error {
+	go func() {
+		<-ctx.Done()
+		t.conn.Close()
+	}()
+
+	buf := make([]byte, 1500)
+	for {
+		n, _, err := t.conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		pkt, err := dhcp4.Unmarshal(buf[:n])
+		if err != nil {
+			log.Warn("dhcpsim: failed to parse a reply", map[string]interface{}{
+				log.FnError: err.Error(),
+			})
+			continue
+		}
+
+		key := replyKey{binary.BigEndian.Uint32(pkt.TransactionID), pkt.HardwareAddr.String()}
+		t.mu.Lock()
+		ch, ok := t.waiting[key]
+		if ok {
+			delete(t.waiting, key)
+		}
+		t.mu.Unlock()
+		if ok {
+			ch <- pkt
+		}
+	}
+}
+
+// Exchange implements Transport.
+func (t *SocketTransport) Exchange(ctx context.Context, pkt *dhcp4.Packet) (*dhcp4.Packet, error) {
+	data, err := pkt.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	if pkt.Type == dhcp4.MsgRelease {
+		_, err = t.conn.WriteToUDP(data, t.server)
+		return nil, err
+	}
+
+	key := replyKey{binary.BigEndian.Uint32(pkt.TransactionID), pkt.HardwareAddr.String()}
+	ch := make(chan *dhcp4.Packet, 1)
+	t.mu.Lock()
+	t.waiting[key] = ch
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		delete(t.waiting, key)
+		t.mu.Unlock()
+	}()
+
+	_, err = t.conn.WriteToUDP(data, t.server)
+	if err != nil {
+		return nil, err
+	}
+
+	timer := time.NewTimer(t.timeout)
+	defer timer.Stop()
+	select {
+	case resp := <-ch:
+		return resp, nil
+	case <-timer.C:
+		return nil, errors.New("timed out")
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
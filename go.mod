@@ -11,6 +11,7 @@ require (
 	github.com/flatcar/ignition v0.36.2
 	github.com/google/go-cmp v0.7.0
 	github.com/google/go-tpm v0.9.5
+	github.com/google/go-tpm-tools v0.4.4
 	github.com/hashicorp/go-version v1.7.0
 	github.com/onsi/ginkgo/v2 v2.23.4
 	github.com/onsi/gomega v1.37.0
@@ -20,6 +21,7 @@ require (
 	github.com/spf13/cobra v1.9.1
 	github.com/vektah/gqlparser/v2 v2.5.30
 	github.com/vincent-petithory/dataurl v1.0.0
+	go.etcd.io/bbolt v1.4.2
 	go.etcd.io/etcd/api/v3 v3.6.2
 	go.etcd.io/etcd/client/v3 v3.6.2
 	go.universe.tf/netboot v0.0.0-20240531232330-2ed7bd30206a
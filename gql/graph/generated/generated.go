@@ -41,6 +41,8 @@ type Config struct {
 
 type ResolverRoot interface {
 	BMC() BMCResolver
+	EncryptionKey() EncryptionKeyResolver
+	Machine() MachineResolver
 	MachineSpec() MachineSpecResolver
 	MachineStatus() MachineStatusResolver
 	Mutation() MutationResolver
@@ -61,15 +63,22 @@ type ComplexityRoot struct {
 		IPv4 func(childComplexity int) int
 	}
 
+	EncryptionKey struct {
+		CreatedAt func(childComplexity int) int
+		Path      func(childComplexity int) int
+		Revision  func(childComplexity int) int
+	}
+
 	Label struct {
 		Name  func(childComplexity int) int
 		Value func(childComplexity int) int
 	}
 
 	Machine struct {
-		Info   func(childComplexity int) int
-		Spec   func(childComplexity int) int
-		Status func(childComplexity int) int
+		EncryptionKeys func(childComplexity int) int
+		Info           func(childComplexity int) int
+		Spec           func(childComplexity int) int
+		Status         func(childComplexity int) int
 	}
 
 	MachineInfo struct {
@@ -120,6 +129,12 @@ type BMCResolver interface {
 	BmcType(ctx context.Context, obj *sabakan.MachineBMC) (string, error)
 	Ipv4(ctx context.Context, obj *sabakan.MachineBMC) (*gql.IPAddress, error)
 }
+type EncryptionKeyResolver interface {
+	CreatedAt(ctx context.Context, obj *sabakan.EncryptionKeyInfo) (*gql.DateTime, error)
+}
+type MachineResolver interface {
+	EncryptionKeys(ctx context.Context, obj *sabakan.Machine) ([]*sabakan.EncryptionKeyInfo, error)
+}
 type MachineSpecResolver interface {
 	Labels(ctx context.Context, obj *sabakan.MachineSpec) ([]*model.Label, error)
 	Rack(ctx context.Context, obj *sabakan.MachineSpec) (int, error)
@@ -186,6 +201,27 @@ func (e *executableSchema) Complexity(ctx context.Context, typeName, field strin
 
 		return e.complexity.BMCInfo.IPv4(childComplexity), true
 
+	case "EncryptionKey.createdAt":
+		if e.complexity.EncryptionKey.CreatedAt == nil {
+			break
+		}
+
+		return e.complexity.EncryptionKey.CreatedAt(childComplexity), true
+
+	case "EncryptionKey.path":
+		if e.complexity.EncryptionKey.Path == nil {
+			break
+		}
+
+		return e.complexity.EncryptionKey.Path(childComplexity), true
+
+	case "EncryptionKey.revision":
+		if e.complexity.EncryptionKey.Revision == nil {
+			break
+		}
+
+		return e.complexity.EncryptionKey.Revision(childComplexity), true
+
 	case "Label.name":
 		if e.complexity.Label.Name == nil {
 			break
@@ -200,6 +236,13 @@ func (e *executableSchema) Complexity(ctx context.Context, typeName, field strin
 
 		return e.complexity.Label.Value(childComplexity), true
 
+	case "Machine.encryptionKeys":
+		if e.complexity.Machine.EncryptionKeys == nil {
+			break
+		}
+
+		return e.complexity.Machine.EncryptionKeys(childComplexity), true
+
 	case "Machine.info":
 		if e.complexity.Machine.Info == nil {
 			break
@@ -532,6 +575,16 @@ type Machine {
     spec: MachineSpec!
     status: MachineStatus!
     info: MachineInfo!
+    encryptionKeys: [EncryptionKey!]!
+}
+
+"""
+EncryptionKey represents meta data of a disk encryption key of a machine.
+"""
+type EncryptionKey {
+    path: String!
+    createdAt: DateTime!
+    revision: Int!
 }
 
 """
@@ -1056,6 +1109,138 @@ func (ec *executionContext) fieldContext_BMCInfo_ipv4(_ context.Context, field g
 	return fc, nil
 }
 
+func (ec *executionContext) _EncryptionKey_path(ctx context.Context, field graphql.CollectedField, obj *sabakan.EncryptionKeyInfo) (ret graphql.Marshaler) {
+	fc, err := ec.fieldContext_EncryptionKey_path(ctx, field)
+	if err != nil {
+		return graphql.Null
+	}
+	ctx = graphql.WithFieldContext(ctx, fc)
+	defer func() {
+		if r := recover(); r != nil {
+			ec.Error(ctx, ec.Recover(ctx, r))
+			ret = graphql.Null
+		}
+	}()
+	resTmp, err := ec.ResolverMiddleware(ctx, func(rctx context.Context) (any, error) {
+		ctx = rctx // use context from middleware stack in children
+		return obj.Path, nil
+	})
+	if err != nil {
+		ec.Error(ctx, err)
+		return graphql.Null
+	}
+	if resTmp == nil {
+		if !graphql.HasFieldError(ctx, fc) {
+			ec.Errorf(ctx, "must not be null")
+		}
+		return graphql.Null
+	}
+	res := resTmp.(string)
+	fc.Result = res
+	return ec.marshalNString2string(ctx, field.Selections, res)
+}
+
+func (ec *executionContext) fieldContext_EncryptionKey_path(_ context.Context, field graphql.CollectedField) (fc *graphql.FieldContext, err error) {
+	fc = &graphql.FieldContext{
+		Object:     "EncryptionKey",
+		Field:      field,
+		IsMethod:   false,
+		IsResolver: false,
+		Child: func(ctx context.Context, field graphql.CollectedField) (*graphql.FieldContext, error) {
+			return nil, errors.New("field of type String does not have child fields")
+		},
+	}
+	return fc, nil
+}
+
+func (ec *executionContext) _EncryptionKey_createdAt(ctx context.Context, field graphql.CollectedField, obj *sabakan.EncryptionKeyInfo) (ret graphql.Marshaler) {
+	fc, err := ec.fieldContext_EncryptionKey_createdAt(ctx, field)
+	if err != nil {
+		return graphql.Null
+	}
+	ctx = graphql.WithFieldContext(ctx, fc)
+	defer func() {
+		if r := recover(); r != nil {
+			ec.Error(ctx, ec.Recover(ctx, r))
+			ret = graphql.Null
+		}
+	}()
+	resTmp, err := ec.ResolverMiddleware(ctx, func(rctx context.Context) (any, error) {
+		ctx = rctx // use context from middleware stack in children
+		return ec.resolvers.EncryptionKey().CreatedAt(rctx, obj)
+	})
+	if err != nil {
+		ec.Error(ctx, err)
+		return graphql.Null
+	}
+	if resTmp == nil {
+		if !graphql.HasFieldError(ctx, fc) {
+			ec.Errorf(ctx, "must not be null")
+		}
+		return graphql.Null
+	}
+	res := resTmp.(*gql.DateTime)
+	fc.Result = res
+	return ec.marshalNDateTime2ᚖgithubᚗcomᚋcybozuᚑgoᚋsabakanᚋv3ᚋgqlᚐDateTime(ctx, field.Selections, res)
+}
+
+func (ec *executionContext) fieldContext_EncryptionKey_createdAt(_ context.Context, field graphql.CollectedField) (fc *graphql.FieldContext, err error) {
+	fc = &graphql.FieldContext{
+		Object:     "EncryptionKey",
+		Field:      field,
+		IsMethod:   true,
+		IsResolver: true,
+		Child: func(ctx context.Context, field graphql.CollectedField) (*graphql.FieldContext, error) {
+			return nil, errors.New("field of type DateTime does not have child fields")
+		},
+	}
+	return fc, nil
+}
+
+func (ec *executionContext) _EncryptionKey_revision(ctx context.Context, field graphql.CollectedField, obj *sabakan.EncryptionKeyInfo) (ret graphql.Marshaler) {
+	fc, err := ec.fieldContext_EncryptionKey_revision(ctx, field)
+	if err != nil {
+		return graphql.Null
+	}
+	ctx = graphql.WithFieldContext(ctx, fc)
+	defer func() {
+		if r := recover(); r != nil {
+			ec.Error(ctx, ec.Recover(ctx, r))
+			ret = graphql.Null
+		}
+	}()
+	resTmp, err := ec.ResolverMiddleware(ctx, func(rctx context.Context) (any, error) {
+		ctx = rctx // use context from middleware stack in children
+		return obj.Revision, nil
+	})
+	if err != nil {
+		ec.Error(ctx, err)
+		return graphql.Null
+	}
+	if resTmp == nil {
+		if !graphql.HasFieldError(ctx, fc) {
+			ec.Errorf(ctx, "must not be null")
+		}
+		return graphql.Null
+	}
+	res := resTmp.(int64)
+	fc.Result = res
+	return ec.marshalNInt2int64(ctx, field.Selections, res)
+}
+
+func (ec *executionContext) fieldContext_EncryptionKey_revision(_ context.Context, field graphql.CollectedField) (fc *graphql.FieldContext, err error) {
+	fc = &graphql.FieldContext{
+		Object:     "EncryptionKey",
+		Field:      field,
+		IsMethod:   false,
+		IsResolver: false,
+		Child: func(ctx context.Context, field graphql.CollectedField) (*graphql.FieldContext, error) {
+			return nil, errors.New("field of type Int does not have child fields")
+		},
+	}
+	return fc, nil
+}
+
 func (ec *executionContext) _Label_name(ctx context.Context, field graphql.CollectedField, obj *model.Label) (ret graphql.Marshaler) {
 	fc, err := ec.fieldContext_Label_name(ctx, field)
 	if err != nil {
@@ -1310,6 +1495,58 @@ func (ec *executionContext) fieldContext_Machine_info(_ context.Context, field g
 	return fc, nil
 }
 
+func (ec *executionContext) _Machine_encryptionKeys(ctx context.Context, field graphql.CollectedField, obj *sabakan.Machine) (ret graphql.Marshaler) {
+	fc, err := ec.fieldContext_Machine_encryptionKeys(ctx, field)
+	if err != nil {
+		return graphql.Null
+	}
+	ctx = graphql.WithFieldContext(ctx, fc)
+	defer func() {
+		if r := recover(); r != nil {
+			ec.Error(ctx, ec.Recover(ctx, r))
+			ret = graphql.Null
+		}
+	}()
+	resTmp, err := ec.ResolverMiddleware(ctx, func(rctx context.Context) (any, error) {
+		ctx = rctx // use context from middleware stack in children
+		return ec.resolvers.Machine().EncryptionKeys(rctx, obj)
+	})
+	if err != nil {
+		ec.Error(ctx, err)
+		return graphql.Null
+	}
+	if resTmp == nil {
+		if !graphql.HasFieldError(ctx, fc) {
+			ec.Errorf(ctx, "must not be null")
+		}
+		return graphql.Null
+	}
+	res := resTmp.([]*sabakan.EncryptionKeyInfo)
+	fc.Result = res
+	return ec.marshalNEncryptionKey2ᚕᚖgithubᚗcomᚋcybozuᚑgoᚋsabakanᚋv3ᚐEncryptionKeyInfoᚄ(ctx, field.Selections, res)
+}
+
+func (ec *executionContext) fieldContext_Machine_encryptionKeys(_ context.Context, field graphql.CollectedField) (fc *graphql.FieldContext, err error) {
+	fc = &graphql.FieldContext{
+		Object:     "Machine",
+		Field:      field,
+		IsMethod:   true,
+		IsResolver: true,
+		Child: func(ctx context.Context, field graphql.CollectedField) (*graphql.FieldContext, error) {
+			switch field.Name {
+			case "path":
+				return ec.fieldContext_EncryptionKey_path(ctx, field)
+			case "createdAt":
+				return ec.fieldContext_EncryptionKey_createdAt(ctx, field)
+			case "revision":
+				return ec.fieldContext_EncryptionKey_revision(ctx, field)
+			}
+			return nil, fmt.Errorf("no field named %q was found under type EncryptionKey", field.Name)
+		},
+	}
+	return fc, nil
+}
+
 func (ec *executionContext) _MachineInfo_network(ctx context.Context, field graphql.CollectedField, obj *sabakan.MachineInfo) (ret graphql.Marshaler) {
 	fc, err := ec.fieldContext_MachineInfo_network(ctx, field)
 	if err != nil {
@@ -2281,6 +2518,8 @@ func (ec *executionContext) fieldContext_Query_machine(ctx context.Context, fiel
 				return ec.fieldContext_Machine_status(ctx, field)
 			case "info":
 				return ec.fieldContext_Machine_info(ctx, field)
+			case "encryptionKeys":
+				return ec.fieldContext_Machine_encryptionKeys(ctx, field)
 			}
 			return nil, fmt.Errorf("no field named %q was found under type Machine", field.Name)
 		},
@@ -2344,6 +2583,8 @@ func (ec *executionContext) fieldContext_Query_searchMachines(ctx context.Contex
 				return ec.fieldContext_Machine_status(ctx, field)
 			case "info":
 				return ec.fieldContext_Machine_info(ctx, field)
+			case "encryptionKeys":
+				return ec.fieldContext_Machine_encryptionKeys(ctx, field)
 			}
 			return nil, fmt.Errorf("no field named %q was found under type Machine", field.Name)
 		},
@@ -4686,6 +4927,86 @@ func (ec *executionContext) _BMCInfo(ctx context.Context, sel ast.SelectionSet,
 	return out
 }
 
+var encryptionKeyImplementors = []string{"EncryptionKey"}
+
+func (ec *executionContext) _EncryptionKey(ctx context.Context, sel ast.SelectionSet, obj *sabakan.EncryptionKeyInfo) graphql.Marshaler {
+	fields := graphql.CollectFields(ec.OperationContext, sel, encryptionKeyImplementors)
+
+	out := graphql.NewFieldSet(fields)
+	deferred := make(map[string]*graphql.FieldSet)
+	for i, field := range fields {
+		switch field.Name {
+		case "__typename":
+			out.Values[i] = graphql.MarshalString("EncryptionKey")
+		case "path":
+			out.Values[i] = ec._EncryptionKey_path(ctx, field, obj)
+			if out.Values[i] == graphql.Null {
+				atomic.AddUint32(&out.Invalids, 1)
+			}
+		case "createdAt":
+			field := field
+
+			innerFunc := func(ctx context.Context, fs *graphql.FieldSet) (res graphql.Marshaler) {
+				defer func() {
+					if r := recover(); r != nil {
+						ec.Error(ctx, ec.Recover(ctx, r))
+					}
+				}()
+				res = ec._EncryptionKey_createdAt(ctx, field, obj)
+				if res == graphql.Null {
+					atomic.AddUint32(&fs.Invalids, 1)
+				}
+				return res
+			}
+
+			if field.Deferrable != nil {
+				dfs, ok := deferred[field.Deferrable.Label]
+				di := 0
+				if ok {
+					dfs.AddField(field)
+					di = len(dfs.Values) - 1
+				} else {
+					dfs = graphql.NewFieldSet([]graphql.CollectedField{field})
+					deferred[field.Deferrable.Label] = dfs
+				}
+				dfs.Concurrently(di, func(ctx context.Context) graphql.Marshaler {
+					return innerFunc(ctx, dfs)
+				})
+
+				// don't run the out.Concurrently() call below
+				out.Values[i] = graphql.Null
+				continue
+			}
+
+			out.Concurrently(i, func(ctx context.Context) graphql.Marshaler { return innerFunc(ctx, out) })
+		case "revision":
+			out.Values[i] = ec._EncryptionKey_revision(ctx, field, obj)
+			if out.Values[i] == graphql.Null {
+				atomic.AddUint32(&out.Invalids, 1)
+			}
+		default:
+			panic("unknown field " + strconv.Quote(field.Name))
+		}
+	}
+	out.Dispatch(ctx)
+	if out.Invalids > 0 {
+		return graphql.Null
+	}
+
+	atomic.AddInt32(&ec.deferred, int32(len(deferred)))
+
+	for label, dfs := range deferred {
+		ec.processDeferredGroup(graphql.DeferredGroup{
+			Label:    label,
+			Path:     graphql.GetPath(ctx),
+			FieldSet: dfs,
+			Context:  ctx,
+		})
+	}
+
+	return out
+}
+
 var labelImplementors = []string{"Label"}
 
 func (ec *executionContext) _Label(ctx context.Context, sel ast.SelectionSet, obj *model.Label) graphql.Marshaler {
@@ -4744,18 +5065,54 @@ func (ec *executionContext) _Machine(ctx context.Context, sel ast.SelectionSet,
 		case "spec":
 			out.Values[i] = ec._Machine_spec(ctx, field, obj)
 			if out.Values[i] == graphql.Null {
-				out.Invalids++
+				atomic.AddUint32(&out.Invalids, 1)
 			}
 		case "status":
 			out.Values[i] = ec._Machine_status(ctx, field, obj)
 			if out.Values[i] == graphql.Null {
-				out.Invalids++
+				atomic.AddUint32(&out.Invalids, 1)
 			}
 		case "info":
 			out.Values[i] = ec._Machine_info(ctx, field, obj)
 			if out.Values[i] == graphql.Null {
-				out.Invalids++
+				atomic.AddUint32(&out.Invalids, 1)
 			}
+		case "encryptionKeys":
+			field := field
+
+			innerFunc := func(ctx context.Context, fs *graphql.FieldSet) (res graphql.Marshaler) {
+				defer func() {
+					if r := recover(); r != nil {
+						ec.Error(ctx, ec.Recover(ctx, r))
+					}
+				}()
+				res = ec._Machine_encryptionKeys(ctx, field, obj)
+				if res == graphql.Null {
+					atomic.AddUint32(&fs.Invalids, 1)
+				}
+				return res
+			}
+
+			if field.Deferrable != nil {
+				dfs, ok := deferred[field.Deferrable.Label]
+				di := 0
+				if ok {
+					dfs.AddField(field)
+					di = len(dfs.Values) - 1
+				} else {
+					dfs = graphql.NewFieldSet([]graphql.CollectedField{field})
+					deferred[field.Deferrable.Label] = dfs
+				}
+				dfs.Concurrently(di, func(ctx context.Context) graphql.Marshaler {
+					return innerFunc(ctx, dfs)
+				})
+
+				// don't run the out.Concurrently() call below
+				out.Values[i] = graphql.Null
+				continue
+			}
+
+			out.Concurrently(i, func(ctx context.Context) graphql.Marshaler { return innerFunc(ctx, out) })
 		default:
 			panic("unknown field " + strconv.Quote(field.Name))
 		}
@@ -5879,6 +6236,60 @@ func (ec *executionContext) marshalNDateTime2ᚖgithubᚗcomᚋcybozuᚑgoᚋsab
 	return v
 }
 
+func (ec *executionContext) marshalNEncryptionKey2ᚕᚖgithubᚗcomᚋcybozuᚑgoᚋsabakanᚋv3ᚐEncryptionKeyInfoᚄ(ctx context.Context, sel ast.SelectionSet, v []*sabakan.EncryptionKeyInfo) graphql.Marshaler {
+	ret := make(graphql.Array, len(v))
+	var wg sync.WaitGroup
+	isLen1 := len(v) == 1
+	if !isLen1 {
+		wg.Add(len(v))
+	}
+	for i := range v {
+		i := i
+		fc := &graphql.FieldContext{
+			Index:  &i,
+			Result: &v[i],
+		}
+		ctx := graphql.WithFieldContext(ctx, fc)
+		f := func(i int) {
+			defer func() {
+				if r := recover(); r != nil {
+					ec.Error(ctx, ec.Recover(ctx, r))
+					ret = nil
+				}
+			}()
+			if !isLen1 {
+				defer wg.Done()
+			}
+			ret[i] = ec.marshalNEncryptionKey2ᚖgithubᚗcomᚋcybozuᚑgoᚋsabakanᚋv3ᚐEncryptionKeyInfo(ctx, sel, v[i])
+		}
+		if isLen1 {
+			f(i)
+		} else {
+			go f(i)
+		}
+
+	}
+	wg.Wait()
+
+	for _, e := range ret {
+		if e == graphql.Null {
+			return graphql.Null
+		}
+	}
+
+	return ret
+}
+
+func (ec *executionContext) marshalNEncryptionKey2ᚖgithubᚗcomᚋcybozuᚑgoᚋsabakanᚋv3ᚐEncryptionKeyInfo(ctx context.Context, sel ast.SelectionSet, v *sabakan.EncryptionKeyInfo) graphql.Marshaler {
+	if v == nil {
+		if !graphql.HasFieldError(ctx, graphql.GetFieldContext(ctx)) {
+			ec.Errorf(ctx, "the requested element is null which the schema does not allow")
+		}
+		return graphql.Null
+	}
+	return ec._EncryptionKey(ctx, sel, v)
+}
+
 func (ec *executionContext) unmarshalNFloat2float64(ctx context.Context, v any) (float64, error) {
 	res, err := graphql.UnmarshalFloatContext(ctx, v)
 	return res, graphql.ErrorOnPath(ctx, err)
@@ -5983,6 +6394,22 @@ func (ec *executionContext) marshalNInt2int(ctx context.Context, sel ast.Selecti
 	return res
 }
 
+func (ec *executionContext) unmarshalNInt2int64(ctx context.Context, v any) (int64, error) {
+	res, err := graphql.UnmarshalInt64(v)
+	return res, graphql.ErrorOnPath(ctx, err)
+}
+
+func (ec *executionContext) marshalNInt2int64(ctx context.Context, sel ast.SelectionSet, v int64) graphql.Marshaler {
+	_ = sel
+	res := graphql.MarshalInt64(v)
+	if res == graphql.Null {
+		if !graphql.HasFieldError(ctx, graphql.GetFieldContext(ctx)) {
+			ec.Errorf(ctx, "the requested element is null which the schema does not allow")
+		}
+	}
+	return res
+}
+
 func (ec *executionContext) marshalNLabel2ᚖgithubᚗcomᚋcybozuᚑgoᚋsabakanᚋv3ᚋgqlᚋgraphᚋmodelᚐLabel(ctx context.Context, sel ast.SelectionSet, v *model.Label) graphql.Marshaler {
 	if v == nil {
 		if !graphql.HasFieldError(ctx, graphql.GetFieldContext(ctx)) {
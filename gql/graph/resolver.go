@@ -1,6 +1,13 @@
 package graph
 
-import sabakan "github.com/cybozu-go/sabakan/v3"
+import (
+	"context"
+
+	"github.com/cybozu-go/log"
+	sabakan "github.com/cybozu-go/sabakan/v3"
+	"github.com/cybozu-go/sabakan/v3/gql"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
 
 // This file will not be regenerated automatically.
 //
@@ -9,3 +16,27 @@ import sabakan "github.com/cybozu-go/sabakan/v3"
 type Resolver struct {
 	Model sabakan.Model
 }
+
+// authorize checks RBAC permissions of the request.
+// Denied requests are recorded in the audit log.
+func (r *Resolver) authorize(ctx context.Context, cat sabakan.AuditCategory, verb, instance string) error {
+	err := sabakan.Authorize(ctx, cat, verb)
+	if err == nil {
+		return nil
+	}
+
+	err = r.Model.Log.Record(ctx, cat, instance, "deny", "graphql "+verb)
+	if err != nil {
+		log.Error("failed to record a denied request", map[string]interface{}{
+			log.FnError: err,
+			"category":  string(cat),
+			"instance":  instance,
+		})
+	}
+	return &gqlerror.Error{
+		Message: sabakan.ErrForbidden.Error(),
+		Extensions: map[string]interface{}{
+			"type": gql.ErrForbidden,
+		},
+	}
+}
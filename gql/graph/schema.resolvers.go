@@ -29,6 +29,22 @@ func (r *bMCResolver) Ipv4(ctx context.Context, obj *sabakan.MachineBMC) (*gql.I
 	return &gql.IPAddress{IP: net.ParseIP(obj.IPv4)}, nil
 }
 
+// CreatedAt is the resolver for the createdAt field.
+func (r *encryptionKeyResolver) CreatedAt(ctx context.Context, obj *sabakan.EncryptionKeyInfo) (*gql.DateTime, error) {
+	t := gql.DateTime(obj.CreatedAt)
+	return &t, nil
+}
+
+// EncryptionKeys is the resolver for the encryptionKeys field.
+func (r *machineResolver) EncryptionKeys(ctx context.Context, obj *sabakan.Machine) ([]*sabakan.EncryptionKeyInfo, error) {
+	serial := obj.Spec.Serial
+	if err := r.authorize(ctx, sabakan.AuditCrypts, sabakan.VerbRead, serial); err != nil {
+		return nil, err
+	}
+
+	return r.Model.Storage.ListEncryptionKeys(ctx, serial)
+}
+
 // Labels is the resolver for the labels field.
 func (r *machineSpecResolver) Labels(ctx context.Context, obj *sabakan.MachineSpec) ([]*model.Label, error) {
 	if len(obj.Labels) == 0 {
@@ -94,6 +110,10 @@ func (r *mutationResolver) SetMachineState(ctx context.Context, serial string, s
 		"state":  state,
 	})
 
+	if err := r.authorize(ctx, sabakan.AuditMachines, sabakan.VerbWrite, serial); err != nil {
+		return &sabakan.MachineStatus{}, err
+	}
+
 	err := r.Model.Machine.SetState(ctx, serial, state)
 	if err != nil {
 		switch err {
@@ -166,6 +186,10 @@ func (r *queryResolver) Machine(ctx context.Context, serial string) (*sabakan.Ma
 		"serial": serial,
 	})
 
+	if err := r.authorize(ctx, sabakan.AuditMachines, sabakan.VerbRead, serial); err != nil {
+		return &sabakan.Machine{}, err
+	}
+
 	machine, err := r.Model.Machine.Get(ctx, serial)
 	if err != nil {
 		return &sabakan.Machine{}, err
@@ -183,6 +207,10 @@ func (r *queryResolver) SearchMachines(ctx context.Context, having *model.Machin
 		"nothaving": notHaving,
 	})
 
+	if err := r.authorize(ctx, sabakan.AuditMachines, sabakan.VerbRead, ""); err != nil {
+		return nil, err
+	}
+
 	machines, err := r.Model.Machine.Query(ctx, sabakan.Query{})
 	if err != nil {
 		return nil, err
@@ -200,6 +228,12 @@ func (r *queryResolver) SearchMachines(ctx context.Context, having *model.Machin
 // BMC returns generated.BMCResolver implementation.
 func (r *Resolver) BMC() generated.BMCResolver { return &bMCResolver{r} }
 
+// EncryptionKey returns generated.EncryptionKeyResolver implementation.
+func (r *Resolver) EncryptionKey() generated.EncryptionKeyResolver { return &encryptionKeyResolver{r} }
+
+// Machine returns generated.MachineResolver implementation.
+func (r *Resolver) Machine() generated.MachineResolver { return &machineResolver{r} }
+
 // MachineSpec returns generated.MachineSpecResolver implementation.
 func (r *Resolver) MachineSpec() generated.MachineSpecResolver { return &machineSpecResolver{r} }
 
@@ -216,6 +250,8 @@ func (r *Resolver) NICConfig() generated.NICConfigResolver { return &nICConfigRe
 func (r *Resolver) Query() generated.QueryResolver { return &queryResolver{r} }
 
 type bMCResolver struct{ *Resolver }
+type encryptionKeyResolver struct{ *Resolver }
+type machineResolver struct{ *Resolver }
 type machineSpecResolver struct{ *Resolver }
 type machineStatusResolver struct{ *Resolver }
 type mutationResolver struct{ *Resolver }
@@ -27,6 +27,9 @@ const (
 
 	// ErrInternalServerError is an error code when internal server error has occurred.
 	ErrInternalServerError = "INTERNAL_SERVER_ERROR"
+
+	// ErrForbidden is an error code when the request is not permitted.
+	ErrForbidden = "FORBIDDEN"
 )
 
 // IPAddress represents "IPAddress" GraphQL custom scalar.
@@ -0,0 +1,29 @@
+package sabakan
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrUnknownMasterKey is returned when a wrapped key refers to a master key
+// that is not available.
+var ErrUnknownMasterKey = errors.New("unknown master key")
+
+// KMS wraps and unwraps disk encryption keys with master keys.
+//
+// Implementations must be able to unwrap keys wrapped with any master key
+// they know, so that keys can be re-wrapped after the current master key
+// is rotated.
+type KMS interface {
+	// KeyID returns the ID of the current master key.
+	KeyID() string
+
+	// Wrap encrypts plaintext with the current master key.
+	// aad is authenticated but not encrypted; the same aad must be given
+	// to Unwrap.
+	Wrap(ctx context.Context, plaintext, aad []byte) (keyID string, ciphertext []byte, err error)
+
+	// Unwrap decrypts ciphertext with the master key identified by keyID.
+	// This returns ErrUnknownMasterKey if keyID is not known.
+	Unwrap(ctx context.Context, keyID string, ciphertext, aad []byte) ([]byte, error)
+}
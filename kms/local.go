@@ -0,0 +1,98 @@
+// Package kms implements sabakan.KMS.
+package kms
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+// MasterKeySize is the size of master keys in bytes.
+const MasterKeySize = 32
+
+// Local is a sabakan.KMS that encrypts keys with AES-256-GCM using
+// master keys held in memory.
+type Local struct {
+	current string
+	aeads   map[string]cipher.AEAD
+}
+
+// NewLocal creates Local from a map of master key IDs to master keys.
+// current is the ID of the master key used to wrap keys.
+func NewLocal(current string, keys map[string][]byte) (*Local, error) {
+	if _, ok := keys[current]; !ok {
+		return nil, errors.New("no master key for the current key ID: " + current)
+	}
+
+	aeads := make(map[string]cipher.AEAD)
+	for id, key := range keys {
+		if id == "" {
+			return nil, errors.New("empty master key ID")
+		}
+		if len(key) != MasterKeySize {
+			return nil, fmt.Errorf("master key %s must be %d bytes", id, MasterKeySize)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		aeads[id] = aead
+	}
+
+	return &Local{current: current, aeads: aeads}, nil
+}
+
+// LoadLocal creates Local from a map of master key IDs to files.
+// Each file must contain a raw master key of MasterKeySize bytes.
+func LoadLocal(current string, files map[string]string) (*Local, error) {
+	keys := make(map[string][]byte)
+	for id, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		keys[id] = data
+	}
+	return NewLocal(current, keys)
+}
+
+// KeyID implements sabakan.KMS.
+func (l *Local) KeyID() string {
+	return l.current
+}
+
+// Wrap implements sabakan.KMS.
+//
+// The returned ciphertext is a random nonce followed by the sealed data.
+func (l *Local) Wrap(ctx context.Context, plaintext, aad []byte) (string, []byte, error) {
+	aead := l.aeads[l.current]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return "", nil, err
+	}
+	return l.current, aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+// Unwrap implements sabakan.KMS.
+func (l *Local) Unwrap(ctx context.Context, keyID string, ciphertext, aad []byte) ([]byte, error) {
+	aead, ok := l.aeads[keyID]
+	if !ok {
+		return nil, sabakan.ErrUnknownMasterKey
+	}
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("too short ciphertext")
+	}
+	nonce := ciphertext[:aead.NonceSize()]
+	return aead.Open(nil, nonce, ciphertext[aead.NonceSize():], aad)
+}
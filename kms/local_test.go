@@ -0,0 +1,102 @@
+package kms
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+func testLocalWrap(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	key1 := bytes.Repeat([]byte{1}, MasterKeySize)
+	key2 := bytes.Repeat([]byte{2}, MasterKeySize)
+
+	l1, err := NewLocal("1", map[string][]byte{"1": key1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, data, err := l1.Wrap(ctx, []byte("disk key"), []byte("crypts/1234/disk0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "1" {
+		t.Error("wrong key ID:", id)
+	}
+	if bytes.Contains(data, []byte("disk key")) {
+		t.Error("plaintext is not encrypted")
+	}
+
+	_, err = l1.Unwrap(ctx, id, data, []byte("crypts/1234/disk1"))
+	if err == nil {
+		t.Error("unwrapped with wrong aad")
+	}
+
+	// rotated
+	l2, err := NewLocal("2", map[string][]byte{"1": key1, "2": key2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l2.KeyID() != "2" {
+		t.Error("wrong current key ID:", l2.KeyID())
+	}
+	plain, err := l2.Unwrap(ctx, id, data, []byte("crypts/1234/disk0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plain) != "disk key" {
+		t.Error("wrong plaintext:", string(plain))
+	}
+
+	id, data, err = l2.Wrap(ctx, plain, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = l1.Unwrap(ctx, id, data, nil)
+	if err != sabakan.ErrUnknownMasterKey {
+		t.Error("unexpected error:", err)
+	}
+}
+
+func testLoadLocal(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good")
+	err := os.WriteFile(good, bytes.Repeat([]byte{1}, MasterKeySize), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	short := filepath.Join(dir, "short")
+	err = os.WriteFile(short, []byte("short"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = LoadLocal("a", map[string]string{"a": good})
+	if err != nil {
+		t.Error(err)
+	}
+	_, err = LoadLocal("a", map[string]string{"a": short})
+	if err == nil {
+		t.Error("short master key should be rejected")
+	}
+	_, err = LoadLocal("b", map[string]string{"a": good})
+	if err == nil {
+		t.Error("missing current master key should be rejected")
+	}
+	_, err = LoadLocal("a", map[string]string{"a": filepath.Join(dir, "none")})
+	if err == nil {
+		t.Error("missing file should be rejected")
+	}
+}
+
+func TestLocal(t *testing.T) {
+	t.Run("Wrap", testLocalWrap)
+	t.Run("Load", testLoadLocal)
+}
@@ -0,0 +1,37 @@
+package sabakan
+
+import (
+	"context"
+	"crypto/ed25519"
+	"io"
+	"time"
+)
+
+// LogConfig configures audit logs.
+type LogConfig struct {
+	// RetentionDays is the number of days to keep logs in the model.
+	// Zero means 60 days.
+	RetentionDays int
+
+	// Archive stores logs before they are removed from the model.
+	// If nil, logs are just removed.
+	Archive LogArchive
+
+	// CheckpointKey signs checkpoints of the hash chain.
+	// If nil, checkpoints are not signed.
+	CheckpointKey ed25519.PrivateKey
+}
+
+// LogArchive stores audit logs removed from the model by compaction.
+//
+// Logs are stored per day.  day is the UTC date of the logs;
+// its time of day is ignored.
+type LogArchive interface {
+	// Store stores JSONL-formatted audit logs of the day.
+	// If logs of the day have been stored, they are replaced.
+	Store(ctx context.Context, day time.Time, logs []byte) error
+
+	// Load writes JSONL-formatted audit logs of the day to w.
+	// This returns ErrNotFound if logs of the day are not stored.
+	Load(ctx context.Context, day time.Time, w io.Writer) error
+}
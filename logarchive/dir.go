@@ -0,0 +1,95 @@
+// Package logarchive implements sabakan.LogArchive.
+package logarchive
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+// Dir is a sabakan.LogArchive that stores gzip-compressed JSONL files
+// named YYYYMMDD.jsonl.gz in a directory.
+type Dir struct {
+	dir string
+}
+
+// NewDir creates Dir.  The directory is created if it does not exist.
+func NewDir(dir string) (*Dir, error) {
+	if !filepath.IsAbs(dir) {
+		return nil, errors.New("archive directory must be an absolute path: " + dir)
+	}
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &Dir{dir: dir}, nil
+}
+
+func (d *Dir) filename(day time.Time) string {
+	return filepath.Join(d.dir, day.UTC().Format("20060102")+".jsonl.gz")
+}
+
+// Store implements sabakan.LogArchive.
+func (d *Dir) Store(ctx context.Context, day time.Time, logs []byte) error {
+	f, err := os.CreateTemp(d.dir, ".tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		f.Close()
+		os.Remove(f.Name())
+	}()
+
+	gw := gzip.NewWriter(f)
+	_, err = gw.Write(logs)
+	if err != nil {
+		return err
+	}
+	err = gw.Close()
+	if err != nil {
+		return err
+	}
+	err = f.Sync()
+	if err != nil {
+		return err
+	}
+	err = f.Chmod(0644)
+	if err != nil {
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), d.filename(day))
+}
+
+// Load implements sabakan.LogArchive.
+func (d *Dir) Load(ctx context.Context, day time.Time, w io.Writer) error {
+	f, err := os.Open(d.filename(day))
+	if errors.Is(err, fs.ErrNotExist) {
+		return sabakan.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, gr)
+	if err != nil {
+		return err
+	}
+	return gr.Close()
+}
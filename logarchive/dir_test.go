@@ -0,0 +1,91 @@
+package logarchive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+func TestDir(t *testing.T) {
+	t.Parallel()
+
+	tmpdir := t.TempDir()
+	_, err := NewDir("relative/path")
+	if err == nil {
+		t.Error("relative path should be rejected")
+	}
+
+	dir, err := NewDir(filepath.Join(tmpdir, "archive"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	day := time.Date(2026, 10, 19, 12, 34, 56, 0, time.UTC)
+	buf := new(bytes.Buffer)
+	err = dir.Load(ctx, day, buf)
+	if err != sabakan.ErrNotFound {
+		t.Error("unexpected error:", err)
+	}
+
+	logs := []byte("{\"category\":\"machines\"}\n{\"category\":\"ipam\"}\n")
+	err = dir.Store(ctx, day, logs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dir.Load(ctx, day.Truncate(24*time.Hour), buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), logs) {
+		t.Error("wrong logs:", buf.String())
+	}
+
+	// stored file is gzip-compressed JSONL
+	f, err := os.Open(filepath.Join(tmpdir, "archive", "20261019.jsonl.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(gr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, logs) {
+		t.Error("wrong file content:", string(data))
+	}
+
+	// replace
+	logs2 := []byte("{\"category\":\"assets\"}\n")
+	err = dir.Store(ctx, day, logs2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	err = dir.Load(ctx, day, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), logs2) {
+		t.Error("logs should be replaced:", buf.String())
+	}
+
+	entries, err := os.ReadDir(filepath.Join(tmpdir, "archive"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Error("temporary files should be removed:", len(entries))
+	}
+}
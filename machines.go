@@ -3,6 +3,7 @@ package sabakan
 import (
 	"errors"
 	"fmt"
+	"net"
 	"regexp"
 	"time"
 
@@ -73,12 +74,20 @@ const (
 	SetStateErrorFormat = "transition from [ %s ] to [ %s ] is forbidden"
 )
 
+// LabelBootLoop is the name of the label put on machines that are
+// quarantined due to boot loops.  The value is the detected time
+// in BootLoopLabelFormat.
+const LabelBootLoop = "boot-loop"
+
+// BootLoopLabelFormat is the time format of the value of LabelBootLoop.
+const BootLoopLabelFormat = "20060102T150405Z"
+
 var (
 	reValidBmcType       = regexp.MustCompile(`^[a-z0-9A-Z-_/.]+$`)
 	reValidLabelName     = regexp.MustCompile(`^[a-z0-9A-Z]([a-z0-9A-Z_.-]{0,61}[a-z0-9A-Z])?$`)
 	reValidLabelVal      = regexp.MustCompile(`^[a-z0-9A-Z]([a-z0-9A-Z_.-]{0,61}[a-z0-9A-Z])?$`)
 	permittedTransitions = map[MachineState][]MachineState{
-		StateUninitialized: {StateHealthy, StateRetiring},
+		StateUninitialized: {StateHealthy, StateUnhealthy, StateRetiring},
 		StateHealthy:       {StateUnhealthy, StateUnreachable, StateUpdating, StateRetiring},
 		StateUnhealthy:     {StateHealthy, StateUnreachable, StateUpdating, StateRetiring},
 		StateUnreachable:   {StateHealthy, StateUnhealthy, StateUpdating, StateRetiring},
@@ -130,6 +139,16 @@ func IsValidLabelValue(value string) bool {
 	return reValidLabelVal.MatchString(value)
 }
 
+// NormalizeMACAddress parses a MAC address and returns it in the canonical
+// form used by sabakan, i.e. lower-case hexadecimal digits separated by colons.
+func NormalizeMACAddress(mac string) (string, error) {
+	hw, err := net.ParseMAC(mac)
+	if err != nil {
+		return "", err
+	}
+	return hw.String(), nil
+}
+
 // MachineBMC is a bmc interface struct for Machine
 type MachineBMC struct {
 	IPv4 string `json:"ipv4"`
@@ -146,6 +165,7 @@ type MachineSpec struct {
 	Role         string            `json:"role"`
 	IPv4         []string          `json:"ipv4"`
 	IPv6         []string          `json:"ipv6"`
+	MACAddresses []string          `json:"mac-addresses,omitempty"`
 	RegisterDate time.Time         `json:"register-date"`
 	RetireDate   time.Time         `json:"retire-date"`
 	BMC          MachineBMC        `json:"bmc"`
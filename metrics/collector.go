@@ -49,6 +49,14 @@ func NewCollector(model *sabakan.Model) *Collector {
 				collectors: []prometheus.Collector{APIRequestTotal},
 				updater:    updateNop,
 			},
+			"dhcp_policy_dropped_count": {
+				collectors: []prometheus.Collector{DHCPPolicyDroppedTotal},
+				updater:    updateNop,
+			},
+			"boot_loop": {
+				collectors: []prometheus.Collector{BootLoopQuarantined, BootLoopDetectedTotal},
+				updater:    updateBootLoopMetrics,
+			},
 			"assets_total": {
 				collectors: []prometheus.Collector{AssetsBytesTotal, AssetsItemsTotal},
 				updater:    updateAssetMetrics,
@@ -141,6 +149,23 @@ func updateMachineStatus(ctx context.Context, model *sabakan.Model) error {
 	return nil
 }
 
+func updateBootLoopMetrics(ctx context.Context, model *sabakan.Model) error {
+	machines, err := model.Machine.Query(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	var quarantined int
+	for _, m := range machines {
+		if _, ok := m.Spec.Labels[sabakan.LabelBootLoop]; ok {
+			quarantined++
+		}
+	}
+	BootLoopQuarantined.Set(float64(quarantined))
+
+	return nil
+}
+
 func updateAssetMetrics(ctx context.Context, model *sabakan.Model) error {
 	assets, err := model.Asset.GetInfoAll(ctx)
 	if err != nil {
@@ -242,6 +242,12 @@ func testAssetsMetrics(t *testing.T) {
 			expectedName:  "sabakan_images_items_total",
 			expectedValue: 3,
 		},
+		{
+			name:          "get the number of quarantined machines",
+			input:         quarantinedMachine,
+			expectedName:  "sabakan_boot_loop_quarantined",
+			expectedValue: 1,
+		},
 	}
 
 	for _, tt := range testCases {
@@ -313,6 +319,15 @@ func twoMachines() (*sabakan.Model, error) {
 	return &model, err
 }
 
+func quarantinedMachine() (*sabakan.Model, error) {
+	model, err := twoMachines()
+	if err != nil {
+		return nil, err
+	}
+	err = model.Machine.PutLabel(context.Background(), "002", sabakan.LabelBootLoop, "20261019T000000Z")
+	return model, err
+}
+
 func twoAssets() (*sabakan.Model, error) {
 	model := mock.NewModel()
 
@@ -57,3 +57,31 @@ var ImagesItemsTotal = prometheus.NewGauge(
 		Help:      "The total items of Images.",
 	},
 )
+
+// DHCPPolicyDroppedTotal returns the total count of DHCP packets dropped by policy
+var DHCPPolicyDroppedTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "dhcp_policy_dropped_count",
+		Help:      "The total count of DHCP packets dropped by policy.",
+	},
+	[]string{"reason"},
+)
+
+// BootLoopQuarantined returns the number of machines quarantined by the boot loop detection
+var BootLoopQuarantined = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "boot_loop_quarantined",
+		Help:      "The number of machines quarantined by the boot loop detection.",
+	},
+)
+
+// BootLoopDetectedTotal returns the total count of detected boot loops
+var BootLoopDetectedTotal = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "boot_loop_detected_count",
+		Help:      "The total count of detected boot loops.",
+	},
+)
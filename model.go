@@ -29,6 +29,26 @@ type StorageModel interface {
 	GetEncryptionKey(ctx context.Context, serial string, diskByPath string) ([]byte, error)
 	PutEncryptionKey(ctx context.Context, serial string, diskByPath string, key []byte) error
 	DeleteEncryptionKeys(ctx context.Context, serial string) ([]string, error)
+
+	// ListEncryptionKeys returns the meta data of keys of the machine.
+	// If serial is empty, this returns keys of all machines.
+	// This returns ErrNotFound if the machine is not found.
+	ListEncryptionKeys(ctx context.Context, serial string) ([]*EncryptionKeyInfo, error)
+}
+
+// CryptPolicyModel is an interface for disk encryption policies.
+//
+// kind is either CryptPolicyRole or CryptPolicyMachine, and name is
+// the role or the serial of the machine.
+type CryptPolicyModel interface {
+	Put(ctx context.Context, kind, name string, policy *CryptPolicy) error
+	Get(ctx context.Context, kind, name string) (*CryptPolicy, error)
+	Delete(ctx context.Context, kind, name string) error
+
+	// Resolve returns the policy applied to the machine.
+	// The policy for the machine takes precedence over the one for its role.
+	// This returns ErrNotFound if the machine or the policy is not found.
+	Resolve(ctx context.Context, serial string) (*CryptPolicy, error)
 }
 
 // MachineModel is an interface for machine database.
@@ -57,6 +77,10 @@ type DHCPModel interface {
 	Renew(ctx context.Context, ciaddr net.IP, mac net.HardwareAddr) error
 	Release(ctx context.Context, ciaddr net.IP, mac net.HardwareAddr) error
 	Decline(ctx context.Context, ciaddr net.IP, mac net.HardwareAddr) error
+
+	// LeaseOwner returns the MAC address of the client leasing ip.
+	// If ip is not leased, this returns ErrNotFound.
+	LeaseOwner(ctx context.Context, ip net.IP) (net.HardwareAddr, error)
 }
 
 // ImageModel is an interface to manage boot images.
@@ -74,7 +98,7 @@ type ImageModel interface {
 		f func(modtime time.Time, content io.ReadSeeker)) error
 }
 
-// AssetHandler is an interface for AssetModel.Get
+// AssetHandler is an interface for AssetModel.Get and AssetModel.GetVersion
 type AssetHandler interface {
 	ServeContent(asset *Asset, content io.ReadSeeker)
 	Redirect(url string)
@@ -88,6 +112,14 @@ type AssetModel interface {
 	Put(ctx context.Context, name, contentType string, csum []byte, options map[string]string, r io.Reader) (*AssetStatus, error)
 	Get(ctx context.Context, name string, h AssetHandler) error
 	Delete(ctx context.Context, name string) error
+
+	// GetVersion serves the content of a version of an asset.
+	// id may be the current or a previous version.
+	GetVersion(ctx context.Context, name string, id int, h AssetHandler) error
+
+	// Rollback atomically makes a previous version of an asset current.
+	// This returns ErrNotFound if the asset or the version does not exist.
+	Rollback(ctx context.Context, name string, id int) error
 }
 
 // IgnitionModel is an interface for ignition template.
@@ -101,6 +133,16 @@ type IgnitionModel interface {
 // LogModel is an interface for audit logs.
 type LogModel interface {
 	Dump(ctx context.Context, since, until time.Time, w io.Writer) error
+
+	// Query writes logs matching q in JSONLines.
+	Query(ctx context.Context, q *LogQuery, w io.Writer) error
+
+	// Chain returns the state of the hash chain of audit logs.
+	Chain(ctx context.Context) (*AuditChain, error)
+
+	// Record adds an audit log entry for an event that does not update
+	// any resources, such as denied requests.
+	Record(ctx context.Context, cat AuditCategory, instance, action, detail string) error
 }
 
 // KernelParamsModel is an interface for kernel parameters.
@@ -109,6 +151,22 @@ type KernelParamsModel interface {
 	GetParams(ctx context.Context, os string) (string, error)
 }
 
+// SwitchModel is an interface for network switches provisioned by ONIE or ZTP.
+type SwitchModel interface {
+	Put(ctx context.Context, sw *Switch) error
+	Get(ctx context.Context, mac string) (*Switch, error)
+	GetAll(ctx context.Context) ([]*Switch, error)
+	Delete(ctx context.Context, mac string) error
+}
+
+// WebhookModel is an interface for webhook subscriptions to audit logs.
+type WebhookModel interface {
+	Put(ctx context.Context, hook *Webhook) error
+	Get(ctx context.Context, name string) (*Webhook, error)
+	GetAll(ctx context.Context) ([]*Webhook, error)
+	Delete(ctx context.Context, name string) error
+}
+
 // HealthModel is an interface for etcd health status
 type HealthModel interface {
 	GetHealth(ctx context.Context) error
@@ -120,6 +178,26 @@ type SchemaModel interface {
 	Upgrade(ctx context.Context) error
 }
 
+// BackupModel is an interface to back up and restore the state.
+type BackupModel interface {
+	// Dump returns a consistent snapshot of the state including
+	// disk encryption keys in plain.
+	Dump(ctx context.Context) (*BackupState, error)
+
+	// Load imports the state into an empty model.
+	// Assets and images are not imported by Load; their contents need
+	// to be uploaded through AssetModel and ImageModel.
+	// This returns ErrConflicted if the model is not empty.
+	Load(ctx context.Context, state *BackupState) error
+
+	// Unload removes the state imported by Load and the images in state
+	// so that a failed restore can be retried.
+	// Images are removed from the indices without being recorded as
+	// deleted because deleted images cannot be uploaded again.
+	// Assets need to be deleted through AssetModel.
+	Unload(ctx context.Context, state *BackupState) error
+}
+
 // Runner is an interface to run the underlying goroutines.
 //
 // The caller must pass a channel as follows.
@@ -139,6 +217,7 @@ type Runner interface {
 type Model struct {
 	Runner
 	Storage      StorageModel
+	CryptPolicy  CryptPolicyModel
 	Machine      MachineModel
 	IPAM         IPAMModel
 	DHCP         DHCPModel
@@ -147,6 +226,9 @@ type Model struct {
 	Ignition     IgnitionModel
 	Log          LogModel
 	KernelParams KernelParamsModel
+	Switch       SwitchModel
+	Webhook      WebhookModel
 	Health       HealthModel
 	Schema       SchemaModel
+	Backup       BackupModel
 }
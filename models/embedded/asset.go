@@ -0,0 +1,306 @@
+package embedded
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/cybozu-go/sabakan/v3"
+	"github.com/cybozu-go/sabakan/v3/models/etcd"
+)
+
+func (d *driver) getAssetDir() etcd.AssetDir {
+	return etcd.AssetDir{
+		Dir: filepath.Join(d.dataDir, "assets"),
+	}
+}
+
+func decodeAsset(data []byte) (*sabakan.Asset, error) {
+	a := new(sabakan.Asset)
+	err := json.Unmarshal(data, a)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (t *txn) getAsset(name string) (*sabakan.Asset, error) {
+	data := t.get(KeyAssets + name)
+	if data == nil {
+		return nil, sabakan.ErrNotFound
+	}
+	return decodeAsset(data)
+}
+
+func (d *driver) assetNewID(ctx context.Context) (int, error) {
+	var id int
+	err := d.update(ctx, func(t *txn) error {
+		if data := t.get(KeyAssetsID); data != nil {
+			var err error
+			id, err = strconv.Atoi(string(data))
+			if err != nil {
+				return err
+			}
+		}
+		id++
+		return t.put(KeyAssetsID, []byte(strconv.Itoa(id)))
+	})
+	return id, err
+}
+
+func (d *driver) assetGetIndex(ctx context.Context) ([]string, error) {
+	ret := []string{}
+	err := d.view(ctx, func(t *txn) error {
+		return t.scan(KeyAssets, func(key string, _ []byte) error {
+			ret = append(ret, key[len(KeyAssets):])
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (d *driver) assetGetInfoAll(ctx context.Context) ([]*sabakan.Asset, error) {
+	var assets []*sabakan.Asset
+	err := d.view(ctx, func(t *txn) error {
+		return t.scan(KeyAssets, func(_ string, value []byte) error {
+			a, err := decodeAsset(value)
+			if err != nil {
+				return err
+			}
+			assets = append(assets, a)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	dir := d.getAssetDir()
+	for _, a := range assets {
+		a.Exists = dir.Exists(a.ID)
+	}
+	return assets, nil
+}
+
+func (d *driver) assetGetInfo(ctx context.Context, name string) (*sabakan.Asset, error) {
+	var a *sabakan.Asset
+	err := d.view(ctx, func(t *txn) error {
+		var err error
+		a, err = t.getAsset(name)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	a.Exists = d.getAssetDir().Exists(a.ID)
+	return a, nil
+}
+
+func (d *driver) assetPut(ctx context.Context, name, contentType string,
+	csum []byte, options map[string]string, r io.Reader) (*sabakan.AssetStatus, error) {
+	id, err := d.assetNewID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := d.getAssetDir()
+	hsum, err := dir.Save(id, r, csum)
+	if err != nil {
+		return nil, err
+	}
+	size, err := dir.Size(id)
+	if err != nil {
+		dir.Remove(id)
+		return nil, err
+	}
+
+	hsumString := hex.EncodeToString(hsum)
+	a := &sabakan.Asset{
+		Name:        name,
+		ID:          id,
+		ContentType: contentType,
+		Date:        time.Now().UTC(),
+		Size:        size,
+		Sha256:      hsumString,
+		Uploader:    sabakan.AuditUser(ctx),
+		Options:     options,
+		URLs:        []string{d.myURL("/api/v1/assets", name)},
+	}
+
+	retStatus := http.StatusCreated
+	var dels []int
+	err = d.update(ctx, func(t *txn) error {
+		prev, err := t.getAsset(name)
+		switch err {
+		case nil:
+			retStatus = http.StatusOK
+			dels = a.AppendHistory(prev)
+		case sabakan.ErrNotFound:
+		default:
+			return err
+		}
+
+		err = t.putJSON(KeyAssets+name, a)
+		if err != nil {
+			return err
+		}
+		return t.addLog(time.Now(), sabakan.AuditAssets, name, "put", "new checksum: "+hsumString)
+	})
+	if err != nil {
+		dir.Remove(id)
+		return nil, err
+	}
+
+	for _, id := range dels {
+		dir.Remove(id)
+	}
+
+	return &sabakan.AssetStatus{
+		Status: retStatus,
+		ID:     id,
+	}, nil
+}
+
+func (d *driver) assetGet(ctx context.Context, name string, h sabakan.AssetHandler) error {
+	var a *sabakan.Asset
+	err := d.view(ctx, func(t *txn) error {
+		var err error
+		a, err = t.getAsset(name)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	g, err := os.Open(d.getAssetDir().Path(a.ID))
+	if os.IsNotExist(err) {
+		return sabakan.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	defer g.Close()
+
+	h.ServeContent(a, g)
+	return nil
+}
+
+func (d *driver) assetDelete(ctx context.Context, name string) error {
+	var a *sabakan.Asset
+	err := d.update(ctx, func(t *txn) error {
+		var err error
+		a, err = t.getAsset(name)
+		if err != nil {
+			return err
+		}
+
+		_, err = t.delete(KeyAssets + name)
+		if err != nil {
+			return err
+		}
+		return t.addLog(time.Now(), sabakan.AuditAssets, name, "delete", "")
+	})
+	if err != nil {
+		return err
+	}
+
+	dir := d.getAssetDir()
+	for _, id := range a.IDs() {
+		dir.Remove(id)
+	}
+	return nil
+}
+
+func (d *driver) assetGetVersion(ctx context.Context, name string, id int, h sabakan.AssetHandler) error {
+	var a *sabakan.Asset
+	err := d.view(ctx, func(t *txn) error {
+		var err error
+		a, err = t.getAsset(name)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	v := a.Version(id)
+	if v == nil {
+		return sabakan.ErrNotFound
+	}
+
+	g, err := os.Open(d.getAssetDir().Path(id))
+	if os.IsNotExist(err) {
+		return sabakan.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	defer g.Close()
+
+	h.ServeContent(v, g)
+	return nil
+}
+
+func (d *driver) assetRollback(ctx context.Context, name string, id int) error {
+	return d.update(ctx, func(t *txn) error {
+		a, err := t.getAsset(name)
+		if err != nil {
+			return err
+		}
+		err = a.Rollback(id, time.Now())
+		if err != nil {
+			return err
+		}
+
+		err = t.putJSON(KeyAssets+name, a)
+		if err != nil {
+			return err
+		}
+		return t.addLog(time.Now(), sabakan.AuditAssets, name, "rollback", "new checksum: "+a.Sha256)
+	})
+}
+
+type assetDriver struct {
+	*driver
+}
+
+func (d assetDriver) GetIndex(ctx context.Context) ([]string, error) {
+	return d.assetGetIndex(ctx)
+}
+
+func (d assetDriver) GetInfo(ctx context.Context, name string) (*sabakan.Asset, error) {
+	return d.assetGetInfo(ctx, name)
+}
+
+func (d assetDriver) GetInfoAll(ctx context.Context) ([]*sabakan.Asset, error) {
+	return d.assetGetInfoAll(ctx)
+}
+
+func (d assetDriver) Put(ctx context.Context, name, contentType string,
+	csum []byte, options map[string]string, r io.Reader) (*sabakan.AssetStatus, error) {
+	return d.assetPut(ctx, name, contentType, csum, options, r)
+}
+
+func (d assetDriver) Get(ctx context.Context, name string, h sabakan.AssetHandler) error {
+	return d.assetGet(ctx, name, h)
+}
+
+func (d assetDriver) Delete(ctx context.Context, name string) error {
+	return d.assetDelete(ctx, name)
+}
+
+func (d assetDriver) GetVersion(ctx context.Context, name string, id int, h sabakan.AssetHandler) error {
+	return d.assetGetVersion(ctx, name, id, h)
+}
+
+func (d assetDriver) Rollback(ctx context.Context, name string, id int) error {
+	return d.assetRollback(ctx, name, id)
+}
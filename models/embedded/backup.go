@@ -0,0 +1,347 @@
+package embedded
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+func (d *driver) backupDump(ctx context.Context) (*sabakan.BackupState, error) {
+	state := &sabakan.BackupState{
+		KernelParams: make(map[string]string),
+		Ignitions:    make(map[string]map[string]*sabakan.IgnitionTemplate),
+		Images:       make(map[string]sabakan.ImageIndex),
+	}
+
+	err := d.view(ctx, func(t *txn) error {
+		ipam := new(sabakan.IPAMConfig)
+		found, err := t.getJSON(KeyIPAM, ipam)
+		if err != nil {
+			return err
+		}
+		if found {
+			state.IPAM = ipam
+		}
+		dhcp := new(sabakan.DHCPConfig)
+		found, err = t.getJSON(KeyDHCP, dhcp)
+		if err != nil {
+			return err
+		}
+		if found {
+			state.DHCP = dhcp
+		}
+
+		err = t.scan(KeyMachines, func(_ string, value []byte) error {
+			m := new(sabakan.Machine)
+			err := json.Unmarshal(value, m)
+			if err != nil {
+				return err
+			}
+			state.Machines = append(state.Machines, m)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		err = t.scan(KeyCrypts, func(key string, value []byte) error {
+			name := key[len(KeyCrypts):]
+			fields := strings.SplitN(name, "/", 2)
+			if len(fields) != 2 {
+				return nil
+			}
+			var meta cryptMeta
+			_, err := t.getJSON(KeyCryptsMeta+name, &meta)
+			if err != nil {
+				return err
+			}
+			state.CryptKeys = append(state.CryptKeys, &sabakan.BackupCryptKey{
+				Serial:    fields[0],
+				Path:      fields[1],
+				Key:       append([]byte(nil), value...),
+				CreatedAt: meta.CreatedAt,
+			})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		err = t.scan(KeyCryptPolicies, func(key string, value []byte) error {
+			fields := strings.SplitN(key[len(KeyCryptPolicies):], "/", 2)
+			if len(fields) != 2 {
+				return nil
+			}
+			policy := new(sabakan.CryptPolicy)
+			err := json.Unmarshal(value, policy)
+			if err != nil {
+				return err
+			}
+			state.CryptPolicies = append(state.CryptPolicies, &sabakan.BackupCryptPolicy{
+				Kind:   fields[0],
+				Name:   fields[1],
+				Policy: policy,
+			})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		err = t.scan(KeyKernelParams, func(key string, value []byte) error {
+			state.KernelParams[key[len(KeyKernelParams):]] = string(value)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		err = t.scan(KeyIgnitions, func(key string, value []byte) error {
+			fields := strings.SplitN(key[len(KeyIgnitions):], "/", 2)
+			if len(fields) != 2 {
+				return nil
+			}
+			tmpl := new(sabakan.IgnitionTemplate)
+			err := json.Unmarshal(value, tmpl)
+			if err != nil {
+				return err
+			}
+			templates := state.Ignitions[fields[0]]
+			if templates == nil {
+				templates = make(map[string]*sabakan.IgnitionTemplate)
+				state.Ignitions[fields[0]] = templates
+			}
+			templates[fields[1]] = tmpl
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		err = t.scan(KeySwitches, func(_ string, value []byte) error {
+			sw := new(sabakan.Switch)
+			err := json.Unmarshal(value, sw)
+			if err != nil {
+				return err
+			}
+			state.Switches = append(state.Switches, sw)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		err = t.scan(KeyAssets, func(_ string, value []byte) error {
+			a, err := decodeAsset(value)
+			if err != nil {
+				return err
+			}
+			state.Assets = append(state.Assets, a)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		return t.scan(KeyImages, func(key string, value []byte) error {
+			os, index, err := decodeImageIndex(key, value)
+			if err != nil || len(index) == 0 {
+				return err
+			}
+			state.Images[os] = index
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// isEmpty returns true if nothing restored by backupLoad exists.
+func (t *txn) isEmpty() (bool, error) {
+	if t.get(KeyIPAM) != nil || t.get(KeyDHCP) != nil {
+		return false, nil
+	}
+	for _, prefix := range []string{
+		KeyMachines, KeyCrypts, KeyCryptPolicies, KeyKernelParams,
+		KeyIgnitions, KeySwitches, KeyAssets,
+	} {
+		if t.hasPrefix(prefix) {
+			return false, nil
+		}
+	}
+
+	empty := true
+	err := t.scan(KeyImages, func(key string, value []byte) error {
+		_, index, err := decodeImageIndex(key, value)
+		if len(index) > 0 {
+			empty = false
+		}
+		return err
+	})
+	return empty, err
+}
+
+func (d *driver) backupLoad(ctx context.Context, state *sabakan.BackupState) error {
+	return d.update(ctx, func(t *txn) error {
+		empty, err := t.isEmpty()
+		if err != nil {
+			return err
+		}
+		if !empty {
+			return sabakan.ErrConflicted
+		}
+
+		if state.IPAM != nil {
+			err := t.putJSON(KeyIPAM, state.IPAM)
+			if err != nil {
+				return err
+			}
+		}
+		if state.DHCP != nil {
+			err := t.putJSON(KeyDHCP, state.DHCP)
+			if err != nil {
+				return err
+			}
+		}
+		for _, m := range state.Machines {
+			err := t.putJSON(KeyMachines+m.Spec.Serial, m)
+			if err != nil {
+				return err
+			}
+		}
+		for _, k := range state.CryptKeys {
+			err := t.put(path.Join(KeyCrypts, k.Serial, k.Path), k.Key)
+			if err != nil {
+				return err
+			}
+			err = t.putJSON(path.Join(KeyCryptsMeta, k.Serial, k.Path),
+				cryptMeta{CreatedAt: k.CreatedAt, Revision: t.rev})
+			if err != nil {
+				return err
+			}
+		}
+		for _, p := range state.CryptPolicies {
+			err := t.putJSON(cryptPolicyKey(p.Kind, p.Name), p.Policy)
+			if err != nil {
+				return err
+			}
+		}
+		for os, params := range state.KernelParams {
+			err := t.put(path.Join(KeyKernelParams, os), []byte(params))
+			if err != nil {
+				return err
+			}
+		}
+		for role, templates := range state.Ignitions {
+			for id, tmpl := range templates {
+				err := t.putJSON(keyIgnitionRolePrefix(role)+id, tmpl)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		for _, sw := range state.Switches {
+			err := t.putJSON(KeySwitches+sw.MAC, sw)
+			if err != nil {
+				return err
+			}
+		}
+
+		return t.addLog(time.Now(), sabakan.AuditBackup, "", "restore",
+			fmt.Sprintf("%d machines, %d keys", len(state.Machines), len(state.CryptKeys)))
+	})
+}
+
+func (d *driver) backupUnload(ctx context.Context, state *sabakan.BackupState) error {
+	err := d.update(ctx, func(t *txn) error {
+		keys := []string{KeyIPAM, KeyDHCP}
+		for _, m := range state.Machines {
+			keys = append(keys, KeyMachines+m.Spec.Serial)
+		}
+		for _, k := range state.CryptKeys {
+			keys = append(keys, path.Join(KeyCrypts, k.Serial, k.Path), path.Join(KeyCryptsMeta, k.Serial, k.Path))
+		}
+		for _, p := range state.CryptPolicies {
+			keys = append(keys, cryptPolicyKey(p.Kind, p.Name))
+		}
+		for os := range state.KernelParams {
+			keys = append(keys, path.Join(KeyKernelParams, os))
+		}
+		for role, templates := range state.Ignitions {
+			for id := range templates {
+				keys = append(keys, keyIgnitionRolePrefix(role)+id)
+			}
+		}
+		for _, sw := range state.Switches {
+			keys = append(keys, KeySwitches+sw.MAC)
+		}
+		for _, key := range keys {
+			_, err := t.delete(key)
+			if err != nil {
+				return err
+			}
+		}
+
+		for os, restored := range state.Images {
+			index, err := t.getImageIndex(os)
+			if err != nil {
+				return err
+			}
+			deleted, err := t.getImageDeleted(os)
+			if err != nil {
+				return err
+			}
+			for _, img := range restored {
+				index = index.Remove(img.ID)
+			}
+			err = t.putImageIndex(os, index, deleted)
+			if err != nil {
+				return err
+			}
+		}
+
+		return t.addLog(time.Now(), sabakan.AuditBackup, "", "unload",
+			fmt.Sprintf("%d machines, %d keys", len(state.Machines), len(state.CryptKeys)))
+	})
+	if err != nil {
+		return err
+	}
+
+	for os, restored := range state.Images {
+		ids := make([]string, len(restored))
+		for i, img := range restored {
+			ids[i] = img.ID
+		}
+		err = d.getImageDir(os).GC(ids)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type backupDriver struct {
+	*driver
+}
+
+// Dump implements sabakan.BackupModel
+func (d backupDriver) Dump(ctx context.Context) (*sabakan.BackupState, error) {
+	return d.backupDump(ctx)
+}
+
+// Load implements sabakan.BackupModel
+func (d backupDriver) Load(ctx context.Context, state *sabakan.BackupState) error {
+	return d.backupLoad(ctx, state)
+}
+
+// Unload implements sabakan.BackupModel
+func (d backupDriver) Unload(ctx context.Context, state *sabakan.BackupState) error {
+	return d.backupUnload(ctx, state)
+}
@@ -0,0 +1,53 @@
+package embedded
+
+import "time"
+
+// Keys in the bucket.  They are the same as the etcd schema
+// except for those used only for coordination between servers.
+const (
+	KeyVersion          = "version"
+	KeyCrypts           = "crypts/"
+	KeyCryptsMeta       = "crypts-meta/"
+	KeyCryptPolicies    = "crypt-policies/"
+	KeyDHCP             = "dhcp"
+	KeyIPAM             = "ipam"
+	KeyLeaseUsages      = "lease-usages/"
+	KeyMachines         = "machines/"
+	KeyImages           = "images/"
+	KeyAssets           = "assets/"
+	KeyAssetsID         = "assets"
+	KeyIgnitions        = "ignitions/"
+	KeyAudit            = "audit/"
+	KeyAuditLastGC      = "audit"
+	KeyAuditHead        = "audit-head"
+	KeyAuditCheckpoints = "audit-checkpoints/"
+	KeyKernelParams     = "kernel-params/"
+	KeySwitches         = "switches/"
+	KeyWebhooks         = "webhooks/"
+	KeyWebhookCursors   = "webhook-cursors/"
+)
+
+// DBFile is the filename of the database in the data directory.
+const DBFile = "sabakan.db"
+
+// MaxDeleted is the maximum number of deleted image IDs stored in the database.
+const MaxDeleted = 10
+
+// MaxIgnitions is a number of the ignition templates to keep.
+const MaxIgnitions = 10
+
+// Log parameters
+const (
+	defaultLogRetentionDays = 60
+	logCompactionTick       = 1 * time.Hour
+	logCompactionInterval   = 23 * time.Hour
+	logCheckpointInterval   = 1 * time.Hour
+)
+
+// Webhook parameters
+const (
+	webhookInterval   = 5 * time.Second
+	webhookTimeout    = 30 * time.Second
+	webhookMinBackoff = 5 * time.Second
+	webhookMaxBackoff = 10 * time.Minute
+)
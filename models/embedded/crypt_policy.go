@@ -0,0 +1,105 @@
+package embedded
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"time"
+
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+func cryptPolicyKey(kind, name string) string {
+	return path.Join(KeyCryptPolicies, kind, name)
+}
+
+func (t *txn) getCryptPolicy(kind, name string) (*sabakan.CryptPolicy, error) {
+	policy := new(sabakan.CryptPolicy)
+	found, err := t.getJSON(cryptPolicyKey(kind, name), policy)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, sabakan.ErrNotFound
+	}
+	return policy, nil
+}
+
+func (d *driver) cryptPolicyPut(ctx context.Context, kind, name string, policy *sabakan.CryptPolicy) error {
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+
+	return d.update(ctx, func(t *txn) error {
+		err := t.put(cryptPolicyKey(kind, name), data)
+		if err != nil {
+			return err
+		}
+		return t.addLog(time.Now(), sabakan.AuditCryptPolicy, path.Join(kind, name), "put", string(data))
+	})
+}
+
+func (d *driver) cryptPolicyGet(ctx context.Context, kind, name string) (*sabakan.CryptPolicy, error) {
+	var policy *sabakan.CryptPolicy
+	err := d.view(ctx, func(t *txn) error {
+		var err error
+		policy, err = t.getCryptPolicy(kind, name)
+		return err
+	})
+	return policy, err
+}
+
+func (d *driver) cryptPolicyDelete(ctx context.Context, kind, name string) error {
+	return d.update(ctx, func(t *txn) error {
+		deleted, err := t.delete(cryptPolicyKey(kind, name))
+		if err != nil {
+			return err
+		}
+		if !deleted {
+			return sabakan.ErrNotFound
+		}
+		return t.addLog(time.Now(), sabakan.AuditCryptPolicy, path.Join(kind, name), "delete", "")
+	})
+}
+
+func (d *driver) cryptPolicyResolve(ctx context.Context, serial string) (*sabakan.CryptPolicy, error) {
+	var policy *sabakan.CryptPolicy
+	err := d.view(ctx, func(t *txn) error {
+		m, err := t.getMachine(serial)
+		if err != nil {
+			return err
+		}
+
+		policy, err = t.getCryptPolicy(sabakan.CryptPolicyMachine, serial)
+		if err != sabakan.ErrNotFound {
+			return err
+		}
+		policy, err = t.getCryptPolicy(sabakan.CryptPolicyRole, m.Spec.Role)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+type cryptPolicyDriver struct {
+	*driver
+}
+
+func (d cryptPolicyDriver) Put(ctx context.Context, kind, name string, policy *sabakan.CryptPolicy) error {
+	return d.cryptPolicyPut(ctx, kind, name, policy)
+}
+
+func (d cryptPolicyDriver) Get(ctx context.Context, kind, name string) (*sabakan.CryptPolicy, error) {
+	return d.cryptPolicyGet(ctx, kind, name)
+}
+
+func (d cryptPolicyDriver) Delete(ctx context.Context, kind, name string) error {
+	return d.cryptPolicyDelete(ctx, kind, name)
+}
+
+func (d cryptPolicyDriver) Resolve(ctx context.Context, serial string) (*sabakan.CryptPolicy, error) {
+	return d.cryptPolicyResolve(ctx, serial)
+}
@@ -0,0 +1,288 @@
+package embedded
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"path"
+	"time"
+
+	"github.com/cybozu-go/log"
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+func (t *txn) getDHCPConfig() (*sabakan.DHCPConfig, error) {
+	config := new(sabakan.DHCPConfig)
+	found, err := t.getJSON(KeyDHCP, config)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errors.New("DHCPConfig is not set")
+	}
+	return config, nil
+}
+
+func (d *driver) putDHCPConfig(ctx context.Context, config *sabakan.DHCPConfig) error {
+	j, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	return d.update(ctx, func(t *txn) error {
+		err := t.put(KeyDHCP, j)
+		if err != nil {
+			return err
+		}
+		return t.addLog(time.Now(), sabakan.AuditDHCP, "config", "put", string(j))
+	})
+}
+
+func (d *driver) getDHCPConfig() (*sabakan.DHCPConfig, error) {
+	var config *sabakan.DHCPConfig
+	err := d.view(context.Background(), func(t *txn) error {
+		var err error
+		config, err = t.getDHCPConfig()
+		return err
+	})
+	return config, err
+}
+
+// leaseInfo is the same as the one in the etcd driver.
+type leaseInfo struct {
+	Index      int       `json:"index"`
+	LeaseUntil time.Time `json:"lease"`
+}
+
+// leaseUsage maps MAC addresses to leases in a lease range.
+type leaseUsage map[string]leaseInfo
+
+func leaseUsageKey(lrkey string) string {
+	return path.Join(KeyLeaseUsages, lrkey)
+}
+
+func (t *txn) getLeaseUsage(lrkey string) (leaseUsage, error) {
+	lu := make(leaseUsage)
+	_, err := t.getJSON(leaseUsageKey(lrkey), &lu)
+	if err != nil {
+		return nil, err
+	}
+	if lu == nil {
+		lu = make(leaseUsage)
+	}
+	return lu, nil
+}
+
+func (t *txn) putLeaseUsage(lrkey string, lu leaseUsage) error {
+	return t.putJSON(leaseUsageKey(lrkey), lu)
+}
+
+func (lu leaseUsage) gc() {
+	now := time.Now()
+	for k, v := range lu {
+		if v.LeaseUntil.Before(now) {
+			delete(lu, k)
+		}
+	}
+}
+
+func (lu leaseUsage) lease(mac net.HardwareAddr, lr *sabakan.LeaseRange, du time.Duration) (net.IP, error) {
+	hwAddr := mac.String()
+	leaseUntil := time.Now().Add(du)
+	if v, ok := lu[hwAddr]; ok {
+		v.LeaseUntil = leaseUntil
+		lu[hwAddr] = v
+		return lr.IP(v.Index), nil
+	}
+
+	lu.gc()
+
+	used := make(map[int]bool)
+	for _, v := range lu {
+		used[v.Index] = true
+	}
+
+	for i := 0; i < lr.Count; i++ {
+		if used[i] {
+			continue
+		}
+		lu[hwAddr] = leaseInfo{i, leaseUntil}
+		log.Debug("embedded/dhcp: lease", map[string]interface{}{
+			"node_index":  i,
+			"mac":         hwAddr,
+			"ip":          lr.IP(i),
+			"lease_until": leaseUntil,
+		})
+		return lr.IP(i), nil
+	}
+
+	return nil, errors.New("no leasable IP address found from " + lr.Key())
+}
+
+func (lu leaseUsage) renew(mac net.HardwareAddr, du time.Duration) error {
+	hwAddr := mac.String()
+	v, ok := lu[hwAddr]
+	if !ok {
+		return errors.New("not leased for " + hwAddr)
+	}
+
+	v.LeaseUntil = time.Now().Add(du)
+	lu[hwAddr] = v
+	return nil
+}
+
+func (lu leaseUsage) release(mac net.HardwareAddr) {
+	delete(lu, mac.String())
+}
+
+func (lu leaseUsage) decline(mac net.HardwareAddr) {
+	hwAddr := mac.String()
+	v, ok := lu[hwAddr]
+	if !ok {
+		return
+	}
+
+	// keep the address unavailable until the lease expires
+	lu[generateDummyMAC(v.Index).String()] = v
+	delete(lu, hwAddr)
+}
+
+func generateDummyMAC(idx int) net.HardwareAddr {
+	return net.HardwareAddr{
+		0xff,
+		0,
+		byte((idx / 256 / 256 / 256) % 256),
+		byte((idx / 256 / 256) % 256),
+		byte((idx / 256) % 256),
+		byte(idx % 256),
+	}
+}
+
+// updateLease calls fn with the lease usage of the range that ip belongs to.
+func (d *driver) updateLease(ctx context.Context, ip net.IP, fn func(lu leaseUsage, lr *sabakan.LeaseRange, dc *sabakan.DHCPConfig) error) error {
+	return d.update(ctx, func(t *txn) error {
+		ipam, err := t.getIPAMConfig()
+		if err != nil {
+			return err
+		}
+		dc, err := t.getDHCPConfig()
+		if err != nil {
+			return err
+		}
+
+		lr := ipam.LeaseRange(ip)
+		if lr == nil {
+			return errors.New("invalid address: " + ip.String())
+		}
+
+		lu, err := t.getLeaseUsage(lr.Key())
+		if err != nil {
+			return err
+		}
+		err = fn(lu, lr, dc)
+		if err != nil {
+			return err
+		}
+		return t.putLeaseUsage(lr.Key(), lu)
+	})
+}
+
+func (d *driver) dhcpLease(ctx context.Context, ifaddr net.IP, mac net.HardwareAddr) (net.IP, error) {
+	var ip net.IP
+	err := d.updateLease(ctx, ifaddr, func(lu leaseUsage, lr *sabakan.LeaseRange, dc *sabakan.DHCPConfig) error {
+		var err error
+		ip, err = lu.lease(mac, lr, dc.LeaseDuration())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ip, nil
+}
+
+func (d *driver) dhcpRenew(ctx context.Context, ciaddr net.IP, mac net.HardwareAddr) error {
+	return d.updateLease(ctx, ciaddr, func(lu leaseUsage, lr *sabakan.LeaseRange, dc *sabakan.DHCPConfig) error {
+		return lu.renew(mac, dc.LeaseDuration())
+	})
+}
+
+func (d *driver) dhcpRelease(ctx context.Context, ciaddr net.IP, mac net.HardwareAddr) error {
+	return d.updateLease(ctx, ciaddr, func(lu leaseUsage, lr *sabakan.LeaseRange, dc *sabakan.DHCPConfig) error {
+		lu.release(mac)
+		return nil
+	})
+}
+
+func (d *driver) dhcpDecline(ctx context.Context, ciaddr net.IP, mac net.HardwareAddr) error {
+	return d.updateLease(ctx, ciaddr, func(lu leaseUsage, lr *sabakan.LeaseRange, dc *sabakan.DHCPConfig) error {
+		lu.decline(mac)
+		return nil
+	})
+}
+
+func (d *driver) dhcpLeaseOwner(ctx context.Context, ip net.IP) (net.HardwareAddr, error) {
+	var owner net.HardwareAddr
+	err := d.view(ctx, func(t *txn) error {
+		ipam, err := t.getIPAMConfig()
+		if err != nil {
+			return err
+		}
+
+		lr := ipam.LeaseRange(ip)
+		if lr == nil {
+			return sabakan.ErrNotFound
+		}
+
+		lu, err := t.getLeaseUsage(lr.Key())
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		for hwAddr, v := range lu {
+			if v.LeaseUntil.Before(now) || !lr.IP(v.Index).Equal(ip) {
+				continue
+			}
+			owner, err = net.ParseMAC(hwAddr)
+			return err
+		}
+		return sabakan.ErrNotFound
+	})
+	if err != nil {
+		return nil, err
+	}
+	return owner, nil
+}
+
+type dhcpDriver struct {
+	*driver
+}
+
+func (d dhcpDriver) PutConfig(ctx context.Context, config *sabakan.DHCPConfig) error {
+	return d.putDHCPConfig(ctx, config)
+}
+
+func (d dhcpDriver) GetConfig() (*sabakan.DHCPConfig, error) {
+	return d.getDHCPConfig()
+}
+
+func (d dhcpDriver) Lease(ctx context.Context, ifaddr net.IP, mac net.HardwareAddr) (net.IP, error) {
+	return d.dhcpLease(ctx, ifaddr, mac)
+}
+
+func (d dhcpDriver) Renew(ctx context.Context, ciaddr net.IP, mac net.HardwareAddr) error {
+	return d.dhcpRenew(ctx, ciaddr, mac)
+}
+
+func (d dhcpDriver) Release(ctx context.Context, ciaddr net.IP, mac net.HardwareAddr) error {
+	return d.dhcpRelease(ctx, ciaddr, mac)
+}
+
+func (d dhcpDriver) Decline(ctx context.Context, ciaddr net.IP, mac net.HardwareAddr) error {
+	return d.dhcpDecline(ctx, ciaddr, mac)
+}
+
+func (d dhcpDriver) LeaseOwner(ctx context.Context, ip net.IP) (net.HardwareAddr, error) {
+	return d.dhcpLeaseOwner(ctx, ip)
+}
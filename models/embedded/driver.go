@@ -0,0 +1,153 @@
+// Package embedded implements sabakan model on an embedded bbolt database.
+//
+// This is intended for a single sabakan server without etcd, such as
+// a small lab.  Assets and images are stored in the data directory
+// as the etcd driver does, but they are not replicated to other servers.
+package embedded
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/cybozu-go/sabakan/v3"
+	"github.com/cybozu-go/well"
+	bolt "go.etcd.io/bbolt"
+)
+
+type driver struct {
+	db           *bolt.DB
+	dataDir      string
+	advertiseURL *url.URL
+	logConfig    sabakan.LogConfig
+}
+
+// OpenDB opens the database in dataDir.
+// The database is locked exclusively until it is closed.
+func OpenDB(dataDir string) (*bolt.DB, error) {
+	err := os.MkdirAll(dataDir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return bolt.Open(filepath.Join(dataDir, DBFile), 0600, &bolt.Options{Timeout: 10 * time.Second})
+}
+
+// NewModel returns sabakan.Model
+//
+// logConfig configures audit logs in the same way as etcd.NewModel.
+func NewModel(db *bolt.DB, dataDir string, advertiseURL *url.URL, logConfig sabakan.LogConfig) (sabakan.Model, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucketName)
+		return err
+	})
+	if err != nil {
+		return sabakan.Model{}, err
+	}
+
+	d := &driver{
+		db:           db,
+		dataDir:      dataDir,
+		advertiseURL: advertiseURL,
+		logConfig:    logConfig,
+	}
+	return sabakan.Model{
+		Runner:       d,
+		Storage:      d,
+		CryptPolicy:  cryptPolicyDriver{d},
+		Machine:      machineDriver{d},
+		IPAM:         ipamDriver{d},
+		DHCP:         dhcpDriver{d},
+		Image:        imageDriver{d},
+		Asset:        assetDriver{d},
+		Log:          logDriver{d},
+		Ignition:     d,
+		KernelParams: kernelParamsDriver{d},
+		Switch:       switchDriver{d},
+		Webhook:      webhookDriver{d},
+		Health:       healthDriver{d},
+		Schema:       d,
+		Backup:       backupDriver{d},
+	}, nil
+}
+
+func (d *driver) myURL(p ...string) string {
+	u := *d.advertiseURL
+	u.Path = path.Join(p...)
+	return u.String()
+}
+
+// Run starts background goroutines.  This should be called as a goroutine.
+//
+// Unlike the etcd driver, the model is always up-to-date, so an object
+// is sent to ch just once.
+func (d *driver) Run(ctx context.Context, ch chan<- struct{}) error {
+	err := d.gcFiles(ctx)
+	if err != nil {
+		return err
+	}
+
+	env := well.NewEnvironment(ctx)
+
+	// log compaction
+	env.Go(d.logCompactor)
+
+	// checkpoints of the hash chain of logs
+	env.Go(d.logCheckpointer)
+
+	// deliver audit logs to webhooks
+	env.Go(d.webhookDispatcher)
+
+	env.Stop()
+
+	ch <- struct{}{}
+	return env.Wait()
+}
+
+// gcFiles removes assets and images that are not referenced from the
+// database.  They are left when sabakan stops before committing uploads.
+func (d *driver) gcFiles(ctx context.Context) error {
+	ids := make(map[int]bool)
+	oses := make(map[string]sabakan.ImageIndex)
+	err := d.view(ctx, func(t *txn) error {
+		err := t.scan(KeyAssets, func(key string, value []byte) error {
+			a, err := decodeAsset(value)
+			if err != nil {
+				return err
+			}
+			for _, id := range a.IDs() {
+				ids[id] = true
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return t.scan(KeyImages, func(key string, value []byte) error {
+			os, index, err := decodeImageIndex(key, value)
+			if err != nil || index == nil {
+				return err
+			}
+			oses[os] = index
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	err = d.getAssetDir().GC(ids)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for os, index := range oses {
+		err = d.imageGC(os, index)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package embedded
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cybozu-go/sabakan/v3"
+	"github.com/cybozu-go/sabakan/v3/models/modeltest"
+)
+
+func newTestImage(kernel, initrd string) io.Reader {
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	for _, f := range []struct{ name, data string }{
+		{sabakan.ImageKernelFilename, kernel},
+		{sabakan.ImageInitrdFilename, initrd},
+	} {
+		err := tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.data))})
+		if err != nil {
+			panic(err)
+		}
+		tw.Write([]byte(f.data))
+	}
+	tw.Close()
+	return buf
+}
+
+// testRegisterMachine puts the IPAM configuration and registers a worker.
+func testRegisterMachine(t *testing.T, d *driver, serial string) {
+	ctx := context.Background()
+	config := modeltest.IPAMConfig
+	err := d.putIPAMConfig(ctx, &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.machineRegister(ctx, []*sabakan.Machine{
+		sabakan.NewMachine(sabakan.MachineSpec{Serial: serial, Role: "worker"}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testDriverPersistence(t *testing.T) {
+	t.Parallel()
+
+	dataDir := t.TempDir()
+	ctx := context.Background()
+
+	d := testOpenDriver(t, dataDir)
+	testRegisterMachine(t, d, "12345678")
+	_, err := d.assetPut(ctx, "foo", "text/plain", nil, nil, strings.NewReader("bar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d = testOpenDriver(t, dataDir)
+	m, err := d.machineGet(ctx, "12345678")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Spec.IndexInRack != modeltest.IPAMConfig.NodeIndexOffset+1 {
+		t.Error("unexpected machine:", m)
+	}
+	a, err := d.assetGetInfo(ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !a.Exists {
+		t.Error("asset should exist")
+	}
+	if n := len(testLogs(t, d)); n != 3 {
+		t.Error("unexpected number of logs:", n)
+	}
+
+	// revisions continue after reopen
+	logs := testLogs(t, d)
+	err = d.recordLog(ctx, sabakan.AuditIPXE, "", "action", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := testLastLog(t, d)
+	if last.Revision <= logs[len(logs)-1].Revision || last.Seq != 4 {
+		t.Error("unexpected log:", last)
+	}
+}
+
+func testDriverGCFiles(t *testing.T) {
+	t.Parallel()
+
+	d := testNewDriver(t)
+	ctx := context.Background()
+
+	status, err := d.assetPut(ctx, "foo", "text/plain", nil, nil, strings.NewReader("bar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.imageUpload(ctx, "coreos", "1", newTestImage("kernel", "initrd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// files left by interrupted uploads
+	err = os.WriteFile(d.getAssetDir().Path(100), []byte("garbage"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.MkdirAll(filepath.Join(d.getImageDir("coreos").Dir, "2"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = d.gcFiles(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d.getAssetDir().Exists(100) {
+		t.Error("garbage asset was not removed")
+	}
+	if !d.getAssetDir().Exists(status.ID) {
+		t.Error("asset was removed")
+	}
+	if d.getImageDir("coreos").Exists("2") {
+		t.Error("garbage image was not removed")
+	}
+	if !d.getImageDir("coreos").Exists("1") {
+		t.Error("image was removed")
+	}
+}
+
+func testDriverCryptMeta(t *testing.T) {
+	t.Parallel()
+
+	dataDir := t.TempDir()
+	ctx := context.Background()
+
+	d := testOpenDriver(t, dataDir)
+	testRegisterMachine(t, d, "12345678")
+	revisions := func() map[string]int64 {
+		infos, err := d.ListEncryptionKeys(ctx, "12345678")
+		if err != nil {
+			t.Fatal(err)
+		}
+		revs := make(map[string]int64)
+		for _, info := range infos {
+			revs[info.Path] = info.Revision
+		}
+		return revs
+	}
+
+	err := d.PutEncryptionKey(ctx, "12345678", "disk1", []byte("key1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rev1 := revisions()["disk1"]
+	if rev1 == 0 {
+		t.Fatal("revision is not recorded")
+	}
+
+	// reading a key runs a read-write transaction to record the audit log
+	_, err = d.GetEncryptionKey(ctx, "12345678", "disk1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.PutEncryptionKey(ctx, "12345678", "disk2", []byte("key2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	revs := revisions()
+	if revs["disk1"] != rev1 {
+		t.Error("revision of an existing key should not change:", revs["disk1"], rev1)
+	}
+	if revs["disk2"] <= rev1+1 {
+		t.Error("revision should be that of the transaction creating the key:", revs["disk2"], rev1)
+	}
+
+	err = d.db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d = testOpenDriver(t, dataDir)
+	if actual := revisions(); actual["disk1"] != revs["disk1"] || actual["disk2"] != revs["disk2"] {
+		t.Error("revisions should be kept after reopen:", actual, revs)
+	}
+}
+
+func TestDriver(t *testing.T) {
+	t.Run("Persistence", testDriverPersistence)
+	t.Run("GCFiles", testDriverGCFiles)
+	t.Run("CryptMeta", testDriverCryptMeta)
+}
@@ -0,0 +1,19 @@
+package embedded
+
+import (
+	"context"
+)
+
+func (d *driver) getHealth(ctx context.Context) error {
+	return d.view(ctx, func(t *txn) error {
+		return nil
+	})
+}
+
+type healthDriver struct {
+	*driver
+}
+
+func (d healthDriver) GetHealth(ctx context.Context) error {
+	return d.getHealth(ctx)
+}
@@ -0,0 +1,123 @@
+package embedded
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/cybozu-go/sabakan/v3"
+	version "github.com/hashicorp/go-version"
+)
+
+func keyIgnitionRolePrefix(role string) string {
+	return KeyIgnitions + role + "/"
+}
+
+// ignitionVersions returns sorted versions of templates for the role.
+func (t *txn) ignitionVersions(role string) ([]*version.Version, error) {
+	pfx := keyIgnitionRolePrefix(role)
+
+	var versions []*version.Version
+	err := t.scan(pfx, func(key string, _ []byte) error {
+		ver, err := version.NewVersion(key[len(pfx):])
+		if err != nil {
+			return err
+		}
+		versions = append(versions, ver)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Sort(version.Collection(versions))
+	return versions, nil
+}
+
+// PutTemplate implements sabakan.IgnitionModel
+func (d *driver) PutTemplate(ctx context.Context, role, id string, tmpl *sabakan.IgnitionTemplate) error {
+	pfx := keyIgnitionRolePrefix(role)
+	target := pfx + id
+
+	return d.update(ctx, func(t *txn) error {
+		// Prohibit overwriting
+		if t.get(target) != nil {
+			return sabakan.ErrConflicted
+		}
+
+		err := t.putJSON(target, tmpl)
+		if err != nil {
+			return err
+		}
+
+		versions, err := t.ignitionVersions(role)
+		if err != nil {
+			return err
+		}
+		if len(versions) > MaxIgnitions {
+			for _, ver := range versions[:len(versions)-MaxIgnitions] {
+				_, err = t.delete(pfx + ver.Original())
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		return t.addLog(time.Now(), sabakan.AuditIgnition, role, "put", id)
+	})
+}
+
+// GetTemplateIDs implements sabakan.IgnitionModel
+func (d *driver) GetTemplateIDs(ctx context.Context, role string) ([]string, error) {
+	var versions []*version.Version
+	err := d.view(ctx, func(t *txn) error {
+		var err error
+		versions, err = t.ignitionVersions(role)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, nil
+	}
+
+	result := make([]string, len(versions))
+	for i, ver := range versions {
+		result[i] = ver.Original()
+	}
+	return result, nil
+}
+
+// GetTemplate implements sabakan.IgnitionModel
+func (d *driver) GetTemplate(ctx context.Context, role string, id string) (*sabakan.IgnitionTemplate, error) {
+	tmpl := new(sabakan.IgnitionTemplate)
+	err := d.view(ctx, func(t *txn) error {
+		found, err := t.getJSON(keyIgnitionRolePrefix(role)+id, tmpl)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return sabakan.ErrNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// DeleteTemplate implements sabakan.IgnitionModel
+func (d *driver) DeleteTemplate(ctx context.Context, role string, id string) error {
+	return d.update(ctx, func(t *txn) error {
+		deleted, err := t.delete(keyIgnitionRolePrefix(role) + id)
+		if err != nil {
+			return err
+		}
+		if !deleted {
+			return sabakan.ErrNotFound
+		}
+		return t.addLog(time.Now(), sabakan.AuditIgnition, role, "delete", id)
+	})
+}
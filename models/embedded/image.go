@@ -0,0 +1,317 @@
+package embedded
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cybozu-go/log"
+	"github.com/cybozu-go/sabakan/v3"
+	"github.com/cybozu-go/sabakan/v3/models/etcd"
+)
+
+var (
+	imageMembers = map[string][]string{
+		"coreos": {
+			sabakan.ImageKernelFilename,
+			sabakan.ImageInitrdFilename,
+		},
+	}
+)
+
+func (d *driver) getImageDir(os string) etcd.ImageDir {
+	return etcd.ImageDir{
+		Dir: filepath.Join(d.dataDir, "images", os),
+	}
+}
+
+// decodeImageIndex decodes a value of KeyImages keys.
+// This returns nil index for the list of deleted images.
+func decodeImageIndex(key string, data []byte) (string, sabakan.ImageIndex, error) {
+	os := key[len(KeyImages):]
+	if strings.HasSuffix(os, "/deleted") {
+		return "", nil, nil
+	}
+
+	var index sabakan.ImageIndex
+	err := json.Unmarshal(data, &index)
+	if err != nil {
+		return "", nil, err
+	}
+	return os, index, nil
+}
+
+func (t *txn) getImageIndex(os string) (sabakan.ImageIndex, error) {
+	var index sabakan.ImageIndex
+	found, err := t.getJSON(path.Join(KeyImages, os), &index)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return sabakan.ImageIndex{}, nil
+	}
+	return index, nil
+}
+
+func (t *txn) getImageDeleted(os string) ([]string, error) {
+	var deleted []string
+	_, err := t.getJSON(path.Join(KeyImages, os, "deleted"), &deleted)
+	return deleted, err
+}
+
+func (t *txn) putImageIndex(os string, index sabakan.ImageIndex, deleted []string) error {
+	if len(deleted) > MaxDeleted {
+		deleted = deleted[len(deleted)-MaxDeleted:]
+	}
+
+	err := t.putJSON(path.Join(KeyImages, os), index)
+	if err != nil {
+		return err
+	}
+	return t.putJSON(path.Join(KeyImages, os, "deleted"), deleted)
+}
+
+// imageGC removes image directories that are not in the index.
+func (d *driver) imageGC(os string, index sabakan.ImageIndex) error {
+	dir := d.getImageDir(os)
+	entries, err := readDir(dir.Dir)
+	if err != nil {
+		return err
+	}
+
+	var garbage []string
+	for _, name := range entries {
+		if index.Find(name) == nil {
+			log.Info("removing garbage image", map[string]interface{}{
+				"os": os,
+				"id": name,
+			})
+			garbage = append(garbage, name)
+		}
+	}
+	return dir.GC(garbage)
+}
+
+func readDir(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Name()
+	}
+	return names, nil
+}
+
+func (d *driver) imageGetIndex(ctx context.Context, os string) (sabakan.ImageIndex, error) {
+	var index sabakan.ImageIndex
+	err := d.view(ctx, func(t *txn) error {
+		var err error
+		index, err = t.getImageIndex(os)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	dir := d.getImageDir(os)
+	for _, img := range index {
+		img.Exists = dir.Exists(img.ID)
+	}
+	return index, nil
+}
+
+func (d *driver) imageGetInfoAll(ctx context.Context) ([]*sabakan.Image, error) {
+	var images []*sabakan.Image
+	err := d.view(ctx, func(t *txn) error {
+		return t.scan(KeyImages, func(key string, value []byte) error {
+			os, index, err := decodeImageIndex(key, value)
+			if err != nil {
+				return err
+			}
+
+			dir := d.getImageDir(os)
+			for _, img := range index {
+				img.Exists = dir.Exists(img.ID)
+			}
+			images = append(images, index...)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+func (d *driver) imageUpload(ctx context.Context, os, id string, r io.Reader) error {
+	var deleted []string
+	err := d.view(ctx, func(t *txn) error {
+		var err error
+		deleted, err = t.getImageDeleted(os)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for _, d := range deleted {
+		if d == id {
+			return sabakan.ErrConflicted
+		}
+	}
+
+	dir := d.getImageDir(os)
+	err = dir.Extract(r, id, imageMembers[os])
+	if err != nil {
+		return err
+	}
+	size, err := dir.Size(id)
+	if err != nil {
+		return err
+	}
+
+	var dels []string
+	err = d.update(ctx, func(t *txn) error {
+		index, err := t.getImageIndex(os)
+		if err != nil {
+			return err
+		}
+		deleted, err := t.getImageDeleted(os)
+		if err != nil {
+			return err
+		}
+
+		index, dels = index.Append(&sabakan.Image{
+			ID:   id,
+			Date: time.Now().UTC(),
+			Size: size,
+			URLs: []string{d.myURL("/api/v1/images", os, id)},
+		})
+		err = t.putImageIndex(os, index, append(deleted, dels...))
+		if err != nil {
+			return err
+		}
+		return t.addLog(time.Now(), sabakan.AuditImage, os, "upload", "id="+id)
+	})
+	if err != nil {
+		return err
+	}
+
+	return dir.GC(dels)
+}
+
+func (d *driver) imageDownload(ctx context.Context, os, id string, out io.Writer) error {
+	index, err := d.imageGetIndex(ctx, os)
+	if err != nil {
+		return err
+	}
+
+	img := index.Find(id)
+	if img == nil || !img.Exists {
+		return sabakan.ErrNotFound
+	}
+
+	err = d.getImageDir(os).Download(out, id)
+	if err != nil {
+		log.Error("imageDownload failed", map[string]interface{}{
+			"os":        os,
+			"id":        id,
+			log.FnError: err.Error(),
+		})
+	}
+	return err
+}
+
+func (d *driver) imageDelete(ctx context.Context, os, id string) error {
+	err := d.update(ctx, func(t *txn) error {
+		index, err := t.getImageIndex(os)
+		if err != nil {
+			return err
+		}
+		deleted, err := t.getImageDeleted(os)
+		if err != nil {
+			return err
+		}
+
+		if index.Find(id) == nil {
+			return sabakan.ErrNotFound
+		}
+
+		err = t.putImageIndex(os, index.Remove(id), append(deleted, id))
+		if err != nil {
+			return err
+		}
+		return t.addLog(time.Now(), sabakan.AuditImage, os, "delete", "id="+id)
+	})
+	if err != nil {
+		return err
+	}
+
+	return d.getImageDir(os).GC([]string{id})
+}
+
+func (d *driver) imageServeFile(ctx context.Context, os, filename string,
+	f func(modtime time.Time, content io.ReadSeeker)) error {
+
+	index, err := d.imageGetIndex(ctx, os)
+	if err != nil {
+		return err
+	}
+
+	dir := d.getImageDir(os)
+	for i := len(index) - 1; i >= 0; i-- {
+		id := index[i].ID
+		date := index[i].Date
+		if !index[i].Exists {
+			log.Warn("imageServeFile: no local copy", map[string]interface{}{
+				"id": id,
+			})
+			continue
+		}
+
+		return dir.ServeFile(id, filename, func(content io.ReadSeeker) {
+			f(date, content)
+		})
+	}
+
+	return sabakan.ErrNotFound
+}
+
+type imageDriver struct {
+	*driver
+}
+
+func (d imageDriver) GetIndex(ctx context.Context, os string) (sabakan.ImageIndex, error) {
+	return d.imageGetIndex(ctx, os)
+}
+
+func (d imageDriver) GetInfoAll(ctx context.Context) ([]*sabakan.Image, error) {
+	return d.imageGetInfoAll(ctx)
+}
+
+func (d imageDriver) Upload(ctx context.Context, os, id string, r io.Reader) error {
+	return d.imageUpload(ctx, os, id, r)
+}
+
+func (d imageDriver) Download(ctx context.Context, os, id string, out io.Writer) error {
+	return d.imageDownload(ctx, os, id, out)
+}
+
+func (d imageDriver) Delete(ctx context.Context, os, id string) error {
+	return d.imageDelete(ctx, os, id)
+}
+
+func (d imageDriver) ServeFile(ctx context.Context, os, filename string,
+	f func(modtime time.Time, content io.ReadSeeker)) error {
+	return d.imageServeFile(ctx, os, filename, f)
+}
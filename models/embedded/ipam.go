@@ -0,0 +1,63 @@
+package embedded
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+func (t *txn) getIPAMConfig() (*sabakan.IPAMConfig, error) {
+	config := new(sabakan.IPAMConfig)
+	found, err := t.getJSON(KeyIPAM, config)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errors.New("IPAMConfig is not set")
+	}
+	return config, nil
+}
+
+func (d *driver) putIPAMConfig(ctx context.Context, config *sabakan.IPAMConfig) error {
+	j, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	return d.update(ctx, func(t *txn) error {
+		if t.hasPrefix(KeyMachines) {
+			return errors.New("machines already exists")
+		}
+
+		err := t.put(KeyIPAM, j)
+		if err != nil {
+			return err
+		}
+		return t.addLog(time.Now(), sabakan.AuditIPAM, "config", "put", string(j))
+	})
+}
+
+func (d *driver) getIPAMConfig() (*sabakan.IPAMConfig, error) {
+	var config *sabakan.IPAMConfig
+	err := d.view(context.Background(), func(t *txn) error {
+		var err error
+		config, err = t.getIPAMConfig()
+		return err
+	})
+	return config, err
+}
+
+type ipamDriver struct {
+	*driver
+}
+
+func (d ipamDriver) PutConfig(ctx context.Context, config *sabakan.IPAMConfig) error {
+	return d.putIPAMConfig(ctx, config)
+}
+
+func (d ipamDriver) GetConfig() (*sabakan.IPAMConfig, error) {
+	return d.getIPAMConfig()
+}
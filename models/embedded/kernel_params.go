@@ -0,0 +1,39 @@
+package embedded
+
+import (
+	"context"
+	"path"
+
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+func (d *driver) putParams(ctx context.Context, os string, params string) error {
+	return d.update(ctx, func(t *txn) error {
+		return t.put(path.Join(KeyKernelParams, os), []byte(params))
+	})
+}
+
+func (d *driver) getParams(ctx context.Context, os string) (string, error) {
+	var params string
+	err := d.view(ctx, func(t *txn) error {
+		v := t.get(path.Join(KeyKernelParams, os))
+		if v == nil {
+			return sabakan.ErrNotFound
+		}
+		params = string(v)
+		return nil
+	})
+	return params, err
+}
+
+type kernelParamsDriver struct {
+	*driver
+}
+
+func (d kernelParamsDriver) PutParams(ctx context.Context, os string, params string) error {
+	return d.putParams(ctx, os, params)
+}
+
+func (d kernelParamsDriver) GetParams(ctx context.Context, os string) (string, error) {
+	return d.getParams(ctx, os)
+}
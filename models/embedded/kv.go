@@ -0,0 +1,202 @@
+package embedded
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// bucketName is the name of the bucket that holds all keys.
+var bucketName = []byte("sabakan")
+
+// txn is a transaction of the database.
+//
+// Values returned from get and scan are valid only in the transaction.
+type txn struct {
+	ctx context.Context
+	b   *bolt.Bucket
+
+	// rev is the revision of a read-write transaction.
+	// Revisions are increased by one for each read-write transaction.
+	rev int64
+
+	// logged is true if an audit log entry has been added.
+	logged bool
+}
+
+// update runs fn in a read-write transaction.
+// If fn returns an error, nothing is changed.
+func (d *driver) update(ctx context.Context, fn func(t *txn) error) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketName)
+		rev, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		return fn(&txn{ctx: ctx, b: b, rev: int64(rev)})
+	})
+}
+
+// view runs fn in a read-only transaction.
+func (d *driver) view(ctx context.Context, fn func(t *txn) error) error {
+	return d.db.View(func(tx *bolt.Tx) error {
+		return fn(&txn{ctx: ctx, b: tx.Bucket(bucketName)})
+	})
+}
+
+// get returns the value of key, or nil if key does not exist.
+func (t *txn) get(key string) []byte {
+	return t.b.Get([]byte(key))
+}
+
+// getJSON decodes the value of key into v.
+// This returns false if key does not exist.
+func (t *txn) getJSON(key string, v interface{}) (bool, error) {
+	data := t.get(key)
+	if data == nil {
+		return false, nil
+	}
+	return true, json.Unmarshal(data, v)
+}
+
+func (t *txn) put(key string, value []byte) error {
+	if value == nil {
+		// bbolt does not distinguish nil from missing values
+		value = []byte{}
+	}
+	return t.b.Put([]byte(key), value)
+}
+
+func (t *txn) putJSON(key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return t.put(key, data)
+}
+
+// delete removes key.  This returns false if key does not exist.
+func (t *txn) delete(key string) (bool, error) {
+	if t.get(key) == nil {
+		return false, nil
+	}
+	return true, t.b.Delete([]byte(key))
+}
+
+// hasPrefix returns true if a key with prefix exists.
+func (t *txn) hasPrefix(prefix string) bool {
+	k, _ := t.b.Cursor().Seek([]byte(prefix))
+	return k != nil && bytes.HasPrefix(k, []byte(prefix))
+}
+
+// scan calls fn for each key with prefix in ascending order.
+func (t *txn) scan(prefix string, fn func(key string, value []byte) error) error {
+	p := []byte(prefix)
+	c := t.b.Cursor()
+	for k, v := c.Seek(p); k != nil && bytes.HasPrefix(k, p); k, v = c.Next() {
+		err := fn(string(k), v)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanRange calls fn for each key in [key, endKey) until fn returns true.
+// Empty endKey means no upper bound.
+// If desc is true, keys are scanned in descending order.
+// This returns true if fn returns true.
+func (t *txn) scanRange(key, endKey string, desc bool, fn func(key string, value []byte) (bool, error)) (bool, error) {
+	start, end := []byte(key), []byte(endKey)
+	beforeEnd := func(k []byte) bool {
+		return len(end) == 0 || bytes.Compare(k, end) < 0
+	}
+	c := t.b.Cursor()
+
+	var k, v []byte
+	if desc {
+		if len(end) == 0 {
+			k, v = c.Last()
+		} else {
+			k, v = c.Seek(end)
+			if k == nil {
+				k, v = c.Last()
+			}
+		}
+		if k != nil && !beforeEnd(k) {
+			k, v = c.Prev()
+		}
+	} else {
+		k, v = c.Seek(start)
+	}
+
+	for k != nil && bytes.Compare(k, start) >= 0 && beforeEnd(k) {
+		done, err := fn(string(k), v)
+		if err != nil || done {
+			return done, err
+		}
+		if desc {
+			k, v = c.Prev()
+		} else {
+			k, v = c.Next()
+		}
+	}
+	return false, nil
+}
+
+// deleteRange removes keys in [key, endKey) and returns the number of them.
+// Empty endKey means no upper bound.
+func (t *txn) deleteRange(key, endKey string) (int64, error) {
+	var keys []string
+	_, err := t.scanRange(key, endKey, false, func(key string, value []byte) (bool, error) {
+		keys = append(keys, key)
+		return false, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, k := range keys {
+		err := t.b.Delete([]byte(k))
+		if err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(keys)), nil
+}
+
+// deletePrefix removes keys with prefix and returns them.
+func (t *txn) deletePrefix(prefix string) ([]string, error) {
+	var keys []string
+	err := t.scan(prefix, func(key string, value []byte) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, k := range keys {
+		err := t.b.Delete([]byte(k))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// prefixEnd returns the smallest key greater than all keys with prefix.
+// If there is no such key, this returns an empty string, which means
+// no upper bound for scanRange and deleteRange.
+func prefixEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+	return ""
+}
@@ -0,0 +1,108 @@
+package embedded
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPrefixEnd(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		prefix   string
+		expected string
+	}{
+		{"audit/", "audit0"},
+		{"a\xff", "b"},
+		{"a\xff\xff", "b"},
+		{"\xff", ""},
+		{"\xff\xff", ""},
+		{"", ""},
+	}
+	for _, c := range cases {
+		if actual := prefixEnd(c.prefix); actual != c.expected {
+			t.Errorf("prefixEnd(%q) = %q, expected %q", c.prefix, actual, c.expected)
+		}
+	}
+}
+
+func TestScanRange(t *testing.T) {
+	t.Parallel()
+
+	d := testNewDriver(t)
+	ctx := context.Background()
+
+	// keys of the driver are in lower case
+	keys := []string{"A", "B", "B\xff", "C", "\xff", "\xff\xff"}
+	err := d.update(ctx, func(t *txn) error {
+		for _, k := range keys {
+			err := t.put(k, []byte(k))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scan := func(key, endKey string, desc bool, limit int) []string {
+		var ret []string
+		err := d.view(ctx, func(t *txn) error {
+			_, err := t.scanRange(key, endKey, desc, func(key string, _ []byte) (bool, error) {
+				ret = append(ret, key)
+				return len(ret) == limit, nil
+			})
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ret
+	}
+
+	cases := []struct {
+		name     string
+		key      string
+		endKey   string
+		desc     bool
+		limit    int
+		expected []string
+	}{
+		{"asc", "B", "C", false, 0, []string{"B", "B\xff"}},
+		{"desc", "B", "C", true, 0, []string{"B\xff", "B"}},
+		{"empty", "B", "B", false, 0, nil},
+		{"empty-desc", "B", "B", true, 0, nil},
+		{"prefix", "B", prefixEnd("B"), false, 0, []string{"B", "B\xff"}},
+		{"end-missing-desc", "A", "BB", true, 0, []string{"B", "A"}},
+		{"limit", "A", "D", false, 2, []string{"A", "B"}},
+		{"all-ff", "\xff", prefixEnd("\xff"), false, 0, []string{"\xff", "\xff\xff"}},
+		{"all-ff-desc", "\xff", prefixEnd("\xff"), true, 0, []string{"\xff\xff", "\xff"}},
+		{"unbounded-desc", "", "", true, 2, []string{"\xff\xff", "\xff"}},
+	}
+	for _, c := range cases {
+		actual := scan(c.key, c.endKey, c.desc, c.limit)
+		if !cmp.Equal(actual, c.expected) {
+			t.Errorf("%s: unexpected keys: %q", c.name, actual)
+		}
+	}
+
+	var deleted int64
+	err = d.update(ctx, func(t *txn) error {
+		var err error
+		deleted, err = t.deleteRange("\xff", prefixEnd("\xff"))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 2 {
+		t.Error("unexpected number of deleted keys:", deleted)
+	}
+	if actual := scan("A", "", false, 0); len(actual) == 0 || actual[len(actual)-1] >= "\xff" {
+		t.Errorf("unexpected keys after deleteRange: %q", actual)
+	}
+}
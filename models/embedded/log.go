@@ -0,0 +1,512 @@
+package embedded
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/cybozu-go/log"
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+func auditKey(t time.Time) string {
+	return KeyAudit + t.UTC().Format("20060102") + "/"
+}
+
+// addLog adds an audit log entry to the hash chain.
+// Audit log keys are made from revisions, so a transaction can add
+// only one entry.
+func (t *txn) addLog(ts time.Time, cat sabakan.AuditCategory, instance, action, detail string) error {
+	if t.logged {
+		return errors.New("audit log has already been added in the transaction")
+	}
+	t.logged = true
+
+	head := new(sabakan.AuditCheckpoint)
+	_, err := t.getJSON(KeyAuditHead, head)
+	if err != nil {
+		return err
+	}
+
+	a := sabakan.NewAuditLog(t.ctx, ts, t.rev, cat, instance, action, detail)
+	a.Seq = head.Seq + 1
+	a.PrevHash = head.Hash
+	a.Hash, err = a.ComputeHash()
+	if err != nil {
+		return err
+	}
+
+	err = t.putJSON(auditKey(ts)+fmt.Sprintf("%016x", uint64(t.rev)), a)
+	if err != nil {
+		return err
+	}
+	return t.putJSON(KeyAuditHead, &sabakan.AuditCheckpoint{Seq: a.Seq, Hash: a.Hash, Timestamp: a.Timestamp})
+}
+
+// logRetention returns the duration to keep logs in the database.
+func (d *driver) logRetention() time.Duration {
+	days := d.logConfig.RetentionDays
+	if days == 0 {
+		days = defaultLogRetentionDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// auditDay returns the date of an audit log key.
+func auditDay(key string) (time.Time, error) {
+	if len(key) < len(KeyAudit)+8 {
+		return time.Time{}, fmt.Errorf("invalid audit log key: %s", key)
+	}
+	return time.Parse("20060102", key[len(KeyAudit):len(KeyAudit)+8])
+}
+
+// oldestLogKey returns the key of the oldest log, or "" if there are no logs.
+func (t *txn) oldestLogKey() string {
+	var oldest string
+	t.scanRange(KeyAudit, prefixEnd(KeyAudit), false, func(key string, value []byte) (bool, error) {
+		oldest = key
+		return true, nil
+	})
+	return oldest
+}
+
+// logArchiveDay stores logs of the day in the archive, then removes them.
+func (d *driver) logArchiveDay(ctx context.Context, day time.Time) (int64, error) {
+	key := auditKey(day)
+	endKey := auditKey(day.AddDate(0, 0, 1))
+
+	buf := new(bytes.Buffer)
+	err := d.view(ctx, func(t *txn) error {
+		_, err := t.scanRange(key, endKey, false, func(_ string, value []byte) (bool, error) {
+			buf.Write(value)
+			buf.WriteByte('\n')
+			return false, nil
+		})
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	err = d.logConfig.Archive.Store(ctx, day, buf.Bytes())
+	if err != nil {
+		return 0, err
+	}
+
+	var deleted int64
+	err = d.update(ctx, func(t *txn) error {
+		var err error
+		deleted, err = t.deleteRange(key, endKey)
+		return err
+	})
+	return deleted, err
+}
+
+func (d *driver) logCompact(ctx context.Context, now time.Time) error {
+	oldest := now.Add(-d.logRetention())
+	key := auditKey(oldest)
+
+	log.Info("log: compacting...", map[string]interface{}{
+		"key": key,
+	})
+
+	var deleted int64
+	if d.logConfig.Archive == nil {
+		err := d.update(ctx, func(t *txn) error {
+			var err error
+			deleted, err = t.deleteRange(KeyAudit, key)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	} else {
+		for {
+			var oldestKey string
+			err := d.view(ctx, func(t *txn) error {
+				oldestKey = t.oldestLogKey()
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if oldestKey == "" || oldestKey >= key {
+				break
+			}
+
+			day, err := auditDay(oldestKey)
+			if err != nil {
+				return err
+			}
+			n, err := d.logArchiveDay(ctx, day)
+			if err != nil {
+				// keep logs until the next compaction
+				log.Error("log: failed to archive logs", map[string]interface{}{
+					log.FnError: err,
+					"day":       day.Format("20060102"),
+				})
+				break
+			}
+			deleted += n
+		}
+	}
+
+	log.Info("log: compacted", map[string]interface{}{
+		"deleted": deleted,
+	})
+
+	return d.update(ctx, func(t *txn) error {
+		return d.logAnchor(t, now)
+	})
+}
+
+// putCheckpoint records a checkpoint of the hash chain unless it exists.
+// The checkpoint is signed if the key is configured.
+func (d *driver) putCheckpoint(t *txn, seq uint64, hash string, now time.Time) error {
+	key := KeyAuditCheckpoints + fmt.Sprintf("%016x", seq)
+	if t.get(key) != nil {
+		return nil
+	}
+
+	c := &sabakan.AuditCheckpoint{Seq: seq, Hash: hash, Timestamp: now.UTC()}
+	if d.logConfig.CheckpointKey != nil {
+		c.Sign(d.logConfig.CheckpointKey)
+	}
+	return t.putJSON(key, c)
+}
+
+// logCheckpoint records the head of the hash chain as a checkpoint.
+func (d *driver) logCheckpoint(t *txn, now time.Time) (uint64, error) {
+	head := new(sabakan.AuditCheckpoint)
+	found, err := t.getJSON(KeyAuditHead, head)
+	if err != nil || !found {
+		return 0, err
+	}
+	return head.Seq, d.putCheckpoint(t, head.Seq, head.Hash, now)
+}
+
+// logAnchor records a checkpoint linked from the oldest entry
+// so that the hash chain can be verified after compaction.
+//
+// Without the archive, checkpoints older than the anchor are removed.
+func (d *driver) logAnchor(t *txn, now time.Time) error {
+	var anchor uint64
+	oldestKey := t.oldestLogKey()
+	if oldestKey == "" {
+		var err error
+		anchor, err = d.logCheckpoint(t, now)
+		if err != nil {
+			return err
+		}
+	} else {
+		// the oldest key has the smallest revision, hence the smallest
+		// sequence number in the day.
+		first := new(sabakan.AuditLog)
+		_, err := t.getJSON(oldestKey, first)
+		if err != nil {
+			return err
+		}
+		if first.Seq <= 1 {
+			return nil
+		}
+
+		anchor = first.Seq - 1
+		err = d.putCheckpoint(t, anchor, first.PrevHash, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.logConfig.Archive != nil || anchor == 0 {
+		return nil
+	}
+	_, err := t.deleteRange(KeyAuditCheckpoints, KeyAuditCheckpoints+fmt.Sprintf("%016x", anchor))
+	return err
+}
+
+func (d *driver) logTryCompact(ctx context.Context, now time.Time) error {
+	var lastGC time.Time
+	err := d.view(ctx, func(t *txn) error {
+		_, err := t.getJSON(KeyAuditLastGC, &lastGC)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if now.Sub(lastGC) < logCompactionInterval {
+		return nil
+	}
+
+	err = d.logCompact(ctx, now)
+	if err != nil {
+		return err
+	}
+	return d.update(ctx, func(t *txn) error {
+		return t.putJSON(KeyAuditLastGC, now)
+	})
+}
+
+// logCompactor is a goroutine to compact logs periodically.
+func (d *driver) logCompactor(ctx context.Context) error {
+	ticker := time.NewTicker(logCompactionTick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			err := d.logTryCompact(ctx, now.UTC())
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// logCheckpointer is a goroutine to record checkpoints periodically.
+func (d *driver) logCheckpointer(ctx context.Context) error {
+	ticker := time.NewTicker(logCheckpointInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			err := d.update(ctx, func(t *txn) error {
+				_, err := d.logCheckpoint(t, now)
+				return err
+			})
+			if err != nil {
+				log.Error("embedded: failed to record audit log checkpoint", map[string]interface{}{
+					log.FnError: err,
+				})
+			}
+		}
+	}
+}
+
+func (d *driver) logChain(ctx context.Context) (*sabakan.AuditChain, error) {
+	chain := &sabakan.AuditChain{Checkpoints: []*sabakan.AuditCheckpoint{}}
+	err := d.view(ctx, func(t *txn) error {
+		head := new(sabakan.AuditCheckpoint)
+		found, err := t.getJSON(KeyAuditHead, head)
+		if err != nil {
+			return err
+		}
+		if found {
+			chain.Head = head
+		}
+
+		return t.scan(KeyAuditCheckpoints, func(_ string, value []byte) error {
+			c := new(sabakan.AuditCheckpoint)
+			err := json.Unmarshal(value, c)
+			if err != nil {
+				return err
+			}
+			chain.Checkpoints = append(chain.Checkpoints, c)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return chain, nil
+}
+
+func (d *driver) recordLog(ctx context.Context, cat sabakan.AuditCategory, instance, action, detail string) error {
+	return d.update(ctx, func(t *txn) error {
+		return t.addLog(time.Now(), cat, instance, action, detail)
+	})
+}
+
+func (d *driver) logDump(ctx context.Context, since, until time.Time, w io.Writer) error {
+	return d.logQuery(ctx, &sabakan.LogQuery{Since: since, Until: until}, w)
+}
+
+// logWriter writes audit logs matching a query.
+type logWriter struct {
+	q     *sabakan.LogQuery
+	w     *bufio.Writer
+	count int
+}
+
+// write writes a log entry if it matches the query.
+// This returns true when the number of logs reaches the limit.
+func (lw *logWriter) write(value []byte) (bool, error) {
+	if lw.q.HasFilters() {
+		a := new(sabakan.AuditLog)
+		err := json.Unmarshal(value, a)
+		if err != nil {
+			return false, err
+		}
+		if !lw.q.Match(a) {
+			return false, nil
+		}
+	}
+
+	_, err := lw.w.Write(value)
+	if err != nil {
+		return false, err
+	}
+	err = lw.w.WriteByte('\n')
+	if err != nil {
+		return false, err
+	}
+
+	lw.count++
+	return lw.q.Limit > 0 && lw.count == lw.q.Limit, nil
+}
+
+// logArchivedDays returns the days in [since, until) whose logs have
+// been removed from the database.  If until is zero, it is not limited.
+func (t *txn) logArchivedDays(since, until time.Time) ([]time.Time, error) {
+	// logs are archived per day, so days before the oldest log
+	// are only in the archive.
+	end := time.Now().UTC().AddDate(0, 0, 1)
+	if oldestKey := t.oldestLogKey(); oldestKey != "" {
+		var err error
+		end, err = auditDay(oldestKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !until.IsZero() {
+		u := until.UTC().Truncate(24 * time.Hour)
+		if u.Before(end) {
+			end = u
+		}
+	}
+
+	var days []time.Time
+	for day := since.UTC().Truncate(24 * time.Hour); day.Before(end); day = day.AddDate(0, 0, 1) {
+		days = append(days, day)
+	}
+	return days, nil
+}
+
+// logLoadArchive calls fn for each archived log of the day until fn returns true.
+// This returns true if fn returns true.
+func (d *driver) logLoadArchive(ctx context.Context, day time.Time, desc bool,
+	fn func(value []byte) (bool, error)) (bool, error) {
+
+	buf := new(bytes.Buffer)
+	err := d.logConfig.Archive.Load(ctx, day, buf)
+	if err == sabakan.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	lines := bytes.Split(bytes.TrimSuffix(buf.Bytes(), []byte{'\n'}), []byte{'\n'})
+	for i := range lines {
+		line := lines[i]
+		if desc {
+			line = lines[len(lines)-1-i]
+		}
+		if len(line) == 0 {
+			continue
+		}
+		done, err := fn(line)
+		if err != nil || done {
+			return done, err
+		}
+	}
+	return false, nil
+}
+
+// logQuery writes logs matching the query.
+//
+// If the archive is configured and q.Since is not zero, archived logs
+// are also read.
+func (d *driver) logQuery(ctx context.Context, q *sabakan.LogQuery, w io.Writer) error {
+	lw := &logWriter{q: q, w: bufio.NewWriterSize(w, 2048)}
+
+	key := KeyAudit
+	endKey := prefixEnd(KeyAudit)
+
+	if !q.Since.IsZero() {
+		key = auditKey(q.Since)
+	}
+	if !q.Until.IsZero() {
+		endKey = auditKey(q.Until)
+	}
+	desc := q.Order == sabakan.LogOrderDesc
+
+	// read logs in a transaction so that compaction does not remove
+	// them in the middle.
+	return d.view(ctx, func(t *txn) error {
+		var archived []time.Time
+		if d.logConfig.Archive != nil && !q.Since.IsZero() {
+			var err error
+			archived, err = t.logArchivedDays(q.Since, q.Until)
+			if err != nil {
+				return err
+			}
+		}
+
+		if !desc {
+			for _, day := range archived {
+				done, err := d.logLoadArchive(ctx, day, desc, lw.write)
+				if err != nil {
+					return err
+				}
+				if done {
+					return lw.w.Flush()
+				}
+			}
+		}
+
+		done, err := t.scanRange(key, endKey, desc, func(_ string, value []byte) (bool, error) {
+			return lw.write(value)
+		})
+		if err != nil {
+			return err
+		}
+		if done {
+			return lw.w.Flush()
+		}
+
+		if desc {
+			for i := len(archived) - 1; i >= 0; i-- {
+				done, err := d.logLoadArchive(ctx, archived[i], desc, lw.write)
+				if err != nil {
+					return err
+				}
+				if done {
+					break
+				}
+			}
+		}
+
+		return lw.w.Flush()
+	})
+}
+
+type logDriver struct {
+	*driver
+}
+
+func (d logDriver) Dump(ctx context.Context, since, until time.Time, w io.Writer) error {
+	return d.logDump(ctx, since, until, w)
+}
+
+func (d logDriver) Query(ctx context.Context, q *sabakan.LogQuery, w io.Writer) error {
+	return d.logQuery(ctx, q, w)
+}
+
+func (d logDriver) Chain(ctx context.Context) (*sabakan.AuditChain, error) {
+	return d.logChain(ctx)
+}
+
+func (d logDriver) Record(ctx context.Context, cat sabakan.AuditCategory, instance, action, detail string) error {
+	return d.recordLog(ctx, cat, instance, action, detail)
+}
@@ -0,0 +1,180 @@
+package embedded
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/cybozu-go/sabakan/v3"
+	"github.com/cybozu-go/sabakan/v3/logarchive"
+	"github.com/google/go-cmp/cmp"
+)
+
+// testAddLogs adds two logs for each day, and returns their revisions.
+func testAddLogs(t *testing.T, d *driver, days []time.Time) []int64 {
+	var revs []int64
+	for _, ts := range days {
+		for i, cat := range []sabakan.AuditCategory{sabakan.AuditIPAM, sabakan.AuditMachines} {
+			err := d.update(context.Background(), func(t *txn) error {
+				revs = append(revs, t.rev)
+				return t.addLog(ts.Add(time.Duration(i)*time.Minute), cat, "instance", "action", "test")
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return revs
+}
+
+func testLogRevisions(t *testing.T, d *driver, q *sabakan.LogQuery) []int64 {
+	buf := new(bytes.Buffer)
+	err := d.logQuery(context.Background(), q, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var revs []int64
+	for _, a := range testParseLogs(t, buf.Bytes()) {
+		revs = append(revs, a.Revision)
+	}
+	return revs
+}
+
+func testParseLogs(t *testing.T, data []byte) []*sabakan.AuditLog {
+	var logs []*sabakan.AuditLog
+	for _, line := range bytes.Split(bytes.TrimSpace(data), []byte{'\n'}) {
+		if len(line) == 0 {
+			continue
+		}
+		a := new(sabakan.AuditLog)
+		err := json.Unmarshal(line, a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		logs = append(logs, a)
+	}
+	return logs
+}
+
+func testLogCompact(t *testing.T) {
+	t.Parallel()
+
+	d := testNewDriver(t)
+	d.logConfig.RetentionDays = 30
+	ctx := context.Background()
+
+	now := time.Date(2013, time.April, 5, 1, 2, 3, 4, time.UTC)
+	revs := testAddLogs(t, d, []time.Time{
+		now.AddDate(0, 0, -31),
+		now.AddDate(0, 0, -1),
+	})
+
+	err := d.logCompact(ctx, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logs := testLogs(t, d)
+	if len(logs) != 2 || logs[0].Revision != revs[2] {
+		t.Error("old logs were not removed:", logs)
+	}
+
+	chain, err := d.logChain(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := sabakan.VerifyAuditChain(logs, chain, nil, true, true)
+	if !r.OK() || !r.Anchored {
+		t.Error("logs should be anchored after compaction:", r)
+	}
+
+	// compaction runs only once a day
+	err = d.logTryCompact(ctx, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testAddLogs(t, d, []time.Time{now.AddDate(0, 0, -40)})
+	err = d.logTryCompact(ctx, now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(testLogs(t, d)) != 4 {
+		t.Error("logs should not be compacted")
+	}
+	err = d.logTryCompact(ctx, now.Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(testLogs(t, d)) != 2 {
+		t.Error("logs should be compacted")
+	}
+}
+
+func testLogArchive(t *testing.T) {
+	t.Parallel()
+
+	d := testNewDriver(t)
+	ctx := context.Background()
+
+	archive, err := logarchive.NewDir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.logConfig.RetentionDays = 30
+	d.logConfig.Archive = archive
+
+	now := time.Date(2013, time.April, 5, 1, 2, 3, 4, time.UTC)
+	days := []time.Time{
+		now.AddDate(0, 0, -32),
+		now.AddDate(0, 0, -31),
+		now.AddDate(0, 0, -1),
+	}
+	revs := testAddLogs(t, d, days)
+
+	err = d.logCompact(ctx, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(testLogs(t, d)); n != 2 {
+		t.Error("unexpected number of logs:", n)
+	}
+	for _, day := range days[:2] {
+		buf := new(bytes.Buffer)
+		err = archive.Load(ctx, day, buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := bytes.Count(buf.Bytes(), []byte{'\n'}); n != 2 {
+			t.Error("wrong number of archived logs:", day, n)
+		}
+	}
+
+	cases := []struct {
+		q        *sabakan.LogQuery
+		expected []int64
+	}{
+		{&sabakan.LogQuery{}, revs[4:]},
+		{&sabakan.LogQuery{Since: now.AddDate(0, 0, -40)}, revs},
+		{&sabakan.LogQuery{Since: now.AddDate(0, 0, -31)}, revs[2:]},
+		{&sabakan.LogQuery{Since: now.AddDate(0, 0, -40), Until: now.AddDate(0, 0, -31)}, revs[:2]},
+		{&sabakan.LogQuery{Since: now.AddDate(0, 0, -40), Order: sabakan.LogOrderDesc, Limit: 3},
+			[]int64{revs[5], revs[4], revs[3]}},
+		{&sabakan.LogQuery{Since: now.AddDate(0, 0, -40), Category: sabakan.AuditMachines},
+			[]int64{revs[1], revs[3], revs[5]}},
+	}
+	for i, c := range cases {
+		actual := testLogRevisions(t, d, c.q)
+		if !cmp.Equal(actual, c.expected) {
+			t.Error("unexpected logs:", i, actual)
+		}
+	}
+}
+
+func TestLog(t *testing.T) {
+	t.Run("Compact", testLogCompact)
+	t.Run("Archive", testLogArchive)
+}
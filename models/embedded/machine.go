@@ -0,0 +1,294 @@
+package embedded
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+func (t *txn) getMachine(serial string) (*sabakan.Machine, error) {
+	m := new(sabakan.Machine)
+	found, err := t.getJSON(KeyMachines+serial, m)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, sabakan.ErrNotFound
+	}
+	return m, nil
+}
+
+// usedIndices returns node indices used in the rack.
+//
+// Unlike etcd, node indices are not stored separately because
+// they are always consistent with machines.
+func (t *txn) usedIndices(rack uint) (map[uint]bool, error) {
+	used := make(map[uint]bool)
+	err := t.scan(KeyMachines, func(_ string, value []byte) error {
+		m := new(sabakan.Machine)
+		err := json.Unmarshal(value, m)
+		if err != nil {
+			return err
+		}
+		if m.Spec.Rack == rack {
+			used[m.Spec.IndexInRack] = true
+		}
+		return nil
+	})
+	return used, err
+}
+
+// assignNodeIndex assigns a node index to m.
+// Boot servers always have NodeIndexOffset.  Others have the smallest
+// unused index in the rack.
+func assignNodeIndex(m *sabakan.Machine, used map[uint]bool, c *sabakan.IPAMConfig) error {
+	if m.Spec.Role == "boot" {
+		idx := c.NodeIndexOffset
+		if used[idx] {
+			return sabakan.ErrConflicted
+		}
+		used[idx] = true
+		m.Spec.IndexInRack = idx
+		return nil
+	}
+
+	for i := uint(0); i < c.MaxNodesInRack; i++ {
+		idx := i + c.NodeIndexOffset + 1
+		if !used[idx] {
+			used[idx] = true
+			m.Spec.IndexInRack = idx
+			return nil
+		}
+	}
+	return errors.New("no node index is available for new machine")
+}
+
+func (d *driver) machineRegister(ctx context.Context, machines []*sabakan.Machine) error {
+	return d.update(ctx, func(t *txn) error {
+		cfg, err := t.getIPAMConfig()
+		if err != nil {
+			return err
+		}
+
+		for _, m := range machines {
+			if t.get(KeyMachines+m.Spec.Serial) != nil {
+				return sabakan.ErrConflicted
+			}
+		}
+
+		usage := make(map[uint]map[uint]bool)
+		serials := make([]string, len(machines))
+		for i, m := range machines {
+			used := usage[m.Spec.Rack]
+			if used == nil {
+				used, err = t.usedIndices(m.Spec.Rack)
+				if err != nil {
+					return err
+				}
+				usage[m.Spec.Rack] = used
+			}
+
+			err = assignNodeIndex(m, used, cfg)
+			if err != nil {
+				return err
+			}
+			cfg.GenerateIP(m)
+
+			err = t.putJSON(KeyMachines+m.Spec.Serial, m)
+			if err != nil {
+				return err
+			}
+			serials[i] = m.Spec.Serial
+		}
+
+		return t.addLog(time.Now(), sabakan.AuditMachines, "", "register",
+			strings.Join(serials, "\n"))
+	})
+}
+
+func (d *driver) machineGet(ctx context.Context, serial string) (*sabakan.Machine, error) {
+	var m *sabakan.Machine
+	err := d.view(ctx, func(t *txn) error {
+		var err error
+		m, err = t.getMachine(serial)
+		return err
+	})
+	return m, err
+}
+
+// machineUpdate updates a machine by fn and records the difference.
+// If fn returns false, the audit log is not recorded.
+func (d *driver) machineUpdate(ctx context.Context, serial, action string,
+	fn func(t *txn, m *sabakan.Machine) (bool, error)) error {
+
+	return d.update(ctx, func(t *txn) error {
+		m, err := t.getMachine(serial)
+		if err != nil {
+			return err
+		}
+		before, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+
+		changed, err := fn(t, m)
+		if err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		err = t.put(KeyMachines+serial, data)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			return nil
+		}
+
+		detail, err := sabakan.AuditDiff(before, data)
+		if err != nil {
+			return err
+		}
+		return t.addLog(time.Now(), sabakan.AuditMachines, serial, action, detail)
+	})
+}
+
+func (d *driver) machineSetState(ctx context.Context, serial string, state sabakan.MachineState) error {
+	return d.machineUpdate(ctx, serial, "set-state", func(t *txn, m *sabakan.Machine) (bool, error) {
+		prevState := m.Status.State
+		err := m.SetState(state)
+		if err != nil {
+			return false, err
+		}
+		if state == sabakan.StateRetired && t.hasPrefix(KeyCrypts+serial+"/") {
+			return false, sabakan.ErrEncryptionKeyExists
+		}
+
+		// setting the same state is frequent and changes nothing
+		return prevState != state, nil
+	})
+}
+
+func (d *driver) machinePutLabel(ctx context.Context, serial string, label, value string) error {
+	return d.machineUpdate(ctx, serial, "put-label", func(t *txn, m *sabakan.Machine) (bool, error) {
+		m.PutLabel(label, value)
+		return true, nil
+	})
+}
+
+func (d *driver) machineDeleteLabel(ctx context.Context, serial string, label string) error {
+	return d.machineUpdate(ctx, serial, "delete-label", func(t *txn, m *sabakan.Machine) (bool, error) {
+		return true, m.DeleteLabel(label)
+	})
+}
+
+func (d *driver) machineSetRetireDate(ctx context.Context, serial string, date time.Time) error {
+	return d.machineUpdate(ctx, serial, "set-retire-date", func(t *txn, m *sabakan.Machine) (bool, error) {
+		m.Spec.RetireDate = date
+		return true, nil
+	})
+}
+
+func (d *driver) machineQuery(ctx context.Context, q sabakan.Query) ([]*sabakan.Machine, error) {
+	var res []*sabakan.Machine
+	err := d.view(ctx, func(t *txn) error {
+		return t.scan(KeyMachines, func(_ string, value []byte) error {
+			m := new(sabakan.Machine)
+			err := json.Unmarshal(value, m)
+			if err != nil {
+				return err
+			}
+
+			matched, err := q.Match(m)
+			if err != nil {
+				return err
+			}
+			if matched {
+				res = append(res, m)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (d *driver) machineDelete(ctx context.Context, serial string) error {
+	return d.update(ctx, func(t *txn) error {
+		m, err := t.getMachine(serial)
+		if err != nil {
+			return err
+		}
+		if m.Status.State != sabakan.StateRetired {
+			return errors.New("non-retired machine cannot be deleted")
+		}
+
+		before, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		detail, err := sabakan.AuditDiff(before, nil)
+		if err != nil {
+			return err
+		}
+
+		_, err = t.delete(KeyMachines + serial)
+		if err != nil {
+			return err
+		}
+		return t.addLog(time.Now(), sabakan.AuditMachines, serial, "delete", detail)
+	})
+}
+
+type machineDriver struct {
+	*driver
+}
+
+// Register implements sabakan.MachineModel
+func (d machineDriver) Register(ctx context.Context, machines []*sabakan.Machine) error {
+	return d.machineRegister(ctx, machines)
+}
+
+// Get implements sabakan.MachineModel
+func (d machineDriver) Get(ctx context.Context, serial string) (*sabakan.Machine, error) {
+	return d.machineGet(ctx, serial)
+}
+
+// SetState implements sabakan.MachineModel
+func (d machineDriver) SetState(ctx context.Context, serial string, state sabakan.MachineState) error {
+	return d.machineSetState(ctx, serial, state)
+}
+
+// PutLabel implements sabakan.MachineModel
+func (d machineDriver) PutLabel(ctx context.Context, serial string, label, value string) error {
+	return d.machinePutLabel(ctx, serial, label, value)
+}
+
+// DeleteLabel implements sabakan.MachineModel
+func (d machineDriver) DeleteLabel(ctx context.Context, serial string, label string) error {
+	return d.machineDeleteLabel(ctx, serial, label)
+}
+
+// SetRetireDate implements sabakan.MachineModel
+func (d machineDriver) SetRetireDate(ctx context.Context, serial string, date time.Time) error {
+	return d.machineSetRetireDate(ctx, serial, date)
+}
+
+// Query implements sabakan.MachineModel
+func (d machineDriver) Query(ctx context.Context, query sabakan.Query) ([]*sabakan.Machine, error) {
+	return d.machineQuery(ctx, query)
+}
+
+// Delete implements sabakan.MachineModel
+func (d machineDriver) Delete(ctx context.Context, serial string) error {
+	return d.machineDelete(ctx, serial)
+}
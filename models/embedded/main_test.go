@@ -0,0 +1,70 @@
+package embedded
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/url"
+	"testing"
+
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+func testOpenModel(t *testing.T, dataDir string) sabakan.Model {
+	db, err := OpenDB(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	u, err := url.Parse("http://localhost:10080")
+	if err != nil {
+		t.Fatal(err)
+	}
+	model, err := NewModel(db, dataDir, u, sabakan.LogConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return model
+}
+
+func testOpenDriver(t *testing.T, dataDir string) *driver {
+	return testOpenModel(t, dataDir).Runner.(*driver)
+}
+
+func testNewDriver(t *testing.T) *driver {
+	return testOpenDriver(t, t.TempDir())
+}
+
+// testLogs returns all audit logs in the database.
+func testLogs(t *testing.T, d *driver) []*sabakan.AuditLog {
+	buf := new(bytes.Buffer)
+	err := d.logQuery(context.Background(), &sabakan.LogQuery{}, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var logs []*sabakan.AuditLog
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		a := new(sabakan.AuditLog)
+		err := json.Unmarshal(scanner.Bytes(), a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		logs = append(logs, a)
+	}
+	return logs
+}
+
+// testLastLog returns the last audit log in the database.
+func testLastLog(t *testing.T, d *driver) *sabakan.AuditLog {
+	logs := testLogs(t, d)
+	if len(logs) == 0 {
+		t.Fatal("no audit logs")
+	}
+	return logs[len(logs)-1]
+}
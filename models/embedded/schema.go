@@ -0,0 +1,38 @@
+package embedded
+
+import (
+	"context"
+	"errors"
+
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+// Version implements sabakan.SchemaModel
+//
+// The embedded database has been introduced with the current schema,
+// so a new database is initialized with sabakan.SchemaVersion.
+func (d *driver) Version(ctx context.Context) (string, error) {
+	var sv string
+	err := d.update(ctx, func(t *txn) error {
+		if v := t.get(KeyVersion); v != nil {
+			sv = string(v)
+			return nil
+		}
+		sv = sabakan.SchemaVersion
+		return t.put(KeyVersion, []byte(sv))
+	})
+	return sv, err
+}
+
+// Upgrade implements sabakan.SchemaModel
+func (d *driver) Upgrade(ctx context.Context) error {
+	sv, err := d.Version(ctx)
+	if err != nil {
+		return err
+	}
+
+	if sv == sabakan.SchemaVersion {
+		return nil
+	}
+	return errors.New("unknown schema version: " + sv)
+}
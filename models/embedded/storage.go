@@ -0,0 +1,146 @@
+package embedded
+
+import (
+	"context"
+	"errors"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+// cryptMeta is the value of KeyCryptsMeta keys.
+//
+// Unlike etcd, bbolt does not track revisions of keys, so the revision
+// of the transaction that created the key is recorded here.
+type cryptMeta struct {
+	CreatedAt time.Time `json:"created-at"`
+	Revision  int64     `json:"revision"`
+}
+
+// GetEncryptionKey implements sabakan.StorageModel
+func (d *driver) GetEncryptionKey(ctx context.Context, serial string, diskByPath string) ([]byte, error) {
+	target := path.Join(KeyCrypts, serial, diskByPath)
+
+	var key []byte
+	err := d.update(ctx, func(t *txn) error {
+		value := t.get(target)
+		if value == nil {
+			return t.addLog(time.Now(), sabakan.AuditCrypts, serial, "get-failed",
+				diskByPath+": not found")
+		}
+
+		key = append([]byte(nil), value...)
+		return t.addLog(time.Now(), sabakan.AuditCrypts, serial, "get", diskByPath)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// PutEncryptionKey implements sabakan.StorageModel
+func (d *driver) PutEncryptionKey(ctx context.Context, serial string, diskByPath string, key []byte) error {
+	target := path.Join(KeyCrypts, serial, diskByPath)
+	metaKey := path.Join(KeyCryptsMeta, serial, diskByPath)
+
+	return d.update(ctx, func(t *txn) error {
+		m, err := t.getMachine(serial)
+		if err != nil {
+			return err
+		}
+		if m.Status.State == sabakan.StateRetiring || m.Status.State == sabakan.StateRetired {
+			return errors.New("machine was retiring or retired")
+		}
+		if t.get(target) != nil {
+			return sabakan.ErrConflicted
+		}
+
+		err = t.put(target, key)
+		if err != nil {
+			return err
+		}
+		err = t.putJSON(metaKey, cryptMeta{CreatedAt: time.Now().UTC(), Revision: t.rev})
+		if err != nil {
+			return err
+		}
+		return t.addLog(time.Now(), sabakan.AuditCrypts, serial, "put", diskByPath)
+	})
+}
+
+// DeleteEncryptionKeys implements sabakan.StorageModel
+func (d *driver) DeleteEncryptionKeys(ctx context.Context, serial string) ([]string, error) {
+	ckey := path.Join(KeyCrypts, serial) + "/"
+	metaKey := path.Join(KeyCryptsMeta, serial) + "/"
+
+	var ret []string
+	err := d.update(ctx, func(t *txn) error {
+		m, err := t.getMachine(serial)
+		if err != nil {
+			return err
+		}
+		if m.Status.State != sabakan.StateRetiring {
+			return errors.New("machine is not retiring")
+		}
+
+		keys, err := t.deletePrefix(ckey)
+		if err != nil {
+			return err
+		}
+		_, err = t.deletePrefix(metaKey)
+		if err != nil {
+			return err
+		}
+
+		ret = make([]string, len(keys))
+		for i, k := range keys {
+			ret[i] = k[len(ckey):]
+		}
+		return t.addLog(time.Now(), sabakan.AuditCrypts, serial, "delete", "")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// ListEncryptionKeys implements sabakan.StorageModel
+func (d *driver) ListEncryptionKeys(ctx context.Context, serial string) ([]*sabakan.EncryptionKeyInfo, error) {
+	var prefix string
+	if serial != "" {
+		prefix = serial + "/"
+	}
+
+	infos := []*sabakan.EncryptionKeyInfo{}
+	err := d.view(ctx, func(t *txn) error {
+		if serial != "" && t.get(KeyMachines+serial) == nil {
+			return sabakan.ErrNotFound
+		}
+
+		return t.scan(KeyCrypts+prefix, func(key string, _ []byte) error {
+			name := key[len(KeyCrypts):]
+			fields := strings.SplitN(name, "/", 2)
+			if len(fields) != 2 {
+				return nil
+			}
+
+			var meta cryptMeta
+			_, err := t.getJSON(KeyCryptsMeta+name, &meta)
+			if err != nil {
+				return err
+			}
+			infos = append(infos, &sabakan.EncryptionKeyInfo{
+				Serial:    fields[0],
+				Path:      fields[1],
+				CreatedAt: meta.CreatedAt,
+				Revision:  meta.Revision,
+			})
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return infos, nil
+}
@@ -0,0 +1,94 @@
+package embedded
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+func (d *driver) switchPut(ctx context.Context, sw *sabakan.Switch) error {
+	data, err := json.Marshal(sw)
+	if err != nil {
+		return err
+	}
+
+	return d.update(ctx, func(t *txn) error {
+		err := t.put(KeySwitches+sw.MAC, data)
+		if err != nil {
+			return err
+		}
+		return t.addLog(time.Now(), sabakan.AuditSwitches, sw.MAC, "put", string(data))
+	})
+}
+
+func (d *driver) switchGet(ctx context.Context, mac string) (*sabakan.Switch, error) {
+	sw := new(sabakan.Switch)
+	err := d.view(ctx, func(t *txn) error {
+		found, err := t.getJSON(KeySwitches+mac, sw)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return sabakan.ErrNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sw, nil
+}
+
+func (d *driver) switchGetAll(ctx context.Context) ([]*sabakan.Switch, error) {
+	switches := []*sabakan.Switch{}
+	err := d.view(ctx, func(t *txn) error {
+		return t.scan(KeySwitches, func(_ string, value []byte) error {
+			sw := new(sabakan.Switch)
+			err := json.Unmarshal(value, sw)
+			if err != nil {
+				return err
+			}
+			switches = append(switches, sw)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return switches, nil
+}
+
+func (d *driver) switchDelete(ctx context.Context, mac string) error {
+	return d.update(ctx, func(t *txn) error {
+		deleted, err := t.delete(KeySwitches + mac)
+		if err != nil {
+			return err
+		}
+		if !deleted {
+			return sabakan.ErrNotFound
+		}
+		return t.addLog(time.Now(), sabakan.AuditSwitches, mac, "delete", "")
+	})
+}
+
+type switchDriver struct {
+	*driver
+}
+
+func (d switchDriver) Put(ctx context.Context, sw *sabakan.Switch) error {
+	return d.switchPut(ctx, sw)
+}
+
+func (d switchDriver) Get(ctx context.Context, mac string) (*sabakan.Switch, error) {
+	return d.switchGet(ctx, mac)
+}
+
+func (d switchDriver) GetAll(ctx context.Context) ([]*sabakan.Switch, error) {
+	return d.switchGetAll(ctx)
+}
+
+func (d switchDriver) Delete(ctx context.Context, mac string) error {
+	return d.switchDelete(ctx, mac)
+}
@@ -0,0 +1,125 @@
+package embedded
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+// webhookCursor is the position of the last delivered audit log entry.
+//
+// Revision is the revision of the entry.  As in the etcd driver, entries
+// written after the cursor are searched from one day before Timestamp.
+type webhookCursor struct {
+	Revision  int64     `json:"revision"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func (d *driver) webhookPut(ctx context.Context, hook *sabakan.Webhook) error {
+	data, err := json.Marshal(hook)
+	if err != nil {
+		return err
+	}
+
+	// do not record the secret
+	copied := *hook
+	copied.Secret = ""
+	detail, err := json.Marshal(&copied)
+	if err != nil {
+		return err
+	}
+
+	return d.update(ctx, func(t *txn) error {
+		err := t.put(KeyWebhooks+hook.Name, data)
+		if err != nil {
+			return err
+		}
+
+		// audit logs written after this will be delivered.
+		now := time.Now()
+		key := KeyWebhookCursors + hook.Name
+		if t.get(key) == nil {
+			err = t.putJSON(key, webhookCursor{Revision: t.rev, Timestamp: now.UTC()})
+			if err != nil {
+				return err
+			}
+		}
+		return t.addLog(now, sabakan.AuditWebhooks, hook.Name, "put", string(detail))
+	})
+}
+
+func (d *driver) webhookGet(ctx context.Context, name string) (*sabakan.Webhook, error) {
+	hook := new(sabakan.Webhook)
+	err := d.view(ctx, func(t *txn) error {
+		found, err := t.getJSON(KeyWebhooks+name, hook)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return sabakan.ErrNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hook, nil
+}
+
+func (d *driver) webhookGetAll(ctx context.Context) ([]*sabakan.Webhook, error) {
+	hooks := []*sabakan.Webhook{}
+	err := d.view(ctx, func(t *txn) error {
+		return t.scan(KeyWebhooks, func(_ string, value []byte) error {
+			hook := new(sabakan.Webhook)
+			err := json.Unmarshal(value, hook)
+			if err != nil {
+				return err
+			}
+			hooks = append(hooks, hook)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hooks, nil
+}
+
+func (d *driver) webhookDelete(ctx context.Context, name string) error {
+	return d.update(ctx, func(t *txn) error {
+		deleted, err := t.delete(KeyWebhooks + name)
+		if err != nil {
+			return err
+		}
+		if !deleted {
+			return sabakan.ErrNotFound
+		}
+		_, err = t.delete(KeyWebhookCursors + name)
+		if err != nil {
+			return err
+		}
+		return t.addLog(time.Now(), sabakan.AuditWebhooks, name, "delete", "")
+	})
+}
+
+type webhookDriver struct {
+	*driver
+}
+
+func (d webhookDriver) Put(ctx context.Context, hook *sabakan.Webhook) error {
+	return d.webhookPut(ctx, hook)
+}
+
+func (d webhookDriver) Get(ctx context.Context, name string) (*sabakan.Webhook, error) {
+	return d.webhookGet(ctx, name)
+}
+
+func (d webhookDriver) GetAll(ctx context.Context) ([]*sabakan.Webhook, error) {
+	return d.webhookGetAll(ctx)
+}
+
+func (d webhookDriver) Delete(ctx context.Context, name string) error {
+	return d.webhookDelete(ctx, name)
+}
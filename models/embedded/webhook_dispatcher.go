@@ -0,0 +1,277 @@
+package embedded
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cybozu-go/log"
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+// cloudEvent is a CloudEvents v1.0 envelope in the structured content mode.
+type cloudEvent struct {
+	SpecVersion     string            `json:"specversion"`
+	ID              string            `json:"id"`
+	Source          string            `json:"source"`
+	Type            string            `json:"type"`
+	Subject         string            `json:"subject,omitempty"`
+	Time            time.Time         `json:"time"`
+	DataContentType string            `json:"datacontenttype"`
+	Data            *sabakan.AuditLog `json:"data"`
+}
+
+type webhookBackoff struct {
+	failures int
+	next     time.Time
+}
+
+// webhookSender sends audit log entries to webhooks in the same way
+// as the etcd driver.
+type webhookSender struct {
+	client  *http.Client
+	backoff map[string]*webhookBackoff
+}
+
+func (s *webhookSender) ready(name string, now time.Time) bool {
+	b, ok := s.backoff[name]
+	return !ok || !now.Before(b.next)
+}
+
+func (s *webhookSender) record(name string, now time.Time, err error) {
+	if err == nil {
+		delete(s.backoff, name)
+		return
+	}
+
+	b, ok := s.backoff[name]
+	if !ok {
+		b = new(webhookBackoff)
+		s.backoff[name] = b
+	}
+	b.failures++
+
+	wait := webhookMaxBackoff
+	if b.failures < 32 && webhookMinBackoff<<(b.failures-1) < webhookMaxBackoff {
+		wait = webhookMinBackoff << (b.failures - 1)
+	}
+	b.next = now.Add(wait)
+}
+
+func (s *webhookSender) forget(names map[string]bool) {
+	for name := range s.backoff {
+		if !names[name] {
+			delete(s.backoff, name)
+		}
+	}
+}
+
+func (s *webhookSender) post(ctx context.Context, hook *sabakan.Webhook, id string, a *sabakan.AuditLog) error {
+	var body []byte
+	var err error
+	contentType := "application/json"
+	if hook.CloudEvents {
+		body, err = json.Marshal(cloudEvent{
+			SpecVersion:     "1.0",
+			ID:              id,
+			Source:          "sabakan",
+			Type:            "sabakan.audit." + string(a.Category),
+			Subject:         a.Instance,
+			Time:            a.Timestamp,
+			DataContentType: "application/json",
+			Data:            a,
+		})
+		contentType = "application/cloudevents+json"
+	} else {
+		body, err = json.Marshal(a)
+	}
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set(sabakan.WebhookDeliveryHeader, id)
+	if hook.Secret != "" {
+		req.Header.Set(sabakan.WebhookSignatureHeader, sabakan.SignWebhookPayload(hook.Secret, body))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// pendingLog is an audit log entry to be delivered.
+type pendingLog struct {
+	id  string
+	rev int64
+	log *sabakan.AuditLog
+}
+
+// auditRevision returns the revision in an audit log key.
+func auditRevision(key string) (int64, error) {
+	if len(key) < 16 {
+		return 0, fmt.Errorf("invalid audit log key: %s", key)
+	}
+	rev, err := strconv.ParseUint(key[len(key)-16:], 16, 64)
+	return int64(rev), err
+}
+
+// pendingLogs returns audit logs written after the cursor in the order
+// of revisions, and the current revision.
+func (t *txn) pendingLogs(cur *webhookCursor) ([]pendingLog, int64, error) {
+	var logs []pendingLog
+	_, err := t.scanRange(auditKey(cur.Timestamp.Add(-24*time.Hour)), prefixEnd(KeyAudit), false,
+		func(key string, value []byte) (bool, error) {
+			rev, err := auditRevision(key)
+			if err != nil {
+				return false, err
+			}
+			if rev <= cur.Revision {
+				return false, nil
+			}
+
+			a := new(sabakan.AuditLog)
+			err = json.Unmarshal(value, a)
+			if err != nil {
+				return false, err
+			}
+			logs = append(logs, pendingLog{strings.TrimPrefix(key, KeyAudit), rev, a})
+			return false, nil
+		})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	sort.Slice(logs, func(i, j int) bool {
+		return logs[i].rev < logs[j].rev
+	})
+	return logs, int64(t.b.Sequence()), nil
+}
+
+// deliverWebhook delivers audit logs written after the cursor to the webhook.
+func (d *driver) deliverWebhook(ctx context.Context, s *webhookSender, hook *sabakan.Webhook) error {
+	key := KeyWebhookCursors + hook.Name
+	cur := new(webhookCursor)
+
+	var logs []pendingLog
+	var headRev int64
+	err := d.view(ctx, func(t *txn) error {
+		found, err := t.getJSON(key, cur)
+		if err != nil || !found {
+			return err
+		}
+		logs, headRev, err = t.pendingLogs(cur)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if headRev <= cur.Revision {
+		return nil
+	}
+
+	saveCursor := func() error {
+		return d.update(ctx, func(t *txn) error {
+			// the webhook may have been deleted
+			if t.get(KeyWebhooks+hook.Name) == nil {
+				return nil
+			}
+			return t.putJSON(key, cur)
+		})
+	}
+
+	for _, l := range logs {
+		matched := hook.Match(l.log)
+		if matched {
+			err = s.post(ctx, hook, l.id, l.log)
+			if err != nil {
+				return err
+			}
+		}
+		cur.Revision = l.rev
+		if l.log.Timestamp.After(cur.Timestamp) {
+			cur.Timestamp = l.log.Timestamp
+		}
+		if matched {
+			err = saveCursor()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	cur.Revision = headRev
+	return saveCursor()
+}
+
+// deliverWebhooks delivers audit logs to all webhooks that are not backing off.
+func (d *driver) deliverWebhooks(ctx context.Context, s *webhookSender) {
+	hooks, err := d.webhookGetAll(ctx)
+	if err != nil {
+		log.Error("embedded: failed to list webhooks", map[string]interface{}{
+			log.FnError: err,
+		})
+		return
+	}
+
+	names := make(map[string]bool)
+	for _, hook := range hooks {
+		names[hook.Name] = true
+		if !s.ready(hook.Name, time.Now()) {
+			continue
+		}
+
+		err := d.deliverWebhook(ctx, s, hook)
+		if ctx.Err() != nil {
+			return
+		}
+		s.record(hook.Name, time.Now(), err)
+		if err != nil {
+			log.Warn("embedded: failed to deliver audit logs to webhook", map[string]interface{}{
+				log.FnError: err,
+				"webhook":   hook.Name,
+				"failures":  s.backoff[hook.Name].failures,
+			})
+		}
+	}
+	s.forget(names)
+}
+
+// webhookDispatcher is a goroutine to deliver audit logs to webhooks.
+func (d *driver) webhookDispatcher(ctx context.Context) error {
+	s := &webhookSender{
+		client:  &http.Client{Timeout: webhookTimeout},
+		backoff: make(map[string]*webhookBackoff),
+	}
+
+	ticker := time.NewTicker(webhookInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			d.deliverWebhooks(ctx, s)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package embedded
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+type testWebhookServer struct {
+	mu       sync.Mutex
+	logs     []*sabakan.AuditLog
+	ids      []string
+	failures int
+}
+
+func (s *testWebhookServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failures > 0 {
+		s.failures--
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	a := new(sabakan.AuditLog)
+	err = json.Unmarshal(data, a)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s.logs = append(s.logs, a)
+	s.ids = append(s.ids, r.Header.Get(sabakan.WebhookDeliveryHeader))
+}
+
+func testWebhookDeliver(t *testing.T) {
+	t.Parallel()
+
+	d := testNewDriver(t)
+	ctx := context.Background()
+
+	ts := &testWebhookServer{failures: 1}
+	server := httptest.NewServer(ts)
+	defer server.Close()
+
+	err := d.recordLog(ctx, sabakan.AuditIPXE, "before", "action", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hook := &sabakan.Webhook{
+		Name:       "test",
+		URL:        server.URL,
+		Categories: []sabakan.AuditCategory{sabakan.AuditIPXE},
+	}
+	err = d.webhookPut(ctx, hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, instance := range []string{"1", "2"} {
+		err = d.recordLog(ctx, sabakan.AuditIPXE, instance, "action", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = d.switchPut(ctx, &sabakan.Switch{MAC: "00:00:00:00:00:01"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &webhookSender{
+		client:  &http.Client{Timeout: 10 * time.Second},
+		backoff: make(map[string]*webhookBackoff),
+	}
+	err = d.deliverWebhook(ctx, s, hook)
+	if err == nil {
+		t.Error("delivery should fail")
+	}
+	err = d.deliverWebhook(ctx, s, hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// nothing is delivered twice
+	err = d.deliverWebhook(ctx, s, hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if len(ts.logs) != 2 || ts.logs[0].Instance != "1" || ts.logs[1].Instance != "2" {
+		t.Fatal("unexpected delivered logs:", ts.logs)
+	}
+	if ts.ids[0] == "" || ts.ids[0] == ts.ids[1] {
+		t.Error("unexpected delivery IDs:", ts.ids)
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	t.Run("Deliver", testWebhookDeliver)
+}
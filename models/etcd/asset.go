@@ -123,7 +123,11 @@ func (d *driver) assetGetInfoWithRev(ctx context.Context, name string) (*sabakan
 func (d *driver) assetGetInfo(ctx context.Context, name string) (*sabakan.Asset, error) {
 	a, _, err := d.assetGetInfoWithRev(ctx, name)
 	if a != nil {
-		a.Exists = d.getAssetDir().Exists(a.ID)
+		if d.objects.Store != nil {
+			a.Exists = d.assetObjectExists(ctx, a.ID)
+		} else {
+			a.Exists = d.getAssetDir().Exists(a.ID)
+		}
 	}
 	return a, err
 }
@@ -135,15 +139,24 @@ func (d *driver) assetPut(ctx context.Context, name, contentType string,
 		return nil, err
 	}
 
+	var hsum []byte
+	var size int64
 	dir := d.getAssetDir()
-	hsum, err := dir.Save(id, r, csum)
-	if err != nil {
-		return nil, err
-	}
+	if d.objects.Store != nil {
+		hsum, size, err = d.assetSaveObject(ctx, id, r, csum)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		hsum, err = dir.Save(id, r, csum)
+		if err != nil {
+			return nil, err
+		}
 
-	size, err := dir.Size(id)
-	if err != nil {
-		return nil, err
+		size, err = dir.Size(id)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	hsumString := hex.EncodeToString(hsum)
@@ -154,38 +167,53 @@ func (d *driver) assetPut(ctx context.Context, name, contentType string,
 		Date:        time.Now().UTC(),
 		Size:        size,
 		Sha256:      hsumString,
+		Uploader:    sabakan.AuditUser(ctx),
 		Options:     options,
 		URLs:        []string{d.myURL("/api/v1/assets", name)},
 	}
-	data, err := json.Marshal(a)
-	if err != nil {
-		return nil, err
-	}
 
 	key := KeyAssets + name
-	resp, err := d.client.Get(ctx, key, clientv3.WithKeysOnly())
+	resp, err := d.client.Get(ctx, key)
 	if err != nil {
 		return nil, err
 	}
 
 	ifop := clientv3util.KeyMissing(key)
 	retStatus := http.StatusCreated
+	var dels []int
 
 	if resp.Count != 0 {
+		prev, err := decodeAsset(resp.Kvs[0].Value)
+		if err != nil {
+			return nil, err
+		}
+		dels = a.AppendHistory(prev)
 		rev := resp.Kvs[0].ModRevision
 		ifop = clientv3.Compare(clientv3.ModRevision(key), "=", rev)
 		retStatus = http.StatusOK
 	}
 
+	data, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+
 	tresp, err := d.client.Txn(ctx).
 		If(ifop).Then(clientv3.OpPut(key, string(data))).Commit()
 	if err != nil {
 		return nil, err
 	}
 	if !tresp.Succeeded {
-		dir.Remove(id)
+		if d.objects.Store != nil {
+			d.objects.Store.Delete(ctx, assetObjectKey(id))
+		} else {
+			dir.Remove(id)
+		}
 		return nil, sabakan.ErrConflicted
 	}
+	if d.objects.Store != nil {
+		d.assetDeleteObjects(ctx, dels)
+	}
 
 	d.addLog(ctx, time.Now(), tresp.Header.Revision, sabakan.AuditAssets,
 		name, "put", "new checksum: "+hsumString)
@@ -213,6 +241,10 @@ func (d *driver) assetGet(ctx context.Context, name string, h sabakan.AssetHandl
 		return err
 	}
 
+	if d.objects.Store != nil {
+		return d.assetServeObject(ctx, a, h)
+	}
+
 	dir := d.getAssetDir()
 
 	if dir.Exists(a.ID) {
@@ -234,7 +266,7 @@ func (d *driver) assetDelete(ctx context.Context, name string) error {
 	key := KeyAssets + name
 	resp, err := d.client.Txn(ctx).
 		If(clientv3util.KeyExists(key)).
-		Then(clientv3.OpDelete(key)).
+		Then(clientv3.OpDelete(key, clientv3.WithPrevKV())).
 		Commit()
 
 	if err != nil {
@@ -245,11 +277,84 @@ func (d *driver) assetDelete(ctx context.Context, name string) error {
 		return sabakan.ErrNotFound
 	}
 
+	if d.objects.Store != nil {
+		for _, prev := range resp.Responses[0].GetResponseDeleteRange().PrevKvs {
+			d.assetDeleteObject(ctx, prev.Value)
+		}
+	}
+
 	d.addLog(ctx, time.Now(), resp.Header.Revision, sabakan.AuditAssets, name, "delete", "")
 
 	return nil
 }
 
+func (d *driver) assetGetVersion(ctx context.Context, name string, id int, h sabakan.AssetHandler) error {
+	a, _, err := d.assetGetInfoWithRev(ctx, name)
+	if err != nil {
+		return err
+	}
+	v := a.Version(id)
+	if v == nil {
+		return sabakan.ErrNotFound
+	}
+
+	if d.objects.Store != nil {
+		return d.assetServeObject(ctx, v, h)
+	}
+
+	dir := d.getAssetDir()
+
+	if dir.Exists(id) {
+		g, err := os.Open(dir.Path(id))
+		if err != nil {
+			return err
+		}
+		defer g.Close()
+
+		h.ServeContent(v, g)
+		return nil
+	}
+
+	u := v.URLs[rand.Intn(len(v.URLs))]
+	h.Redirect(u + "?version=" + strconv.Itoa(id))
+	return nil
+}
+
+func (d *driver) assetRollback(ctx context.Context, name string, id int) error {
+	key := KeyAssets + name
+
+RETRY:
+	a, rev, err := d.assetGetInfoWithRev(ctx, name)
+	if err != nil {
+		return err
+	}
+	err = a.Rollback(id, time.Now())
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+
+	resp, err := d.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(key), "=", rev)).
+		Then(clientv3.OpPut(key, string(data))).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		goto RETRY
+	}
+
+	d.addLog(ctx, time.Now(), resp.Header.Revision, sabakan.AuditAssets,
+		name, "rollback", "new checksum: "+a.Sha256)
+
+	return nil
+}
+
 type assetDriver struct {
 	*driver
 }
@@ -278,3 +383,11 @@ func (d assetDriver) Get(ctx context.Context, name string, h sabakan.AssetHandle
 func (d assetDriver) Delete(ctx context.Context, name string) error {
 	return d.assetDelete(ctx, name)
 }
+
+func (d assetDriver) GetVersion(ctx context.Context, name string, id int, h sabakan.AssetHandler) error {
+	return d.assetGetVersion(ctx, name, id, h)
+}
+
+func (d assetDriver) Rollback(ctx context.Context, name string, id int) error {
+	return d.assetRollback(ctx, name, id)
+}
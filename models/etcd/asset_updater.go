@@ -136,6 +136,11 @@ func (d *driver) downloadAsset(ctx context.Context, asset *sabakan.Asset) error
 }
 
 func (d *driver) initAssets(ctx context.Context, rev int64) error {
+	if d.objects.Store != nil {
+		// assets in the object storage need not be replicated
+		return nil
+	}
+
 	resp, err := d.client.Get(ctx, KeyAssets,
 		clientv3.WithPrefix(),
 		clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend),
@@ -155,7 +160,10 @@ REDO:
 		if err != nil {
 			return err
 		}
-		ids[asset.ID] = true
+		// previous versions are kept if they exist, but not downloaded
+		for _, id := range asset.IDs() {
+			ids[id] = true
+		}
 		if dir.Exists(asset.ID) {
 			continue
 		}
@@ -223,10 +231,10 @@ func (d *driver) handleAssetAdd(ctx context.Context, asset *sabakan.Asset) error
 }
 
 func (d *driver) handleAssetUpdate(ctx context.Context, oldA, newA *sabakan.Asset) error {
-	if oldA.ID != newA.ID {
-		err := d.handleAssetDelete(ctx, oldA)
-		if err != nil {
-			return err
+	// remove versions discarded from the history
+	for _, id := range oldA.IDs() {
+		if newA.Version(id) == nil {
+			d.removeLocalAsset(oldA.Name, id)
 		}
 	}
 
@@ -234,28 +242,38 @@ func (d *driver) handleAssetUpdate(ctx context.Context, oldA, newA *sabakan.Asse
 }
 
 func (d *driver) handleAssetDelete(ctx context.Context, asset *sabakan.Asset) error {
+	for _, id := range asset.IDs() {
+		d.removeLocalAsset(asset.Name, id)
+	}
+	return nil
+}
+
+func (d *driver) removeLocalAsset(name string, id int) {
 	dir := d.getAssetDir()
 
-	if !dir.Exists(asset.ID) {
-		return nil
+	if !dir.Exists(id) {
+		return
 	}
 
 	log.Info("asset: delete a local copy", map[string]interface{}{
-		"name": asset.Name,
-		"id":   asset.ID,
+		"name": name,
+		"id":   id,
 	})
-	err := dir.Remove(asset.ID)
+	err := dir.Remove(id)
 	if err != nil {
 		log.Error("asset: failed to remove a local copy", map[string]interface{}{
 			log.FnError: err,
-			"name":      asset.Name,
-			"id":        asset.ID,
+			"name":      name,
+			"id":        id,
 		})
 	}
-	return nil
 }
 
 func (d *driver) handleAssetEvent(ctx context.Context, ev *clientv3.Event) error {
+	if d.objects.Store != nil {
+		return nil
+	}
+
 	switch {
 	case ev.IsCreate():
 		a, err := decodeAsset(ev.Kv.Value)
@@ -0,0 +1,422 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/cybozu-go/log"
+	"github.com/cybozu-go/sabakan/v3"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/clientv3util"
+)
+
+// maxBackupLoadOps is the maximum number of operations in a transaction
+// to load a backup.  etcd limits it to 128 by default.
+const maxBackupLoadOps = 100
+
+// backupPrefixes are prefixes of keys restored from backups.
+// Node indices are not included because they are left empty after
+// machines are deleted; they are overwritten by backups.
+var backupPrefixes = []string{
+	KeyMachines, KeyCrypts, KeyCryptsMeta, KeyCryptPolicies,
+	KeyKernelParams, KeyIgnitions, KeySwitches, KeyAssets,
+}
+
+func (d *driver) backupDump(ctx context.Context) (*sabakan.BackupState, error) {
+	// read everything at the same revision
+	resp, err := d.client.Txn(ctx).
+		Then(
+			clientv3.OpGet(KeyIPAM),
+			clientv3.OpGet(KeyDHCP),
+			clientv3.OpGet(KeyMachines, clientv3.WithPrefix()),
+			clientv3.OpGet(KeyCrypts, clientv3.WithPrefix()),
+			clientv3.OpGet(KeyCryptsMeta, clientv3.WithPrefix()),
+			clientv3.OpGet(KeyCryptPolicies, clientv3.WithPrefix()),
+			clientv3.OpGet(KeyKernelParams, clientv3.WithPrefix()),
+			clientv3.OpGet(KeyIgnitions, clientv3.WithPrefix()),
+			clientv3.OpGet(KeySwitches, clientv3.WithPrefix()),
+			clientv3.OpGet(KeyAssets, clientv3.WithPrefix()),
+			clientv3.OpGet(KeyImages, clientv3.WithPrefix()),
+		).
+		Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	state := &sabakan.BackupState{
+		KernelParams: make(map[string]string),
+		Ignitions:    make(map[string]map[string]*sabakan.IgnitionTemplate),
+		Images:       make(map[string]sabakan.ImageIndex),
+	}
+
+	if ipam := resp.Responses[0].GetResponseRange().Kvs; len(ipam) > 0 {
+		state.IPAM = new(sabakan.IPAMConfig)
+		err = json.Unmarshal(ipam[0].Value, state.IPAM)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if dhcp := resp.Responses[1].GetResponseRange().Kvs; len(dhcp) > 0 {
+		state.DHCP = new(sabakan.DHCPConfig)
+		err = json.Unmarshal(dhcp[0].Value, state.DHCP)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, kv := range resp.Responses[2].GetResponseRange().Kvs {
+		m := new(sabakan.Machine)
+		err = json.Unmarshal(kv.Value, m)
+		if err != nil {
+			return nil, err
+		}
+		state.Machines = append(state.Machines, m)
+	}
+
+	created := make(map[string]time.Time)
+	for _, kv := range resp.Responses[4].GetResponseRange().Kvs {
+		var meta cryptMeta
+		err = json.Unmarshal(kv.Value, &meta)
+		if err != nil {
+			return nil, err
+		}
+		created[string(kv.Key)[len(KeyCryptsMeta):]] = meta.CreatedAt
+	}
+	for _, kv := range resp.Responses[3].GetResponseRange().Kvs {
+		name := string(kv.Key)[len(KeyCrypts):]
+		fields := strings.SplitN(name, "/", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		key, err := d.unwrapKey(ctx, string(kv.Key), kv.Value)
+		if err != nil {
+			return nil, err
+		}
+		state.CryptKeys = append(state.CryptKeys, &sabakan.BackupCryptKey{
+			Serial:    fields[0],
+			Path:      fields[1],
+			Key:       key,
+			CreatedAt: created[name],
+		})
+	}
+
+	for _, kv := range resp.Responses[5].GetResponseRange().Kvs {
+		fields := strings.SplitN(string(kv.Key)[len(KeyCryptPolicies):], "/", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		policy := new(sabakan.CryptPolicy)
+		err = json.Unmarshal(kv.Value, policy)
+		if err != nil {
+			return nil, err
+		}
+		state.CryptPolicies = append(state.CryptPolicies, &sabakan.BackupCryptPolicy{
+			Kind:   fields[0],
+			Name:   fields[1],
+			Policy: policy,
+		})
+	}
+
+	for _, kv := range resp.Responses[6].GetResponseRange().Kvs {
+		state.KernelParams[string(kv.Key)[len(KeyKernelParams):]] = string(kv.Value)
+	}
+
+	for _, kv := range resp.Responses[7].GetResponseRange().Kvs {
+		fields := strings.SplitN(string(kv.Key)[len(KeyIgnitions):], "/", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		tmpl := new(sabakan.IgnitionTemplate)
+		err = json.Unmarshal(kv.Value, tmpl)
+		if err != nil {
+			return nil, err
+		}
+		templates := state.Ignitions[fields[0]]
+		if templates == nil {
+			templates = make(map[string]*sabakan.IgnitionTemplate)
+			state.Ignitions[fields[0]] = templates
+		}
+		templates[fields[1]] = tmpl
+	}
+
+	for _, kv := range resp.Responses[8].GetResponseRange().Kvs {
+		sw := new(sabakan.Switch)
+		err = json.Unmarshal(kv.Value, sw)
+		if err != nil {
+			return nil, err
+		}
+		state.Switches = append(state.Switches, sw)
+	}
+
+	for _, kv := range resp.Responses[9].GetResponseRange().Kvs {
+		a := new(sabakan.Asset)
+		err = json.Unmarshal(kv.Value, a)
+		if err != nil {
+			return nil, err
+		}
+		state.Assets = append(state.Assets, a)
+	}
+
+	for _, kv := range resp.Responses[10].GetResponseRange().Kvs {
+		os := string(kv.Key)[len(KeyImages):]
+		if strings.HasSuffix(os, "/deleted") {
+			continue
+		}
+		var index sabakan.ImageIndex
+		err = json.Unmarshal(kv.Value, &index)
+		if err != nil {
+			return nil, err
+		}
+		if len(index) > 0 {
+			state.Images[os] = index
+		}
+	}
+
+	return state, nil
+}
+
+func (d *driver) backupLoadOps(ctx context.Context, state *sabakan.BackupState) ([]clientv3.Op, error) {
+	var ops []clientv3.Op
+	putJSON := func(key string, v interface{}) error {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		ops = append(ops, clientv3.OpPut(key, string(data)))
+		return nil
+	}
+
+	if state.IPAM != nil {
+		err := putJSON(KeyIPAM, state.IPAM)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if state.DHCP != nil {
+		err := putJSON(KeyDHCP, state.DHCP)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	usage := make(map[uint][]uint)
+	for _, m := range state.Machines {
+		err := putJSON(path.Join(KeyMachines, m.Spec.Serial), m)
+		if err != nil {
+			return nil, err
+		}
+		usage[m.Spec.Rack] = append(usage[m.Spec.Rack], m.Spec.IndexInRack)
+	}
+	for rack, indices := range usage {
+		err := putJSON(d.indexInRackKey(rack), indices)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, k := range state.CryptKeys {
+		target := path.Join(KeyCrypts, k.Serial, k.Path)
+		value, err := d.wrapKey(ctx, target, k.Key)
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, clientv3.OpPut(target, string(value)))
+		err = putJSON(path.Join(KeyCryptsMeta, k.Serial, k.Path), cryptMeta{CreatedAt: k.CreatedAt})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, p := range state.CryptPolicies {
+		err := putJSON(cryptPolicyKey(p.Kind, p.Name), p.Policy)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for os, params := range state.KernelParams {
+		ops = append(ops, clientv3.OpPut(path.Join(KeyKernelParams, os), params))
+	}
+	for role, templates := range state.Ignitions {
+		for id, tmpl := range templates {
+			err := putJSON(keyIgnitionRolePrefix(role)+id, tmpl)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, sw := range state.Switches {
+		err := putJSON(KeySwitches+sw.MAC, sw)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ops, nil
+}
+
+func (d *driver) backupLoad(ctx context.Context, state *sabakan.BackupState) error {
+	ops, err := d.backupLoadOps(ctx, state)
+	if err != nil {
+		return err
+	}
+
+	// image indices may be left empty after images are deleted
+	resp, err := d.client.Get(ctx, KeyImages, clientv3.WithPrefix())
+	if err != nil {
+		return err
+	}
+	for _, kv := range resp.Kvs {
+		if strings.HasSuffix(string(kv.Key), "/deleted") {
+			continue
+		}
+		var index sabakan.ImageIndex
+		err = json.Unmarshal(kv.Value, &index)
+		if err != nil {
+			return err
+		}
+		if len(index) > 0 {
+			return sabakan.ErrConflicted
+		}
+	}
+
+	// The first transaction checks that keys to be restored do not exist.
+	// The rest are split to keep the number of operations in a transaction
+	// within the limit of etcd.
+	cmps := []clientv3.Cmp{
+		clientv3util.KeyMissing(KeyIPAM),
+		clientv3util.KeyMissing(KeyDHCP),
+	}
+	for _, prefix := range backupPrefixes {
+		cmps = append(cmps, clientv3.Compare(clientv3.CreateRevision(prefix), "=", 0).WithPrefix())
+	}
+
+	var rev int64
+	var written int
+	for written < len(ops) || rev == 0 {
+		n := min(len(ops)-written, maxBackupLoadOps)
+		tresp, err := d.client.Txn(ctx).If(cmps...).Then(ops[written : written+n]...).Commit()
+		if err != nil {
+			rerr := d.backupRollback(ctx, ops[:written])
+			if rerr != nil {
+				log.Error("backup: failed to roll back the restore", map[string]interface{}{
+					log.FnError: rerr,
+				})
+			}
+			return err
+		}
+		if !tresp.Succeeded {
+			return sabakan.ErrConflicted
+		}
+		written += n
+		cmps = nil
+		rev = tresp.Header.Revision
+	}
+
+	d.addLog(ctx, time.Now(), rev, sabakan.AuditBackup, "", "restore",
+		fmt.Sprintf("%d machines, %d keys", len(state.Machines), len(state.CryptKeys)))
+	return nil
+}
+
+// backupRollback removes keys written by ops so that the restore can be
+// retried after a failure partway through.
+func (d *driver) backupRollback(ctx context.Context, ops []clientv3.Op) error {
+	// remove keys even if the request is canceled.
+	ctx = context.WithoutCancel(ctx)
+	for len(ops) > 0 {
+		n := min(len(ops), maxBackupLoadOps)
+		dels := make([]clientv3.Op, n)
+		for i, op := range ops[:n] {
+			dels[i] = clientv3.OpDelete(string(op.KeyBytes()))
+		}
+		_, err := d.client.Txn(ctx).Then(dels...).Commit()
+		if err != nil {
+			return err
+		}
+		ops = ops[n:]
+	}
+	return nil
+}
+
+// backupUnloadImages removes restored images from the index of os.
+func (d *driver) backupUnloadImages(ctx context.Context, os string, restored sabakan.ImageIndex) error {
+	key := path.Join(KeyImages, os)
+RETRY:
+	index, rev, err := d.imageGetIndexWithRev(ctx, os)
+	if err != nil {
+		return err
+	}
+	var ids []string
+	for _, img := range restored {
+		if index.Find(img.ID) != nil {
+			ids = append(ids, img.ID)
+			index = index.Remove(img.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	j, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	resp, err := d.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(key), "=", rev)).
+		Then(clientv3.OpPut(key, string(j))).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		goto RETRY
+	}
+
+	if d.objects.Store != nil {
+		d.imageDeleteObjects(ctx, os, ids)
+	}
+	return d.getImageDir(os).GC(ids)
+}
+
+func (d *driver) backupUnload(ctx context.Context, state *sabakan.BackupState) error {
+	ops, err := d.backupLoadOps(ctx, state)
+	if err != nil {
+		return err
+	}
+	err = d.backupRollback(ctx, ops)
+	if err != nil {
+		return err
+	}
+
+	for os, index := range state.Images {
+		err = d.backupUnloadImages(ctx, os, index)
+		if err != nil {
+			return err
+		}
+	}
+
+	return d.recordLog(ctx, sabakan.AuditBackup, "", "unload",
+		fmt.Sprintf("%d machines, %d keys", len(state.Machines), len(state.CryptKeys)))
+}
+
+type backupDriver struct {
+	*driver
+}
+
+// Dump implements sabakan.BackupModel
+func (d backupDriver) Dump(ctx context.Context) (*sabakan.BackupState, error) {
+	return d.backupDump(ctx)
+}
+
+// Load implements sabakan.BackupModel
+func (d backupDriver) Load(ctx context.Context, state *sabakan.BackupState) error {
+	return d.backupLoad(ctx, state)
+}
+
+// Unload implements sabakan.BackupModel
+func (d backupDriver) Unload(ctx context.Context, state *sabakan.BackupState) error {
+	return d.backupUnload(ctx, state)
+}
@@ -0,0 +1,60 @@
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/cybozu-go/sabakan/v3"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func testBackupLoadRollback(t *testing.T) {
+	t.Parallel()
+
+	d, _ := testNewDriver(t)
+	ctx := context.Background()
+
+	state := &sabakan.BackupState{
+		KernelParams: map[string]string{
+			// too large for a request to etcd
+			"coreos": strings.Repeat("a", 3*1024*1024),
+		},
+	}
+	for i := 0; i < maxBackupLoadOps+20; i++ {
+		state.Machines = append(state.Machines, sabakan.NewMachine(sabakan.MachineSpec{
+			Serial:      fmt.Sprint(i),
+			IndexInRack: uint(i + 4),
+		}))
+	}
+
+	err := d.backupLoad(ctx, state)
+	if err == nil {
+		t.Fatal("restoring too large kernel params should fail")
+	}
+	resp, err := d.client.Get(ctx, KeyMachines, clientv3.WithPrefix(), clientv3.WithCountOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Count != 0 {
+		t.Error("restored machines should be removed:", resp.Count)
+	}
+
+	state.KernelParams["coreos"] = "console=ttyS0"
+	err = d.backupLoad(ctx, state)
+	if err != nil {
+		t.Fatal("restore should be retried:", err)
+	}
+	resp, err = d.client.Get(ctx, KeyMachines, clientv3.WithPrefix(), clientv3.WithCountOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Count != int64(len(state.Machines)) {
+		t.Error("machines are not restored:", resp.Count)
+	}
+}
+
+func TestBackup(t *testing.T) {
+	t.Run("LoadRollback", testBackupLoadRollback)
+}
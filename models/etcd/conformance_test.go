@@ -0,0 +1,43 @@
+package etcd
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/cybozu-go/sabakan/v3"
+	"github.com/cybozu-go/sabakan/v3/models/modeltest"
+)
+
+func TestConformance(t *testing.T) {
+	t.Parallel()
+
+	modeltest.Run(t, func(t *testing.T) sabakan.Model {
+		client, err := newEtcdClient(t.Name() + "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		u, err := url.Parse("http://localhost:10080")
+		if err != nil {
+			t.Fatal(err)
+		}
+		model := NewModel(client, t.TempDir(), u, nil, sabakan.LogConfig{}, ObjectConfig{})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		ch := make(chan struct{}, 1)
+		done := make(chan struct{})
+		go func() {
+			model.Runner.Run(ctx, ch)
+			close(done)
+		}()
+		t.Cleanup(func() {
+			cancel()
+			<-done
+			client.Close()
+		})
+
+		// wait for the watchers to load the database
+		<-ch
+		return model
+	})
+}
@@ -7,6 +7,8 @@ const (
 	KeyVersion          = "version"
 	KeySchemaLockPrefix = "schema-lock/"
 	KeyCrypts           = "crypts/"
+	KeyCryptsMeta       = "crypts-meta/"
+	KeyCryptPolicies    = "crypt-policies/"
 	KeyDHCP             = "dhcp"
 	KeyIPAM             = "ipam"
 	KeyLeaseUsages      = "lease-usages/"
@@ -18,7 +20,15 @@ const (
 	KeyIgnitions        = "ignitions/"
 	KeyAudit            = "audit/"
 	KeyAuditLastGC      = "audit"
+	KeyAuditSequence    = "audit-seq"
+	KeyAuditHead        = "audit-head"
+	KeyAuditCheckpoints = "audit-checkpoints/"
+	KeyAuditArchived    = "audit-archived/"
 	KeyKernelParams     = "kernel-params/"
+	KeySwitches         = "switches/"
+	KeyWebhooks         = "webhooks/"
+	KeyWebhookCursors   = "webhook-cursors/"
+	KeyWebhookLock      = "webhook-lock/"
 )
 
 // MaxDeleted is the maximum number of deleted image IDs stored in etcd.
@@ -37,12 +47,30 @@ const (
 	maxJitterSeconds = 30
 	maxAssetURLs     = 10
 	maxImageURLs     = 10
+
+	// objectURLExpiry is the lifetime of URLs to download assets from
+	// the object storage.
+	objectURLExpiry = 15 * time.Minute
 )
 
 // Log parameters
 const (
-	logRetentionDays      = 60
-	logCompactionTick     = 1 * time.Hour
-	logCompactionInterval = 23 * time.Hour
-	logPageSize           = 100
+	defaultLogRetentionDays = 60
+	logCompactionTick       = 1 * time.Hour
+	logCompactionInterval   = 23 * time.Hour
+	logPageSize             = 100
+	logFlushInterval        = 10 * time.Second
+	logCheckpointInterval   = 1 * time.Hour
+	logBatchSize            = 100
+	maxBatchedLogs          = 10000
+	maxLogAppendRetries     = 10
+)
+
+// Webhook parameters
+const (
+	webhookInterval       = 5 * time.Second
+	webhookTimeout        = 30 * time.Second
+	webhookMinBackoff     = 5 * time.Second
+	webhookMaxBackoff     = 10 * time.Minute
+	webhookRevisionWindow = 1000
 )
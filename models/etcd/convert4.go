@@ -0,0 +1,40 @@
+package etcd
+
+import (
+	"context"
+
+	"github.com/cybozu-go/log"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+func (d *driver) convertTo4(ctx context.Context, mu *concurrency.Mutex) error {
+	// wrap raw encryption keys.  Without KMS, raw keys are left as is.
+	count, err := d.rewrapKeys(ctx, mu.IsOwner())
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		log.Info("wrapped encryption keys", map[string]interface{}{
+			"count": count,
+		})
+	}
+
+	// update schema version
+	const thisVersion = "4"
+	tresp, err := d.client.Txn(ctx).
+		If(mu.IsOwner()).
+		Then(clientv3.OpPut(KeyVersion, thisVersion)).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !tresp.Succeeded {
+		return errLostOwner
+	}
+
+	log.Info("updated schema version", map[string]interface{}{
+		"to": thisVersion,
+	})
+	return nil
+}
@@ -0,0 +1,114 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"time"
+
+	"github.com/cybozu-go/sabakan/v3"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func cryptPolicyKey(kind, name string) string {
+	return path.Join(KeyCryptPolicies, kind, name)
+}
+
+func (d *driver) cryptPolicyPut(ctx context.Context, kind, name string, policy *sabakan.CryptPolicy) error {
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+
+	resp, err := d.client.Put(ctx, cryptPolicyKey(kind, name), string(data))
+	if err != nil {
+		return err
+	}
+
+	d.addLog(ctx, time.Now(), resp.Header.Revision, sabakan.AuditCryptPolicy, path.Join(kind, name), "put", string(data))
+	return nil
+}
+
+func (d *driver) cryptPolicyGet(ctx context.Context, kind, name string) (*sabakan.CryptPolicy, error) {
+	resp, err := d.client.Get(ctx, cryptPolicyKey(kind, name))
+	if err != nil {
+		return nil, err
+	}
+	if resp.Count == 0 {
+		return nil, sabakan.ErrNotFound
+	}
+
+	policy := new(sabakan.CryptPolicy)
+	err = json.Unmarshal(resp.Kvs[0].Value, policy)
+	if err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+func (d *driver) cryptPolicyDelete(ctx context.Context, kind, name string) error {
+	resp, err := d.client.Delete(ctx, cryptPolicyKey(kind, name))
+	if err != nil {
+		return err
+	}
+	if resp.Deleted == 0 {
+		return sabakan.ErrNotFound
+	}
+
+	d.addLog(ctx, time.Now(), resp.Header.Revision, sabakan.AuditCryptPolicy, path.Join(kind, name), "delete", "")
+	return nil
+}
+
+func (d *driver) cryptPolicyResolve(ctx context.Context, serial string) (*sabakan.CryptPolicy, error) {
+	resp, err := d.client.Txn(ctx).
+		Then(
+			clientv3.OpGet(KeyMachines+serial),
+			clientv3.OpGet(cryptPolicyKey(sabakan.CryptPolicyMachine, serial)),
+		).
+		Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	machineResp := resp.Responses[0].GetResponseRange()
+	if machineResp.Count == 0 {
+		return nil, sabakan.ErrNotFound
+	}
+
+	policyResp := resp.Responses[1].GetResponseRange()
+	if policyResp.Count != 0 {
+		policy := new(sabakan.CryptPolicy)
+		err = json.Unmarshal(policyResp.Kvs[0].Value, policy)
+		if err != nil {
+			return nil, err
+		}
+		return policy, nil
+	}
+
+	m := new(sabakan.Machine)
+	err = json.Unmarshal(machineResp.Kvs[0].Value, m)
+	if err != nil {
+		return nil, err
+	}
+	return d.cryptPolicyGet(ctx, sabakan.CryptPolicyRole, m.Spec.Role)
+}
+
+type cryptPolicyDriver struct {
+	*driver
+}
+
+func (d cryptPolicyDriver) Put(ctx context.Context, kind, name string, policy *sabakan.CryptPolicy) error {
+	return d.cryptPolicyPut(ctx, kind, name, policy)
+}
+
+func (d cryptPolicyDriver) Get(ctx context.Context, kind, name string) (*sabakan.CryptPolicy, error) {
+	return d.cryptPolicyGet(ctx, kind, name)
+}
+
+func (d cryptPolicyDriver) Delete(ctx context.Context, kind, name string) error {
+	return d.cryptPolicyDelete(ctx, kind, name)
+}
+
+func (d cryptPolicyDriver) Resolve(ctx context.Context, serial string) (*sabakan.CryptPolicy, error) {
+	return d.cryptPolicyResolve(ctx, serial)
+}
@@ -0,0 +1,86 @@
+package etcd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cybozu-go/sabakan/v3"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCryptPolicy(t *testing.T) {
+	t.Parallel()
+
+	d, ch := testNewDriver(t)
+	_, err := initializeTestData(d, ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	_, err = d.cryptPolicyResolve(ctx, "12345678")
+	if err != sabakan.ErrNotFound {
+		t.Fatal("unexpected error: ", err)
+	}
+
+	rolePolicy := &sabakan.CryptPolicy{
+		Disks:      []sabakan.DiskSelector{{Path: "pci-*-nvme-*"}},
+		RequireTPM: true,
+	}
+	err = d.cryptPolicyPut(ctx, sabakan.CryptPolicyRole, "worker", rolePolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	machinePolicy := &sabakan.CryptPolicy{Cipher: "aes-cbc-essiv:sha256", KeySize: 256}
+	err = d.cryptPolicyPut(ctx, sabakan.CryptPolicyMachine, "12345679", machinePolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := d.cryptPolicyGet(ctx, sabakan.CryptPolicyRole, "worker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(p, rolePolicy) {
+		t.Error("wrong policy stored:", cmp.Diff(p, rolePolicy))
+	}
+	_, err = d.cryptPolicyGet(ctx, sabakan.CryptPolicyMachine, "12345678")
+	if err != sabakan.ErrNotFound {
+		t.Error("unexpected error: ", err)
+	}
+
+	p, err = d.cryptPolicyResolve(ctx, "12345678")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(p, rolePolicy) {
+		t.Error("role policy should be applied:", cmp.Diff(p, rolePolicy))
+	}
+	p, err = d.cryptPolicyResolve(ctx, "12345679")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(p, machinePolicy) {
+		t.Error("machine policy should be applied:", cmp.Diff(p, machinePolicy))
+	}
+	_, err = d.cryptPolicyResolve(ctx, "99999999")
+	if err != sabakan.ErrNotFound {
+		t.Error("unexpected error: ", err)
+	}
+
+	err = d.cryptPolicyDelete(ctx, sabakan.CryptPolicyMachine, "12345679")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.cryptPolicyDelete(ctx, sabakan.CryptPolicyMachine, "12345679")
+	if err != sabakan.ErrNotFound {
+		t.Fatal("unexpected error: ", err)
+	}
+	p, err = d.cryptPolicyResolve(ctx, "12345679")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(p, rolePolicy) {
+		t.Error("role policy should be applied:", cmp.Diff(p, rolePolicy))
+	}
+}
@@ -415,6 +415,32 @@ RETRY:
 	return nil
 }
 
+func (d *driver) dhcpLeaseOwner(ctx context.Context, ip net.IP) (net.HardwareAddr, error) {
+	ipam, err := d.getIPAMConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	lr := ipam.LeaseRange(ip)
+	if lr == nil {
+		return nil, sabakan.ErrNotFound
+	}
+
+	lu, err := d.getLeaseUsage(ctx, lr.Key())
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for hwAddr, v := range lu.hwMap {
+		if v.LeaseUntil.Before(now) || !lr.IP(v.Index).Equal(ip) {
+			continue
+		}
+		return net.ParseMAC(hwAddr)
+	}
+	return nil, sabakan.ErrNotFound
+}
+
 type dhcpDriver struct {
 	*driver
 }
@@ -442,3 +468,7 @@ func (d dhcpDriver) Release(ctx context.Context, ciaddr net.IP, mac net.Hardware
 func (d dhcpDriver) Decline(ctx context.Context, ciaddr net.IP, mac net.HardwareAddr) error {
 	return d.dhcpDecline(ctx, ciaddr, mac)
 }
+
+func (d dhcpDriver) LeaseOwner(ctx context.Context, ip net.IP) (net.HardwareAddr, error) {
+	return d.dhcpLeaseOwner(ctx, ip)
+}
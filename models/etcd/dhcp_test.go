@@ -9,17 +9,13 @@ import (
 	"time"
 
 	"github.com/cybozu-go/sabakan/v3"
+	"github.com/cybozu-go/sabakan/v3/models/modeltest"
 	clientv3 "go.etcd.io/etcd/client/v3"
 )
 
-var testDHCPConfig = sabakan.DHCPConfig{
-	LeaseMinutes: 30,
-	DNSServers:   []string{"10.0.0.1", "10.0.0.2"},
-}
-
 func testDHCPPutConfig(t *testing.T) {
 	d, ch := testNewDriver(t)
-	config := &testDHCPConfig
+	config := &modeltest.DHCPConfig
 	err := d.putDHCPConfig(context.Background(), config)
 	if err != nil {
 		t.Fatal(err)
@@ -47,7 +43,7 @@ func testDHCPPutConfig(t *testing.T) {
 
 func testDHCPGetConfig(t *testing.T) {
 	d, ch := testNewDriver(t)
-	config := &testDHCPConfig
+	config := &modeltest.DHCPConfig
 
 	bytes, err := json.Marshal(config)
 	if err != nil {
@@ -70,8 +66,8 @@ func testDHCPGetConfig(t *testing.T) {
 }
 
 func testSetupConfig(t *testing.T, d *driver, ch <-chan struct{}) {
-	ipam := &testIPAMConfig
-	config := &testDHCPConfig
+	ipam := &modeltest.IPAMConfig
+	config := &modeltest.DHCPConfig
 
 	err := d.putIPAMConfig(context.Background(), ipam)
 	if err != nil {
@@ -228,6 +224,36 @@ func testDHCPRelease(t *testing.T) {
 	}
 }
 
+func testDHCPLeaseOwner(t *testing.T) {
+	d, ch := testNewDriver(t)
+	testSetupConfig(t, d, ch)
+
+	interfaceip := net.ParseIP("10.69.0.195")
+	mac := net.HardwareAddr([]byte{0x11, 0x22, 0x33, 0x44, 0x55, 0x66})
+
+	dhcpip, err := d.dhcpLease(context.Background(), interfaceip, mac)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	owner, err := d.dhcpLeaseOwner(context.Background(), dhcpip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner.String() != mac.String() {
+		t.Error("unexpected owner", owner)
+	}
+
+	err = d.dhcpRelease(context.Background(), dhcpip, mac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = d.dhcpLeaseOwner(context.Background(), dhcpip)
+	if err != sabakan.ErrNotFound {
+		t.Error("released address should not have owner", err)
+	}
+}
+
 func testDHCPDecline(t *testing.T) {
 	d, ch := testNewDriver(t)
 	testSetupConfig(t, d, ch)
@@ -364,6 +390,7 @@ func TestDHCP(t *testing.T) {
 	t.Run("Lease", testDHCPLease)
 	t.Run("Renew", testDHCPRenew)
 	t.Run("Release", testDHCPRelease)
+	t.Run("LeaseOwner", testDHCPLeaseOwner)
 	t.Run("Decline", testDHCPDecline)
 	t.Run("Expire", testDHCPLeaseExpiration)
 	t.Run("Race", testDHCPLeaseRace)
@@ -21,10 +21,28 @@ type driver struct {
 	mi           *machinesIndex
 	ipamConfig   atomic.Value
 	dhcpConfig   atomic.Value
+	logs         logBatcher
+	logConfig    sabakan.LogConfig
+	objects      ObjectConfig
+	kms          sabakan.KMS
+}
+
+// ObjectConfig configures the object storage for assets and images.
+type ObjectConfig struct {
+	// Store stores assets and images.  If nil, they are stored in the
+	// data directory of each server and replicated between servers.
+	Store sabakan.ObjectStore
+
+	// Redirect redirects clients to URLs of Store to download assets.
+	// If false, sabakan proxies the contents.
+	Redirect bool
 }
 
 // NewModel returns sabakan.Model
-func NewModel(client *clientv3.Client, dataDir string, advertiseURL *url.URL) sabakan.Model {
+//
+// If kms is not nil, disk encryption keys are wrapped with it.
+func NewModel(client *clientv3.Client, dataDir string, advertiseURL *url.URL, kms sabakan.KMS,
+	logConfig sabakan.LogConfig, objectConfig ObjectConfig) sabakan.Model {
 	d := &driver{
 		client: client,
 		httpclient: &well.HTTPClient{
@@ -33,10 +51,14 @@ func NewModel(client *clientv3.Client, dataDir string, advertiseURL *url.URL) sa
 		dataDir:      dataDir,
 		advertiseURL: advertiseURL,
 		mi:           newMachinesIndex(),
+		logConfig:    logConfig,
+		objects:      objectConfig,
+		kms:          kms,
 	}
 	return sabakan.Model{
 		Runner:       d,
 		Storage:      d,
+		CryptPolicy:  cryptPolicyDriver{d},
 		Machine:      machineDriver{d},
 		IPAM:         ipamDriver{d},
 		DHCP:         dhcpDriver{d},
@@ -45,8 +67,11 @@ func NewModel(client *clientv3.Client, dataDir string, advertiseURL *url.URL) sa
 		Log:          logDriver{d},
 		Ignition:     d,
 		KernelParams: kernelParamsDriver{d},
+		Switch:       switchDriver{d},
+		Webhook:      webhookDriver{d},
 		Health:       healthDriver{d},
 		Schema:       d,
+		Backup:       backupDriver{d},
 	}
 }
 
@@ -105,6 +130,18 @@ func (d *driver) Run(ctx context.Context, ch chan<- struct{}) error {
 	// log compaction
 	env.Go(d.logCompactor)
 
+	// batched logs
+	env.Go(d.logFlusher)
+
+	// checkpoints of the hash chain of logs
+	env.Go(d.logCheckpointer)
+
+	// re-wrap encryption keys with the current master key
+	env.Go(d.keyRewrapper)
+
+	// deliver audit logs to webhooks
+	env.Go(d.webhookDispatcher)
+
 	env.Stop()
 
 	return env.Wait()
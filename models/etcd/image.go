@@ -46,7 +46,11 @@ func (d *driver) imageGetIndexWithRev(ctx context.Context, os string) (sabakan.I
 	}
 	dir := d.getImageDir(os)
 	for _, img := range ret {
-		img.Exists = dir.Exists(img.ID)
+		if d.objects.Store != nil {
+			img.Exists = d.imageObjectsExist(ctx, os, img.ID)
+		} else {
+			img.Exists = dir.Exists(img.ID)
+		}
 	}
 	return ret, resp.Kvs[0].ModRevision, nil
 }
@@ -146,14 +150,26 @@ RETRY:
 		}
 	}
 
-	dir := d.getImageDir(os)
-	err = dir.Extract(r, id, imageMembers[os])
-	if err != nil {
-		return err
-	}
-	size, err := dir.Size(id)
-	if err != nil {
-		return err
+	var size int64
+	if d.objects.Store != nil {
+		if index.Find(id) != nil && d.imageObjectsExist(ctx, os, id) {
+			size, err = d.imageCompareObjects(ctx, os, id, r)
+		} else {
+			size, err = d.imageSaveObjects(ctx, os, id, r)
+		}
+		if err != nil {
+			return err
+		}
+	} else {
+		dir := d.getImageDir(os)
+		err = dir.Extract(r, id, imageMembers[os])
+		if err != nil {
+			return err
+		}
+		size, err = dir.Size(id)
+		if err != nil {
+			return err
+		}
 	}
 
 	index, dels := index.Append(&sabakan.Image{
@@ -174,6 +190,9 @@ RETRY:
 	if !resp.Succeeded {
 		goto RETRY
 	}
+	if d.objects.Store != nil {
+		d.imageDeleteObjects(ctx, os, dels)
+	}
 
 	d.addLog(ctx, time.Now(), resp.Header.Revision, sabakan.AuditImage, os, "upload",
 		"id="+id)
@@ -192,6 +211,10 @@ func (d *driver) imageDownload(ctx context.Context, os, id string, out io.Writer
 		return sabakan.ErrNotFound
 	}
 
+	if d.objects.Store != nil {
+		return d.imageDownloadObjects(ctx, out, os, id)
+	}
+
 	dir := d.getImageDir(os)
 	if !dir.Exists(id) {
 		return sabakan.ErrNotFound
@@ -246,6 +269,9 @@ RETRY:
 	if !resp.Succeeded {
 		goto RETRY
 	}
+	if d.objects.Store != nil {
+		d.imageDeleteObjects(ctx, os, []string{id})
+	}
 
 	d.addLog(ctx, time.Now(), resp.Header.Revision, sabakan.AuditImage, os, "delete",
 		"id="+id)
@@ -265,6 +291,22 @@ func (d *driver) imageServeFile(ctx context.Context, os, filename string,
 	for i := len(index) - 1; i >= 0; i-- {
 		id := index[i].ID
 		date := index[i].Date
+		if d.objects.Store != nil {
+			r, err := d.objects.Store.Open(ctx, imageObjectKey(os, id, filename))
+			if err == sabakan.ErrNotFound {
+				log.Warn("imageServeFile: no object", map[string]interface{}{
+					"id": id,
+				})
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+
+			f(date, r)
+			return nil
+		}
 		if !dir.Exists(id) {
 			log.Warn("imageServeFile: no local copy", map[string]interface{}{
 				"id": id,
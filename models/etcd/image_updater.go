@@ -115,6 +115,11 @@ OUTER:
 }
 
 func (d *driver) updateImage(ctx context.Context) error {
+	if d.objects.Store != nil {
+		// images in the object storage need not be replicated
+		return nil
+	}
+
 	resp, err := d.client.Get(ctx, KeyImages, clientv3.WithPrefix())
 	if err != nil {
 		return err
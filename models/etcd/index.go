@@ -23,6 +23,7 @@ type machinesIndex struct {
 	Labels  map[string][]string
 	IPv4    map[string]string
 	IPv6    map[string]string
+	MAC     map[string]string
 	BMCType map[string][]string
 	State   map[sabakan.MachineState][]string
 }
@@ -34,6 +35,7 @@ func newMachinesIndex() *machinesIndex {
 		Labels:  make(map[string][]string),
 		IPv4:    make(map[string]string),
 		IPv6:    make(map[string]string),
+		MAC:     make(map[string]string),
 		BMCType: make(map[string][]string),
 		State:   make(map[sabakan.MachineState][]string),
 	}
@@ -84,6 +86,9 @@ func (mi *machinesIndex) addNoLock(m *sabakan.Machine) {
 	for _, ip := range spec.IPv6 {
 		mi.IPv6[ip] = spec.Serial
 	}
+	for _, mac := range spec.MACAddresses {
+		mi.MAC[mac] = spec.Serial
+	}
 	if len(spec.BMC.IPv4) > 0 {
 		mi.IPv4[spec.BMC.IPv4] = spec.Serial
 	}
@@ -127,6 +132,9 @@ func (mi *machinesIndex) deleteNoLock(m *sabakan.Machine) {
 	for _, ip := range spec.IPv6 {
 		delete(mi.IPv6, ip)
 	}
+	for _, mac := range spec.MACAddresses {
+		delete(mi.MAC, mac)
+	}
 	delete(mi.IPv4, spec.BMC.IPv4)
 	delete(mi.IPv6, spec.BMC.IPv6)
 
@@ -173,6 +181,11 @@ func (mi *machinesIndex) query(q sabakan.Query) []string {
 			res[serial] = struct{}{}
 		}
 	}
+	for _, mac := range strings.Split(q.MAC(), ",") {
+		if serial, ok := mi.MAC[strings.ToLower(mac)]; len(mac) > 0 && ok {
+			res[serial] = struct{}{}
+		}
+	}
 	for _, bmcType := range strings.Split(q.BMCType(), ",") {
 		for _, serial := range mi.BMCType[bmcType] {
 			res[serial] = struct{}{}
@@ -7,29 +7,14 @@ import (
 	"testing"
 
 	"github.com/cybozu-go/sabakan/v3"
+	"github.com/cybozu-go/sabakan/v3/models/modeltest"
 )
 
-var testIPAMConfig = sabakan.IPAMConfig{
-	MaxNodesInRack:    28,
-	NodeIPv4Pool:      "10.69.0.0/20",
-	NodeIPv4Offset:    "",
-	NodeRangeSize:     6,
-	NodeRangeMask:     26,
-	NodeIPPerNode:     3,
-	NodeIndexOffset:   3,
-	NodeGatewayOffset: 1,
-	BMCIPv4Pool:       "10.72.16.0/20",
-	BMCIPv4Offset:     "0.0.1.0",
-	BMCRangeSize:      5,
-	BMCRangeMask:      20,
-	BMCGatewayOffset:  1,
-}
-
 func testIPAMPutConfig(t *testing.T) {
 	t.Parallel()
 
 	d, ch := testNewDriver(t)
-	config := &testIPAMConfig
+	config := &modeltest.IPAMConfig
 	err := d.putIPAMConfig(context.Background(), config)
 	if err != nil {
 		t.Fatal(err)
@@ -72,7 +57,7 @@ func testIPAMGetConfig(t *testing.T) {
 	t.Parallel()
 
 	d, ch := testNewDriver(t)
-	config := &testIPAMConfig
+	config := &modeltest.IPAMConfig
 
 	bytes, err := json.Marshal(config)
 	if err != nil {
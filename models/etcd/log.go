@@ -2,6 +2,7 @@ package etcd
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -22,19 +23,8 @@ func (d *driver) addLog(ctx context.Context, ts time.Time, rev int64, cat sabaka
 	instance, action, detail string) {
 
 	a := sabakan.NewAuditLog(ctx, ts, rev, cat, instance, action, detail)
-	j, err := json.Marshal(a)
-	if err != nil { // unlikely
-		log.Error("etcd: addLog failed", map[string]interface{}{
-			log.FnError: err,
-			"category":  string(cat),
-			"instance":  instance,
-			"action":    action,
-		})
-		return
-	}
-
 	key := auditKey(ts) + fmt.Sprintf("%016x", uint64(rev))
-	_, err = d.client.Put(ctx, key, string(j))
+	err := d.appendLogs(ctx, []string{key}, []*sabakan.AuditLog{a})
 	if err == nil {
 		return
 	}
@@ -47,6 +37,85 @@ func (d *driver) addLog(ctx context.Context, ts time.Time, rev int64, cat sabaka
 	})
 }
 
+// appendLogs links audit log entries to the hash chain and writes them
+// at keys atomically.  KeyAuditHead is updated by compare-and-swap
+// so that no two entries have the same sequence number.
+//
+// Entries are chained in the order they are appended.  As this runs after
+// the modification is committed, the order may differ from that of
+// revisions for concurrent modifications.
+//
+// As all writers contend on KeyAuditHead, the compare-and-swap is retried
+// at most maxLogAppendRetries times.
+func (d *driver) appendLogs(ctx context.Context, keys []string, entries []*sabakan.AuditLog) error {
+	var retries int
+RETRY:
+	resp, err := d.client.Get(ctx, KeyAuditHead)
+	if err != nil {
+		return err
+	}
+	head := new(sabakan.AuditCheckpoint)
+	var headRev int64
+	if resp.Count != 0 {
+		err = json.Unmarshal(resp.Kvs[0].Value, head)
+		if err != nil {
+			return err
+		}
+		headRev = resp.Kvs[0].ModRevision
+	}
+
+	ops := make([]clientv3.Op, 0, len(entries)+1)
+	for i, a := range entries {
+		a.Seq = head.Seq + 1
+		a.PrevHash = head.Hash
+		a.Hash, err = a.ComputeHash()
+		if err != nil {
+			return err
+		}
+		j, err := json.Marshal(a)
+		if err != nil {
+			return err
+		}
+		ops = append(ops, clientv3.OpPut(keys[i], string(j)))
+		head = &sabakan.AuditCheckpoint{Seq: a.Seq, Hash: a.Hash, Timestamp: a.Timestamp}
+	}
+	j, err := json.Marshal(head)
+	if err != nil {
+		return err
+	}
+	ops = append(ops, clientv3.OpPut(KeyAuditHead, string(j)))
+
+	tresp, err := d.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(KeyAuditHead), "=", headRev)).
+		Then(ops...).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !tresp.Succeeded {
+		if retries == maxLogAppendRetries {
+			return fmt.Errorf("%s was updated concurrently %d times", KeyAuditHead, retries+1)
+		}
+		retries++
+		goto RETRY
+	}
+	return nil
+}
+
+// recordLog adds an audit log entry without updating other keys.
+// As audit log keys are made from revisions, this updates KeyAuditSequence
+// to obtain a new revision.
+func (d *driver) recordLog(ctx context.Context, cat sabakan.AuditCategory, instance, action, detail string) error {
+	now := time.Now()
+	resp, err := d.client.Put(ctx, KeyAuditSequence, "")
+	if err != nil {
+		return err
+	}
+
+	d.addLog(ctx, now, resp.Header.Revision, cat, instance, action, detail)
+	return nil
+}
+
 func (d *driver) logLastGCTime(ctx context.Context, nowData string) (t time.Time, rev int64, e error) {
 RETRY:
 	resp, err := d.client.Get(ctx, KeyAuditLastGC)
@@ -76,24 +145,260 @@ RETRY:
 	return
 }
 
+// logRetention returns the duration to keep logs in etcd.
+func (d *driver) logRetention() time.Duration {
+	days := d.logConfig.RetentionDays
+	if days == 0 {
+		days = defaultLogRetentionDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// auditDay returns the date of an audit log key.
+func auditDay(key string) (time.Time, error) {
+	if len(key) < len(KeyAudit)+8 {
+		return time.Time{}, fmt.Errorf("invalid audit log key: %s", key)
+	}
+	return time.Parse("20060102", key[len(KeyAudit):len(KeyAudit)+8])
+}
+
+// logArchiveDay stores logs of the day in the archive, then removes them from etcd.
+// The day is recorded in etcd so that servers can tell the archive is missing.
+func (d *driver) logArchiveDay(ctx context.Context, day time.Time) (int64, error) {
+	key := auditKey(day)
+	endKey := auditKey(day.AddDate(0, 0, 1))
+
+	buf := new(bytes.Buffer)
+	_, err := d.logScan(ctx, key, endKey, clientv3.SortAscend, func(value []byte) (bool, error) {
+		buf.Write(value)
+		buf.WriteByte('\n')
+		return false, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	err = d.logConfig.Archive.Store(ctx, day, buf.Bytes())
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := d.client.Txn(ctx).
+		Then(
+			clientv3.OpPut(KeyAuditArchived+day.Format("20060102"), ""),
+			clientv3.OpDelete(key, clientv3.WithRange(endKey)),
+		).
+		Commit()
+	if err != nil {
+		return 0, err
+	}
+	return resp.Responses[1].GetResponseDeleteRange().Deleted, nil
+}
+
 func (d *driver) logCompact(ctx context.Context, now time.Time) error {
-	oldest := now.Add(time.Duration(-logRetentionDays) * 24 * time.Hour)
+	oldest := now.Add(-d.logRetention())
 	key := auditKey(oldest)
 
 	log.Info("log: compacting...", map[string]interface{}{
 		"key": key,
 	})
 
-	resp, err := d.client.Delete(ctx, KeyAudit, clientv3.WithRange(key))
-	if err != nil {
-		return err
+	if d.logConfig.Archive == nil {
+		resp, err := d.client.Delete(ctx, KeyAudit, clientv3.WithRange(key))
+		if err != nil {
+			return err
+		}
+
+		log.Info("log: compacted", map[string]interface{}{
+			"deleted": resp.Deleted,
+		})
+		return d.logAnchor(ctx, now)
+	}
+
+	var deleted int64
+	for {
+		resp, err := d.client.Get(ctx, KeyAudit,
+			clientv3.WithRange(key),
+			clientv3.WithKeysOnly(),
+			clientv3.WithLimit(1),
+		)
+		if err != nil {
+			return err
+		}
+		if len(resp.Kvs) == 0 {
+			break
+		}
+
+		day, err := auditDay(string(resp.Kvs[0].Key))
+		if err != nil {
+			return err
+		}
+		n, err := d.logArchiveDay(ctx, day)
+		if err != nil {
+			// keep logs in etcd until the next compaction
+			log.Error("log: failed to archive logs", map[string]interface{}{
+				log.FnError: err,
+				"day":       day.Format("20060102"),
+			})
+			break
+		}
+		deleted += n
 	}
 
 	log.Info("log: compacted", map[string]interface{}{
-		"deleted": resp.Deleted,
+		"deleted": deleted,
 	})
 
-	return nil
+	return d.logAnchor(ctx, now)
+}
+
+// logPutCheckpoint records a checkpoint of the hash chain.
+// The checkpoint is signed if the key is configured.
+func (d *driver) logPutCheckpoint(ctx context.Context, seq uint64, hash string, now time.Time) error {
+	c := &sabakan.AuditCheckpoint{Seq: seq, Hash: hash, Timestamp: now.UTC()}
+	if d.logConfig.CheckpointKey != nil {
+		c.Sign(d.logConfig.CheckpointKey)
+	}
+	j, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	key := KeyAuditCheckpoints + fmt.Sprintf("%016x", seq)
+	_, err = d.client.Txn(ctx).
+		If(clientv3util.KeyMissing(key)).
+		Then(clientv3.OpPut(key, string(j))).
+		Commit()
+	return err
+}
+
+// logCheckpoint records the head of the hash chain as a checkpoint.
+func (d *driver) logCheckpoint(ctx context.Context, now time.Time) (uint64, error) {
+	resp, err := d.client.Get(ctx, KeyAuditHead)
+	if err != nil {
+		return 0, err
+	}
+	if resp.Count == 0 {
+		return 0, nil
+	}
+
+	head := new(sabakan.AuditCheckpoint)
+	err = json.Unmarshal(resp.Kvs[0].Value, head)
+	if err != nil {
+		return 0, err
+	}
+	return head.Seq, d.logPutCheckpoint(ctx, head.Seq, head.Hash, now)
+}
+
+// logAnchor records a checkpoint linked from the oldest entry in etcd
+// so that the hash chain can be verified after compaction.
+//
+// Without the archive, checkpoints older than the anchor are removed.
+func (d *driver) logAnchor(ctx context.Context, now time.Time) error {
+	resp, err := d.client.Get(ctx, KeyAudit,
+		clientv3.WithPrefix(),
+		clientv3.WithKeysOnly(),
+		clientv3.WithLimit(1),
+	)
+	if err != nil {
+		return err
+	}
+
+	var anchor uint64
+	if len(resp.Kvs) == 0 {
+		anchor, err = d.logCheckpoint(ctx, now)
+		if err != nil {
+			return err
+		}
+	} else {
+		day, err := auditDay(string(resp.Kvs[0].Key))
+		if err != nil {
+			return err
+		}
+
+		var first *sabakan.AuditLog
+		_, err = d.logScan(ctx, auditKey(day), auditKey(day.AddDate(0, 0, 1)), clientv3.SortAscend, func(value []byte) (bool, error) {
+			a := new(sabakan.AuditLog)
+			err := json.Unmarshal(value, a)
+			if err != nil {
+				return false, err
+			}
+			if a.Seq != 0 && (first == nil || a.Seq < first.Seq) {
+				first = a
+			}
+			return false, nil
+		})
+		if err != nil {
+			return err
+		}
+		if first == nil || first.Seq == 1 {
+			return nil
+		}
+
+		anchor = first.Seq - 1
+		err = d.logPutCheckpoint(ctx, anchor, first.PrevHash, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.logConfig.Archive != nil || anchor == 0 {
+		return nil
+	}
+	_, err = d.client.Delete(ctx, KeyAuditCheckpoints,
+		clientv3.WithRange(KeyAuditCheckpoints+fmt.Sprintf("%016x", anchor)))
+	return err
+}
+
+// logCheckpointer is a goroutine to record checkpoints periodically.
+func (d *driver) logCheckpointer(ctx context.Context) error {
+	ticker := time.NewTicker(logCheckpointInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			_, err := d.logCheckpoint(ctx, now)
+			if err != nil {
+				log.Error("etcd: failed to record audit log checkpoint", map[string]interface{}{
+					log.FnError: err,
+				})
+			}
+		}
+	}
+}
+
+func (d *driver) logChain(ctx context.Context) (*sabakan.AuditChain, error) {
+	resp, err := d.client.Txn(ctx).
+		Then(
+			clientv3.OpGet(KeyAuditHead),
+			clientv3.OpGet(KeyAuditCheckpoints, clientv3.WithPrefix()),
+		).
+		Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	chain := &sabakan.AuditChain{Checkpoints: []*sabakan.AuditCheckpoint{}}
+	headResp := resp.Responses[0].GetResponseRange()
+	if headResp.Count != 0 {
+		chain.Head = new(sabakan.AuditCheckpoint)
+		err = json.Unmarshal(headResp.Kvs[0].Value, chain.Head)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, kv := range resp.Responses[1].GetResponseRange().Kvs {
+		c := new(sabakan.AuditCheckpoint)
+		err = json.Unmarshal(kv.Value, c)
+		if err != nil {
+			return nil, err
+		}
+		chain.Checkpoints = append(chain.Checkpoints, c)
+	}
+	return chain, nil
 }
 
 func (d *driver) logTryCompact(ctx context.Context, now time.Time) error {
@@ -145,60 +450,345 @@ func (d *driver) logCompactor(ctx context.Context) error {
 }
 
 func (d *driver) logDump(ctx context.Context, since, until time.Time, w io.Writer) error {
-	bufw := bufio.NewWriterSize(w, 2048)
+	return d.logQuery(ctx, &sabakan.LogQuery{Since: since, Until: until}, w)
+}
 
-	key := KeyAudit
-	endKey := clientv3.GetPrefixRangeEnd(KeyAudit)
+// logWriter writes audit logs matching a query.
+type logWriter struct {
+	q     *sabakan.LogQuery
+	w     *bufio.Writer
+	count int
+}
+
+// write writes a log entry if it matches the query.
+// This returns true when the number of logs reaches the limit.
+func (lw *logWriter) write(value []byte) (bool, error) {
+	if lw.q.HasFilters() {
+		a := new(sabakan.AuditLog)
+		err := json.Unmarshal(value, a)
+		if err != nil {
+			return false, err
+		}
+		if !lw.q.Match(a) {
+			return false, nil
+		}
+	}
 
-	if !since.IsZero() {
-		key = auditKey(since)
+	_, err := lw.w.Write(value)
+	if err != nil {
+		return false, err
 	}
-	if !until.IsZero() {
-		endKey = auditKey(until)
+	err = lw.w.WriteByte('\n')
+	if err != nil {
+		return false, err
+	}
+
+	lw.count++
+	return lw.q.Limit > 0 && lw.count == lw.q.Limit, nil
+}
+
+// logScan calls fn for each log in the range of keys until fn returns true.
+// This returns true if fn returns true.
+func (d *driver) logScan(ctx context.Context, key, endKey string, order clientv3.SortOrder,
+	fn func(value []byte) (bool, error)) (bool, error) {
+
+	if order == clientv3.SortDescend {
+		return d.logScanDesc(ctx, key, endKey, fn)
+	}
+	return d.logScanRange(ctx, key, endKey, 0, fn)
+}
+
+// logScanRange calls fn for each log in the range of keys in the ascending
+// order until fn returns true.  Logs are read at rev, or at the current
+// revision if rev is 0.
+func (d *driver) logScanRange(ctx context.Context, key, endKey string, rev int64,
+	fn func(value []byte) (bool, error)) (bool, error) {
+
+	// paginate for large number of logs.
+	// Keys are not sorted by etcd as it would read the whole range.
+	for {
+		resp, err := d.client.Get(ctx, key,
+			clientv3.WithRange(endKey),
+			clientv3.WithLimit(logPageSize),
+			clientv3.WithRev(rev),
+		)
+		if err != nil {
+			return false, err
+		}
+		if rev == 0 {
+			// to retrieve following pages at the same revision.
+			rev = resp.Header.Revision
+		}
+
+		for _, kv := range resp.Kvs {
+			done, err := fn(kv.Value)
+			if err != nil {
+				return false, err
+			}
+			if done {
+				return true, nil
+			}
+		}
+
+		if !resp.More {
+			return false, nil
+		}
+		key = string(resp.Kvs[len(resp.Kvs)-1].Key) + "\x00"
 	}
+}
 
-	// paginate for large number of logs
+// logScanDesc is logScan in the descending order.
+//
+// etcd ignores the limit to sort keys in the descending order, so logs
+// are read day by day from the newest in the ascending order and reversed.
+func (d *driver) logScanDesc(ctx context.Context, key, endKey string,
+	fn func(value []byte) (bool, error)) (bool, error) {
 
 	resp, err := d.client.Get(ctx, key,
 		clientv3.WithRange(endKey),
-		clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend),
-		clientv3.WithLimit(logPageSize),
+		clientv3.WithKeysOnly(),
+		clientv3.WithLimit(1),
 	)
 	if err != nil {
-		return err
+		return false, err
+	}
+	if len(resp.Kvs) == 0 {
+		return false, nil
+	}
+	rev := resp.Header.Revision
+	oldest, err := auditDay(string(resp.Kvs[0].Key))
+	if err != nil {
+		return false, err
 	}
-	rev := resp.Header.Revision //  to retrieve following pages at the same revision.
-	kvs := resp.Kvs
 
-REDO:
-	for _, kv := range kvs {
-		_, err = bufw.Write(kv.Value)
+	for hi := endKey; ; {
+		day, err := d.logLastDay(ctx, oldest, hi, rev)
 		if err != nil {
-			return err
+			return false, err
 		}
-		err = bufw.WriteByte('\n')
+
+		lo := max(auditKey(day), key)
+		var values [][]byte
+		_, err = d.logScanRange(ctx, lo, hi, rev, func(value []byte) (bool, error) {
+			values = append(values, value)
+			return false, nil
+		})
 		if err != nil {
-			return err
+			return false, err
+		}
+		for i := len(values) - 1; i >= 0; i-- {
+			done, err := fn(values[i])
+			if err != nil || done {
+				return done, err
+			}
 		}
+
+		if !day.After(oldest) {
+			return false, nil
+		}
+		hi = lo
 	}
+}
 
-	if resp.More {
-		resp, err = d.client.Get(ctx, string(resp.Kvs[len(resp.Kvs)-1].Key),
+// logLastDay returns the day of the newest log before endKey at rev.
+// A log of the day oldest must exist before endKey.
+func (d *driver) logLastDay(ctx context.Context, oldest time.Time, endKey string, rev int64) (time.Time, error) {
+	// exists returns true if logs exist in [n days after oldest, endKey).
+	exists := func(n int) (bool, error) {
+		resp, err := d.client.Get(ctx, auditKey(oldest.AddDate(0, 0, n)),
 			clientv3.WithRange(endKey),
-			clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend),
-			clientv3.WithLimit(logPageSize),
+			clientv3.WithKeysOnly(),
+			clientv3.WithLimit(1),
 			clientv3.WithRev(rev),
 		)
+		if err != nil {
+			return false, err
+		}
+		return len(resp.Kvs) > 0, nil
+	}
+
+	// in most cases, logs exist on the day before endKey.
+	if end, err := auditDay(endKey); err == nil {
+		n := int(end.Sub(oldest).Hours()/24) - 1
+		if n > 0 {
+			ok, err := exists(n)
+			if err != nil {
+				return time.Time{}, err
+			}
+			if ok {
+				return oldest.AddDate(0, 0, n), nil
+			}
+		}
+	}
+
+	// logs exist in [lo, endKey), but not in [hi, endKey).
+	lo, hi := 0, 1
+	for {
+		ok, err := exists(hi)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if !ok {
+			break
+		}
+		lo, hi = hi, hi*2
+	}
+	for hi-lo > 1 {
+		mid := (lo + hi) / 2
+		ok, err := exists(mid)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if ok {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return oldest.AddDate(0, 0, lo), nil
+}
+
+// logArchivedDays returns the days in [since, until) whose logs have
+// been removed from etcd.  If until is zero, it is not limited.
+func (d *driver) logArchivedDays(ctx context.Context, since, until time.Time) ([]time.Time, error) {
+	resp, err := d.client.Get(ctx, KeyAudit,
+		clientv3.WithPrefix(),
+		clientv3.WithKeysOnly(),
+		clientv3.WithLimit(1),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// logs are archived per day, so days before the oldest log in etcd
+	// are only in the archive.
+	end := time.Now().UTC().AddDate(0, 0, 1)
+	if len(resp.Kvs) > 0 {
+		end, err = auditDay(string(resp.Kvs[0].Key))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !until.IsZero() {
+		u := until.UTC().Truncate(24 * time.Hour)
+		if u.Before(end) {
+			end = u
+		}
+	}
+
+	var days []time.Time
+	for day := since.UTC().Truncate(24 * time.Hour); day.Before(end); day = day.AddDate(0, 0, 1) {
+		days = append(days, day)
+	}
+	return days, nil
+}
+
+// logLoadArchive calls fn for each archived log of the day until fn returns true.
+// This returns true if fn returns true.
+//
+// If the archive of the day is not found although the day was archived,
+// e.g. by another server, this returns an error.
+func (d *driver) logLoadArchive(ctx context.Context, day time.Time, order clientv3.SortOrder,
+	fn func(value []byte) (bool, error)) (bool, error) {
+
+	buf := new(bytes.Buffer)
+	err := d.logConfig.Archive.Load(ctx, day, buf)
+	if err == sabakan.ErrNotFound {
+		resp, err := d.client.Get(ctx, KeyAuditArchived+day.Format("20060102"), clientv3.WithCountOnly())
+		if err != nil {
+			return false, err
+		}
+		if resp.Count == 0 {
+			// no logs were recorded on the day
+			return false, nil
+		}
+		return false, fmt.Errorf("archived logs of %s are not found", day.Format("2006-01-02"))
+	}
+	if err != nil {
+		return false, err
+	}
+
+	lines := bytes.Split(bytes.TrimSuffix(buf.Bytes(), []byte{'\n'}), []byte{'\n'})
+	for i := range lines {
+		line := lines[i]
+		if order == clientv3.SortDescend {
+			line = lines[len(lines)-1-i]
+		}
+		if len(line) == 0 {
+			continue
+		}
+		done, err := fn(line)
+		if err != nil || done {
+			return done, err
+		}
+	}
+	return false, nil
+}
+
+// logQuery writes logs matching the query.
+//
+// If the archive is configured and q.Since is not zero, archived logs
+// are also read.
+func (d *driver) logQuery(ctx context.Context, q *sabakan.LogQuery, w io.Writer) error {
+	lw := &logWriter{q: q, w: bufio.NewWriterSize(w, 2048)}
+
+	key := KeyAudit
+	endKey := clientv3.GetPrefixRangeEnd(KeyAudit)
+
+	if !q.Since.IsZero() {
+		key = auditKey(q.Since)
+	}
+	if !q.Until.IsZero() {
+		endKey = auditKey(q.Until)
+	}
+
+	order := clientv3.SortAscend
+	if q.Order == sabakan.LogOrderDesc {
+		order = clientv3.SortDescend
+	}
+
+	var archived []time.Time
+	if d.logConfig.Archive != nil && !q.Since.IsZero() {
+		var err error
+		archived, err = d.logArchivedDays(ctx, q.Since, q.Until)
 		if err != nil {
 			return err
 		}
+	}
+
+	if order == clientv3.SortAscend {
+		for _, day := range archived {
+			done, err := d.logLoadArchive(ctx, day, order, lw.write)
+			if err != nil {
+				return err
+			}
+			if done {
+				return lw.w.Flush()
+			}
+		}
+	}
 
-		// ignore the first key
-		kvs = resp.Kvs[1:]
-		goto REDO
+	done, err := d.logScan(ctx, key, endKey, order, lw.write)
+	if err != nil {
+		return err
+	}
+	if done {
+		return lw.w.Flush()
+	}
+
+	if order == clientv3.SortDescend {
+		for i := len(archived) - 1; i >= 0; i-- {
+			done, err := d.logLoadArchive(ctx, archived[i], order, lw.write)
+			if err != nil {
+				return err
+			}
+			if done {
+				break
+			}
+		}
 	}
 
-	return bufw.Flush()
+	return lw.w.Flush()
 }
 
 type logDriver struct {
@@ -208,3 +798,15 @@ type logDriver struct {
 func (d logDriver) Dump(ctx context.Context, since, until time.Time, w io.Writer) error {
 	return d.logDump(ctx, since, until, w)
 }
+
+func (d logDriver) Query(ctx context.Context, q *sabakan.LogQuery, w io.Writer) error {
+	return d.logQuery(ctx, q, w)
+}
+
+func (d logDriver) Chain(ctx context.Context) (*sabakan.AuditChain, error) {
+	return d.logChain(ctx)
+}
+
+func (d logDriver) Record(ctx context.Context, cat sabakan.AuditCategory, instance, action, detail string) error {
+	return d.recordLog(ctx, cat, instance, action, detail)
+}
@@ -0,0 +1,183 @@
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cybozu-go/log"
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+// logBatcher buffers audit log entries to write them in batches.
+//
+// Entries exceeding maxBatchedLogs before flush are dropped, and
+// the number of dropped entries is recorded instead.
+// The zero value is ready to use.
+type logBatcher struct {
+	mu      sync.Mutex
+	entries []*sabakan.AuditLog
+	dropped map[sabakan.AuditCategory]int
+}
+
+func (b *logBatcher) add(a *sabakan.AuditLog) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.entries) >= maxBatchedLogs {
+		b.drop(a.Category, 1)
+		return
+	}
+	b.entries = append(b.entries, a)
+}
+
+func (b *logBatcher) drop(cat sabakan.AuditCategory, n int) {
+	if b.dropped == nil {
+		b.dropped = make(map[sabakan.AuditCategory]int)
+	}
+	b.dropped[cat] += n
+}
+
+// take returns buffered entries and the numbers of dropped entries,
+// and clears the buffer.
+func (b *logBatcher) take() ([]*sabakan.AuditLog, map[sabakan.AuditCategory]int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	entries, dropped := b.entries, b.dropped
+	b.entries = nil
+	b.dropped = nil
+	return entries, dropped
+}
+
+// restore puts back entries and the numbers of dropped entries that
+// were taken but not written.  Restored entries precede those added
+// after take.  Entries exceeding maxBatchedLogs are dropped.
+func (b *logBatcher) restore(entries []*sabakan.AuditLog, dropped map[sabakan.AuditCategory]int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	entries = append(entries[:len(entries):len(entries)], b.entries...)
+	if len(entries) > maxBatchedLogs {
+		for _, a := range entries[maxBatchedLogs:] {
+			b.drop(a.Category, 1)
+		}
+		entries = entries[:maxBatchedLogs]
+	}
+	b.entries = entries
+	for cat, n := range dropped {
+		b.drop(cat, n)
+	}
+}
+
+// addBatchedLog buffers an audit log entry for events that may happen
+// very frequently.  Buffered entries are written by logFlusher.
+func (d *driver) addBatchedLog(ctx context.Context, ts time.Time, cat sabakan.AuditCategory,
+	instance, action, detail string) {
+
+	d.logs.add(sabakan.NewAuditLog(ctx, ts, 0, cat, instance, action, detail))
+}
+
+// flushLogs writes buffered audit log entries.
+//
+// All entries in a batch share the same revision obtained by updating
+// KeyAuditSequence.  Their keys are made unique by appending sequence numbers.
+//
+// Entries that are not written due to errors are put back to the buffer
+// to be written in the next flush.
+func (d *driver) flushLogs(ctx context.Context) error {
+	entries, dropped := d.logs.take()
+	if len(entries) == 0 && len(dropped) == 0 {
+		return nil
+	}
+
+	cats := make([]sabakan.AuditCategory, 0, len(dropped))
+	for cat := range dropped {
+		cats = append(cats, cat)
+	}
+	sort.Slice(cats, func(i, j int) bool { return cats[i] < cats[j] })
+
+	now := time.Now().UTC()
+	all := make([]*sabakan.AuditLog, 0, len(entries)+len(cats))
+	all = append(all, entries...)
+	for _, cat := range cats {
+		all = append(all, &sabakan.AuditLog{
+			Timestamp: now,
+			Category:  cat,
+			Action:    "drop",
+			Detail:    fmt.Sprintf("%d log entries were dropped", dropped[cat]),
+		})
+	}
+
+	n, err := d.writeBatchedLogs(ctx, all)
+	if err != nil {
+		remaining := make(map[sabakan.AuditCategory]int)
+		for i := max(n, len(entries)); i < len(all); i++ {
+			cat := cats[i-len(entries)]
+			remaining[cat] = dropped[cat]
+		}
+		d.logs.restore(entries[min(n, len(entries)):], remaining)
+		return err
+	}
+	return nil
+}
+
+// writeBatchedLogs writes entries in batches of logBatchSize.
+// This returns the number of entries written.
+//
+// If the commit of a batch fails with an error, the batch may have been
+// written; such entries are counted as not written so that they are
+// recorded at least once.
+func (d *driver) writeBatchedLogs(ctx context.Context, entries []*sabakan.AuditLog) (int, error) {
+	resp, err := d.client.Put(ctx, KeyAuditSequence, "")
+	if err != nil {
+		return 0, err
+	}
+	rev := resp.Header.Revision
+
+	var written int
+	keys := make([]string, 0, logBatchSize)
+	batch := make([]*sabakan.AuditLog, 0, logBatchSize)
+	for i, a := range entries {
+		a.Revision = rev
+		keys = append(keys, auditKey(a.Timestamp)+fmt.Sprintf("%016x-%06x", uint64(rev), i))
+		batch = append(batch, a)
+
+		if len(batch) == logBatchSize || i == len(entries)-1 {
+			err = d.appendLogs(ctx, keys, batch)
+			if err != nil {
+				return written, err
+			}
+			written += len(batch)
+			keys = keys[:0]
+			batch = batch[:0]
+		}
+	}
+	return written, nil
+}
+
+// logFlusher is a goroutine to flush batched logs periodically.
+func (d *driver) logFlusher(ctx context.Context) error {
+	ticker := time.NewTicker(logFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			// flush remaining entries before exit
+			ctx, cancel := context.WithTimeout(context.Background(), logFlushInterval)
+			err := d.flushLogs(ctx)
+			cancel()
+			return err
+		case <-ticker.C:
+			err := d.flushLogs(ctx)
+			if err != nil {
+				log.Error("etcd: failed to flush audit logs", map[string]interface{}{
+					log.FnError: err,
+				})
+			}
+		}
+	}
+}
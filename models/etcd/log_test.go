@@ -3,11 +3,16 @@ package etcd
 import (
 	"bytes"
 	"context"
+	"crypto/ed25519"
 	"encoding/json"
+	"fmt"
+	"io"
 	"testing"
 	"time"
 
 	"github.com/cybozu-go/sabakan/v3"
+	"github.com/cybozu-go/sabakan/v3/logarchive"
+	"github.com/google/go-cmp/cmp"
 	clientv3 "go.etcd.io/etcd/client/v3"
 )
 
@@ -233,9 +238,439 @@ func testLogDump(t *testing.T) {
 	}
 }
 
+func testLogRecord(t *testing.T) {
+	t.Parallel()
+
+	d, _ := testNewDriver(t)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		err := d.recordLog(ctx, sabakan.AuditIPAM, "config/ipam", "deny", "PUT /api/v1/config/ipam")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	err := d.logDump(ctx, time.Time{}, time.Time{}, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	if count := bytes.Count(data, []byte("\n")); count != 2 {
+		t.Fatal(`count != 2`, count)
+	}
+
+	var a sabakan.AuditLog
+	err = json.Unmarshal(data[:bytes.IndexByte(data, '\n')], &a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Action != "deny" || a.Instance != "config/ipam" {
+		t.Error("wrong log entry:", a)
+	}
+}
+
+func testLogBatch(t *testing.T) {
+	t.Parallel()
+
+	d, _ := testNewDriver(t)
+	ctx := context.Background()
+
+	for i := 0; i < logBatchSize+1; i++ {
+		d.addBatchedLog(ctx, time.Now(), sabakan.AuditCrypts, "1234", "get", "disk")
+	}
+	err := d.flushLogs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	err = d.logDump(ctx, time.Time{}, time.Time{}, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := bytes.Count(buf.Bytes(), []byte("\n")); count != logBatchSize+1 {
+		t.Error(`count != logBatchSize+1`, count)
+	}
+
+	// entries are put back if flush fails
+	d.addBatchedLog(ctx, time.Now(), sabakan.AuditCrypts, "1234", "get", "disk")
+	d.logs.drop(sabakan.AuditCrypts, 2)
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	err = d.flushLogs(canceled)
+	if err == nil {
+		t.Fatal("flush should fail")
+	}
+	err = d.flushLogs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	err = d.logDump(ctx, time.Time{}, time.Time{}, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := bytes.Count(buf.Bytes(), []byte("\n")); count != logBatchSize+3 {
+		t.Error(`count != logBatchSize+3`, count)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("2 log entries were dropped")) {
+		t.Error("drop entry is lost")
+	}
+
+	var b logBatcher
+	for i := 0; i < maxBatchedLogs+3; i++ {
+		b.add(&sabakan.AuditLog{Category: sabakan.AuditCrypts})
+	}
+	entries, dropped := b.take()
+	if len(entries) != maxBatchedLogs || dropped[sabakan.AuditCrypts] != 3 {
+		t.Fatal("wrong entries:", len(entries), dropped)
+	}
+	entries, dropped = b.take()
+	if len(entries) != 0 || len(dropped) != 0 {
+		t.Error("entries are not cleared")
+	}
+
+	// restored entries precede new ones, and excess entries are dropped
+	b.add(&sabakan.AuditLog{Category: sabakan.AuditCrypts, Action: "new"})
+	old := make([]*sabakan.AuditLog, maxBatchedLogs)
+	for i := range old {
+		old[i] = &sabakan.AuditLog{Category: sabakan.AuditCrypts, Action: "old"}
+	}
+	b.restore(old, map[sabakan.AuditCategory]int{sabakan.AuditCrypts: 2})
+	entries, dropped = b.take()
+	if len(entries) != maxBatchedLogs || entries[0].Action != "old" || entries[len(entries)-1].Action != "old" {
+		t.Error("wrong restored entries:", len(entries))
+	}
+	if dropped[sabakan.AuditCrypts] != 3 {
+		t.Error("wrong dropped count:", dropped)
+	}
+}
+
+func testLogQuery(t *testing.T) {
+	t.Parallel()
+
+	d, _ := testNewDriver(t)
+	ctx := context.Background()
+
+	ts := time.Date(2013, time.April, 5, 1, 2, 3, 4, time.UTC)
+	for i := int64(0); i < 2*logPageSize; i++ {
+		instance := "1234"
+		if i%2 == 1 {
+			instance = "5678"
+		}
+		d.addLog(ctx, ts, 100+i, sabakan.AuditMachines, instance, "state", "healthy")
+		ts = ts.Add(time.Hour)
+	}
+	d.addLog(ctx, ts, 100+2*logPageSize, sabakan.AuditIPAM, "config", "put", "test")
+
+	query := func(q *sabakan.LogQuery) []*sabakan.AuditLog {
+		buf := new(bytes.Buffer)
+		err := d.logQuery(ctx, q, buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var logs []*sabakan.AuditLog
+		dec := json.NewDecoder(buf)
+		for dec.More() {
+			a := new(sabakan.AuditLog)
+			err = dec.Decode(a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			logs = append(logs, a)
+		}
+		return logs
+	}
+
+	logs := query(&sabakan.LogQuery{Category: sabakan.AuditMachines, Instance: "5678"})
+	if len(logs) != logPageSize {
+		t.Fatal(`len(logs) != logPageSize`, len(logs))
+	}
+	for _, a := range logs {
+		if a.Instance != "5678" {
+			t.Error("unexpected log:", a)
+		}
+	}
+
+	logs = query(&sabakan.LogQuery{Order: sabakan.LogOrderDesc})
+	if len(logs) != 2*logPageSize+1 {
+		t.Fatal(`len(logs) != 2*logPageSize+1`, len(logs))
+	}
+	for i, a := range logs {
+		if a.Revision != 100+2*logPageSize-int64(i) {
+			t.Fatal("wrong order:", i, a.Revision)
+		}
+	}
+
+	logs = query(&sabakan.LogQuery{Instance: "1234", Order: sabakan.LogOrderDesc, Limit: 3})
+	if len(logs) != 3 {
+		t.Fatal(`len(logs) != 3`, len(logs))
+	}
+	if logs[0].Revision != 100+2*logPageSize-2 || logs[2].Revision != 100+2*logPageSize-6 {
+		t.Error("wrong logs:", logs[0].Revision, logs[2].Revision)
+	}
+
+	logs = query(&sabakan.LogQuery{
+		Since:    time.Date(2013, time.April, 6, 0, 0, 0, 0, time.UTC),
+		Until:    time.Date(2013, time.April, 7, 0, 0, 0, 0, time.UTC),
+		Instance: "1234",
+		Limit:    100,
+	})
+	if len(logs) != 12 {
+		t.Error(`len(logs) != 12`, len(logs))
+	}
+
+	logs = query(&sabakan.LogQuery{
+		Until:    time.Date(2013, time.April, 7, 0, 0, 0, 0, time.UTC),
+		Instance: "1234",
+		Order:    sabakan.LogOrderDesc,
+	})
+	if len(logs) != 24 {
+		t.Fatal(`len(logs) != 24`, len(logs))
+	}
+	if logs[0].Revision != 146 || logs[23].Revision != 100 {
+		t.Error("wrong logs:", logs[0].Revision, logs[23].Revision)
+	}
+
+	logs = query(&sabakan.LogQuery{Category: sabakan.AuditIPAM, Action: "delete"})
+	if len(logs) != 0 {
+		t.Error(`len(logs) != 0`, len(logs))
+	}
+}
+
+func testLogArchive(t *testing.T) {
+	t.Parallel()
+
+	d, _ := testNewDriver(t)
+	ctx := context.Background()
+
+	archive, err := logarchive.NewDir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.logConfig = sabakan.LogConfig{RetentionDays: 30, Archive: archive}
+
+	now := time.Date(2013, time.April, 5, 1, 2, 3, 4, time.UTC)
+	days := []time.Time{
+		now.AddDate(0, 0, -32),
+		now.AddDate(0, 0, -31),
+		now.AddDate(0, 0, -1),
+	}
+	for i, ts := range days {
+		d.addLog(ctx, ts, 100+2*int64(i), sabakan.AuditIPAM, "config", "put", "test")
+		d.addLog(ctx, ts.Add(time.Minute), 101+2*int64(i), sabakan.AuditMachines, "1234", "state", "healthy")
+	}
+
+	err = d.logCompact(ctx, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := d.client.Get(ctx, KeyAudit, clientv3.WithPrefix(), clientv3.WithCountOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Count != 2 {
+		t.Error(`resp.Count != 2`, resp.Count)
+	}
+	for _, day := range days[:2] {
+		buf := new(bytes.Buffer)
+		err = archive.Load(ctx, day, buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := bytes.Count(buf.Bytes(), []byte{'\n'}); n != 2 {
+			t.Error("wrong number of archived logs:", day, n)
+		}
+	}
+
+	query := func(q *sabakan.LogQuery) []int64 {
+		buf := new(bytes.Buffer)
+		err := d.logQuery(ctx, q, buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var revs []int64
+		dec := json.NewDecoder(buf)
+		for dec.More() {
+			a := new(sabakan.AuditLog)
+			err = dec.Decode(a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			revs = append(revs, a.Revision)
+		}
+		return revs
+	}
+
+	cases := []struct {
+		q        *sabakan.LogQuery
+		expected []int64
+	}{
+		{&sabakan.LogQuery{}, []int64{104, 105}},
+		{&sabakan.LogQuery{Since: now.AddDate(0, 0, -40)}, []int64{100, 101, 102, 103, 104, 105}},
+		{&sabakan.LogQuery{Since: now.AddDate(0, 0, -31)}, []int64{102, 103, 104, 105}},
+		{&sabakan.LogQuery{Since: now.AddDate(0, 0, -40), Until: now.AddDate(0, 0, -31)}, []int64{100, 101}},
+		{&sabakan.LogQuery{Since: now.AddDate(0, 0, -40), Order: sabakan.LogOrderDesc}, []int64{105, 104, 103, 102, 101, 100}},
+		{&sabakan.LogQuery{Since: now.AddDate(0, 0, -40), Order: sabakan.LogOrderDesc, Limit: 3}, []int64{105, 104, 103}},
+		{&sabakan.LogQuery{Since: now.AddDate(0, 0, -40), Limit: 3}, []int64{100, 101, 102}},
+		{&sabakan.LogQuery{Since: now.AddDate(0, 0, -40), Category: sabakan.AuditMachines}, []int64{101, 103, 105}},
+	}
+	for i, c := range cases {
+		revs := query(c.q)
+		if !cmp.Equal(revs, c.expected) {
+			t.Error("unexpected logs:", i, revs)
+		}
+	}
+
+	// the archive written by another server is not available
+	other, err := logarchive.NewDir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.logConfig.Archive = other
+	err = d.logQuery(ctx, &sabakan.LogQuery{Since: now.AddDate(0, 0, -40)}, io.Discard)
+	if err == nil {
+		t.Error("missing archive should be an error")
+	}
+	revs := query(&sabakan.LogQuery{Since: now.AddDate(0, 0, -30)})
+	if !cmp.Equal(revs, []int64{104, 105}) {
+		t.Error("unexpected logs:", revs)
+	}
+}
+
+func testLogChain(t *testing.T) {
+	t.Parallel()
+
+	d, _ := testNewDriver(t)
+	ctx := context.Background()
+
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.logConfig = sabakan.LogConfig{RetentionDays: 30, CheckpointKey: priv}
+
+	now := time.Date(2013, time.April, 5, 1, 2, 3, 4, time.UTC)
+	days := []time.Time{
+		now.AddDate(0, 0, -32),
+		now.AddDate(0, 0, -31),
+		now.AddDate(0, 0, -1),
+	}
+	for i, ts := range days {
+		d.addLog(ctx, ts, 100+2*int64(i), sabakan.AuditIPAM, "config", "put", "test")
+		d.addLog(ctx, ts.Add(time.Minute), 101+2*int64(i), sabakan.AuditMachines, "1234", "state", "healthy")
+	}
+
+	getLogs := func() []*sabakan.AuditLog {
+		buf := new(bytes.Buffer)
+		err := d.logQuery(ctx, &sabakan.LogQuery{}, buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var logs []*sabakan.AuditLog
+		dec := json.NewDecoder(buf)
+		for dec.More() {
+			a := new(sabakan.AuditLog)
+			err = dec.Decode(a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			logs = append(logs, a)
+		}
+		return logs
+	}
+
+	logs := getLogs()
+	if len(logs) != 6 {
+		t.Fatal("wrong number of logs:", len(logs))
+	}
+	for i, a := range logs {
+		if a.Seq != uint64(i+1) {
+			t.Error("wrong sequence:", i, a.Seq)
+		}
+	}
+
+	seq, err := d.logCheckpoint(ctx, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seq != 6 {
+		t.Error("wrong checkpoint:", seq)
+	}
+
+	chain, err := d.logChain(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chain.Head == nil || chain.Head.Seq != 6 || chain.Head.Hash != logs[5].Hash {
+		t.Error("wrong head:", chain.Head)
+	}
+	if len(chain.Checkpoints) != 1 || !chain.Checkpoints[0].VerifySignature(pub) {
+		t.Error("wrong checkpoints:", chain.Checkpoints)
+	}
+	r := sabakan.VerifyAuditChain(logs, chain, pub, true, true)
+	if !r.OK() || r.Verified != 6 || !r.Anchored {
+		t.Error("chain should be verified:", r)
+	}
+
+	err = d.logCompact(ctx, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logs = getLogs()
+	if len(logs) != 2 {
+		t.Fatal("wrong number of logs after compaction:", len(logs))
+	}
+	chain, err = d.logChain(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain.Checkpoints) != 2 || chain.Checkpoints[0].Seq != 4 {
+		t.Error("checkpoints before the anchor should be removed:", chain.Checkpoints)
+	}
+	r = sabakan.VerifyAuditChain(logs, chain, pub, true, true)
+	if !r.OK() || r.Verified != 2 || !r.Anchored {
+		t.Error("compacted chain should be verified:", r)
+	}
+
+	// modify an entry in etcd
+	logs[0].Detail = "modified"
+	j, err := json.Marshal(logs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = d.client.Put(ctx, auditKey(logs[0].Timestamp)+fmt.Sprintf("%016x", uint64(logs[0].Revision)), string(j))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = sabakan.VerifyAuditChain(getLogs(), chain, pub, true, true)
+	if r.OK() {
+		t.Error("modification should be detected")
+	}
+
+	// remove the last entry
+	_, err = d.client.Delete(ctx, auditKey(logs[1].Timestamp)+fmt.Sprintf("%016x", uint64(logs[1].Revision)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = sabakan.VerifyAuditChain(getLogs(), chain, pub, true, true)
+	if r.OK() {
+		t.Error("truncation should be detected")
+	}
+}
+
 func TestLog(t *testing.T) {
 	t.Run("Add", testLogAdd)
+	t.Run("Record", testLogRecord)
+	t.Run("Batch", testLogBatch)
 	t.Run("Compact", testLogCompact)
 	t.Run("TryCompact", testLogTryCompact)
 	t.Run("Dump", testLogDump)
+	t.Run("Query", testLogQuery)
+	t.Run("Archive", testLogArchive)
+	t.Run("Chain", testLogChain)
 }
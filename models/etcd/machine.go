@@ -115,7 +115,12 @@ RETRY:
 	if err != nil {
 		return err
 	}
+	before, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
 
+	prevState := m.Status.State
 	err = m.SetState(state)
 	if err != nil {
 		return err
@@ -124,6 +129,10 @@ RETRY:
 	if err != nil {
 		return err
 	}
+	detail, err := sabakan.AuditDiff(before, data)
+	if err != nil {
+		return err
+	}
 
 	var thenOp clientv3.Op
 	if state != sabakan.StateRetired {
@@ -154,6 +163,11 @@ RETRY:
 		}
 	}
 
+	// setting the same state is frequent and changes nothing
+	if prevState != state {
+		d.addLog(ctx, time.Now(), tresp.Header.Revision, sabakan.AuditMachines, serial,
+			"set-state", detail)
+	}
 	return nil
 }
 
@@ -166,11 +180,19 @@ RETRY:
 		return err
 	}
 
+	before, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
 	m.PutLabel(label, value)
 	data, err := json.Marshal(m)
 	if err != nil {
 		return err
 	}
+	detail, err := sabakan.AuditDiff(before, data)
+	if err != nil {
+		return err
+	}
 
 	tresp, err := d.client.Txn(ctx).
 		If(clientv3.Compare(clientv3.ModRevision(key), "=", rev)).
@@ -184,7 +206,7 @@ RETRY:
 	}
 
 	d.addLog(ctx, time.Now(), tresp.Header.Revision, sabakan.AuditMachines, serial,
-		"put-label", label+"/"+value)
+		"put-label", detail)
 	return nil
 }
 
@@ -197,6 +219,10 @@ RETRY:
 		return err
 	}
 
+	before, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
 	err = m.DeleteLabel(label)
 	if err != nil {
 		return err
@@ -206,6 +232,10 @@ RETRY:
 	if err != nil {
 		return err
 	}
+	detail, err := sabakan.AuditDiff(before, data)
+	if err != nil {
+		return err
+	}
 
 	tresp, err := d.client.Txn(ctx).
 		If(clientv3.Compare(clientv3.ModRevision(key), "=", rev)).
@@ -219,7 +249,7 @@ RETRY:
 	}
 
 	d.addLog(ctx, time.Now(), tresp.Header.Revision, sabakan.AuditMachines, serial,
-		"delete-label", label)
+		"delete-label", detail)
 	return nil
 }
 
@@ -232,12 +262,20 @@ RETRY:
 		return err
 	}
 
+	before, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
 	m.Spec.RetireDate = date
 
 	data, err := json.Marshal(m)
 	if err != nil {
 		return err
 	}
+	detail, err := sabakan.AuditDiff(before, data)
+	if err != nil {
+		return err
+	}
 
 	tresp, err := d.client.Txn(ctx).
 		If(clientv3.Compare(clientv3.ModRevision(key), "=", rev)).
@@ -251,7 +289,7 @@ RETRY:
 	}
 
 	d.addLog(ctx, time.Now(), tresp.Header.Revision, sabakan.AuditMachines, serial,
-		"set-retire-date", date.String())
+		"set-retire-date", detail)
 	return nil
 }
 
@@ -328,6 +366,15 @@ RETRY:
 		return nil
 	}
 
+	before, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	detail, err := sabakan.AuditDiff(before, nil)
+	if err != nil {
+		return err
+	}
+
 	resp, err := d.machineDoDelete(ctx, m, rev, usage)
 	if err != nil {
 		return err
@@ -338,7 +385,7 @@ RETRY:
 	}
 
 	d.addLog(ctx, time.Now(), resp.Header.Revision, sabakan.AuditMachines, serial,
-		"delete", "")
+		"delete", detail)
 
 	return nil
 }
@@ -1,12 +1,15 @@
 package etcd
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"testing"
 	"time"
 
 	"github.com/cybozu-go/sabakan/v3"
+	"github.com/cybozu-go/sabakan/v3/models/modeltest"
+	"github.com/google/go-cmp/cmp"
 )
 
 func testRegister(t *testing.T) {
@@ -31,11 +34,11 @@ func testRegister(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if len(saved.Spec.IPv4) != int(testIPAMConfig.NodeIPPerNode) {
+	if len(saved.Spec.IPv4) != int(modeltest.IPAMConfig.NodeIPPerNode) {
 		t.Errorf("unexpected assigned IP addresses: %v", len(saved.Spec.IPv4))
 	}
-	if saved.Spec.IndexInRack != testIPAMConfig.NodeIndexOffset+2 {
-		t.Errorf("node index of 2nd worker should be %v but %v", testIPAMConfig.NodeIndexOffset+2, saved.Spec.IndexInRack)
+	if saved.Spec.IndexInRack != modeltest.IPAMConfig.NodeIndexOffset+2 {
+		t.Errorf("node index of 2nd worker should be %v but %v", modeltest.IPAMConfig.NodeIndexOffset+2, saved.Spec.IndexInRack)
 	}
 	if !saved.Spec.RetireDate.Equal(time.Date(2018, time.November, 22, 1, 2, 3, 0, time.UTC)) {
 		t.Error("retire-date is not saved:", saved.Spec.RetireDate)
@@ -78,8 +81,8 @@ func testRegister(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if saved.Spec.IndexInRack != testIPAMConfig.NodeIndexOffset {
-		t.Errorf("node index of boot server should be %v but %v", testIPAMConfig.NodeIndexOffset, saved.Spec.IndexInRack)
+	if saved.Spec.IndexInRack != modeltest.IPAMConfig.NodeIndexOffset {
+		t.Errorf("node index of boot server should be %v but %v", modeltest.IPAMConfig.NodeIndexOffset, saved.Spec.IndexInRack)
 	}
 
 	err = d.machineRegister(context.Background(), bootServer2)
@@ -178,6 +181,27 @@ func testQuery(t *testing.T) {
 	}
 }
 
+func testMachineLogs(t *testing.T, d *driver, serial, action string) []*sabakan.AuditLog {
+	buf := new(bytes.Buffer)
+	q := &sabakan.LogQuery{Category: sabakan.AuditMachines, Instance: serial, Action: action}
+	err := d.logQuery(context.Background(), q, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var logs []*sabakan.AuditLog
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		a := new(sabakan.AuditLog)
+		err = dec.Decode(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		logs = append(logs, a)
+	}
+	return logs
+}
+
 func testSetState(t *testing.T) {
 	d, ch := testNewDriver(t)
 	ctx := context.Background()
@@ -206,6 +230,32 @@ func testSetState(t *testing.T) {
 		t.Error("m.Status.State == sabakan.StateHealthy:", m.Status.State)
 	}
 
+	// setting the same state is not logged
+	err = d.machineSetState(ctx, "12345678", sabakan.StateHealthy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs := testMachineLogs(t, d, "12345678", "set-state")
+	if len(logs) != 1 {
+		t.Fatal("wrong number of logs:", len(logs))
+	}
+	changes, ok := sabakan.ParseAuditDiff(logs[0].Detail)
+	if !ok {
+		t.Fatal("detail is not a diff:", logs[0].Detail)
+	}
+	var found bool
+	for _, c := range changes {
+		if c.Path == "/status/state" {
+			found = true
+			if string(c.Old) != `"uninitialized"` || string(c.New) != `"healthy"` {
+				t.Error("wrong state change:", string(c.Old), string(c.New))
+			}
+		}
+	}
+	if !found {
+		t.Error("state change is not recorded:", logs[0].Detail)
+	}
+
 	err = d.PutEncryptionKey(ctx, "12345678", "abcd-efgh", []byte("data"))
 	if err != nil {
 		t.Fatal(err)
@@ -258,6 +308,18 @@ func testPutLabel(t *testing.T) {
 		t.Error("wrong labels:", m.Spec.Labels)
 	}
 
+	logs := testMachineLogs(t, d, "12345678", "put-label")
+	if len(logs) != 1 {
+		t.Fatal("wrong number of logs:", len(logs))
+	}
+	expected := []sabakan.AuditChange{
+		{Path: "/spec/labels/datacenter", New: json.RawMessage(`"heaven"`)},
+	}
+	changes, _ := sabakan.ParseAuditDiff(logs[0].Detail)
+	if !cmp.Equal(changes, expected) {
+		t.Error("wrong diff:", logs[0].Detail)
+	}
+
 	err = d.machinePutLabel(context.Background(), "1111", "datacenter", "heaven")
 	if err != sabakan.ErrNotFound {
 		if err != nil {
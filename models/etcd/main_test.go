@@ -12,6 +12,7 @@ import (
 	"github.com/cybozu-go/etcdutil"
 	"github.com/cybozu-go/log"
 	"github.com/cybozu-go/sabakan/v3"
+	"github.com/cybozu-go/sabakan/v3/models/modeltest"
 	"github.com/cybozu-go/well"
 	clientv3 "go.etcd.io/etcd/client/v3"
 )
@@ -84,7 +85,7 @@ func testNewDriver(t *testing.T) (*driver, <-chan struct{}) {
 
 func initializeTestData(d *driver, ch <-chan struct{}) ([]*sabakan.Machine, error) {
 	ctx := context.Background()
-	config := &testIPAMConfig
+	config := &modeltest.IPAMConfig
 	err := d.putIPAMConfig(ctx, config)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,309 @@
+package etcd
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/cybozu-go/log"
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+/*
+Object keys:
+
+    - assets/ID
+    - images/OS/ID/kernel
+    - images/OS/ID/initrd.gz
+
+Unlike the data directory, objects are shared by all servers.
+Therefore they are not replicated, and are removed by the server
+that deletes or replaces them in etcd.
+*/
+
+func assetObjectKey(id int) string {
+	return "assets/" + strconv.Itoa(id)
+}
+
+func imageObjectKey(os, id, member string) string {
+	return "images/" + os + "/" + id + "/" + member
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// assetSaveObject uploads an asset to the object storage.
+// When successful, this returns SHA256 checksum and the size of the contents.
+func (d *driver) assetSaveObject(ctx context.Context, id int, r io.Reader, csum []byte) ([]byte, int64, error) {
+	h := sha256.New()
+	cr := &countingReader{r: io.TeeReader(r, h)}
+	key := assetObjectKey(id)
+	err := d.objects.Store.Put(ctx, key, cr)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	hsum := h.Sum(nil)
+	if csum != nil && !bytes.Equal(csum, hsum) {
+		d.objects.Store.Delete(ctx, key)
+		return nil, 0, fmt.Errorf("checksum mismatch for id %d", id)
+	}
+	return hsum, cr.n, nil
+}
+
+func (d *driver) assetObjectExists(ctx context.Context, id int) bool {
+	_, err := d.objects.Store.Size(ctx, assetObjectKey(id))
+	return err == nil
+}
+
+// assetServeObject serves an asset in the object storage.
+func (d *driver) assetServeObject(ctx context.Context, a *sabakan.Asset, h sabakan.AssetHandler) error {
+	key := assetObjectKey(a.ID)
+	if d.objects.Redirect {
+		u, err := d.objects.Store.URL(key, objectURLExpiry)
+		if err != nil {
+			return err
+		}
+		h.Redirect(u)
+		return nil
+	}
+
+	r, err := d.objects.Store.Open(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	h.ServeContent(a, r)
+	return nil
+}
+
+// assetDeleteObject removes objects of all versions of an asset deleted
+// in etcd.  prev is the previous value of the asset key.
+func (d *driver) assetDeleteObject(ctx context.Context, prev []byte) {
+	a, err := decodeAsset(prev)
+	if err != nil {
+		log.Error("asset: failed to remove an object", map[string]interface{}{
+			log.FnError: err,
+		})
+		return
+	}
+	d.assetDeleteObjects(ctx, a.IDs())
+}
+
+// assetDeleteObjects removes objects of asset versions deleted or
+// discarded from the history in etcd.
+func (d *driver) assetDeleteObjects(ctx context.Context, ids []int) {
+	for _, id := range ids {
+		err := d.objects.Store.Delete(ctx, assetObjectKey(id))
+		if err != nil {
+			log.Error("asset: failed to remove an object", map[string]interface{}{
+				log.FnError: err,
+				"id":        id,
+			})
+		}
+	}
+}
+
+// imageSaveObjects reads a tar archive from r to upload files shown in
+// imageMembers to the object storage.  This returns the total size of files.
+//
+// If the tar archive contains a file not in members, or if the tar
+// archive lacks a file in members, this function returns sabakan.ErrBadRequest.
+// In that case, uploaded files are removed.
+func (d *driver) imageSaveObjects(ctx context.Context, os, id string, r io.Reader) (size int64, err error) {
+	defer func() {
+		io.Copy(io.Discard, r)
+	}()
+
+	memberMap := make(map[string]bool)
+	for _, m := range imageMembers[os] {
+		memberMap[m] = true
+	}
+
+	var saved []string
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, key := range saved {
+			d.objects.Store.Delete(ctx, key)
+		}
+	}()
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		if !memberMap[hdr.Name] {
+			return 0, sabakan.ErrBadRequest
+		}
+		delete(memberMap, hdr.Name)
+
+		key := imageObjectKey(os, id, hdr.Name)
+		err = d.objects.Store.Put(ctx, key, tr)
+		if err != nil {
+			return 0, err
+		}
+		saved = append(saved, key)
+		size += hdr.Size
+	}
+
+	if len(memberMap) > 0 {
+		return 0, sabakan.ErrBadRequest
+	}
+	return size, nil
+}
+
+// imageCompareObjects reads a tar archive from r and compares files with
+// the objects of an existing image.  This returns the total size of files.
+//
+// The objects are never overwritten because they are served by all servers.
+// If the tar archive is invalid, this function returns sabakan.ErrBadRequest.
+// If the contents differ from the objects, this returns an error.
+func (d *driver) imageCompareObjects(ctx context.Context, os, id string, r io.Reader) (int64, error) {
+	defer func() {
+		io.Copy(io.Discard, r)
+	}()
+
+	memberMap := make(map[string]bool)
+	for _, m := range imageMembers[os] {
+		memberMap[m] = true
+	}
+
+	var size int64
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		if !memberMap[hdr.Name] {
+			return 0, sabakan.ErrBadRequest
+		}
+		delete(memberMap, hdr.Name)
+
+		eq, err := d.equalObject(ctx, imageObjectKey(os, id, hdr.Name), tr)
+		if err != nil {
+			return 0, err
+		}
+		if !eq {
+			return 0, fmt.Errorf("different content")
+		}
+		size += hdr.Size
+	}
+
+	if len(memberMap) > 0 {
+		return 0, sabakan.ErrBadRequest
+	}
+	return size, nil
+}
+
+func (d *driver) equalObject(ctx context.Context, key string, r io.Reader) (bool, error) {
+	obj, err := d.objects.Store.Open(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	defer obj.Close()
+
+	h1 := sha256.New()
+	_, err = io.Copy(h1, obj)
+	if err != nil {
+		return false, err
+	}
+	h2 := sha256.New()
+	_, err = io.Copy(h2, r)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(h1.Sum(nil), h2.Sum(nil)), nil
+}
+
+func (d *driver) imageObjectsExist(ctx context.Context, os, id string) bool {
+	for _, m := range imageMembers[os] {
+		_, err := d.objects.Store.Size(ctx, imageObjectKey(os, id, m))
+		if err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// imageDownloadObjects writes files of an image in the object storage
+// as a tar archive.
+func (d *driver) imageDownloadObjects(ctx context.Context, w io.Writer, os, id string) error {
+	tw := tar.NewWriter(w)
+
+	for _, m := range imageMembers[os] {
+		err := func() error {
+			r, err := d.objects.Store.Open(ctx, imageObjectKey(os, id, m))
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+
+			size, err := r.Seek(0, io.SeekEnd)
+			if err != nil {
+				return err
+			}
+			_, err = r.Seek(0, io.SeekStart)
+			if err != nil {
+				return err
+			}
+
+			err = tw.WriteHeader(&tar.Header{
+				Name: m,
+				Size: size,
+				Mode: 0644,
+			})
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(tw, r)
+			return err
+		}()
+		if err != nil {
+			return err
+		}
+	}
+
+	return tw.Close()
+}
+
+// imageDeleteObjects removes files of images deleted from the index.
+func (d *driver) imageDeleteObjects(ctx context.Context, os string, ids []string) {
+	for _, id := range ids {
+		for _, m := range imageMembers[os] {
+			err := d.objects.Store.Delete(ctx, imageObjectKey(os, id, m))
+			if err != nil {
+				log.Error("image: failed to remove an object", map[string]interface{}{
+					log.FnError: err,
+					"os":        os,
+					"id":        id,
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package etcd
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cybozu-go/sabakan/v3"
+	"github.com/cybozu-go/sabakan/v3/objectstore"
+	"github.com/cybozu-go/sabakan/v3/objectstore/objectstoretest"
+	"github.com/google/go-cmp/cmp"
+)
+
+func testNewObjectStore(t *testing.T, d *driver) *objectstoretest.FakeS3 {
+	fake := objectstoretest.NewFakeS3("key")
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	store, err := objectstore.NewS3(objectstore.S3Config{
+		Endpoint:        server.URL,
+		Bucket:          "sabakan",
+		AccessKeyID:     "key",
+		SecretAccessKey: "secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.objects = ObjectConfig{Store: store}
+	// assets and images must not be stored in the data directory
+	d.dataDir = "/nonexistent"
+	return fake
+}
+
+func testObjectStoreAsset(t *testing.T) {
+	t.Parallel()
+
+	d, _ := testNewDriver(t)
+	fake := testNewObjectStore(t, d)
+	ctx := context.Background()
+
+	status, err := d.assetPut(ctx, "foo", "text/plain", nil, nil, strings.NewReader("bar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Status != http.StatusCreated {
+		t.Error("wrong status:", status.Status)
+	}
+	if !cmp.Equal(fake.Keys(), []string{"sabakan/assets/1"}) {
+		t.Error("wrong objects:", fake.Keys())
+	}
+
+	a, err := d.assetGetInfo(ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !a.Exists || a.Size != 3 {
+		t.Error("wrong asset:", a)
+	}
+
+	h := new(mockHandler)
+	err = d.assetGet(ctx, "foo", h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !h.calledServeContent || h.err != nil || string(h.content) != "bar" {
+		t.Error("asset is not proxied:", h.calledServeContent, h.err, string(h.content))
+	}
+
+	d.objects.Redirect = true
+	h = new(mockHandler)
+	err = d.assetGet(ctx, "foo", h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !h.calledRedirect || !strings.Contains(h.redirectURL, "/sabakan/assets/1?") {
+		t.Error("asset is not redirected:", h.redirectURL)
+	}
+
+	// checksum mismatch
+	_, err = d.assetPut(ctx, "foo", "text/plain", []byte("wrong"), nil, strings.NewReader("baz"))
+	if err == nil {
+		t.Error("checksum mismatch should be an error")
+	}
+	if !cmp.Equal(fake.Keys(), []string{"sabakan/assets/1"}) {
+		t.Error("object should be removed:", fake.Keys())
+	}
+
+	// replace
+	_, err = d.assetPut(ctx, "foo", "text/plain", nil, nil, strings.NewReader("baz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(fake.Keys(), []string{"sabakan/assets/1", "sabakan/assets/3"}) {
+		t.Error("old object should be kept in the history:", fake.Keys())
+	}
+
+	// the oldest version is removed from the history
+	for i := 0; i < sabakan.MaxAssetVersions-1; i++ {
+		_, err = d.assetPut(ctx, "foo", "text/plain", nil, nil, strings.NewReader("baz"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(fake.Keys()) != sabakan.MaxAssetVersions || fake.Keys()[0] != "sabakan/assets/3" {
+		t.Error("oldest object should be removed:", fake.Keys())
+	}
+
+	err = d.assetDelete(ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.Keys()) != 0 {
+		t.Error("object should be removed:", fake.Keys())
+	}
+}
+
+func testObjectStoreImage(t *testing.T) {
+	t.Parallel()
+
+	d, _ := testNewDriver(t)
+	fake := testNewObjectStore(t, d)
+	ctx := context.Background()
+
+	err := d.imageUpload(ctx, "coreos", "1.0", newTestImage("kernel", "initrd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"sabakan/images/coreos/1.0/initrd.gz", "sabakan/images/coreos/1.0/kernel"}
+	if !cmp.Equal(fake.Keys(), expected) {
+		t.Error("wrong objects:", fake.Keys())
+	}
+
+	index, err := d.imageGetIndex(ctx, "coreos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index) != 1 || !index[0].Exists || index[0].Size != 12 {
+		t.Error("wrong index:", index)
+	}
+
+	// bad archive
+	badImage := func() io.Reader {
+		buf := new(bytes.Buffer)
+		tw := tar.NewWriter(buf)
+		tw.WriteHeader(&tar.Header{Name: sabakan.ImageKernelFilename, Mode: 0644, Size: 1})
+		tw.Write([]byte("k"))
+		tw.Close()
+		return buf
+	}
+	err = d.imageUpload(ctx, "coreos", "2.0", badImage())
+	if err != sabakan.ErrBadRequest {
+		t.Error("incomplete image should be rejected:", err)
+	}
+	if !cmp.Equal(fake.Keys(), expected) {
+		t.Error("objects of the bad image should be removed:", fake.Keys())
+	}
+
+	// uploading the existing image never overwrites objects
+	err = d.imageUpload(ctx, "coreos", "1.0", newTestImage("kernel", "initrd"))
+	if err != nil {
+		t.Error("same content should be accepted:", err)
+	}
+	err = d.imageUpload(ctx, "coreos", "1.0", badImage())
+	if err != sabakan.ErrBadRequest {
+		t.Error("incomplete image should be rejected:", err)
+	}
+	err = d.imageUpload(ctx, "coreos", "1.0", newTestImage("kernel2", "initrd2"))
+	if err == nil {
+		t.Error("different content should be rejected")
+	}
+	if !cmp.Equal(fake.Keys(), expected) {
+		t.Error("wrong objects:", fake.Keys())
+	}
+
+	out := new(bytes.Buffer)
+	err = d.imageDownload(ctx, "coreos", "1.0", out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	tr := tar.NewReader(out)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[hdr.Name] = string(data)
+	}
+	expectedFiles := map[string]string{
+		sabakan.ImageKernelFilename: "kernel",
+		sabakan.ImageInitrdFilename: "initrd",
+	}
+	if !cmp.Equal(files, expectedFiles) {
+		t.Error("wrong archive:", files)
+	}
+
+	var served string
+	err = d.imageServeFile(ctx, "coreos", sabakan.ImageKernelFilename, func(modtime time.Time, content io.ReadSeeker) {
+		data, _ := io.ReadAll(content)
+		served = string(data)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if served != "kernel" {
+		t.Error("wrong file:", served)
+	}
+
+	err = d.imageDelete(ctx, "coreos", "1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.Keys()) != 0 {
+		t.Error("objects should be removed:", fake.Keys())
+	}
+}
+
+func TestObjectStore(t *testing.T) {
+	t.Run("Asset", testObjectStoreAsset)
+	t.Run("Image", testObjectStoreImage)
+}
@@ -98,7 +98,14 @@ func (d *driver) Upgrade(ctx context.Context) error {
 			return err
 		}
 
-		// fallthrough when case "3" is added
+		fallthrough
+	case "3":
+		err := d.convertTo4(ctx, mu)
+		if err != nil {
+			return err
+		}
+
+		// fallthrough when case "4" is added
 		//fallthrough
 	default:
 		return errors.New("unknown schema version: " + sv)
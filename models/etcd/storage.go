@@ -2,8 +2,10 @@ package etcd
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"path"
+	"strings"
 	"time"
 
 	"github.com/cybozu-go/sabakan/v3"
@@ -11,26 +13,53 @@ import (
 	"go.etcd.io/etcd/client/v3/clientv3util"
 )
 
+// cryptMeta is the value of KeyCryptsMeta keys.
+type cryptMeta struct {
+	CreatedAt time.Time `json:"created-at"`
+}
+
 // GetEncryptionKey implements sabakan.StorageModel
 func (d *driver) GetEncryptionKey(ctx context.Context, serial string, diskByPath string) ([]byte, error) {
 	target := path.Join(KeyCrypts, serial, diskByPath)
 	resp, err := d.client.Get(ctx, target)
 	if err != nil {
+		d.addBatchedLog(ctx, time.Now(), sabakan.AuditCrypts, serial, "get-failed",
+			diskByPath+": "+err.Error())
 		return nil, err
 	}
 
 	if resp.Count == 0 {
+		d.addBatchedLog(ctx, time.Now(), sabakan.AuditCrypts, serial, "get-failed",
+			diskByPath+": not found")
 		return nil, nil
 	}
 
-	return resp.Kvs[0].Value, nil
+	key, err := d.unwrapKey(ctx, target, resp.Kvs[0].Value)
+	if err != nil {
+		d.addBatchedLog(ctx, time.Now(), sabakan.AuditCrypts, serial, "get-failed",
+			diskByPath+": "+err.Error())
+		return nil, err
+	}
+
+	d.addBatchedLog(ctx, time.Now(), sabakan.AuditCrypts, serial, "get", diskByPath)
+	return key, nil
 }
 
 // PutEncryptionKey implements sabakan.StorageModel
 func (d *driver) PutEncryptionKey(ctx context.Context, serial string, diskByPath string, key []byte) error {
 	target := path.Join(KeyCrypts, serial, diskByPath)
+	metaKey := path.Join(KeyCryptsMeta, serial, diskByPath)
 	mkey := KeyMachines + serial
 
+	value, err := d.wrapKey(ctx, target, key)
+	if err != nil {
+		return err
+	}
+	meta, err := json.Marshal(cryptMeta{CreatedAt: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+
 RETRY:
 	m, rev, err := d.machineGetWithRev(ctx, serial)
 	if err != nil {
@@ -45,7 +74,10 @@ RETRY:
 		Then(
 			clientv3.OpTxn(
 				[]clientv3.Cmp{clientv3util.KeyMissing(target)},
-				[]clientv3.Op{clientv3.OpPut(target, string(key))},
+				[]clientv3.Op{
+					clientv3.OpPut(target, string(value)),
+					clientv3.OpPut(metaKey, string(meta)),
+				},
 				nil,
 			),
 		).
@@ -72,6 +104,7 @@ RETRY:
 func (d *driver) DeleteEncryptionKeys(ctx context.Context, serial string) ([]string, error) {
 	mkey := KeyMachines + serial
 	ckey := path.Join(KeyCrypts, serial) + "/"
+	metaKey := path.Join(KeyCryptsMeta, serial) + "/"
 
 RETRY:
 	m, rev, err := d.machineGetWithRev(ctx, serial)
@@ -84,7 +117,10 @@ RETRY:
 
 	resp, err := d.client.Txn(ctx).
 		If(clientv3.Compare(clientv3.ModRevision(mkey), "=", rev)).
-		Then(clientv3.OpDelete(ckey, clientv3.WithPrefix(), clientv3.WithPrevKV())).
+		Then(
+			clientv3.OpDelete(ckey, clientv3.WithPrefix(), clientv3.WithPrevKV()),
+			clientv3.OpDelete(metaKey, clientv3.WithPrefix()),
+		).
 		Commit()
 	if err != nil {
 		return nil, err
@@ -105,3 +141,53 @@ RETRY:
 	}
 	return ret, nil
 }
+
+// ListEncryptionKeys implements sabakan.StorageModel
+func (d *driver) ListEncryptionKeys(ctx context.Context, serial string) ([]*sabakan.EncryptionKeyInfo, error) {
+	var prefix string
+	if serial != "" {
+		prefix = serial + "/"
+	}
+
+	ops := []clientv3.Op{
+		clientv3.OpGet(KeyCrypts+prefix, clientv3.WithPrefix(), clientv3.WithKeysOnly()),
+		clientv3.OpGet(KeyCryptsMeta+prefix, clientv3.WithPrefix()),
+	}
+	if serial != "" {
+		ops = append(ops, clientv3.OpGet(KeyMachines+serial, clientv3.WithCountOnly()))
+	}
+	resp, err := d.client.Txn(ctx).Then(ops...).Commit()
+	if err != nil {
+		return nil, err
+	}
+	if serial != "" && resp.Responses[2].GetResponseRange().Count == 0 {
+		return nil, sabakan.ErrNotFound
+	}
+
+	created := make(map[string]time.Time)
+	for _, kv := range resp.Responses[1].GetResponseRange().Kvs {
+		var meta cryptMeta
+		err := json.Unmarshal(kv.Value, &meta)
+		if err != nil {
+			return nil, err
+		}
+		created[string(kv.Key[len(KeyCryptsMeta):])] = meta.CreatedAt
+	}
+
+	kvs := resp.Responses[0].GetResponseRange().Kvs
+	infos := make([]*sabakan.EncryptionKeyInfo, 0, len(kvs))
+	for _, kv := range kvs {
+		name := string(kv.Key[len(KeyCrypts):])
+		fields := strings.SplitN(name, "/", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		infos = append(infos, &sabakan.EncryptionKeyInfo{
+			Serial:    fields[0],
+			Path:      fields[1],
+			CreatedAt: created[name],
+			Revision:  kv.CreateRevision,
+		})
+	}
+	return infos, nil
+}
@@ -1,11 +1,14 @@
 package etcd
 
 import (
+	"bytes"
 	"context"
 	"sort"
 	"testing"
 
 	"github.com/cybozu-go/sabakan/v3"
+	"github.com/cybozu-go/sabakan/v3/kms"
+	clientv3 "go.etcd.io/etcd/client/v3"
 )
 
 func TestStorage(t *testing.T) {
@@ -42,6 +45,29 @@ func TestStorage(t *testing.T) {
 		t.Errorf("invalid data: %s", string(data))
 	}
 
+	infos, err := d.ListEncryptionKeys(context.Background(), "12345678")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 {
+		t.Fatal("wrong number of keys", len(infos))
+	}
+	if infos[0].Serial != "12345678" || infos[0].Path != "abcd-efgh" ||
+		infos[0].CreatedAt.IsZero() || infos[0].Revision == 0 {
+		t.Error("wrong key info", infos[0])
+	}
+	infos, err = d.ListEncryptionKeys(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 3 {
+		t.Error("wrong number of keys", len(infos))
+	}
+	_, err = d.ListEncryptionKeys(context.Background(), "not-exist")
+	if err != sabakan.ErrNotFound {
+		t.Error("unexpected error:", err)
+	}
+
 	_, err = d.DeleteEncryptionKeys(context.Background(), "12345678")
 	if err == nil {
 		t.Error("encryption keys should be deleted only for non-retiring machines")
@@ -64,6 +90,21 @@ func TestStorage(t *testing.T) {
 		t.Error("wrong deleted paths", paths)
 	}
 
+	infos, err = d.ListEncryptionKeys(context.Background(), "12345678")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 0 {
+		t.Error("keys are not deleted", infos)
+	}
+	resp, err := d.client.Get(context.Background(), KeyCryptsMeta+"12345678/", clientv3.WithPrefix(), clientv3.WithCountOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Count != 0 {
+		t.Error("meta data are not deleted")
+	}
+
 	m3, err := d.machineGet(context.Background(), "12345678")
 	if err != nil {
 		t.Fatal(err)
@@ -95,3 +136,93 @@ func TestStorage(t *testing.T) {
 		t.Errorf("not deleted: %s", string(data))
 	}
 }
+
+func TestStorageWrap(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	d, ch := testNewDriver(t)
+	_, err := initializeTestData(d, ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key1 := bytes.Repeat([]byte{1}, kms.MasterKeySize)
+	key2 := bytes.Repeat([]byte{2}, kms.MasterKeySize)
+	l1, err := kms.NewLocal("1", map[string][]byte{"1": key1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l2, err := kms.NewLocal("2", map[string][]byte{"1": key1, "2": key2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// raw key stored without KMS
+	err = d.PutEncryptionKey(ctx, "12345678", "raw", []byte("raw-data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d.kms = l1
+	data, err := d.GetEncryptionKey(ctx, "12345678", "raw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "raw-data" {
+		t.Error("wrong raw key:", string(data))
+	}
+
+	err = d.PutEncryptionKey(ctx, "12345678", "wrapped", []byte("wrapped-data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := d.client.Get(ctx, KeyCrypts+"12345678/wrapped")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := resp.Kvs[0].Value
+	if !bytes.HasPrefix(stored, wrappedKeyPrefix) || bytes.Contains(stored, []byte("wrapped-data")) {
+		t.Error("key is not wrapped:", string(stored))
+	}
+
+	count, err := d.rewrapKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Error("wrong number of re-wrapped keys:", count)
+	}
+
+	// rotate master key
+	d.kms = l2
+	count, err = d.rewrapKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Error("wrong number of re-wrapped keys:", count)
+	}
+	for _, p := range []string{"raw", "wrapped"} {
+		data, err := d.GetEncryptionKey(ctx, "12345678", p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != p+"-data" {
+			t.Error("wrong key:", string(data))
+		}
+	}
+
+	// old master key cannot unwrap keys any longer
+	d.kms = l1
+	_, err = d.GetEncryptionKey(ctx, "12345678", "raw")
+	if err != sabakan.ErrUnknownMasterKey {
+		t.Error("unexpected error:", err)
+	}
+
+	d.kms = nil
+	_, err = d.GetEncryptionKey(ctx, "12345678", "raw")
+	if err == nil {
+		t.Error("wrapped key should not be read without KMS")
+	}
+}
@@ -0,0 +1,143 @@
+package etcd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/cybozu-go/log"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// wrappedKeyPrefix is the prefix of encryption keys wrapped with a master key.
+// Values without this prefix are raw keys stored by older sabakan or
+// by sabakan without KMS.
+var wrappedKeyPrefix = []byte("\x80sabakan-wrapped\x00")
+
+type wrappedKey struct {
+	KeyID string `json:"key-id"`
+	Data  []byte `json:"data"`
+}
+
+func parseWrappedKey(value []byte) (*wrappedKey, error) {
+	if !bytes.HasPrefix(value, wrappedKeyPrefix) {
+		return nil, nil
+	}
+	w := new(wrappedKey)
+	err := json.Unmarshal(value[len(wrappedKeyPrefix):], w)
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// wrapKey wraps key stored at target with the current master key.
+// If KMS is not configured, this returns key as is.
+func (d *driver) wrapKey(ctx context.Context, target string, key []byte) ([]byte, error) {
+	if d.kms == nil {
+		return key, nil
+	}
+
+	id, data, err := d.kms.Wrap(ctx, key, []byte(target))
+	if err != nil {
+		return nil, err
+	}
+	j, err := json.Marshal(wrappedKey{KeyID: id, Data: data})
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte(nil), wrappedKeyPrefix...), j...), nil
+}
+
+// unwrapKey returns the key stored at target.
+func (d *driver) unwrapKey(ctx context.Context, target string, value []byte) ([]byte, error) {
+	w, err := parseWrappedKey(value)
+	if err != nil {
+		return nil, err
+	}
+	if w == nil {
+		return value, nil
+	}
+	if d.kms == nil {
+		return nil, errors.New("key is wrapped but no master key is configured")
+	}
+	return d.kms.Unwrap(ctx, w.KeyID, w.Data, []byte(target))
+}
+
+// rewrapKeys wraps keys that are raw or wrapped with old master keys
+// with the current master key.  Keys modified concurrently are skipped
+// as they have been wrapped by the modifier.
+//
+// cmps are added to the conditions of transactions.
+// This returns the number of re-wrapped keys.
+func (d *driver) rewrapKeys(ctx context.Context, cmps ...clientv3.Cmp) (int, error) {
+	if d.kms == nil {
+		return 0, nil
+	}
+
+	resp, err := d.client.Get(ctx, KeyCrypts, clientv3.WithPrefix())
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, kv := range resp.Kvs {
+		target := string(kv.Key)
+		w, err := parseWrappedKey(kv.Value)
+		if err != nil {
+			return count, errors.New("invalid wrapped key: " + target)
+		}
+		if w != nil && w.KeyID == d.kms.KeyID() {
+			continue
+		}
+
+		key, err := d.unwrapKey(ctx, target, kv.Value)
+		if err != nil {
+			return count, err
+		}
+		value, err := d.wrapKey(ctx, target, key)
+		if err != nil {
+			return count, err
+		}
+
+		conds := append([]clientv3.Cmp{
+			clientv3.Compare(clientv3.ModRevision(target), "=", kv.ModRevision),
+		}, cmps...)
+		tresp, err := d.client.Txn(ctx).
+			If(conds...).
+			Then(clientv3.OpPut(target, string(value))).
+			Commit()
+		if err != nil {
+			return count, err
+		}
+		if tresp.Succeeded {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// keyRewrapper re-wraps keys with the current master key in background.
+func (d *driver) keyRewrapper(ctx context.Context) error {
+	if d.kms == nil {
+		return nil
+	}
+
+	count, err := d.rewrapKeys(ctx)
+	if err != nil {
+		log.Error("etcd: failed to re-wrap encryption keys", map[string]interface{}{
+			log.FnError: err,
+			"count":     count,
+		})
+		return nil
+	}
+	if count > 0 {
+		log.Info("etcd: re-wrapped encryption keys", map[string]interface{}{
+			"key_id": d.kms.KeyID(),
+			"count":  count,
+		})
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/cybozu-go/sabakan/v3"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func (d *driver) switchPut(ctx context.Context, sw *sabakan.Switch) error {
+	data, err := json.Marshal(sw)
+	if err != nil {
+		return err
+	}
+
+	resp, err := d.client.Put(ctx, KeySwitches+sw.MAC, string(data))
+	if err != nil {
+		return err
+	}
+
+	d.addLog(ctx, time.Now(), resp.Header.Revision, sabakan.AuditSwitches, sw.MAC, "put", string(data))
+	return nil
+}
+
+func (d *driver) switchGet(ctx context.Context, mac string) (*sabakan.Switch, error) {
+	resp, err := d.client.Get(ctx, KeySwitches+mac)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Count == 0 {
+		return nil, sabakan.ErrNotFound
+	}
+
+	sw := new(sabakan.Switch)
+	err = json.Unmarshal(resp.Kvs[0].Value, sw)
+	if err != nil {
+		return nil, err
+	}
+	return sw, nil
+}
+
+func (d *driver) switchGetAll(ctx context.Context) ([]*sabakan.Switch, error) {
+	resp, err := d.client.Get(ctx, KeySwitches, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	switches := make([]*sabakan.Switch, len(resp.Kvs))
+	for i, kv := range resp.Kvs {
+		sw := new(sabakan.Switch)
+		err = json.Unmarshal(kv.Value, sw)
+		if err != nil {
+			return nil, err
+		}
+		switches[i] = sw
+	}
+	return switches, nil
+}
+
+func (d *driver) switchDelete(ctx context.Context, mac string) error {
+	resp, err := d.client.Delete(ctx, KeySwitches+mac)
+	if err != nil {
+		return err
+	}
+	if resp.Deleted == 0 {
+		return sabakan.ErrNotFound
+	}
+
+	d.addLog(ctx, time.Now(), resp.Header.Revision, sabakan.AuditSwitches, mac, "delete", "")
+	return nil
+}
+
+type switchDriver struct {
+	*driver
+}
+
+func (d switchDriver) Put(ctx context.Context, sw *sabakan.Switch) error {
+	return d.switchPut(ctx, sw)
+}
+
+func (d switchDriver) Get(ctx context.Context, mac string) (*sabakan.Switch, error) {
+	return d.switchGet(ctx, mac)
+}
+
+func (d switchDriver) GetAll(ctx context.Context) ([]*sabakan.Switch, error) {
+	return d.switchGetAll(ctx)
+}
+
+func (d switchDriver) Delete(ctx context.Context, mac string) error {
+	return d.switchDelete(ctx, mac)
+}
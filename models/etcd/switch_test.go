@@ -0,0 +1,55 @@
+package etcd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cybozu-go/sabakan/v3"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSwitch(t *testing.T) {
+	t.Parallel()
+
+	d, _ := testNewDriver(t)
+	ctx := context.Background()
+
+	_, err := d.switchGet(ctx, "00:11:22:33:44:55")
+	if err != sabakan.ErrNotFound {
+		t.Fatal("unexpected error: ", err)
+	}
+
+	sw1 := &sabakan.Switch{MAC: "00:11:22:33:44:55", Name: "leaf1", Installer: "onie-installer.bin"}
+	sw2 := &sabakan.Switch{MAC: "00:11:22:33:44:66", Name: "leaf2", Script: "ztp.sh"}
+	for _, sw := range []*sabakan.Switch{sw1, sw2} {
+		err = d.switchPut(ctx, sw)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sw, err := d.switchGet(ctx, sw1.MAC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(sw, sw1) {
+		t.Error("wrong switch stored:", cmp.Diff(sw, sw1))
+	}
+
+	switches, err := d.switchGetAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(switches, []*sabakan.Switch{sw1, sw2}) {
+		t.Error("wrong switches:", cmp.Diff(switches, []*sabakan.Switch{sw1, sw2}))
+	}
+
+	err = d.switchDelete(ctx, sw1.MAC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.switchDelete(ctx, sw1.MAC)
+	if err != sabakan.ErrNotFound {
+		t.Fatal("unexpected error: ", err)
+	}
+}
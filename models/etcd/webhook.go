@@ -0,0 +1,138 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/cybozu-go/sabakan/v3"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/clientv3util"
+)
+
+// webhookCursor is the position of the last delivered audit log entry.
+//
+// Revision is the mod revision of the entry.  As entries are written
+// with timestamps taken a little before, entries written after the cursor
+// are searched from one day before Timestamp.
+type webhookCursor struct {
+	Revision  int64     `json:"revision"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// webhookInitCursor sets the cursor of a webhook to rev if it does not exist.
+// Audit logs written after rev will be delivered.
+func (d *driver) webhookInitCursor(ctx context.Context, name string, rev int64, ts time.Time) error {
+	data, err := json.Marshal(webhookCursor{Revision: rev, Timestamp: ts.UTC()})
+	if err != nil {
+		return err
+	}
+
+	key := KeyWebhookCursors + name
+	_, err = d.client.Txn(ctx).
+		If(clientv3util.KeyMissing(key)).
+		Then(clientv3.OpPut(key, string(data))).
+		Commit()
+	return err
+}
+
+func (d *driver) webhookPut(ctx context.Context, hook *sabakan.Webhook) error {
+	data, err := json.Marshal(hook)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	resp, err := d.client.Put(ctx, KeyWebhooks+hook.Name, string(data))
+	if err != nil {
+		return err
+	}
+
+	err = d.webhookInitCursor(ctx, hook.Name, resp.Header.Revision, now)
+	if err != nil {
+		return err
+	}
+
+	// do not record the secret
+	copied := *hook
+	copied.Secret = ""
+	data, err = json.Marshal(&copied)
+	if err != nil {
+		return err
+	}
+	d.addLog(ctx, now, resp.Header.Revision, sabakan.AuditWebhooks, hook.Name, "put", string(data))
+	return nil
+}
+
+func (d *driver) webhookGet(ctx context.Context, name string) (*sabakan.Webhook, error) {
+	resp, err := d.client.Get(ctx, KeyWebhooks+name)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Count == 0 {
+		return nil, sabakan.ErrNotFound
+	}
+
+	hook := new(sabakan.Webhook)
+	err = json.Unmarshal(resp.Kvs[0].Value, hook)
+	if err != nil {
+		return nil, err
+	}
+	return hook, nil
+}
+
+func (d *driver) webhookGetAll(ctx context.Context) ([]*sabakan.Webhook, error) {
+	resp, err := d.client.Get(ctx, KeyWebhooks, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	hooks := make([]*sabakan.Webhook, len(resp.Kvs))
+	for i, kv := range resp.Kvs {
+		hook := new(sabakan.Webhook)
+		err = json.Unmarshal(kv.Value, hook)
+		if err != nil {
+			return nil, err
+		}
+		hooks[i] = hook
+	}
+	return hooks, nil
+}
+
+func (d *driver) webhookDelete(ctx context.Context, name string) error {
+	resp, err := d.client.Txn(ctx).
+		Then(
+			clientv3.OpDelete(KeyWebhooks+name),
+			clientv3.OpDelete(KeyWebhookCursors+name),
+		).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if resp.Responses[0].GetResponseDeleteRange().Deleted == 0 {
+		return sabakan.ErrNotFound
+	}
+
+	d.addLog(ctx, time.Now(), resp.Header.Revision, sabakan.AuditWebhooks, name, "delete", "")
+	return nil
+}
+
+type webhookDriver struct {
+	*driver
+}
+
+func (d webhookDriver) Put(ctx context.Context, hook *sabakan.Webhook) error {
+	return d.webhookPut(ctx, hook)
+}
+
+func (d webhookDriver) Get(ctx context.Context, name string) (*sabakan.Webhook, error) {
+	return d.webhookGet(ctx, name)
+}
+
+func (d webhookDriver) GetAll(ctx context.Context) ([]*sabakan.Webhook, error) {
+	return d.webhookGetAll(ctx)
+}
+
+func (d webhookDriver) Delete(ctx context.Context, name string) error {
+	return d.webhookDelete(ctx, name)
+}
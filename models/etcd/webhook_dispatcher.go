@@ -0,0 +1,335 @@
+package etcd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cybozu-go/log"
+	"github.com/cybozu-go/sabakan/v3"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+// cloudEvent is a CloudEvents v1.0 envelope in the structured content mode.
+type cloudEvent struct {
+	SpecVersion     string            `json:"specversion"`
+	ID              string            `json:"id"`
+	Source          string            `json:"source"`
+	Type            string            `json:"type"`
+	Subject         string            `json:"subject,omitempty"`
+	Time            time.Time         `json:"time"`
+	DataContentType string            `json:"datacontenttype"`
+	Data            *sabakan.AuditLog `json:"data"`
+}
+
+type webhookBackoff struct {
+	failures int
+	next     time.Time
+}
+
+// webhookSender sends audit log entries to webhooks.
+//
+// Failed webhooks are retried with exponential backoff.
+type webhookSender struct {
+	client  *http.Client
+	backoff map[string]*webhookBackoff
+}
+
+func newWebhookSender(client *http.Client) *webhookSender {
+	return &webhookSender{
+		client:  client,
+		backoff: make(map[string]*webhookBackoff),
+	}
+}
+
+// ready returns true if the webhook is not backing off.
+func (s *webhookSender) ready(name string, now time.Time) bool {
+	b, ok := s.backoff[name]
+	return !ok || !now.Before(b.next)
+}
+
+// record records the result of delivery to the webhook.
+func (s *webhookSender) record(name string, now time.Time, err error) {
+	if err == nil {
+		delete(s.backoff, name)
+		return
+	}
+
+	b, ok := s.backoff[name]
+	if !ok {
+		b = new(webhookBackoff)
+		s.backoff[name] = b
+	}
+	b.failures++
+
+	wait := webhookMaxBackoff
+	if b.failures < 32 && webhookMinBackoff<<(b.failures-1) < webhookMaxBackoff {
+		wait = webhookMinBackoff << (b.failures - 1)
+	}
+	b.next = now.Add(wait)
+}
+
+// forget removes the backoff states of webhooks not in names.
+func (s *webhookSender) forget(names map[string]bool) {
+	for name := range s.backoff {
+		if !names[name] {
+			delete(s.backoff, name)
+		}
+	}
+}
+
+// post sends an audit log entry to the webhook.
+// id is the unique ID of the entry.
+func (s *webhookSender) post(ctx context.Context, hook *sabakan.Webhook, id string, a *sabakan.AuditLog) error {
+	var body []byte
+	var err error
+	contentType := "application/json"
+	if hook.CloudEvents {
+		body, err = json.Marshal(cloudEvent{
+			SpecVersion:     "1.0",
+			ID:              id,
+			Source:          "sabakan",
+			Type:            "sabakan.audit." + string(a.Category),
+			Subject:         a.Instance,
+			Time:            a.Timestamp,
+			DataContentType: "application/json",
+			Data:            a,
+		})
+		contentType = "application/cloudevents+json"
+	} else {
+		body, err = json.Marshal(a)
+	}
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set(sabakan.WebhookDeliveryHeader, id)
+	if hook.Secret != "" {
+		req.Header.Set(sabakan.WebhookSignatureHeader, sabakan.SignWebhookPayload(hook.Secret, body))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// deliverWebhook delivers audit logs written after the cursor to the webhook.
+//
+// The cursor is advanced after all entries of the same revision are
+// delivered.  Therefore entries may be delivered more than once if
+// delivery fails in the middle of a revision.
+func (d *driver) deliverWebhook(ctx context.Context, s *webhookSender, hook *sabakan.Webhook, mu *concurrency.Mutex) error {
+	key := KeyWebhookCursors + hook.Name
+	resp, err := d.client.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if resp.Count == 0 {
+		// webhookPut was interrupted
+		return d.webhookInitCursor(ctx, hook.Name, resp.Header.Revision, time.Now())
+	}
+
+	cur := new(webhookCursor)
+	err = json.Unmarshal(resp.Kvs[0].Value, cur)
+	if err != nil {
+		return err
+	}
+	cursorRev := resp.Kvs[0].ModRevision
+	headRev := resp.Header.Revision
+
+	saveCursor := func() error {
+		data, err := json.Marshal(cur)
+		if err != nil {
+			return err
+		}
+		tresp, err := d.client.Txn(ctx).
+			If(mu.IsOwner(), clientv3.Compare(clientv3.ModRevision(key), "=", cursorRev)).
+			Then(clientv3.OpPut(key, string(data))).
+			Commit()
+		if err != nil {
+			return err
+		}
+		if !tresp.Succeeded {
+			return errors.New("webhook cursor has been updated concurrently")
+		}
+		cursorRev = tresp.Header.Revision
+		return nil
+	}
+
+	for cur.Revision < headRev {
+		maxRev := cur.Revision + webhookRevisionWindow
+		if maxRev > headRev {
+			maxRev = headRev
+		}
+
+		aresp, err := d.client.Get(ctx, auditKey(cur.Timestamp.Add(-24*time.Hour)),
+			clientv3.WithRange(clientv3.GetPrefixRangeEnd(KeyAudit)),
+			clientv3.WithMinModRev(cur.Revision+1),
+			clientv3.WithMaxModRev(maxRev),
+		)
+		if err != nil {
+			return err
+		}
+		kvs := aresp.Kvs
+		sort.Slice(kvs, func(i, j int) bool {
+			if kvs[i].ModRevision != kvs[j].ModRevision {
+				return kvs[i].ModRevision < kvs[j].ModRevision
+			}
+			return string(kvs[i].Key) < string(kvs[j].Key)
+		})
+
+		var delivered bool
+		for i, kv := range kvs {
+			a := new(sabakan.AuditLog)
+			err = json.Unmarshal(kv.Value, a)
+			if err != nil {
+				return err
+			}
+
+			if hook.Match(a) {
+				id := strings.TrimPrefix(string(kv.Key), KeyAudit)
+				err = s.post(ctx, hook, id, a)
+				if err != nil {
+					return err
+				}
+				delivered = true
+			}
+			if a.Timestamp.After(cur.Timestamp) {
+				cur.Timestamp = a.Timestamp
+			}
+
+			if i < len(kvs)-1 && kvs[i+1].ModRevision == kv.ModRevision {
+				continue
+			}
+			cur.Revision = kv.ModRevision
+			if delivered {
+				err = saveCursor()
+				if err != nil {
+					return err
+				}
+				delivered = false
+			}
+		}
+
+		cur.Revision = maxRev
+		err = saveCursor()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deliverWebhooks delivers audit logs to all webhooks that are not backing off.
+func (d *driver) deliverWebhooks(ctx context.Context, s *webhookSender, mu *concurrency.Mutex) error {
+	hooks, err := d.webhookGetAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	names := make(map[string]bool)
+	for _, hook := range hooks {
+		names[hook.Name] = true
+		if !s.ready(hook.Name, time.Now()) {
+			continue
+		}
+
+		err := d.deliverWebhook(ctx, s, hook, mu)
+		if ctx.Err() != nil {
+			return nil
+		}
+		s.record(hook.Name, time.Now(), err)
+		if err != nil {
+			log.Warn("etcd: failed to deliver audit logs to webhook", map[string]interface{}{
+				log.FnError: err,
+				"webhook":   hook.Name,
+				"failures":  s.backoff[hook.Name].failures,
+			})
+		}
+	}
+	s.forget(names)
+	return nil
+}
+
+// dispatchWebhooks delivers audit logs while holding the webhook lock.
+func (d *driver) dispatchWebhooks(ctx context.Context, s *webhookSender) error {
+	sess, err := concurrency.NewSession(d.client)
+	if err != nil {
+		return err
+	}
+	defer sess.Close()
+
+	mu := concurrency.NewMutex(sess, KeyWebhookLock)
+	if err := mu.Lock(ctx); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		mu.Unlock(ctx)
+		cancel()
+	}()
+
+	ticker := time.NewTicker(webhookInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-sess.Done():
+			return errors.New("etcd session expired")
+		case <-ticker.C:
+			err := d.deliverWebhooks(ctx, s, mu)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// webhookDispatcher is a goroutine to deliver audit logs to webhooks.
+//
+// Only one sabakan server in the cluster delivers logs at a time.
+// Other servers wait for the lock to take over the delivery.
+func (d *driver) webhookDispatcher(ctx context.Context) error {
+	s := newWebhookSender(&http.Client{Timeout: webhookTimeout})
+
+	for {
+		err := d.dispatchWebhooks(ctx, s)
+		if err != nil {
+			log.Error("etcd: webhook dispatcher failed", map[string]interface{}{
+				log.FnError: err,
+			})
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(webhookInterval):
+		}
+	}
+}
@@ -0,0 +1,346 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cybozu-go/sabakan/v3"
+	"github.com/google/go-cmp/cmp"
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+type webhookReceiver struct {
+	mu       sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.status != http.StatusOK {
+		w.WriteHeader(r.status)
+		return
+	}
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+}
+
+func (r *webhookReceiver) setStatus(status int) {
+	r.mu.Lock()
+	r.status = status
+	r.mu.Unlock()
+}
+
+func (r *webhookReceiver) received() ([]*http.Request, [][]byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.requests, r.bodies
+}
+
+func testWebhookCRUD(t *testing.T) {
+	t.Parallel()
+
+	d, _ := testNewDriver(t)
+	ctx := context.Background()
+
+	hook := &sabakan.Webhook{
+		Name:       "hook1",
+		URL:        "http://example.com/",
+		Categories: []sabakan.AuditCategory{sabakan.AuditMachines},
+		Secret:     "secret",
+	}
+	err := d.webhookPut(ctx, hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := d.client.Get(ctx, KeyWebhookCursors+"hook1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Count != 1 {
+		t.Fatal("cursor should be initialized")
+	}
+
+	got, err := d.webhookGet(ctx, "hook1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(got, hook) {
+		t.Error("wrong webhook:", cmp.Diff(got, hook))
+	}
+
+	hook2 := &sabakan.Webhook{Name: "hook2", URL: "https://example.com/", CloudEvents: true}
+	err = d.webhookPut(ctx, hook2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hooks, err := d.webhookGetAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(hooks, []*sabakan.Webhook{hook, hook2}) {
+		t.Error("wrong webhooks:", hooks)
+	}
+
+	err = d.webhookDelete(ctx, "hook1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = d.webhookGet(ctx, "hook1")
+	if err != sabakan.ErrNotFound {
+		t.Error("webhook should be deleted:", err)
+	}
+	resp, err = d.client.Get(ctx, KeyWebhookCursors+"hook1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Count != 0 {
+		t.Error("cursor should be deleted")
+	}
+	err = d.webhookDelete(ctx, "hook1")
+	if err != sabakan.ErrNotFound {
+		t.Error("unexpected error:", err)
+	}
+}
+
+func testWebhookDeliver(t *testing.T) {
+	t.Parallel()
+
+	d, _ := testNewDriver(t)
+	ctx := context.Background()
+
+	recv := &webhookReceiver{status: http.StatusOK}
+	server := httptest.NewServer(recv)
+	defer server.Close()
+
+	err := d.recordLog(ctx, sabakan.AuditMachines, "before", "put", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hook := &sabakan.Webhook{
+		Name:       "hook1",
+		URL:        server.URL,
+		Categories: []sabakan.AuditCategory{sabakan.AuditMachines},
+		Secret:     "secret",
+	}
+	err = d.webhookPut(ctx, hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, instance := range []string{"m1", "m2"} {
+		err = d.recordLog(ctx, sabakan.AuditMachines, instance, "put", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = d.recordLog(ctx, sabakan.AuditAssets, "asset1", "put", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sess, err := concurrency.NewSession(d.client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sess.Close()
+	mu := concurrency.NewMutex(sess, KeyWebhookLock)
+	err = mu.Lock(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newWebhookSender(&http.Client{Timeout: 10 * time.Second})
+	err = d.deliverWebhook(ctx, s, hook, mu)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reqs, bodies := recv.received()
+	if len(reqs) != 2 {
+		t.Fatal("wrong number of deliveries:", len(reqs))
+	}
+	for i, instance := range []string{"m1", "m2"} {
+		a := new(sabakan.AuditLog)
+		err = json.Unmarshal(bodies[i], a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.Instance != instance {
+			t.Error("wrong entry:", a)
+		}
+		sig := reqs[i].Header.Get(sabakan.WebhookSignatureHeader)
+		if sig != sabakan.SignWebhookPayload("secret", bodies[i]) {
+			t.Error("wrong signature:", sig)
+		}
+		if reqs[i].Header.Get(sabakan.WebhookDeliveryHeader) == "" {
+			t.Error("no delivery ID")
+		}
+	}
+
+	// nothing new
+	err = d.deliverWebhook(ctx, s, hook, mu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reqs, _ = recv.received()
+	if len(reqs) != 2 {
+		t.Error("entries should not be delivered twice:", len(reqs))
+	}
+
+	// failed entries are retried
+	recv.setStatus(http.StatusServiceUnavailable)
+	err = d.recordLog(ctx, sabakan.AuditMachines, "m3", "put", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.deliverWebhook(ctx, s, hook, mu)
+	if err == nil {
+		t.Error("delivery should fail")
+	}
+
+	recv.setStatus(http.StatusOK)
+	err = d.deliverWebhook(ctx, s, hook, mu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reqs, bodies = recv.received()
+	if len(reqs) != 3 {
+		t.Fatal("failed entry should be redelivered:", len(reqs))
+	}
+	a := new(sabakan.AuditLog)
+	err = json.Unmarshal(bodies[2], a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Instance != "m3" {
+		t.Error("wrong entry:", a)
+	}
+
+	// the cursor is not updated without the lock
+	err = mu.Unlock(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.recordLog(ctx, sabakan.AuditMachines, "m4", "put", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.deliverWebhook(ctx, s, hook, mu)
+	if err == nil {
+		t.Error("cursor should not be updated without the lock")
+	}
+}
+
+func testWebhookCloudEvents(t *testing.T) {
+	t.Parallel()
+
+	recv := &webhookReceiver{status: http.StatusOK}
+	server := httptest.NewServer(recv)
+	defer server.Close()
+
+	hook := &sabakan.Webhook{Name: "hook1", URL: server.URL, CloudEvents: true}
+	a := &sabakan.AuditLog{
+		Timestamp: time.Date(2026, 10, 19, 1, 2, 3, 0, time.UTC),
+		Category:  sabakan.AuditMachines,
+		Instance:  "1234abcd",
+		Action:    "state",
+		Detail:    "healthy",
+	}
+	s := newWebhookSender(&http.Client{Timeout: 10 * time.Second})
+	err := s.post(context.Background(), hook, "20261019/0000000000000010", a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reqs, bodies := recv.received()
+	if len(reqs) != 1 {
+		t.Fatal("wrong number of deliveries:", len(reqs))
+	}
+	if ct := reqs[0].Header.Get("Content-Type"); ct != "application/cloudevents+json" {
+		t.Error("wrong content type:", ct)
+	}
+	if sig := reqs[0].Header.Get(sabakan.WebhookSignatureHeader); sig != "" {
+		t.Error("request should not be signed:", sig)
+	}
+
+	ev := new(cloudEvent)
+	err = json.Unmarshal(bodies[0], ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &cloudEvent{
+		SpecVersion:     "1.0",
+		ID:              "20261019/0000000000000010",
+		Source:          "sabakan",
+		Type:            "sabakan.audit.machines",
+		Subject:         "1234abcd",
+		Time:            a.Timestamp,
+		DataContentType: "application/json",
+		Data:            a,
+	}
+	if !cmp.Equal(ev, expected) {
+		t.Error("wrong event:", cmp.Diff(ev, expected))
+	}
+}
+
+func testWebhookBackoff(t *testing.T) {
+	t.Parallel()
+
+	s := newWebhookSender(http.DefaultClient)
+	now := time.Now()
+
+	if !s.ready("hook1", now) {
+		t.Error("new webhook should be ready")
+	}
+
+	s.record("hook1", now, io.EOF)
+	if s.ready("hook1", now) {
+		t.Error("failed webhook should back off")
+	}
+	if !s.ready("hook1", now.Add(webhookMinBackoff)) {
+		t.Error("webhook should be ready after backoff")
+	}
+
+	s.record("hook1", now, io.EOF)
+	if s.ready("hook1", now.Add(webhookMinBackoff)) {
+		t.Error("backoff should increase")
+	}
+
+	for i := 0; i < 100; i++ {
+		s.record("hook1", now, io.EOF)
+	}
+	if !s.ready("hook1", now.Add(webhookMaxBackoff)) {
+		t.Error("backoff should be limited")
+	}
+
+	s.record("hook1", now, nil)
+	if !s.ready("hook1", now) {
+		t.Error("succeeded webhook should be ready")
+	}
+
+	s.record("hook2", now, io.EOF)
+	s.forget(map[string]bool{"hook1": true})
+	if !s.ready("hook2", now) {
+		t.Error("deleted webhook should be forgotten")
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	t.Run("CRUD", testWebhookCRUD)
+	t.Run("Deliver", testWebhookDeliver)
+	t.Run("CloudEvents", testWebhookCloudEvents)
+	t.Run("Backoff", testWebhookBackoff)
+}
@@ -17,15 +17,17 @@ import (
 
 type assetDriver struct {
 	mu     sync.Mutex
+	driver *driver
 	assets map[string]*sabakan.Asset
-	data   map[string][]byte
+	data   map[int][]byte
 	lastID int
 }
 
-func newAssetDriver() *assetDriver {
+func newAssetDriver(d *driver) *assetDriver {
 	return &assetDriver{
+		driver: d,
 		assets: make(map[string]*sabakan.Asset),
-		data:   make(map[string][]byte),
+		data:   make(map[int][]byte),
 	}
 }
 
@@ -87,7 +89,43 @@ func (d *assetDriver) Get(ctx context.Context, name string, h sabakan.AssetHandl
 		return sabakan.ErrNotFound
 	}
 
-	h.ServeContent(asset, bytes.NewReader(d.data[name]))
+	h.ServeContent(asset, bytes.NewReader(d.data[asset.ID]))
+
+	return nil
+}
+
+func (d *assetDriver) GetVersion(ctx context.Context, name string, id int, h sabakan.AssetHandler) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	asset, ok := d.assets[name]
+	if !ok {
+		return sabakan.ErrNotFound
+	}
+	v := asset.Version(id)
+	if v == nil {
+		return sabakan.ErrNotFound
+	}
+
+	h.ServeContent(v, bytes.NewReader(d.data[id]))
+
+	return nil
+}
+
+func (d *assetDriver) Rollback(ctx context.Context, name string, id int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	asset, ok := d.assets[name]
+	if !ok {
+		return sabakan.ErrNotFound
+	}
+	err := asset.Rollback(id, time.Now())
+	if err != nil {
+		return err
+	}
+
+	d.driver.recordLog(ctx, sabakan.AuditAssets, name, "rollback", "new checksum: "+asset.Sha256)
 
 	return nil
 }
@@ -96,13 +134,16 @@ func (d *assetDriver) Delete(ctx context.Context, name string) error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
-	_, ok := d.assets[name]
+	asset, ok := d.assets[name]
 	if !ok {
 		return sabakan.ErrNotFound
 	}
 
+	for _, id := range asset.IDs() {
+		delete(d.data, id)
+	}
 	delete(d.assets, name)
-	delete(d.data, name)
+	d.driver.recordLog(ctx, sabakan.AuditAssets, name, "delete", "")
 
 	return nil
 }
@@ -132,13 +173,15 @@ func (d *assetDriver) newAsset(ctx context.Context, name, contentType string,
 		Date:        time.Now().UTC(),
 		Size:        int64(len(data)),
 		Sha256:      hex.EncodeToString(hsum),
+		Uploader:    sabakan.AuditUser(ctx),
 		Options:     options,
 		URLs:        nil,
 		Exists:      true,
 	}
 
 	d.assets[name] = asset
-	d.data[name] = data
+	d.data[id] = data
+	d.driver.recordLog(ctx, sabakan.AuditAssets, name, "put", "new checksum: "+asset.Sha256)
 
 	status := &sabakan.AssetStatus{
 		Status: http.StatusCreated,
@@ -166,13 +209,20 @@ func (d *assetDriver) updateAsset(ctx context.Context, asset *sabakan.Asset,
 		return nil, errors.New("checksum mismatch")
 	}
 
+	prev := *asset
 	asset.ID = id
 	asset.ContentType = contentType
 	asset.Date = time.Now().UTC()
 	asset.Sha256 = hex.EncodeToString(hsum)
+	asset.Uploader = sabakan.AuditUser(ctx)
 	asset.Options = options
+	asset.Size = int64(len(data))
+	for _, del := range asset.AppendHistory(&prev) {
+		delete(d.data, del)
+	}
 
-	d.data[asset.Name] = data
+	d.data[id] = data
+	d.driver.recordLog(ctx, sabakan.AuditAssets, asset.Name, "put", "new checksum: "+asset.Sha256)
 
 	status := &sabakan.AssetStatus{
 		Status: http.StatusOK,
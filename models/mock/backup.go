@@ -0,0 +1,216 @@
+package mock
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+type backupDriver struct {
+	driver       *driver
+	dhcp         *dhcpDriver
+	image        *imageDriver
+	asset        *assetDriver
+	ignition     *ignitionDriver
+	kernelParams *kernelParamsDriver
+	switches     *switchDriver
+}
+
+// lock locks all sub-drivers.  Sub-drivers record logs while holding
+// their locks, so the lock of the driver is taken last.
+func (d *backupDriver) lock() {
+	d.dhcp.mu.Lock()
+	d.image.mu.Lock()
+	d.asset.mu.Lock()
+	d.ignition.mu.Lock()
+	d.kernelParams.mu.Lock()
+	d.switches.mu.Lock()
+	d.driver.mu.Lock()
+}
+
+func (d *backupDriver) unlock() {
+	d.driver.mu.Unlock()
+	d.switches.mu.Unlock()
+	d.kernelParams.mu.Unlock()
+	d.ignition.mu.Unlock()
+	d.asset.mu.Unlock()
+	d.image.mu.Unlock()
+	d.dhcp.mu.Unlock()
+}
+
+func (d *backupDriver) Dump(ctx context.Context) (*sabakan.BackupState, error) {
+	d.lock()
+	defer d.unlock()
+
+	state := &sabakan.BackupState{
+		KernelParams: make(map[string]string),
+		Ignitions:    make(map[string]map[string]*sabakan.IgnitionTemplate),
+		Images:       make(map[string]sabakan.ImageIndex),
+	}
+	if d.driver.ipam != nil {
+		copied := *d.driver.ipam
+		state.IPAM = &copied
+	}
+	if d.dhcp.dhcp != nil {
+		copied := *d.dhcp.dhcp
+		state.DHCP = &copied
+	}
+
+	for _, m := range d.driver.machines {
+		copied := *m
+		state.Machines = append(state.Machines, &copied)
+	}
+	sort.Slice(state.Machines, func(i, j int) bool {
+		return state.Machines[i].Spec.Serial < state.Machines[j].Spec.Serial
+	})
+
+	for target, key := range d.driver.storage {
+		info := d.driver.storageMeta[target]
+		state.CryptKeys = append(state.CryptKeys, &sabakan.BackupCryptKey{
+			Serial:    info.Serial,
+			Path:      info.Path,
+			Key:       key,
+			CreatedAt: info.CreatedAt,
+		})
+	}
+
+	for name, policy := range d.driver.cryptPolicies {
+		fields := strings.SplitN(name, "/", 2)
+		state.CryptPolicies = append(state.CryptPolicies, &sabakan.BackupCryptPolicy{
+			Kind:   fields[0],
+			Name:   fields[1],
+			Policy: copyCryptPolicy(policy),
+		})
+	}
+
+	for os, params := range d.kernelParams.kernelParams {
+		state.KernelParams[os] = params
+	}
+	for role, templates := range d.ignition.ignitions {
+		copied := make(map[string]*sabakan.IgnitionTemplate)
+		for id, tmpl := range templates {
+			copied[id] = tmpl
+		}
+		state.Ignitions[role] = copied
+	}
+	for _, sw := range d.switches.switches {
+		copied := *sw
+		state.Switches = append(state.Switches, &copied)
+	}
+
+	for _, a := range d.asset.assets {
+		copied := *a
+		state.Assets = append(state.Assets, &copied)
+	}
+	if len(d.image.index) > 0 {
+		index := make(sabakan.ImageIndex, len(d.image.index))
+		for i, img := range d.image.index {
+			copied := *img
+			index[i] = &copied
+		}
+		state.Images["coreos"] = index
+	}
+
+	return state, nil
+}
+
+func (d *backupDriver) Load(ctx context.Context, state *sabakan.BackupState) error {
+	d.lock()
+	defer d.unlock()
+
+	if d.driver.ipam != nil || d.dhcp.dhcp != nil || len(d.driver.machines) > 0 ||
+		len(d.driver.storage) > 0 || len(d.driver.cryptPolicies) > 0 ||
+		len(d.kernelParams.kernelParams) > 0 || len(d.ignition.ignitions) > 0 ||
+		len(d.switches.switches) > 0 || len(d.asset.assets) > 0 || len(d.image.index) > 0 {
+		return sabakan.ErrConflicted
+	}
+
+	if state.IPAM != nil {
+		copied := *state.IPAM
+		d.driver.ipam = &copied
+	}
+	if state.DHCP != nil {
+		copied := *state.DHCP
+		d.dhcp.dhcp = &copied
+	}
+	for _, m := range state.Machines {
+		copied := *m
+		d.driver.machines[m.Spec.Serial] = &copied
+	}
+	for _, k := range state.CryptKeys {
+		target := path.Join(k.Serial, k.Path)
+		d.driver.storage[target] = k.Key
+		d.driver.storageRev++
+		d.driver.storageMeta[target] = &sabakan.EncryptionKeyInfo{
+			Serial:    k.Serial,
+			Path:      k.Path,
+			CreatedAt: k.CreatedAt,
+			Revision:  d.driver.storageRev,
+		}
+	}
+	for _, p := range state.CryptPolicies {
+		d.driver.cryptPolicies[path.Join(p.Kind, p.Name)] = copyCryptPolicy(p.Policy)
+	}
+	for os, params := range state.KernelParams {
+		d.kernelParams.kernelParams[os] = params
+	}
+	for role, templates := range state.Ignitions {
+		copied := make(map[string]*sabakan.IgnitionTemplate)
+		for id, tmpl := range templates {
+			copied[id] = tmpl
+		}
+		d.ignition.ignitions[role] = copied
+	}
+	for _, sw := range state.Switches {
+		copied := *sw
+		d.switches.switches[sw.MAC] = &copied
+	}
+
+	d.driver.addLog(ctx, sabakan.AuditBackup, "", "restore",
+		fmt.Sprintf("%d machines, %d keys", len(state.Machines), len(state.CryptKeys)))
+	return nil
+}
+
+func (d *backupDriver) Unload(ctx context.Context, state *sabakan.BackupState) error {
+	d.lock()
+	defer d.unlock()
+
+	if state.IPAM != nil {
+		d.driver.ipam = nil
+	}
+	if state.DHCP != nil {
+		d.dhcp.dhcp = nil
+	}
+	for _, m := range state.Machines {
+		delete(d.driver.machines, m.Spec.Serial)
+	}
+	for _, k := range state.CryptKeys {
+		target := path.Join(k.Serial, k.Path)
+		delete(d.driver.storage, target)
+		delete(d.driver.storageMeta, target)
+	}
+	for _, p := range state.CryptPolicies {
+		delete(d.driver.cryptPolicies, path.Join(p.Kind, p.Name))
+	}
+	for os := range state.KernelParams {
+		delete(d.kernelParams.kernelParams, os)
+	}
+	for role := range state.Ignitions {
+		delete(d.ignition.ignitions, role)
+	}
+	for _, sw := range state.Switches {
+		delete(d.switches.switches, sw.MAC)
+	}
+	for _, img := range state.Images["coreos"] {
+		d.image.index = d.image.index.Remove(img.ID)
+		delete(d.image.images, img.ID)
+	}
+
+	d.driver.addLog(ctx, sabakan.AuditBackup, "", "unload",
+		fmt.Sprintf("%d machines, %d keys", len(state.Machines), len(state.CryptKeys)))
+	return nil
+}
@@ -0,0 +1,16 @@
+package mock
+
+import (
+	"testing"
+
+	"github.com/cybozu-go/sabakan/v3"
+	"github.com/cybozu-go/sabakan/v3/models/modeltest"
+)
+
+func TestConformance(t *testing.T) {
+	t.Parallel()
+
+	modeltest.Run(t, func(t *testing.T) sabakan.Model {
+		return NewModel()
+	})
+}
@@ -0,0 +1,96 @@
+package mock
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+func copyCryptPolicy(policy *sabakan.CryptPolicy) *sabakan.CryptPolicy {
+	copied := *policy
+	copied.Disks = append([]sabakan.DiskSelector(nil), policy.Disks...)
+	if policy.FormatNonEmpty != nil {
+		formatNonEmpty := *policy.FormatNonEmpty
+		copied.FormatNonEmpty = &formatNonEmpty
+	}
+	return &copied
+}
+
+func (d *driver) cryptPolicyPut(ctx context.Context, kind, name string, policy *sabakan.CryptPolicy) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+	d.cryptPolicies[path.Join(kind, name)] = copyCryptPolicy(policy)
+	d.addLog(ctx, sabakan.AuditCryptPolicy, path.Join(kind, name), "put", string(data))
+	return nil
+}
+
+func (d *driver) cryptPolicyGet(ctx context.Context, kind, name string) (*sabakan.CryptPolicy, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	policy, ok := d.cryptPolicies[path.Join(kind, name)]
+	if !ok {
+		return nil, sabakan.ErrNotFound
+	}
+	return copyCryptPolicy(policy), nil
+}
+
+func (d *driver) cryptPolicyDelete(ctx context.Context, kind, name string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := path.Join(kind, name)
+	if _, ok := d.cryptPolicies[key]; !ok {
+		return sabakan.ErrNotFound
+	}
+	delete(d.cryptPolicies, key)
+	d.addLog(ctx, sabakan.AuditCryptPolicy, key, "delete", "")
+	return nil
+}
+
+func (d *driver) cryptPolicyResolve(ctx context.Context, serial string) (*sabakan.CryptPolicy, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	m, ok := d.machines[serial]
+	if !ok {
+		return nil, sabakan.ErrNotFound
+	}
+
+	policy, ok := d.cryptPolicies[path.Join(sabakan.CryptPolicyMachine, serial)]
+	if ok {
+		return copyCryptPolicy(policy), nil
+	}
+	policy, ok = d.cryptPolicies[path.Join(sabakan.CryptPolicyRole, m.Spec.Role)]
+	if ok {
+		return copyCryptPolicy(policy), nil
+	}
+	return nil, sabakan.ErrNotFound
+}
+
+type cryptPolicyDriver struct {
+	*driver
+}
+
+func (d cryptPolicyDriver) Put(ctx context.Context, kind, name string, policy *sabakan.CryptPolicy) error {
+	return d.cryptPolicyPut(ctx, kind, name, policy)
+}
+
+func (d cryptPolicyDriver) Get(ctx context.Context, kind, name string) (*sabakan.CryptPolicy, error) {
+	return d.cryptPolicyGet(ctx, kind, name)
+}
+
+func (d cryptPolicyDriver) Delete(ctx context.Context, kind, name string) error {
+	return d.cryptPolicyDelete(ctx, kind, name)
+}
+
+func (d cryptPolicyDriver) Resolve(ctx context.Context, serial string) (*sabakan.CryptPolicy, error) {
+	return d.cryptPolicyResolve(ctx, serial)
+}
@@ -2,67 +2,95 @@ package mock
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"net"
 	"sync"
+	"time"
 
 	"github.com/cybozu-go/sabakan/v3"
 )
 
+type leaseInfo struct {
+	index      int
+	leaseUntil time.Time
+}
+
 type leaseUsage struct {
 	leaseRange *sabakan.LeaseRange
-	macMap     map[string]int // MAC address to index-in-range
+	hwMap      map[string]leaseInfo // MAC address to index-in-range
 	usageMap   map[int]bool
 }
 
-func (l *leaseUsage) lease(mac net.HardwareAddr) (net.IP, error) {
-	if idx, ok := l.macMap[mac.String()]; ok {
-		return l.leaseRange.IP(idx), nil
+func (l *leaseUsage) gc() {
+	now := time.Now()
+
+	for k, v := range l.hwMap {
+		if !v.leaseUntil.Before(now) {
+			continue
+		}
+		delete(l.usageMap, v.index)
+		delete(l.hwMap, k)
 	}
+}
+
+func (l *leaseUsage) lease(mac net.HardwareAddr, du time.Duration) (net.IP, error) {
+	hwAddr := mac.String()
+	leaseUntil := time.Now().Add(du)
+	if v, ok := l.hwMap[hwAddr]; ok {
+		v.leaseUntil = leaseUntil
+		l.hwMap[hwAddr] = v
+		return l.leaseRange.IP(v.index), nil
+	}
+
+	l.gc()
 
 	for i := 0; i < l.leaseRange.Count; i++ {
 		if l.usageMap[i] {
 			continue
 		}
 		l.usageMap[i] = true
-		l.macMap[mac.String()] = i
+		l.hwMap[hwAddr] = leaseInfo{i, leaseUntil}
 		return l.leaseRange.IP(i), nil
 	}
 
 	return nil, errors.New("no leasable IP address found from " + l.leaseRange.Key())
 }
 
-func (l *leaseUsage) renew(mac net.HardwareAddr) error {
-	_, ok := l.macMap[mac.String()]
+func (l *leaseUsage) renew(mac net.HardwareAddr, du time.Duration) error {
+	hwAddr := mac.String()
+	v, ok := l.hwMap[hwAddr]
 	if !ok {
-		return errors.New("not leased for " + mac.String())
+		return errors.New("not leased for " + hwAddr)
 	}
+	v.leaseUntil = time.Now().Add(du)
+	l.hwMap[hwAddr] = v
 	return nil
 }
 
 func (l *leaseUsage) release(mac net.HardwareAddr) {
 	key := mac.String()
 
-	idx, ok := l.macMap[key]
+	v, ok := l.hwMap[key]
 	if !ok {
 		return
 	}
 
-	delete(l.macMap, key)
-	delete(l.usageMap, idx)
+	delete(l.hwMap, key)
+	delete(l.usageMap, v.index)
 }
 
 func (l *leaseUsage) decline(mac net.HardwareAddr) {
 	key := mac.String()
 
-	idx, ok := l.macMap[key]
+	v, ok := l.hwMap[key]
 	if !ok {
 		return
 	}
 
-	declineKey := generateDummyMAC(idx).String()
-	l.macMap[declineKey] = idx
-	delete(l.macMap, key)
+	declineKey := generateDummyMAC(v.index).String()
+	l.hwMap[declineKey] = v
+	delete(l.hwMap, key)
 }
 
 func generateDummyMAC(idx int) net.HardwareAddr {
@@ -79,7 +107,7 @@ func generateDummyMAC(idx int) net.HardwareAddr {
 func newLeaseUsage(lr *sabakan.LeaseRange) *leaseUsage {
 	return &leaseUsage{
 		leaseRange: lr,
-		macMap:     make(map[string]int),
+		hwMap:      make(map[string]leaseInfo),
 		usageMap:   make(map[int]bool),
 	}
 }
@@ -99,10 +127,16 @@ func newDHCPDriver(d *driver) *dhcpDriver {
 }
 
 func (d *dhcpDriver) PutConfig(ctx context.Context, config *sabakan.DHCPConfig) error {
+	j, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
 	d.mu.Lock()
 	defer d.mu.Unlock()
 	copied := *config
 	d.dhcp = &copied
+	d.driver.recordLog(ctx, sabakan.AuditDHCP, "config", "put", string(j))
 	return nil
 }
 
@@ -116,6 +150,15 @@ func (d *dhcpDriver) GetConfig() (*sabakan.DHCPConfig, error) {
 	return &copied, nil
 }
 
+// leaseDuration returns the lease duration in the config.
+// d.mu must be held.
+func (d *dhcpDriver) leaseDuration() time.Duration {
+	if d.dhcp == nil {
+		return sabakan.DefaultLeaseDuration
+	}
+	return d.dhcp.LeaseDuration()
+}
+
 func (d *dhcpDriver) Lease(ctx context.Context, ifaddr net.IP, mac net.HardwareAddr) (net.IP, error) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
@@ -137,7 +180,7 @@ func (d *dhcpDriver) Lease(ctx context.Context, ifaddr net.IP, mac net.HardwareA
 		d.leases[key] = lu
 	}
 
-	return lu.lease(mac)
+	return lu.lease(mac, d.leaseDuration())
 }
 
 func (d *dhcpDriver) Renew(ctx context.Context, ciaddr net.IP, mac net.HardwareAddr) error {
@@ -159,7 +202,7 @@ func (d *dhcpDriver) Renew(ctx context.Context, ciaddr net.IP, mac net.HardwareA
 	if lu == nil {
 		return errors.New("not leased for " + mac.String())
 	}
-	return lu.renew(mac)
+	return lu.renew(mac, d.leaseDuration())
 }
 
 func (d *dhcpDriver) Release(ctx context.Context, ciaddr net.IP, mac net.HardwareAddr) error {
@@ -205,3 +248,31 @@ func (d *dhcpDriver) Decline(ctx context.Context, ciaddr net.IP, mac net.Hardwar
 	}
 	return nil
 }
+
+func (d *dhcpDriver) LeaseOwner(ctx context.Context, ip net.IP) (net.HardwareAddr, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	ipam, err := d.driver.getIPAMConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	lr := ipam.LeaseRange(ip)
+	if lr == nil {
+		return nil, sabakan.ErrNotFound
+	}
+
+	lu := d.leases[lr.Key()]
+	if lu == nil {
+		return nil, sabakan.ErrNotFound
+	}
+	now := time.Now()
+	for mac, v := range lu.hwMap {
+		if v.leaseUntil.Before(now) || !lr.IP(v.index).Equal(ip) {
+			continue
+		}
+		return net.ParseMAC(mac)
+	}
+	return nil, sabakan.ErrNotFound
+}
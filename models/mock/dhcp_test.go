@@ -0,0 +1,61 @@
+package mock
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cybozu-go/sabakan/v3"
+	"github.com/cybozu-go/sabakan/v3/models/modeltest"
+)
+
+func TestLeaseExpiry(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	m := NewModel()
+	err := m.IPAM.PutConfig(ctx, &modeltest.IPAMConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.DHCP.PutConfig(ctx, &modeltest.DHCPConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ifaddr := net.ParseIP("10.69.0.195")
+	mac1, _ := net.ParseMAC("00:11:22:33:44:55")
+	mac2, _ := net.ParseMAC("00:11:22:33:44:66")
+	ip1, err := m.DHCP.Lease(ctx, ifaddr, mac1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner, err := m.DHCP.LeaseOwner(ctx, ip1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner.String() != mac1.String() {
+		t.Error("unexpected owner:", owner)
+	}
+
+	// expire the lease
+	dd := m.DHCP.(*dhcpDriver)
+	for _, lu := range dd.leases {
+		v := lu.hwMap[mac1.String()]
+		v.leaseUntil = time.Now().Add(-time.Second)
+		lu.hwMap[mac1.String()] = v
+	}
+
+	_, err = m.DHCP.LeaseOwner(ctx, ip1)
+	if err != sabakan.ErrNotFound {
+		t.Error("expired lease should not have owner:", err)
+	}
+	ip2, err := m.DHCP.Lease(ctx, ifaddr, mac2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ip2.Equal(ip1) {
+		t.Error("expired address should be reused:", ip1, ip2)
+	}
+}
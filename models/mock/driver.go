@@ -14,7 +14,14 @@ type driver struct {
 	ipam     *sabakan.IPAMConfig
 	machines map[string]*sabakan.Machine
 	storage  map[string][]byte
-	log      *sabakan.AuditLog
+
+	logs   []*sabakan.AuditLog
+	logRev int64
+
+	storageMeta map[string]*sabakan.EncryptionKeyInfo
+	storageRev  int64
+
+	cryptPolicies map[string]*sabakan.CryptPolicy
 }
 
 // NewModel returns sabakan.Model
@@ -22,20 +29,37 @@ func NewModel() sabakan.Model {
 	d := &driver{
 		machines: make(map[string]*sabakan.Machine),
 		storage:  make(map[string][]byte),
+
+		storageMeta: make(map[string]*sabakan.EncryptionKeyInfo),
+
+		cryptPolicies: make(map[string]*sabakan.CryptPolicy),
+	}
+	b := &backupDriver{
+		driver:       d,
+		dhcp:         newDHCPDriver(d),
+		image:        newImageDriver(d),
+		asset:        newAssetDriver(d),
+		ignition:     newIgnitionDriver(d),
+		kernelParams: newKernelParamsDriver(),
+		switches:     newSwitchDriver(d),
 	}
 	return sabakan.Model{
 		Runner:       d,
 		IPAM:         ipamDriver{d},
 		Machine:      machineDriver{d},
 		Storage:      d,
-		DHCP:         newDHCPDriver(d),
-		Image:        newImageDriver(),
-		Asset:        newAssetDriver(),
-		Ignition:     newIgnitionDriver(),
+		CryptPolicy:  cryptPolicyDriver{d},
+		DHCP:         b.dhcp,
+		Image:        b.image,
+		Asset:        b.asset,
+		Ignition:     b.ignition,
 		Log:          logDriver{d},
-		KernelParams: newKernelParamsDriver(),
+		KernelParams: b.kernelParams,
+		Switch:       b.switches,
+		Webhook:      newWebhookDriver(d),
 		Health:       newHealthDriver(),
 		Schema:       d,
+		Backup:       b,
 	}
 }
 
@@ -9,37 +9,26 @@ import (
 	version "github.com/hashicorp/go-version"
 )
 
+// maxIgnitions is a number of the ignition templates to keep for each role.
+const maxIgnitions = 10
+
 type ignitionDriver struct {
 	mu        sync.Mutex
+	driver    *driver
 	ignitions map[string]map[string]*sabakan.IgnitionTemplate
 }
 
-func newIgnitionDriver() *ignitionDriver {
+func newIgnitionDriver(d *driver) *ignitionDriver {
 	return &ignitionDriver{
+		driver:    d,
 		ignitions: make(map[string]map[string]*sabakan.IgnitionTemplate),
 	}
 }
 
-func (d *ignitionDriver) PutTemplate(ctx context.Context, role, id string, tmpl *sabakan.IgnitionTemplate) error {
-	d.mu.Lock()
-	defer d.mu.Unlock()
+// sortedIDs returns template IDs of a role sorted by version.
+func (d *ignitionDriver) sortedIDs(role string) ([]string, error) {
 	templateMap := d.ignitions[role]
-	if templateMap == nil {
-		templateMap = make(map[string]*sabakan.IgnitionTemplate)
-		d.ignitions[role] = templateMap
-	}
-	if _, ok := templateMap[id]; ok {
-		return sabakan.ErrConflicted
-	}
-	templateMap[id] = tmpl
-	return nil
-}
-
-func (d *ignitionDriver) GetTemplateIDs(ctx context.Context, role string) ([]string, error) {
-	d.mu.Lock()
-	defer d.mu.Unlock()
-	templateMap, ok := d.ignitions[role]
-	if !ok {
+	if len(templateMap) == 0 {
 		return nil, nil
 	}
 
@@ -61,6 +50,39 @@ func (d *ignitionDriver) GetTemplateIDs(ctx context.Context, role string) ([]str
 	return result, nil
 }
 
+func (d *ignitionDriver) PutTemplate(ctx context.Context, role, id string, tmpl *sabakan.IgnitionTemplate) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	templateMap := d.ignitions[role]
+	if templateMap == nil {
+		templateMap = make(map[string]*sabakan.IgnitionTemplate)
+		d.ignitions[role] = templateMap
+	}
+	if _, ok := templateMap[id]; ok {
+		return sabakan.ErrConflicted
+	}
+	templateMap[id] = tmpl
+	d.driver.recordLog(ctx, sabakan.AuditIgnition, role, "put", id)
+
+	ids, err := d.sortedIDs(role)
+	if err != nil {
+		return err
+	}
+	if len(ids) <= maxIgnitions {
+		return nil
+	}
+	for _, old := range ids[:len(ids)-maxIgnitions] {
+		delete(templateMap, old)
+	}
+	return nil
+}
+
+func (d *ignitionDriver) GetTemplateIDs(ctx context.Context, role string) ([]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.sortedIDs(role)
+}
+
 func (d *ignitionDriver) GetTemplate(ctx context.Context, role string, id string) (*sabakan.IgnitionTemplate, error) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
@@ -82,5 +104,6 @@ func (d *ignitionDriver) DeleteTemplate(ctx context.Context, role string, id str
 		return sabakan.ErrNotFound
 	}
 	delete(ids, id)
+	d.driver.recordLog(ctx, sabakan.AuditIgnition, role, "delete", id)
 	return nil
 }
@@ -17,18 +17,32 @@ type imageData struct {
 	initrd []byte
 }
 
+// maxDeleted is the maximum number of deleted image IDs to remember.
+const maxDeleted = 10
+
 type imageDriver struct {
-	mu     sync.Mutex
-	index  sabakan.ImageIndex
-	images map[string]imageData
+	mu      sync.Mutex
+	driver  *driver
+	index   sabakan.ImageIndex
+	deleted []string
+	images  map[string]imageData
 }
 
-func newImageDriver() *imageDriver {
+func newImageDriver(d *driver) *imageDriver {
 	return &imageDriver{
+		driver: d,
 		images: make(map[string]imageData),
 	}
 }
 
+// addDeleted remembers deleted image IDs to reject re-uploading them.
+func (d *imageDriver) addDeleted(ids ...string) {
+	d.deleted = append(d.deleted, ids...)
+	if len(d.deleted) > maxDeleted {
+		d.deleted = d.deleted[len(d.deleted)-maxDeleted:]
+	}
+}
+
 func (d *imageDriver) GetIndex(ctx context.Context, os string) (sabakan.ImageIndex, error) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
@@ -62,9 +76,10 @@ func (d *imageDriver) Upload(ctx context.Context, os, id string, r io.Reader) er
 		return errors.New("mock driver supports only coreos")
 	}
 
-	img := d.index.Find(id)
-	if img != nil {
-		return sabakan.ErrConflicted
+	for _, deleted := range d.deleted {
+		if deleted == id {
+			return sabakan.ErrConflicted
+		}
 	}
 
 	var kernel, initrd []byte
@@ -105,12 +120,21 @@ func (d *imageDriver) Upload(ctx context.Context, os, id string, r io.Reader) er
 		return sabakan.ErrBadRequest
 	}
 
-	d.images[id] = imageData{kernel, initrd}
-	d.index, _ = d.index.Append(&sabakan.Image{
+	// uploading an existing image makes it the newest but keeps the data
+	if d.index.Find(id) == nil {
+		d.images[id] = imageData{kernel, initrd}
+	}
+	index, dels := d.index.Append(&sabakan.Image{
 		ID:   id,
 		Date: time.Now().UTC(),
 		Size: int64(len(kernel) + len(initrd)),
 	})
+	d.index = index
+	for _, del := range dels {
+		delete(d.images, del)
+	}
+	d.addDeleted(dels...)
+	d.driver.recordLog(ctx, sabakan.AuditImage, os, "upload", "id="+id)
 
 	return nil
 }
@@ -179,6 +203,8 @@ func (d *imageDriver) Delete(ctx context.Context, os, id string) error {
 
 	d.index = d.index.Remove(id)
 	delete(d.images, id)
+	d.addDeleted(id)
+	d.driver.recordLog(ctx, sabakan.AuditImage, os, "delete", "id="+id)
 	return nil
 }
 
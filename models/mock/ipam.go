@@ -2,8 +2,8 @@ package mock
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
-	"time"
 
 	"github.com/cybozu-go/sabakan/v3"
 )
@@ -15,10 +15,13 @@ func (d *driver) putIPAMConfig(ctx context.Context, config *sabakan.IPAMConfig)
 	if len(d.machines) > 0 {
 		return errors.New("machines already exist")
 	}
+	j, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
 	copied := *config
 	d.ipam = &copied
-	d.log = sabakan.NewAuditLog(ctx, time.Now().UTC(), 1, sabakan.AuditIPAM,
-		"config", "put", "test")
+	d.addLog(ctx, sabakan.AuditIPAM, "config", "put", string(j))
 
 	return nil
 }
@@ -5,12 +5,83 @@ import (
 	"encoding/json"
 	"io"
 	"time"
+
+	"github.com/cybozu-go/sabakan/v3"
 )
 
+// addLog appends an audit log entry.  d.mu must be held by the caller.
+func (d *driver) addLog(ctx context.Context, cat sabakan.AuditCategory, instance, action, detail string) {
+	d.logRev++
+	a := sabakan.NewAuditLog(ctx, time.Now().UTC(), d.logRev, cat, instance, action, detail)
+	d.logs = append(d.logs, a)
+}
+
+// recordLog is the same as addLog except that this acquires d.mu.
+// Sub-models that have their own lock use this.
+func (d *driver) recordLog(ctx context.Context, cat sabakan.AuditCategory, instance, action, detail string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.addLog(ctx, cat, instance, action, detail)
+}
+
+func logDay(t time.Time) string {
+	return t.UTC().Format("20060102")
+}
+
+// inRange returns true if a is logged in the date range of q.
+// As etcd driver does, only dates are compared.
+func inRange(q *sabakan.LogQuery, a *sabakan.AuditLog) bool {
+	day := logDay(a.Timestamp)
+	if !q.Since.IsZero() && day < logDay(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && day >= logDay(q.Until) {
+		return false
+	}
+	return true
+}
+
 type logDriver struct {
 	*driver
 }
 
 func (d logDriver) Dump(ctx context.Context, since, until time.Time, w io.Writer) error {
-	return json.NewEncoder(w).Encode(d.driver.log)
+	return d.Query(ctx, &sabakan.LogQuery{Since: since, Until: until}, w)
+}
+
+func (d logDriver) Query(ctx context.Context, q *sabakan.LogQuery, w io.Writer) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	enc := json.NewEncoder(w)
+	count := 0
+	for i := range d.logs {
+		a := d.logs[i]
+		if q.Order == sabakan.LogOrderDesc {
+			a = d.logs[len(d.logs)-1-i]
+		}
+		if !inRange(q, a) || !q.Match(a) {
+			continue
+		}
+
+		err := enc.Encode(a)
+		if err != nil {
+			return err
+		}
+		count++
+		if q.Limit > 0 && count == q.Limit {
+			break
+		}
+	}
+	return nil
+}
+
+func (d logDriver) Record(ctx context.Context, cat sabakan.AuditCategory, instance, action, detail string) error {
+	d.recordLog(ctx, cat, instance, action, detail)
+	return nil
+}
+
+func (d logDriver) Chain(ctx context.Context) (*sabakan.AuditChain, error) {
+	return &sabakan.AuditChain{Checkpoints: []*sabakan.AuditCheckpoint{}}, nil
 }
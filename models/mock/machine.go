@@ -2,6 +2,7 @@ package mock
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"strings"
 	"time"
@@ -9,6 +10,37 @@ import (
 	"github.com/cybozu-go/sabakan/v3"
 )
 
+// assignNodeIndex assigns the smallest unused node index in the rack to m.
+// Boot servers always have NodeIndexOffset.
+func (d *driver) assignNodeIndex(m *sabakan.Machine) error {
+	used := make(map[uint]bool)
+	for _, m2 := range d.machines {
+		if m2.Spec.Rack == m.Spec.Rack {
+			used[m2.Spec.IndexInRack] = true
+		}
+	}
+
+	if m.Spec.Role == "boot" {
+		if used[d.ipam.NodeIndexOffset] {
+			return sabakan.ErrConflicted
+		}
+		m.Spec.IndexInRack = d.ipam.NodeIndexOffset
+		return nil
+	}
+
+	for i := uint(0); i < d.ipam.MaxNodesInRack; i++ {
+		idx := i + d.ipam.NodeIndexOffset + 1
+		if !used[idx] {
+			m.Spec.IndexInRack = idx
+			return nil
+		}
+	}
+	return errors.New("no node index is available for new machine")
+}
+
+// machineRegister registers machines.
+// Unlike other drivers, IPAM config is not required for simpler tests.
+// Node indices and IP addresses are assigned only when it is set.
 func (d *driver) machineRegister(ctx context.Context, machines []*sabakan.Machine) error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
@@ -18,9 +50,25 @@ func (d *driver) machineRegister(ctx context.Context, machines []*sabakan.Machin
 			return sabakan.ErrConflicted
 		}
 	}
-	for _, m := range machines {
+
+	serials := make([]string, len(machines))
+	for i, m := range machines {
+		if d.ipam != nil {
+			err := d.assignNodeIndex(m)
+			if err != nil {
+				// registration is atomic
+				for _, serial := range serials[:i] {
+					delete(d.machines, serial)
+				}
+				return err
+			}
+			d.ipam.GenerateIP(m)
+		}
 		d.machines[m.Spec.Serial] = m
+		serials[i] = m.Spec.Serial
 	}
+
+	d.addLog(ctx, sabakan.AuditMachines, "", "register", strings.Join(serials, "\n"))
 	return nil
 }
 
@@ -36,7 +84,11 @@ func (d *driver) machineGet(ctx context.Context, serial string) (*sabakan.Machin
 	return m, nil
 }
 
-func (d *driver) machineSetState(ctx context.Context, serial string, state sabakan.MachineState) error {
+// machineUpdate updates a machine by fn and records the difference.
+// If fn returns false, the audit log is not recorded.
+func (d *driver) machineUpdate(ctx context.Context, serial, action string,
+	fn func(m *sabakan.Machine) (bool, error)) error {
+
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
@@ -44,51 +96,77 @@ func (d *driver) machineSetState(ctx context.Context, serial string, state sabak
 	if !ok {
 		return sabakan.ErrNotFound
 	}
+	before, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	// modify a copy so that m is kept intact on errors
+	copied := new(sabakan.Machine)
+	err = json.Unmarshal(before, copied)
+	if err != nil {
+		return err
+	}
+	changed, err := fn(copied)
+	if err != nil {
+		return err
+	}
+	*m = *copied
+	if !changed {
+		return nil
+	}
 
-	if state == sabakan.StateRetired {
-		prefix := serial + "/"
-		for k := range d.storage {
-			if strings.HasPrefix(k, prefix) {
-				return sabakan.ErrBadRequest
+	after, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	detail, err := sabakan.AuditDiff(before, after)
+	if err != nil {
+		return err
+	}
+	d.addLog(ctx, sabakan.AuditMachines, serial, action, detail)
+	return nil
+}
+
+func (d *driver) machineSetState(ctx context.Context, serial string, state sabakan.MachineState) error {
+	return d.machineUpdate(ctx, serial, "set-state", func(m *sabakan.Machine) (bool, error) {
+		prevState := m.Status.State
+		err := m.SetState(state)
+		if err != nil {
+			return false, err
+		}
+		if state == sabakan.StateRetired {
+			prefix := serial + "/"
+			for k := range d.storage {
+				if strings.HasPrefix(k, prefix) {
+					return false, sabakan.ErrEncryptionKeyExists
+				}
 			}
 		}
-	}
-	return m.SetState(state)
+
+		// setting the same state is frequent and changes nothing
+		return prevState != state, nil
+	})
 }
 
 func (d *driver) machinePutLabel(ctx context.Context, serial string, label, value string) error {
-	d.mu.Lock()
-	defer d.mu.Unlock()
-
-	m, ok := d.machines[serial]
-	if !ok {
-		return sabakan.ErrNotFound
-	}
-	m.PutLabel(label, value)
-	return nil
+	return d.machineUpdate(ctx, serial, "put-label", func(m *sabakan.Machine) (bool, error) {
+		m.PutLabel(label, value)
+		return true, nil
+	})
 }
 
 func (d *driver) machineDeleteLabel(ctx context.Context, serial string, label string) error {
-	d.mu.Lock()
-	defer d.mu.Unlock()
-
-	m, ok := d.machines[serial]
-	if !ok {
-		return sabakan.ErrNotFound
-	}
-	return m.DeleteLabel(label)
+	return d.machineUpdate(ctx, serial, "delete-label", func(m *sabakan.Machine) (bool, error) {
+		return true, m.DeleteLabel(label)
+	})
 }
 
 func (d *driver) machineSetRetireDate(ctx context.Context, serial string, date time.Time) error {
-	d.mu.Lock()
-	defer d.mu.Unlock()
-
-	m, ok := d.machines[serial]
-	if !ok {
-		return sabakan.ErrNotFound
-	}
-	m.Spec.RetireDate = date
-	return nil
+	return d.machineUpdate(ctx, serial, "set-retire-date", func(m *sabakan.Machine) (bool, error) {
+		m.Spec.RetireDate = date
+		return true, nil
+	})
 }
 
 func (d *driver) machineQuery(ctx context.Context, q sabakan.Query) ([]*sabakan.Machine, error) {
@@ -121,7 +199,17 @@ func (d *driver) machineDelete(ctx context.Context, serial string) error {
 		return errors.New("non-retired machine cannot be deleted")
 	}
 
+	before, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	detail, err := sabakan.AuditDiff(before, nil)
+	if err != nil {
+		return err
+	}
+
 	delete(d.machines, serial)
+	d.addLog(ctx, sabakan.AuditMachines, serial, "delete", detail)
 	return nil
 }
 
@@ -4,7 +4,9 @@ import (
 	"context"
 	"errors"
 	"path"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/cybozu-go/sabakan/v3"
 )
@@ -17,9 +19,11 @@ func (d *driver) GetEncryptionKey(ctx context.Context, serial string, diskByPath
 	target := path.Join(serial, diskByPath)
 	key, ok := d.storage[target]
 	if !ok {
+		d.addLog(ctx, sabakan.AuditCrypts, serial, "get-failed", diskByPath+": not found")
 		return nil, nil
 	}
 
+	d.addLog(ctx, sabakan.AuditCrypts, serial, "get", diskByPath)
 	return key, nil
 }
 
@@ -42,6 +46,14 @@ func (d *driver) PutEncryptionKey(ctx context.Context, serial string, diskByPath
 		return sabakan.ErrConflicted
 	}
 	d.storage[target] = key
+	d.storageRev++
+	d.storageMeta[target] = &sabakan.EncryptionKeyInfo{
+		Serial:    serial,
+		Path:      diskByPath,
+		CreatedAt: time.Now().UTC(),
+		Revision:  d.storageRev,
+	}
+	d.addLog(ctx, sabakan.AuditCrypts, serial, "put", diskByPath)
 
 	return nil
 }
@@ -65,9 +77,39 @@ func (d *driver) DeleteEncryptionKeys(ctx context.Context, serial string) ([]str
 	for k := range d.storage {
 		if strings.HasPrefix(k, prefix) {
 			delete(d.storage, k)
+			delete(d.storageMeta, k)
 			resp = append(resp, k[len(serial)+1:])
 		}
 	}
+	d.addLog(ctx, sabakan.AuditCrypts, serial, "delete", "")
 
 	return resp, nil
 }
+
+// ListEncryptionKeys implements sabakan.StorageModel
+func (d *driver) ListEncryptionKeys(ctx context.Context, serial string) ([]*sabakan.EncryptionKeyInfo, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if serial != "" {
+		if _, ok := d.machines[serial]; !ok {
+			return nil, sabakan.ErrNotFound
+		}
+	}
+
+	infos := make([]*sabakan.EncryptionKeyInfo, 0)
+	for _, info := range d.storageMeta {
+		if serial != "" && info.Serial != serial {
+			continue
+		}
+		copied := *info
+		infos = append(infos, &copied)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Serial != infos[j].Serial {
+			return infos[i].Serial < infos[j].Serial
+		}
+		return infos[i].Path < infos[j].Path
+	})
+	return infos, nil
+}
@@ -0,0 +1,76 @@
+package mock
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+type switchDriver struct {
+	mu       sync.Mutex
+	driver   *driver
+	switches map[string]*sabakan.Switch
+}
+
+func newSwitchDriver(d *driver) *switchDriver {
+	return &switchDriver{
+		driver:   d,
+		switches: make(map[string]*sabakan.Switch),
+	}
+}
+
+func (d *switchDriver) Put(ctx context.Context, sw *sabakan.Switch) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	data, err := json.Marshal(sw)
+	if err != nil {
+		return err
+	}
+	copied := *sw
+	d.switches[sw.MAC] = &copied
+	d.driver.recordLog(ctx, sabakan.AuditSwitches, sw.MAC, "put", string(data))
+	return nil
+}
+
+func (d *switchDriver) Get(ctx context.Context, mac string) (*sabakan.Switch, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	sw, ok := d.switches[mac]
+	if !ok {
+		return nil, sabakan.ErrNotFound
+	}
+	copied := *sw
+	return &copied, nil
+}
+
+func (d *switchDriver) GetAll(ctx context.Context) ([]*sabakan.Switch, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	switches := make([]*sabakan.Switch, 0, len(d.switches))
+	for _, sw := range d.switches {
+		copied := *sw
+		switches = append(switches, &copied)
+	}
+	sort.Slice(switches, func(i, j int) bool {
+		return switches[i].MAC < switches[j].MAC
+	})
+	return switches, nil
+}
+
+func (d *switchDriver) Delete(ctx context.Context, mac string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.switches[mac]; !ok {
+		return sabakan.ErrNotFound
+	}
+	delete(d.switches, mac)
+	d.driver.recordLog(ctx, sabakan.AuditSwitches, mac, "delete", "")
+	return nil
+}
@@ -0,0 +1,83 @@
+package mock
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+type webhookDriver struct {
+	mu     sync.Mutex
+	driver *driver
+	hooks  map[string]*sabakan.Webhook
+}
+
+func newWebhookDriver(d *driver) *webhookDriver {
+	return &webhookDriver{
+		driver: d,
+		hooks:  make(map[string]*sabakan.Webhook),
+	}
+}
+
+func copyWebhook(hook *sabakan.Webhook) *sabakan.Webhook {
+	copied := *hook
+	copied.Categories = append([]sabakan.AuditCategory(nil), hook.Categories...)
+	copied.Actions = append([]string(nil), hook.Actions...)
+	return &copied
+}
+
+func (d *webhookDriver) Put(ctx context.Context, hook *sabakan.Webhook) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// do not record the secret
+	copied := *hook
+	copied.Secret = ""
+	data, err := json.Marshal(&copied)
+	if err != nil {
+		return err
+	}
+	d.hooks[hook.Name] = copyWebhook(hook)
+	d.driver.recordLog(ctx, sabakan.AuditWebhooks, hook.Name, "put", string(data))
+	return nil
+}
+
+func (d *webhookDriver) Get(ctx context.Context, name string) (*sabakan.Webhook, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	hook, ok := d.hooks[name]
+	if !ok {
+		return nil, sabakan.ErrNotFound
+	}
+	return copyWebhook(hook), nil
+}
+
+func (d *webhookDriver) GetAll(ctx context.Context) ([]*sabakan.Webhook, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	hooks := make([]*sabakan.Webhook, 0, len(d.hooks))
+	for _, hook := range d.hooks {
+		hooks = append(hooks, copyWebhook(hook))
+	}
+	sort.Slice(hooks, func(i, j int) bool {
+		return hooks[i].Name < hooks[j].Name
+	})
+	return hooks, nil
+}
+
+func (d *webhookDriver) Delete(ctx context.Context, name string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.hooks[name]; !ok {
+		return sabakan.ErrNotFound
+	}
+	delete(d.hooks, name)
+	d.driver.recordLog(ctx, sabakan.AuditWebhooks, name, "delete", "")
+	return nil
+}
@@ -0,0 +1,292 @@
+package modeltest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+// assetHandler is a sabakan.AssetHandler that reads the content.
+type assetHandler struct {
+	t       *testing.T
+	asset   *sabakan.Asset
+	content string
+	url     string
+}
+
+func (h *assetHandler) ServeContent(asset *sabakan.Asset, content io.ReadSeeker) {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		h.t.Error(err)
+	}
+	h.asset = asset
+	h.content = string(data)
+}
+
+func (h *assetHandler) Redirect(url string) {
+	h.url = url
+}
+
+// getAsset returns the content of an asset.
+func getAsset(t *testing.T, m sabakan.Model, name string) (string, error) {
+	t.Helper()
+
+	h := &assetHandler{t: t}
+	err := m.Asset.Get(context.Background(), name, h)
+	if err != nil {
+		return "", err
+	}
+	if h.url != "" {
+		t.Fatal("asset is not served locally:", h.url)
+	}
+	return h.content, nil
+}
+
+// getAssetVersion returns the content of a version of an asset.
+func getAssetVersion(t *testing.T, m sabakan.Model, name string, id int) (string, error) {
+	t.Helper()
+
+	h := &assetHandler{t: t}
+	err := m.Asset.GetVersion(context.Background(), name, id, h)
+	if err != nil {
+		return "", err
+	}
+	if h.url != "" {
+		t.Fatal("asset is not served locally:", h.url)
+	}
+	if h.asset.ID != id {
+		t.Error("unexpected version is served:", h.asset.ID)
+	}
+	return h.content, nil
+}
+
+func testAsset(t *testing.T, m sabakan.Model) {
+	ctx := context.Background()
+
+	names, err := m.Asset.GetIndex(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 0 {
+		t.Error("index should be empty:", names)
+	}
+
+	status, err := m.Asset.Put(ctx, "foo", "text/plain", nil, map[string]string{"k": "v"},
+		strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Status != http.StatusCreated {
+		t.Error("new asset should be created:", status.Status)
+	}
+	expectLog(t, m, sabakan.AuditAssets, "foo", "put")
+	firstID := status.ID
+
+	asset, err := m.Asset.GetInfo(ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("hello"))
+	if asset.Name != "foo" || asset.ID != firstID || asset.ContentType != "text/plain" ||
+		asset.Size != 5 || asset.Sha256 != hex.EncodeToString(sum[:]) || asset.Options["k"] != "v" {
+		t.Errorf("unexpected asset: %#v", asset)
+	}
+	content, err := getAsset(t, m, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content != "hello" {
+		t.Error("unexpected content:", content)
+	}
+
+	// updating an asset replaces the content and the ID
+	status, err = m.Asset.Put(ctx, "foo", "application/octet-stream", nil, nil,
+		strings.NewReader("hello world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Status != http.StatusOK {
+		t.Error("existing asset should be updated:", status.Status)
+	}
+	if status.ID <= firstID {
+		t.Error("updated asset should have a new ID:", status.ID)
+	}
+	secondID := status.ID
+
+	asset, err = m.Asset.GetInfo(ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if asset.ID != secondID || asset.ContentType != "application/octet-stream" || asset.Size != 11 {
+		t.Errorf("asset is not updated: %#v", asset)
+	}
+	content, err = getAsset(t, m, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content != "hello world" {
+		t.Error("content is not updated:", content)
+	}
+
+	// checksum mismatch does not change the asset
+	_, err = m.Asset.Put(ctx, "foo", "text/plain", sum[:], nil, strings.NewReader("bye"))
+	if err == nil {
+		t.Error("checksum mismatch should be an error")
+	}
+	asset, err = m.Asset.GetInfo(ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if asset.ID != secondID {
+		t.Error("asset should not be changed on errors:", asset.ID)
+	}
+
+	_, err = m.Asset.Put(ctx, "bar", "text/plain", sum[:], nil, strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, err = m.Asset.GetIndex(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 || names[0] != "bar" || names[1] != "foo" {
+		t.Error("unexpected index:", names)
+	}
+	assets, err := m.Asset.GetInfoAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(assets) != 2 {
+		t.Error("unexpected assets:", len(assets))
+	}
+
+	err = m.Asset.Delete(ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLog(t, m, sabakan.AuditAssets, "foo", "delete")
+	_, err = m.Asset.GetInfo(ctx, "foo")
+	if err != sabakan.ErrNotFound {
+		t.Error("GetInfo should return ErrNotFound:", err)
+	}
+	_, err = getAsset(t, m, "foo")
+	if err != sabakan.ErrNotFound {
+		t.Error("Get should return ErrNotFound:", err)
+	}
+	err = m.Asset.Delete(ctx, "foo")
+	if err != sabakan.ErrNotFound {
+		t.Error("Delete should return ErrNotFound:", err)
+	}
+
+	// a new asset with the deleted name has a new ID
+	status, err = m.Asset.Put(ctx, "foo", "text/plain", nil, nil, strings.NewReader("again"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Status != http.StatusCreated || status.ID <= secondID {
+		t.Error("unexpected status:", status)
+	}
+}
+
+func testAssetHistory(t *testing.T, m sabakan.Model) {
+	ctx := context.WithValue(context.Background(), sabakan.AuditKeyUser, "user1")
+
+	var ids []int
+	for i := 0; i < sabakan.MaxAssetVersions; i++ {
+		status, err := m.Asset.Put(ctx, "foo", "text/plain", nil, nil,
+			strings.NewReader(fmt.Sprintf("v%d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, status.ID)
+	}
+
+	asset, err := m.Asset.GetInfo(ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if asset.Uploader != "user1" {
+		t.Error("uploader is not recorded:", asset.Uploader)
+	}
+	versions := asset.Versions()
+	if len(versions) != sabakan.MaxAssetVersions {
+		t.Fatal("unexpected number of versions:", len(versions))
+	}
+	for i, v := range versions {
+		id := ids[len(ids)-1-i]
+		sum := sha256.Sum256([]byte(fmt.Sprintf("v%d", len(ids)-1-i)))
+		if v.ID != id || v.Sha256 != hex.EncodeToString(sum[:]) || v.Uploader != "user1" {
+			t.Errorf("unexpected version: %#v", v)
+		}
+	}
+	for i, id := range ids {
+		content, err := getAssetVersion(t, m, "foo", id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if content != fmt.Sprintf("v%d", i) {
+			t.Error("unexpected content:", content)
+		}
+	}
+
+	// the oldest version is discarded
+	status, err := m.Asset.Put(ctx, "foo", "text/plain", nil, nil, strings.NewReader("bad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = getAssetVersion(t, m, "foo", ids[0])
+	if err != sabakan.ErrNotFound {
+		t.Error("discarded version should not be found:", err)
+	}
+
+	err = m.Asset.Rollback(ctx, "foo", ids[0])
+	if err != sabakan.ErrNotFound {
+		t.Error("rollback to discarded version should fail:", err)
+	}
+	err = m.Asset.Rollback(ctx, "bar", ids[0])
+	if err != sabakan.ErrNotFound {
+		t.Error("rollback of missing asset should fail:", err)
+	}
+
+	last := ids[len(ids)-1]
+	err = m.Asset.Rollback(ctx, "foo", last)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLog(t, m, sabakan.AuditAssets, "foo", "rollback")
+
+	asset, err = m.Asset.GetInfo(ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if asset.ID != last {
+		t.Error("asset is not rolled back:", asset.ID)
+	}
+	versions = asset.Versions()
+	if len(versions) != sabakan.MaxAssetVersions || versions[1].ID != status.ID {
+		t.Error("replaced version should be the latest in the history:", versions)
+	}
+	content, err := getAsset(t, m, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content != fmt.Sprintf("v%d", len(ids)-1) {
+		t.Error("unexpected content:", content)
+	}
+
+	err = m.Asset.Delete(ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = getAssetVersion(t, m, "foo", status.ID)
+	if err != sabakan.ErrNotFound {
+		t.Error("GetVersion should return ErrNotFound:", err)
+	}
+}
@@ -0,0 +1,200 @@
+package modeltest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+func testBackup(t *testing.T, src, dst sabakan.Model) {
+	ctx := context.Background()
+	setupConfig(t, src)
+	registerMachines(t, src, "1", "2")
+
+	err := src.Machine.SetState(ctx, "2", sabakan.StateHealthy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = src.Machine.PutLabel(ctx, "2", "foo", "bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := []byte("0123456789abcdef")
+	err = src.Storage.PutEncryptionKey(ctx, "1", "pci-0000:00:17.0-ata-1", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := &sabakan.CryptPolicy{RequireTPM: true}
+	err = src.CryptPolicy.Put(ctx, sabakan.CryptPolicyRole, "worker", policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = src.KernelParams.PutParams(ctx, "coreos", "console=ttyS0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &sabakan.IgnitionTemplate{
+		Version:  sabakan.Ignition2_3,
+		Template: json.RawMessage(`{"foo":"bar"}`),
+	}
+	err = src.Ignition.PutTemplate(ctx, "worker", "1.0.0", tmpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sw := &sabakan.Switch{MAC: "00:11:22:33:44:55", Name: "sw-55", Installer: "nos"}
+	err = src.Switch.Put(ctx, sw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = src.Asset.Put(ctx, "foo", "text/plain", nil, map[string]string{"k": "v"},
+		strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"2", "1"} {
+		err = src.Image.Upload(ctx, "coreos", id, newImage(t, "kernel"+id, "initrd"+id))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	opts := &sabakan.BackupOptions{CryptKeys: sabakan.BackupKeysEncrypted, Passphrase: "secret"}
+	err = sabakan.WriteBackup(ctx, src, opts, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := buf.Bytes()
+
+	err = sabakan.RestoreBackup(ctx, dst, bytes.NewReader(archive), "wrong")
+	if !errors.Is(err, sabakan.ErrBadRequest) {
+		t.Error("RestoreBackup should fail with wrong passphrase:", err)
+	}
+
+	// a restore failing partway through uploading images is undone
+	// so that it can be retried.
+	err = sabakan.RestoreBackup(ctx, dst, bytes.NewReader(archive[:len(archive)-1536]), "secret")
+	if err == nil {
+		t.Error("RestoreBackup should fail with a truncated archive")
+	}
+	expectLog(t, dst, sabakan.AuditBackup, "", "unload")
+	if _, err := dst.Machine.Get(ctx, "1"); err != sabakan.ErrNotFound {
+		t.Error("machine should be removed after a failed restore:", err)
+	}
+	if _, err := dst.Asset.GetInfo(ctx, "foo"); err != sabakan.ErrNotFound {
+		t.Error("asset should be removed after a failed restore:", err)
+	}
+	if ids := imageIDs(t, dst); len(ids) != 0 {
+		t.Error("images should be removed after a failed restore:", ids)
+	}
+
+	err = sabakan.RestoreBackup(ctx, dst, bytes.NewReader(archive), "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLog(t, dst, sabakan.AuditBackup, "", "restore")
+
+	// only empty models can be restored
+	err = sabakan.RestoreBackup(ctx, dst, bytes.NewReader(archive), "secret")
+	if err != sabakan.ErrConflicted {
+		t.Error("RestoreBackup should return ErrConflicted:", err)
+	}
+
+	for _, serial := range []string{"1", "2"} {
+		expected, err := src.Machine.Get(ctx, serial)
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual, err := dst.Machine.Get(ctx, serial)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(actual.Spec, expected.Spec) || actual.Status.State != expected.Status.State {
+			t.Errorf("machine %s is not restored: %#v", serial, actual)
+		}
+	}
+
+	data, err := dst.Storage.GetEncryptionKey(ctx, "1", "pci-0000:00:17.0-ata-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, key) {
+		t.Error("key is not restored:", string(data))
+	}
+	p, err := dst.CryptPolicy.Get(ctx, sabakan.CryptPolicyRole, "worker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.RequireTPM {
+		t.Error("crypt policy is not restored:", p)
+	}
+	params, err := dst.KernelParams.GetParams(ctx, "coreos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params != "console=ttyS0" {
+		t.Error("kernel params are not restored:", params)
+	}
+	restored, err := dst.Ignition.GetTemplate(ctx, "worker", "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(restored.Template) != `{"foo":"bar"}` {
+		t.Error("ignition template is not restored:", string(restored.Template))
+	}
+	restoredSw, err := dst.Switch.Get(ctx, sw.MAC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restoredSw.Name != sw.Name || restoredSw.Installer != sw.Installer {
+		t.Error("switch is not restored:", restoredSw)
+	}
+
+	content, err := getAsset(t, dst, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content != "hello" {
+		t.Error("asset is not restored:", content)
+	}
+	asset, err := dst.Asset.GetInfo(ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if asset.ContentType != "text/plain" || asset.Options["k"] != "v" {
+		t.Errorf("asset meta data is not restored: %#v", asset)
+	}
+
+	if ids := imageIDs(t, dst); !reflect.DeepEqual(ids, []string{"2", "1"}) {
+		t.Error("images are not restored in order:", ids)
+	}
+	buf.Reset()
+	err = dst.Image.Download(ctx, "coreos", "1", buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := readImage(t, buf)
+	if files[sabakan.ImageKernelFilename] != "kernel1" || files[sabakan.ImageInitrdFilename] != "initrd1" {
+		t.Error("image is not restored:", files)
+	}
+
+	// node indices are restored
+	eventually(t, func() error {
+		_, err := dst.IPAM.GetConfig()
+		return err
+	})
+	registerMachines(t, dst, "3")
+	m3, err := dst.Machine.Get(ctx, "3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m3.Spec.IndexInRack != IPAMConfig.NodeIndexOffset+3 {
+		t.Error("node index of restored machines should not be reused:", m3.Spec.IndexInRack)
+	}
+}
@@ -0,0 +1,120 @@
+package modeltest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+func testDHCP(t *testing.T, m sabakan.Model) {
+	ctx := context.Background()
+
+	_, err := m.DHCP.GetConfig()
+	if err == nil {
+		t.Error("GetConfig should fail before PutConfig")
+	}
+
+	setupConfig(t, m)
+	expectLog(t, m, sabakan.AuditDHCP, "config", "put")
+
+	config := DHCPConfig
+	config.LeaseMinutes = 60
+	err = m.DHCP.PutConfig(ctx, &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, func() error {
+		c, err := m.DHCP.GetConfig()
+		if err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(c, &config) {
+			return errors.New("config is not updated")
+		}
+		return nil
+	})
+
+	ifaddr := net.ParseIP("10.69.0.195")
+	mac1 := net.HardwareAddr{0x11, 0x22, 0x33, 0x44, 0x55, 0x66}
+	mac2 := net.HardwareAddr{0x11, 0x22, 0x33, 0x44, 0x55, 0x67}
+	mac3 := net.HardwareAddr{0x11, 0x22, 0x33, 0x44, 0x55, 0x68}
+
+	ip1, err := m.DHCP.Lease(ctx, ifaddr, mac1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip, err := m.DHCP.Lease(ctx, ifaddr, mac1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ip.Equal(ip1) {
+		t.Error("the same address should be leased for the same MAC:", ip1, ip)
+	}
+	ip2, err := m.DHCP.Lease(ctx, ifaddr, mac2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip2.Equal(ip1) {
+		t.Error("the leased address should not be leased again:", ip2)
+	}
+
+	owner, err := m.DHCP.LeaseOwner(ctx, ip1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner.String() != mac1.String() {
+		t.Error("unexpected owner:", owner)
+	}
+
+	err = m.DHCP.Renew(ctx, ip1, mac1)
+	if err != nil {
+		t.Error(err)
+	}
+	err = m.DHCP.Renew(ctx, ip1, mac3)
+	if err == nil {
+		t.Error("Renew should fail for MAC without lease")
+	}
+
+	// released addresses can be leased again
+	err = m.DHCP.Release(ctx, ip1, mac1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.DHCP.LeaseOwner(ctx, ip1)
+	if err != sabakan.ErrNotFound {
+		t.Error("released address should not have owner:", err)
+	}
+	err = m.DHCP.Renew(ctx, ip1, mac1)
+	if err == nil {
+		t.Error("Renew should fail after Release")
+	}
+	ip, err = m.DHCP.Lease(ctx, ifaddr, mac3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ip.Equal(ip1) {
+		t.Error("released address should be reused:", ip1, ip)
+	}
+
+	// declined addresses are not leased again
+	err = m.DHCP.Decline(ctx, ip2, mac2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip, err = m.DHCP.Lease(ctx, ifaddr, mac2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip.Equal(ip2) {
+		t.Error("declined address should not be leased:", ip)
+	}
+
+	_, err = m.DHCP.LeaseOwner(ctx, net.ParseIP("192.168.0.1"))
+	if err != sabakan.ErrNotFound {
+		t.Error("LeaseOwner should return ErrNotFound for address out of range:", err)
+	}
+}
@@ -0,0 +1,117 @@
+package modeltest
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+func testIgnition(t *testing.T, m sabakan.Model) {
+	ctx := context.Background()
+
+	ids, err := m.Ignition.GetTemplateIDs(ctx, "worker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 0 {
+		t.Error("no templates should exist:", ids)
+	}
+
+	for _, id := range []string{"1.0.1", "1.0.10", "1.0.0", "1.0.2"} {
+		tmpl := &sabakan.IgnitionTemplate{
+			Version:  sabakan.Ignition2_3,
+			Template: json.RawMessage(`{"id":"` + id + `"}`),
+			Metadata: map[string]interface{}{"id": id},
+		}
+		err = m.Ignition.PutTemplate(ctx, "worker", id, tmpl)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectLog(t, m, sabakan.AuditIgnition, "worker", "put")
+
+	err = m.Ignition.PutTemplate(ctx, "worker", "1.0.0", &sabakan.IgnitionTemplate{
+		Version:  sabakan.Ignition2_3,
+		Template: json.RawMessage(`{}`),
+	})
+	if err != sabakan.ErrConflicted {
+		t.Error("templates should not be overwritten:", err)
+	}
+
+	// IDs are sorted by version
+	ids, err = m.Ignition.GetTemplateIDs(ctx, "worker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ids, []string{"1.0.0", "1.0.1", "1.0.2", "1.0.10"}) {
+		t.Error("unexpected IDs:", ids)
+	}
+	ids, err = m.Ignition.GetTemplateIDs(ctx, "boot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 0 {
+		t.Error("templates of other roles are returned:", ids)
+	}
+
+	tmpl, err := m.Ignition.GetTemplate(ctx, "worker", "1.0.10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tmpl.Version != sabakan.Ignition2_3 || string(tmpl.Template) != `{"id":"1.0.10"}` || tmpl.Metadata["id"] != "1.0.10" {
+		t.Error("unexpected template:", tmpl)
+	}
+	_, err = m.Ignition.GetTemplate(ctx, "worker", "2.0.0")
+	if err != sabakan.ErrNotFound {
+		t.Error("GetTemplate should return ErrNotFound:", err)
+	}
+
+	err = m.Ignition.DeleteTemplate(ctx, "worker", "1.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLog(t, m, sabakan.AuditIgnition, "worker", "delete")
+	err = m.Ignition.DeleteTemplate(ctx, "worker", "1.0.1")
+	if err != sabakan.ErrNotFound {
+		t.Error("DeleteTemplate should return ErrNotFound:", err)
+	}
+	_, err = m.Ignition.GetTemplate(ctx, "worker", "1.0.1")
+	if err != sabakan.ErrNotFound {
+		t.Error("deleted template should not be found:", err)
+	}
+	ids, err = m.Ignition.GetTemplateIDs(ctx, "worker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ids, []string{"1.0.0", "1.0.2", "1.0.10"}) {
+		t.Error("unexpected IDs after deletion:", ids)
+	}
+}
+
+func testKernelParams(t *testing.T, m sabakan.Model) {
+	ctx := context.Background()
+
+	_, err := m.KernelParams.GetParams(ctx, "coreos")
+	if err != sabakan.ErrNotFound {
+		t.Error("GetParams should return ErrNotFound:", err)
+	}
+
+	err = m.KernelParams.PutParams(ctx, "coreos", "console=ttyS0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.KernelParams.PutParams(ctx, "coreos", "console=ttyS0 coreos.autologin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	params, err := m.KernelParams.GetParams(ctx, "coreos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params != "console=ttyS0 coreos.autologin" {
+		t.Error("unexpected params:", params)
+	}
+}
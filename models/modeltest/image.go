@@ -0,0 +1,197 @@
+package modeltest
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+// newImage returns a tar archive of a boot image.
+func newImage(t *testing.T, kernel, initrd string) io.Reader {
+	t.Helper()
+
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	files := []struct {
+		name, content string
+	}{
+		{sabakan.ImageKernelFilename, kernel},
+		{sabakan.ImageInitrdFilename, initrd},
+	}
+	for _, f := range files {
+		if f.content == "" {
+			continue
+		}
+		err := tw.WriteHeader(&tar.Header{
+			Name: f.name,
+			Mode: 0644,
+			Size: int64(len(f.content)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = tw.Write([]byte(f.content))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := tw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
+
+// readImage reads files of an image downloaded as a tar archive.
+func readImage(t *testing.T, r io.Reader) map[string]string {
+	t.Helper()
+
+	files := make(map[string]string)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[hdr.Name] = string(data)
+	}
+}
+
+func imageIDs(t *testing.T, m sabakan.Model) []string {
+	t.Helper()
+
+	index, err := m.Image.GetIndex(context.Background(), "coreos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]string, len(index))
+	for i, img := range index {
+		ids[i] = img.ID
+	}
+	return ids
+}
+
+func testImage(t *testing.T, m sabakan.Model) {
+	ctx := context.Background()
+
+	if ids := imageIDs(t, m); len(ids) != 0 {
+		t.Error("index should be empty:", ids)
+	}
+	err := m.Image.ServeFile(ctx, "coreos", sabakan.ImageKernelFilename,
+		func(modtime time.Time, content io.ReadSeeker) {})
+	if err != sabakan.ErrNotFound {
+		t.Error("ServeFile should return ErrNotFound without images:", err)
+	}
+
+	err = m.Image.Upload(ctx, "coreos", "0", newImage(t, "kernel", ""))
+	if err != sabakan.ErrBadRequest {
+		t.Error("image without initrd should be rejected:", err)
+	}
+
+	for i := 1; i <= sabakan.MaxImages+1; i++ {
+		id := strconv.Itoa(i)
+		err = m.Image.Upload(ctx, "coreos", id, newImage(t, "kernel"+id, "initrd"+id))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectLog(t, m, sabakan.AuditImage, "coreos", "upload")
+
+	// the oldest image is removed
+	ids := imageIDs(t, m)
+	if len(ids) != sabakan.MaxImages || ids[0] != "2" || ids[len(ids)-1] != strconv.Itoa(sabakan.MaxImages+1) {
+		t.Error("unexpected index:", ids)
+	}
+	err = m.Image.Download(ctx, "coreos", "1", io.Discard)
+	if err != sabakan.ErrNotFound {
+		t.Error("removed image should not be downloaded:", err)
+	}
+	err = m.Image.Upload(ctx, "coreos", "1", newImage(t, "kernel1", "initrd1"))
+	if err != sabakan.ErrConflicted {
+		t.Error("removed image should not be uploaded again:", err)
+	}
+
+	// uploading an existing image makes it the newest
+	err = m.Image.Upload(ctx, "coreos", "3", newImage(t, "kernel3", "initrd3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids = imageIDs(t, m)
+	if len(ids) != sabakan.MaxImages || ids[len(ids)-1] != "3" {
+		t.Error("uploaded image should be the newest:", ids)
+	}
+
+	var served []byte
+	err = m.Image.ServeFile(ctx, "coreos", sabakan.ImageInitrdFilename,
+		func(modtime time.Time, content io.ReadSeeker) {
+			served, _ = io.ReadAll(content)
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(served) != "initrd3" {
+		t.Error("the newest image should be served:", string(served))
+	}
+
+	buf := new(bytes.Buffer)
+	err = m.Image.Download(ctx, "coreos", "4", buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := readImage(t, buf)
+	if files[sabakan.ImageKernelFilename] != "kernel4" || files[sabakan.ImageInitrdFilename] != "initrd4" {
+		t.Error("unexpected image:", files)
+	}
+
+	images, err := m.Image.GetInfoAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != sabakan.MaxImages {
+		t.Error("unexpected images:", len(images))
+	}
+
+	// deleted images cannot be uploaded again
+	err = m.Image.Delete(ctx, "coreos", "3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLog(t, m, sabakan.AuditImage, "coreos", "delete")
+	err = m.Image.Download(ctx, "coreos", "3", io.Discard)
+	if err != sabakan.ErrNotFound {
+		t.Error("deleted image should not be downloaded:", err)
+	}
+	err = m.Image.Delete(ctx, "coreos", "3")
+	if err != sabakan.ErrNotFound {
+		t.Error("Delete should return ErrNotFound:", err)
+	}
+	err = m.Image.Upload(ctx, "coreos", "3", newImage(t, "kernel3", "initrd3"))
+	if err != sabakan.ErrConflicted {
+		t.Error("deleted image should not be uploaded again:", err)
+	}
+
+	served = nil
+	err = m.Image.ServeFile(ctx, "coreos", sabakan.ImageKernelFilename,
+		func(modtime time.Time, content io.ReadSeeker) {
+			served, _ = io.ReadAll(content)
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(served) != "kernel"+strconv.Itoa(sabakan.MaxImages+1) {
+		t.Error("the newest image should be served after deletion:", string(served))
+	}
+}
@@ -0,0 +1,59 @@
+package modeltest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+func testIPAM(t *testing.T, m sabakan.Model) {
+	ctx := context.Background()
+
+	_, err := m.IPAM.GetConfig()
+	if err == nil {
+		t.Error("GetConfig should fail before PutConfig")
+	}
+
+	config := IPAMConfig
+	err = m.IPAM.PutConfig(ctx, &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLog(t, m, sabakan.AuditIPAM, "config", "put")
+
+	eventually(t, func() error {
+		c, err := m.IPAM.GetConfig()
+		if err != nil {
+			return err
+		}
+		if *c != IPAMConfig {
+			return errors.New("config is not updated")
+		}
+		return nil
+	})
+
+	// the config can be changed until machines are registered
+	config.MaxNodesInRack = 20
+	err = m.IPAM.PutConfig(ctx, &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, func() error {
+		c, err := m.IPAM.GetConfig()
+		if err != nil {
+			return err
+		}
+		if c.MaxNodesInRack != 20 {
+			return errors.New("config is not updated")
+		}
+		return nil
+	})
+
+	registerMachines(t, m, "1")
+	err = m.IPAM.PutConfig(ctx, &config)
+	if err == nil {
+		t.Error("config should not be changed after machines are registered")
+	}
+}
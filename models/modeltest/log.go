@@ -0,0 +1,139 @@
+package modeltest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+// queryLogs returns audit logs matching q.
+func queryLogs(t *testing.T, m sabakan.Model, q *sabakan.LogQuery) []*sabakan.AuditLog {
+	t.Helper()
+
+	buf := new(bytes.Buffer)
+	err := m.Log.Query(context.Background(), q, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var logs []*sabakan.AuditLog
+	s := bufio.NewScanner(buf)
+	for s.Scan() {
+		a := new(sabakan.AuditLog)
+		err := json.Unmarshal(s.Bytes(), a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		logs = append(logs, a)
+	}
+	return logs
+}
+
+func testLog(t *testing.T, m sabakan.Model) {
+	ctx := context.Background()
+
+	for _, instance := range []string{"1", "2", "3"} {
+		err := m.Log.Record(ctx, sabakan.AuditIPXE, instance, "deny", "detail "+instance)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := m.KernelParams.PutParams(ctx, "coreos", "console=ttyS0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.Switch.Put(ctx, &sabakan.Switch{MAC: "00:11:22:33:44:55"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logs := queryLogs(t, m, &sabakan.LogQuery{Category: sabakan.AuditIPXE})
+	if len(logs) != 3 {
+		t.Fatal("unexpected logs:", len(logs))
+	}
+	for i, a := range logs {
+		instance := []string{"1", "2", "3"}[i]
+		if a.Instance != instance || a.Action != "deny" || a.Detail != "detail "+instance {
+			t.Errorf("unexpected log: %#v", a)
+		}
+	}
+	if !(logs[0].Revision < logs[1].Revision && logs[1].Revision < logs[2].Revision) {
+		t.Error("revisions should increase:", logs[0].Revision, logs[1].Revision, logs[2].Revision)
+	}
+
+	logs = queryLogs(t, m, &sabakan.LogQuery{
+		Category: sabakan.AuditIPXE,
+		Order:    sabakan.LogOrderDesc,
+		Limit:    2,
+	})
+	if len(logs) != 2 || logs[0].Instance != "3" || logs[1].Instance != "2" {
+		t.Error("logs should be in descending order:", logs)
+	}
+
+	logs = queryLogs(t, m, &sabakan.LogQuery{Instance: "2"})
+	if len(logs) != 1 || logs[0].Category != sabakan.AuditIPXE {
+		t.Error("unexpected logs for instance:", logs)
+	}
+
+	// all logs are dumped
+	buf := new(bytes.Buffer)
+	err = m.Log.Dump(ctx, time.Time{}, time.Time{}, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.Count(buf.Bytes(), []byte("\n"))
+	if lines != 4 {
+		t.Error("unexpected number of dumped logs:", lines)
+	}
+
+	// the date of Until is not included
+	today := time.Now().UTC()
+	logs = queryLogs(t, m, &sabakan.LogQuery{Since: today.AddDate(0, 0, 1)})
+	if len(logs) != 0 {
+		t.Error("logs of tomorrow should be empty:", logs)
+	}
+	logs = queryLogs(t, m, &sabakan.LogQuery{Until: today})
+	if len(logs) != 0 {
+		t.Error("logs until today should be empty:", logs)
+	}
+	logs = queryLogs(t, m, &sabakan.LogQuery{Since: today, Until: today.AddDate(0, 0, 1)})
+	if len(logs) != 4 {
+		t.Error("unexpected logs of today:", len(logs))
+	}
+
+	chain, err := m.Log.Chain(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chain == nil {
+		t.Error("chain should not be nil")
+	}
+}
+
+func testHealth(t *testing.T, m sabakan.Model) {
+	err := m.Health.GetHealth(context.Background())
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func testSchema(t *testing.T, m sabakan.Model) {
+	ctx := context.Background()
+
+	err := m.Schema.Upgrade(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, err := m.Schema.Version(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != sabakan.SchemaVersion {
+		t.Error("unexpected schema version:", version)
+	}
+}
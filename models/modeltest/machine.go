@@ -0,0 +1,312 @@
+package modeltest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+func testMachine(t *testing.T, m sabakan.Model) {
+	ctx := context.Background()
+	setupConfig(t, m)
+
+	machines := []*sabakan.Machine{
+		sabakan.NewMachine(sabakan.MachineSpec{
+			Serial: "1",
+			Labels: map[string]string{"product": "R630"},
+			Role:   "worker",
+		}),
+		sabakan.NewMachine(sabakan.MachineSpec{
+			Serial: "2",
+			Role:   "worker",
+		}),
+		sabakan.NewMachine(sabakan.MachineSpec{
+			Serial: "3",
+			Rack:   1,
+			Role:   "boot",
+		}),
+	}
+	err := m.Machine.Register(ctx, machines)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLog(t, m, sabakan.AuditMachines, "", "register")
+
+	m1, err := m.Machine.Get(ctx, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m1.Spec.Labels["product"] != "R630" {
+		t.Error("labels are not registered:", m1.Spec.Labels)
+	}
+	if m1.Status.State != sabakan.StateUninitialized {
+		t.Error("registered machine should be uninitialized:", m1.Status.State)
+	}
+	if m1.Spec.IndexInRack != IPAMConfig.NodeIndexOffset+1 {
+		t.Error("unexpected node index:", m1.Spec.IndexInRack)
+	}
+	if len(m1.Spec.IPv4) != int(IPAMConfig.NodeIPPerNode) || len(m1.Spec.BMC.IPv4) == 0 {
+		t.Error("addresses are not assigned:", m1.Spec.IPv4, m1.Spec.BMC.IPv4)
+	}
+
+	m2, err := m.Machine.Get(ctx, "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m2.Spec.IndexInRack != IPAMConfig.NodeIndexOffset+2 {
+		t.Error("unexpected node index:", m2.Spec.IndexInRack)
+	}
+
+	m3, err := m.Machine.Get(ctx, "3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m3.Spec.IndexInRack != IPAMConfig.NodeIndexOffset {
+		t.Error("boot server should have NodeIndexOffset:", m3.Spec.IndexInRack)
+	}
+
+	_, err = m.Machine.Get(ctx, "unknown")
+	if err != sabakan.ErrNotFound {
+		t.Error("Get should return ErrNotFound:", err)
+	}
+
+	// registration is atomic
+	err = m.Machine.Register(ctx, []*sabakan.Machine{
+		sabakan.NewMachine(sabakan.MachineSpec{Serial: "4", Role: "worker"}),
+		sabakan.NewMachine(sabakan.MachineSpec{Serial: "1", Role: "worker"}),
+	})
+	if err != sabakan.ErrConflicted {
+		t.Error("Register should return ErrConflicted:", err)
+	}
+	_, err = m.Machine.Get(ctx, "4")
+	if err != sabakan.ErrNotFound {
+		t.Error("machine should not be registered on conflicts:", err)
+	}
+
+	err = m.Machine.Register(ctx, []*sabakan.Machine{
+		sabakan.NewMachine(sabakan.MachineSpec{Serial: "5", Rack: 1, Role: "boot"}),
+	})
+	if err != sabakan.ErrConflicted {
+		t.Error("second boot server should be conflicted:", err)
+	}
+
+	// labels
+	err = m.Machine.PutLabel(ctx, "2", "foo", "bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLog(t, m, sabakan.AuditMachines, "2", "put-label")
+	m2, err = m.Machine.Get(ctx, "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m2.Spec.Labels["foo"] != "bar" {
+		t.Error("label is not put:", m2.Spec.Labels)
+	}
+	eventually(t, func() error {
+		res, err := m.Machine.Query(ctx, sabakan.Query{"labels": "foo=bar"})
+		if err != nil {
+			return err
+		}
+		if len(res) != 1 || res[0].Spec.Serial != "2" {
+			return errors.New("labeled machine should be queried")
+		}
+		return nil
+	})
+
+	err = m.Machine.DeleteLabel(ctx, "2", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLog(t, m, sabakan.AuditMachines, "2", "delete-label")
+	m2, err = m.Machine.Get(ctx, "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m2.Spec.Labels["foo"]; ok {
+		t.Error("label is not deleted:", m2.Spec.Labels)
+	}
+	err = m.Machine.DeleteLabel(ctx, "2", "foo")
+	if err != sabakan.ErrNotFound {
+		t.Error("DeleteLabel should return ErrNotFound for missing label:", err)
+	}
+	err = m.Machine.PutLabel(ctx, "unknown", "foo", "bar")
+	if err != sabakan.ErrNotFound {
+		t.Error("PutLabel should return ErrNotFound:", err)
+	}
+
+	// retire date
+	date := time.Date(2030, time.January, 2, 3, 4, 5, 0, time.UTC)
+	err = m.Machine.SetRetireDate(ctx, "2", date)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLog(t, m, sabakan.AuditMachines, "2", "set-retire-date")
+	m2, err = m.Machine.Get(ctx, "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m2.Spec.RetireDate.Equal(date) {
+		t.Error("retire date is not set:", m2.Spec.RetireDate)
+	}
+	err = m.Machine.SetRetireDate(ctx, "unknown", date)
+	if err != sabakan.ErrNotFound {
+		t.Error("SetRetireDate should return ErrNotFound:", err)
+	}
+
+	// query
+	eventually(t, func() error {
+		res, err := m.Machine.Query(ctx, sabakan.Query{"serial": "1,3"})
+		if err != nil {
+			return err
+		}
+		if len(res) != 2 {
+			return fmt.Errorf("unexpected query result: %d machines", len(res))
+		}
+		return nil
+	})
+	eventually(t, func() error {
+		res, err := m.Machine.Query(ctx, sabakan.Query{"labels": "foo=bar"})
+		if err != nil {
+			return err
+		}
+		if len(res) != 0 {
+			return errors.New("deleted label should not match")
+		}
+		return nil
+	})
+
+	// deletion
+	err = m.Machine.Delete(ctx, "1")
+	if err == nil {
+		t.Error("non-retired machine should not be deleted")
+	}
+	err = m.Machine.Delete(ctx, "unknown")
+	if err != sabakan.ErrNotFound {
+		t.Error("Delete should return ErrNotFound:", err)
+	}
+
+	err = m.Machine.SetState(ctx, "1", sabakan.StateRetiring)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.Machine.SetState(ctx, "1", sabakan.StateRetired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.Machine.Delete(ctx, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLog(t, m, sabakan.AuditMachines, "1", "delete")
+	_, err = m.Machine.Get(ctx, "1")
+	if err != sabakan.ErrNotFound {
+		t.Error("deleted machine should not be found:", err)
+	}
+	eventually(t, func() error {
+		res, err := m.Machine.Query(ctx, sabakan.Query{"serial": "1"})
+		if err != nil {
+			return err
+		}
+		if len(res) != 0 {
+			return errors.New("deleted machine should not be queried")
+		}
+		return nil
+	})
+
+	// the node index of the deleted machine is reused
+	registerMachines(t, m, "6")
+	m6, err := m.Machine.Get(ctx, "6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m6.Spec.IndexInRack != IPAMConfig.NodeIndexOffset+1 {
+		t.Error("node index should be reused:", m6.Spec.IndexInRack)
+	}
+}
+
+func testMachineState(t *testing.T, m sabakan.Model) {
+	ctx := context.Background()
+	setupConfig(t, m)
+	registerMachines(t, m, "1", "2")
+
+	expectState := func(serial string, state sabakan.MachineState) {
+		t.Helper()
+		machine, err := m.Machine.Get(ctx, serial)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if machine.Status.State != state {
+			t.Errorf("state of %s should be %s: %s", serial, state, machine.Status.State)
+		}
+	}
+
+	// not permitted transitions
+	for _, state := range []sabakan.MachineState{
+		sabakan.StateUnreachable,
+		sabakan.StateUpdating,
+		sabakan.StateRetired,
+	} {
+		err := m.Machine.SetState(ctx, "1", state)
+		if err == nil {
+			t.Error("uninitialized machine should not transit to", state)
+		}
+	}
+	expectState("1", sabakan.StateUninitialized)
+
+	transitions := []sabakan.MachineState{
+		sabakan.StateUnhealthy,
+		sabakan.StateHealthy,
+		sabakan.StateUnhealthy,
+		sabakan.StateUnreachable,
+		sabakan.StateHealthy,
+		sabakan.StateUpdating,
+		sabakan.StateUninitialized,
+		sabakan.StateHealthy,
+		sabakan.StateRetiring,
+		sabakan.StateRetired,
+		sabakan.StateUninitialized,
+	}
+	for _, state := range transitions {
+		err := m.Machine.SetState(ctx, "1", state)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectState("1", state)
+
+		a := expectLog(t, m, sabakan.AuditMachines, "1", "set-state")
+		if changes, ok := sabakan.ParseAuditDiff(a.Detail); !ok || len(changes) == 0 {
+			t.Error("set-state log should have the difference:", a.Detail)
+		}
+	}
+
+	// setting the same state is not recorded
+	before := lastLog(t, m, sabakan.LogQuery{Category: sabakan.AuditMachines, Instance: "1"})
+	err := m.Machine.SetState(ctx, "1", sabakan.StateUninitialized)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := lastLog(t, m, sabakan.LogQuery{Category: sabakan.AuditMachines, Instance: "1"})
+	if before.Revision != after.Revision {
+		t.Error("setting the same state should not be recorded")
+	}
+
+	err = m.Machine.SetState(ctx, "2", sabakan.StateRetiring)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.Machine.SetState(ctx, "2", sabakan.StateHealthy)
+	if err == nil {
+		t.Error("retiring machine should not transit to healthy")
+	}
+	expectState("2", sabakan.StateRetiring)
+
+	err = m.Machine.SetState(ctx, "unknown", sabakan.StateHealthy)
+	if err != sabakan.ErrNotFound {
+		t.Error("SetState should return ErrNotFound:", err)
+	}
+}
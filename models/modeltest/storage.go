@@ -0,0 +1,230 @@
+package modeltest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+func testStorage(t *testing.T, m sabakan.Model) {
+	ctx := context.Background()
+	setupConfig(t, m)
+	registerMachines(t, m, "1", "2")
+
+	key := []byte("0123456789abcdef")
+	err := m.Storage.PutEncryptionKey(ctx, "1", "pci-0000:00:17.0-ata-1", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLog(t, m, sabakan.AuditCrypts, "1", "put")
+
+	err = m.Storage.PutEncryptionKey(ctx, "1", "pci-0000:00:17.0-ata-1", []byte("another key"))
+	if err != sabakan.ErrConflicted {
+		t.Error("PutEncryptionKey should return ErrConflicted:", err)
+	}
+	err = m.Storage.PutEncryptionKey(ctx, "unknown", "pci-0000:00:17.0-ata-1", key)
+	if err != sabakan.ErrNotFound {
+		t.Error("PutEncryptionKey should return ErrNotFound for unknown machine:", err)
+	}
+
+	data, err := m.Storage.GetEncryptionKey(ctx, "1", "pci-0000:00:17.0-ata-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, key) {
+		t.Error("wrong key:", string(data))
+	}
+	data, err = m.Storage.GetEncryptionKey(ctx, "1", "pci-0000:00:17.0-ata-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data != nil {
+		t.Error("missing key should be nil:", string(data))
+	}
+
+	// reads of keys are audited, possibly in batches
+	for _, action := range []string{"get", "get-failed"} {
+		q := sabakan.LogQuery{Category: sabakan.AuditCrypts, Instance: "1", Action: action}
+		eventually(t, func() error {
+			if lastLog(t, m, q) == nil {
+				return fmt.Errorf("audit log is not recorded: action=%s", action)
+			}
+			return nil
+		})
+	}
+
+	infos, err := m.Storage.ListEncryptionKeys(ctx, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || infos[0].Serial != "1" || infos[0].Path != "pci-0000:00:17.0-ata-1" {
+		t.Error("unexpected key list:", infos)
+	} else if infos[0].CreatedAt.IsZero() {
+		t.Error("created-at is not set")
+	}
+	infos, err = m.Storage.ListEncryptionKeys(ctx, "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 0 {
+		t.Error("machine 2 should have no keys:", infos)
+	}
+	infos, err = m.Storage.ListEncryptionKeys(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 {
+		t.Error("unexpected key list:", infos)
+	}
+	_, err = m.Storage.ListEncryptionKeys(ctx, "unknown")
+	if err != sabakan.ErrNotFound {
+		t.Error("ListEncryptionKeys should return ErrNotFound:", err)
+	}
+
+	// keys can be deleted only when the machine is retiring
+	_, err = m.Storage.DeleteEncryptionKeys(ctx, "1")
+	if err == nil {
+		t.Error("keys of non-retiring machine should not be deleted")
+	}
+	_, err = m.Storage.DeleteEncryptionKeys(ctx, "unknown")
+	if err != sabakan.ErrNotFound {
+		t.Error("DeleteEncryptionKeys should return ErrNotFound:", err)
+	}
+
+	err = m.Machine.SetState(ctx, "1", sabakan.StateRetiring)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.Storage.PutEncryptionKey(ctx, "1", "pci-0000:00:17.0-ata-2", key)
+	if err == nil {
+		t.Error("keys should not be added to retiring machine")
+	}
+
+	// machines having keys cannot be retired
+	err = m.Machine.SetState(ctx, "1", sabakan.StateRetired)
+	if err != sabakan.ErrEncryptionKeyExists {
+		t.Error("SetState should return ErrEncryptionKeyExists:", err)
+	}
+	m1, err := m.Machine.Get(ctx, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m1.Status.State != sabakan.StateRetiring {
+		t.Error("state should not be changed:", m1.Status.State)
+	}
+
+	deleted, err := m.Storage.DeleteEncryptionKeys(ctx, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 1 || deleted[0] != "pci-0000:00:17.0-ata-1" {
+		t.Error("unexpected deleted keys:", deleted)
+	}
+	expectLog(t, m, sabakan.AuditCrypts, "1", "delete")
+
+	data, err = m.Storage.GetEncryptionKey(ctx, "1", "pci-0000:00:17.0-ata-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data != nil {
+		t.Error("deleted key should be nil:", string(data))
+	}
+	infos, err = m.Storage.ListEncryptionKeys(ctx, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 0 {
+		t.Error("keys are not deleted:", infos)
+	}
+
+	err = m.Machine.SetState(ctx, "1", sabakan.StateRetired)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// retired machines cannot have keys
+	err = m.Storage.PutEncryptionKey(ctx, "1", "pci-0000:00:17.0-ata-1", key)
+	if err == nil {
+		t.Error("keys should not be added to retired machine")
+	}
+}
+
+func testCryptPolicy(t *testing.T, m sabakan.Model) {
+	ctx := context.Background()
+	setupConfig(t, m)
+	registerMachines(t, m, "1", "2")
+
+	_, err := m.CryptPolicy.Resolve(ctx, "1")
+	if err != sabakan.ErrNotFound {
+		t.Error("Resolve should return ErrNotFound without policies:", err)
+	}
+
+	rolePolicy := &sabakan.CryptPolicy{
+		Disks:  []sabakan.DiskSelector{{Path: "pci-*"}},
+		Cipher: "aes-xts-plain64",
+	}
+	err = m.CryptPolicy.Put(ctx, sabakan.CryptPolicyRole, "worker", rolePolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLog(t, m, sabakan.AuditCryptPolicy, sabakan.CryptPolicyRole+"/worker", "put")
+
+	machinePolicy := &sabakan.CryptPolicy{RequireTPM: true}
+	err = m.CryptPolicy.Put(ctx, sabakan.CryptPolicyMachine, "1", machinePolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err := m.CryptPolicy.Get(ctx, sabakan.CryptPolicyRole, "worker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(policy.Disks) != 1 || policy.Disks[0].Path != "pci-*" || policy.Cipher != "aes-xts-plain64" {
+		t.Error("unexpected policy:", policy)
+	}
+	_, err = m.CryptPolicy.Get(ctx, sabakan.CryptPolicyRole, "boot")
+	if err != sabakan.ErrNotFound {
+		t.Error("Get should return ErrNotFound:", err)
+	}
+
+	// machine policies take precedence over role policies
+	policy, err = m.CryptPolicy.Resolve(ctx, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !policy.RequireTPM {
+		t.Error("machine policy is not resolved:", policy)
+	}
+	policy, err = m.CryptPolicy.Resolve(ctx, "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.Cipher != "aes-xts-plain64" {
+		t.Error("role policy is not resolved:", policy)
+	}
+	_, err = m.CryptPolicy.Resolve(ctx, "unknown")
+	if err != sabakan.ErrNotFound {
+		t.Error("Resolve should return ErrNotFound for unknown machine:", err)
+	}
+
+	err = m.CryptPolicy.Delete(ctx, sabakan.CryptPolicyMachine, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLog(t, m, sabakan.AuditCryptPolicy, sabakan.CryptPolicyMachine+"/1", "delete")
+	err = m.CryptPolicy.Delete(ctx, sabakan.CryptPolicyMachine, "1")
+	if err != sabakan.ErrNotFound {
+		t.Error("Delete should return ErrNotFound:", err)
+	}
+
+	policy, err = m.CryptPolicy.Resolve(ctx, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.RequireTPM {
+		t.Error("deleted policy is resolved:", policy)
+	}
+}
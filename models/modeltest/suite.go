@@ -0,0 +1,195 @@
+// Package modeltest provides a conformance test suite for implementations
+// of sabakan.Model.
+//
+// Every driver should pass this suite so that the behavior of sabakan does
+// not depend on the storage backend.  Use it from a test of the driver:
+//
+//	func TestConformance(t *testing.T) {
+//		modeltest.Run(t, func(t *testing.T) sabakan.Model {
+//			return NewModel(...)
+//		})
+//	}
+package modeltest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+// NewModelFunc returns an empty sabakan.Model for a test.
+//
+// The returned model must be ready to use; if the driver needs
+// goroutines started by Runner.Run, the function should start them and
+// wait for the first notification.  Resources should be released by
+// t.Cleanup.  The function is called concurrently from parallel tests.
+type NewModelFunc func(t *testing.T) sabakan.Model
+
+// Run runs the conformance test suite against models created by newModel.
+func Run(t *testing.T, newModel NewModelFunc) {
+	tests := []struct {
+		name string
+		fn   func(*testing.T, sabakan.Model)
+	}{
+		{"Machine", testMachine},
+		{"MachineState", testMachineState},
+		{"Storage", testStorage},
+		{"CryptPolicy", testCryptPolicy},
+		{"IPAM", testIPAM},
+		{"DHCP", testDHCP},
+		{"Image", testImage},
+		{"Asset", testAsset},
+		{"AssetHistory", testAssetHistory},
+		{"Ignition", testIgnition},
+		{"KernelParams", testKernelParams},
+		{"Switch", testSwitch},
+		{"Webhook", testWebhook},
+		{"Log", testLog},
+		{"Health", testHealth},
+		{"Schema", testSchema},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			tt.fn(t, newModel(t))
+		})
+	}
+
+	t.Run("Backup", func(t *testing.T) {
+		t.Parallel()
+		testBackup(t, newModel(t), newModel(t))
+	})
+}
+
+// Timeouts for drivers that reflect updates asynchronously, such as etcd.
+// pollTimeout is longer than the interval of etcd driver to flush
+// batched audit logs.
+const (
+	pollInterval = 100 * time.Millisecond
+	pollTimeout  = 30 * time.Second
+)
+
+// eventually calls fn until it returns nil.
+func eventually(t *testing.T, fn func() error) {
+	t.Helper()
+
+	deadline := time.Now().Add(pollTimeout)
+	for {
+		err := fn()
+		if err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// IPAMConfig is the IPAM configuration used by the suite.
+// Tests of drivers can use it as well; copy it before modification.
+var IPAMConfig = sabakan.IPAMConfig{
+	MaxNodesInRack:    28,
+	NodeIPv4Pool:      "10.69.0.0/20",
+	NodeIPv4Offset:    "",
+	NodeRangeSize:     6,
+	NodeRangeMask:     26,
+	NodeIPPerNode:     3,
+	NodeIndexOffset:   3,
+	NodeGatewayOffset: 1,
+	BMCIPv4Pool:       "10.72.16.0/20",
+	BMCIPv4Offset:     "0.0.1.0",
+	BMCRangeSize:      5,
+	BMCRangeMask:      20,
+	BMCGatewayOffset:  1,
+}
+
+// DHCPConfig is the DHCP configuration used by the suite.
+var DHCPConfig = sabakan.DHCPConfig{
+	LeaseMinutes: 30,
+	DNSServers:   []string{"10.0.0.1", "10.0.0.2"},
+}
+
+// setupConfig puts IPAM and DHCP configurations and waits for them.
+func setupConfig(t *testing.T, m sabakan.Model) {
+	t.Helper()
+	ctx := context.Background()
+
+	ipam := IPAMConfig
+	err := m.IPAM.PutConfig(ctx, &ipam)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dhcp := DHCPConfig
+	err = m.DHCP.PutConfig(ctx, &dhcp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, func() error {
+		_, err := m.IPAM.GetConfig()
+		return err
+	})
+	eventually(t, func() error {
+		_, err := m.DHCP.GetConfig()
+		return err
+	})
+}
+
+// registerMachines registers workers in rack 0 with the given serials.
+func registerMachines(t *testing.T, m sabakan.Model, serials ...string) {
+	t.Helper()
+
+	machines := make([]*sabakan.Machine, len(serials))
+	for i, serial := range serials {
+		machines[i] = sabakan.NewMachine(sabakan.MachineSpec{
+			Serial: serial,
+			Role:   "worker",
+		})
+	}
+	err := m.Machine.Register(context.Background(), machines)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// lastLog returns the newest audit log entry matching q.
+// This returns nil if there is no such entry.
+func lastLog(t *testing.T, m sabakan.Model, q sabakan.LogQuery) *sabakan.AuditLog {
+	t.Helper()
+
+	q.Order = sabakan.LogOrderDesc
+	q.Limit = 1
+	buf := new(bytes.Buffer)
+	err := m.Log.Query(context.Background(), &q, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() == 0 {
+		return nil
+	}
+
+	a := new(sabakan.AuditLog)
+	err = json.Unmarshal(buf.Bytes(), a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+// expectLog checks that an audit log entry has been recorded.
+func expectLog(t *testing.T, m sabakan.Model, cat sabakan.AuditCategory, instance, action string) *sabakan.AuditLog {
+	t.Helper()
+
+	a := lastLog(t, m, sabakan.LogQuery{Category: cat, Instance: instance, Action: action})
+	if a == nil {
+		t.Fatalf("audit log is not recorded: category=%s, instance=%s, action=%s", cat, instance, action)
+	}
+	return a
+}
@@ -0,0 +1,124 @@
+package modeltest
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+func testSwitch(t *testing.T, m sabakan.Model) {
+	ctx := context.Background()
+
+	_, err := m.Switch.Get(ctx, "00:11:22:33:44:55")
+	if err != sabakan.ErrNotFound {
+		t.Error("Get should return ErrNotFound:", err)
+	}
+
+	for _, mac := range []string{"00:11:22:33:44:66", "00:11:22:33:44:55"} {
+		err = m.Switch.Put(ctx, &sabakan.Switch{MAC: mac, Name: "sw-" + mac[len(mac)-2:], Installer: "nos"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectLog(t, m, sabakan.AuditSwitches, "00:11:22:33:44:55", "put")
+
+	err = m.Switch.Put(ctx, &sabakan.Switch{MAC: "00:11:22:33:44:55", Name: "sw-55", Script: "ztp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sw, err := m.Switch.Get(ctx, "00:11:22:33:44:55")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sw.Name != "sw-55" || sw.Installer != "" || sw.Script != "ztp" {
+		t.Error("switch is not replaced:", sw)
+	}
+
+	switches, err := m.Switch.GetAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(switches) != 2 || switches[0].MAC != "00:11:22:33:44:55" || switches[1].MAC != "00:11:22:33:44:66" {
+		t.Error("switches should be sorted by MAC:", switches)
+	}
+
+	err = m.Switch.Delete(ctx, "00:11:22:33:44:55")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLog(t, m, sabakan.AuditSwitches, "00:11:22:33:44:55", "delete")
+	err = m.Switch.Delete(ctx, "00:11:22:33:44:55")
+	if err != sabakan.ErrNotFound {
+		t.Error("Delete should return ErrNotFound:", err)
+	}
+	switches, err = m.Switch.GetAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(switches) != 1 {
+		t.Error("switch is not deleted:", switches)
+	}
+}
+
+func testWebhook(t *testing.T, m sabakan.Model) {
+	ctx := context.Background()
+
+	_, err := m.Webhook.Get(ctx, "hook1")
+	if err != sabakan.ErrNotFound {
+		t.Error("Get should return ErrNotFound:", err)
+	}
+
+	hook := &sabakan.Webhook{
+		Name:       "hook1",
+		URL:        "http://localhost:1/hook",
+		Categories: []sabakan.AuditCategory{sabakan.AuditMachines},
+		Actions:    []string{"set-state"},
+		Secret:     "very-secret",
+	}
+	err = m.Webhook.Put(ctx, hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := expectLog(t, m, sabakan.AuditWebhooks, "hook1", "put")
+	if strings.Contains(a.Detail, "very-secret") {
+		t.Error("secret should not be recorded:", a.Detail)
+	}
+
+	got, err := m.Webhook.Get(ctx, "hook1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.URL != hook.URL || got.Secret != hook.Secret ||
+		len(got.Categories) != 1 || got.Categories[0] != sabakan.AuditMachines ||
+		len(got.Actions) != 1 || got.Actions[0] != "set-state" {
+		t.Error("unexpected webhook:", got)
+	}
+
+	err = m.Webhook.Put(ctx, &sabakan.Webhook{Name: "hook0", URL: "http://localhost:1/hook0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hooks, err := m.Webhook.GetAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hooks) != 2 || hooks[0].Name != "hook0" || hooks[1].Name != "hook1" {
+		t.Error("webhooks should be sorted by name:", hooks)
+	}
+
+	err = m.Webhook.Delete(ctx, "hook1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLog(t, m, sabakan.AuditWebhooks, "hook1", "delete")
+	err = m.Webhook.Delete(ctx, "hook1")
+	if err != sabakan.ErrNotFound {
+		t.Error("Delete should return ErrNotFound:", err)
+	}
+	_, err = m.Webhook.Get(ctx, "hook1")
+	if err != sabakan.ErrNotFound {
+		t.Error("deleted webhook should not be found:", err)
+	}
+}
@@ -0,0 +1,32 @@
+package sabakan
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// ObjectStore is an object storage shared by sabakan servers.
+//
+// If configured, assets and images are stored in the object storage
+// instead of the data directory of each server.
+type ObjectStore interface {
+	// Put stores the contents read from r as key.
+	// If the object exists, it is replaced.
+	Put(ctx context.Context, key string, r io.Reader) error
+
+	// Size returns the byte size of the object.
+	// This returns ErrNotFound if the object does not exist.
+	Size(ctx context.Context, key string) (int64, error)
+
+	// Open opens the object for reading.
+	// This returns ErrNotFound if the object does not exist.
+	Open(ctx context.Context, key string) (io.ReadSeekCloser, error)
+
+	// Delete removes the object.  Deleting a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+
+	// URL returns a URL to download the object without credentials.
+	// The URL expires after expires.
+	URL(key string, expires time.Duration) (string, error)
+}
@@ -0,0 +1,487 @@
+// Package objectstore implements sabakan.ObjectStore.
+package objectstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+const (
+	s3Algorithm       = "AWS4-HMAC-SHA256"
+	s3TimeFormat      = "20060102T150405Z"
+	s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+	// s3PartSize is the size of parts of multipart uploads.
+	// Objects smaller than this are uploaded by a single request.
+	s3PartSize = 16 << 20
+)
+
+// S3Config is the configuration of S3.
+type S3Config struct {
+	// Endpoint is the URL of the S3-compatible API such as
+	// "https://s3.ap-northeast-1.amazonaws.com" or "http://minio:9000".
+	Endpoint string
+
+	// Region is the region of the bucket.  Default is "us-east-1".
+	Region string
+
+	// Bucket is the name of the bucket.
+	Bucket string
+
+	// Prefix is prepended to keys of objects.
+	Prefix string
+
+	AccessKeyID     string
+	SecretAccessKey string
+
+	// Client is used to send requests.  Default is http.DefaultClient.
+	Client *http.Client
+}
+
+// S3 is a sabakan.ObjectStore on an S3-compatible API.
+//
+// Requests are signed with AWS Signature Version 4 and sent in the
+// path style, i.e. ENDPOINT/BUCKET/KEY.
+type S3 struct {
+	endpoint *url.URL
+	region   string
+	bucket   string
+	prefix   string
+	keyID    string
+	secret   string
+	client   *http.Client
+	partSize int
+}
+
+// NewS3 creates S3.
+func NewS3(cfg S3Config) (*S3, error) {
+	u, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.New("invalid S3 endpoint: " + cfg.Endpoint)
+	}
+	if cfg.Bucket == "" {
+		return nil, errors.New("no S3 bucket")
+	}
+	if cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return nil, errors.New("no S3 credentials")
+	}
+
+	s := &S3{
+		endpoint: u,
+		region:   cfg.Region,
+		bucket:   cfg.Bucket,
+		prefix:   cfg.Prefix,
+		keyID:    cfg.AccessKeyID,
+		secret:   cfg.SecretAccessKey,
+		client:   cfg.Client,
+		partSize: s3PartSize,
+	}
+	if s.region == "" {
+		s.region = "us-east-1"
+	}
+	if s.client == nil {
+		s.client = http.DefaultClient
+	}
+	return s, nil
+}
+
+// s3Escape percent-encodes s as required by Signature Version 4.
+func s3Escape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func s3CanonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var params []string
+	for _, k := range keys {
+		values := append([]string(nil), q[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			params = append(params, s3Escape(k, true)+"="+s3Escape(v, true))
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+func hashHex(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func (s *S3) objectURL(key string, q url.Values) *url.URL {
+	u := *s.endpoint
+	p := strings.TrimSuffix(u.Path, "/") + "/" + s.bucket + "/" + s.prefix + key
+	u.Path = p
+	u.RawPath = s3Escape(p, false)
+	u.RawQuery = s3CanonicalQuery(q)
+	return &u
+}
+
+func (s *S3) scope(now time.Time) string {
+	return now.UTC().Format("20060102") + "/" + s.region + "/s3/aws4_request"
+}
+
+func (s *S3) signature(now time.Time, canonicalRequest string) string {
+	stringToSign := strings.Join([]string{
+		s3Algorithm,
+		now.UTC().Format(s3TimeFormat),
+		s.scope(now),
+		hashHex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secret), now.UTC().Format("20060102"))
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// sign adds the Authorization header to req.  All headers in req.Header
+// and Host are signed.
+func (s *S3) sign(req *http.Request, payloadHash string, now time.Time) {
+	req.Header.Set("X-Amz-Date", now.UTC().Format(s3TimeFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.keyID, s.scope(now), signedHeaders, s.signature(now, canonicalRequest)))
+}
+
+// presign returns u with the query string authentication for GET.
+func (s *S3) presign(u *url.URL, expires time.Duration, now time.Time) string {
+	q := u.Query()
+	q.Set("X-Amz-Algorithm", s3Algorithm)
+	q.Set("X-Amz-Credential", s.keyID+"/"+s.scope(now))
+	q.Set("X-Amz-Date", now.UTC().Format(s3TimeFormat))
+	q.Set("X-Amz-Expires", strconv.Itoa(int(expires.Seconds())))
+	q.Set("X-Amz-SignedHeaders", "host")
+	query := s3CanonicalQuery(q)
+
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet,
+		u.EscapedPath(),
+		query,
+		"host:" + u.Host + "\n",
+		"host",
+		s3UnsignedPayload,
+	}, "\n")
+
+	signed := *u
+	signed.RawQuery = query + "&X-Amz-Signature=" + s.signature(now, canonicalRequest)
+	return signed.String()
+}
+
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// do sends a signed request.  If the response status is not 2xx,
+// the response is closed and an error is returned.
+func (s *S3) do(ctx context.Context, method, key string, q url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u := s.objectURL(key, q)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.URL = u
+	req.ContentLength = int64(len(body))
+	if body == nil {
+		req.Body = http.NoBody
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	s.sign(req, hashHex(body), time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound && (method == http.MethodGet || method == http.MethodHead) {
+		return nil, sabakan.ErrNotFound
+	}
+	e := new(s3Error)
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	xml.Unmarshal(data, e)
+	return nil, fmt.Errorf("s3: %s %s: %d %s: %s", method, key, resp.StatusCode, e.Code, e.Message)
+}
+
+type s3InitiateResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+type s3Part struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type s3CompleteUpload struct {
+	XMLName xml.Name `xml:"CompleteMultipartUpload"`
+	Parts   []s3Part `xml:"Part"`
+}
+
+func (s *S3) uploadPart(ctx context.Context, key, uploadID string, num int, data []byte) (string, error) {
+	q := url.Values{"partNumber": {strconv.Itoa(num)}, "uploadId": {uploadID}}
+	resp, err := s.do(ctx, http.MethodPut, key, q, nil, data)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return resp.Header.Get("ETag"), nil
+}
+
+func (s *S3) putMultipart(ctx context.Context, key string, r io.Reader, buf []byte) error {
+	resp, err := s.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil, nil)
+	if err != nil {
+		return err
+	}
+	result := new(s3InitiateResult)
+	err = xml.NewDecoder(resp.Body).Decode(result)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	abort := func() {
+		resp, err := s.do(context.WithoutCancel(ctx), http.MethodDelete, key, url.Values{"uploadId": {result.UploadID}}, nil, nil)
+		if err == nil {
+			resp.Body.Close()
+		}
+	}
+
+	var parts []s3Part
+	n := len(buf)
+	for {
+		etag, err := s.uploadPart(ctx, key, result.UploadID, len(parts)+1, buf[:n])
+		if err != nil {
+			abort()
+			return err
+		}
+		parts = append(parts, s3Part{PartNumber: len(parts) + 1, ETag: etag})
+
+		n, err = io.ReadFull(r, buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			abort()
+			return err
+		}
+	}
+
+	body, err := xml.Marshal(s3CompleteUpload{Parts: parts})
+	if err != nil {
+		abort()
+		return err
+	}
+	resp, err = s.do(ctx, http.MethodPost, key, url.Values{"uploadId": {result.UploadID}}, nil, body)
+	if err != nil {
+		abort()
+		return err
+	}
+	defer resp.Body.Close()
+
+	// CompleteMultipartUpload may fail after returning 200 OK.
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var root struct {
+		XMLName xml.Name
+		s3Error
+	}
+	if xml.Unmarshal(data, &root) == nil && root.XMLName.Local == "Error" {
+		abort()
+		return fmt.Errorf("s3: complete %s: %s: %s", key, root.Code, root.Message)
+	}
+	return nil
+}
+
+// Put implements sabakan.ObjectStore.
+//
+// Large objects are uploaded in parts so that the size need not be known.
+func (s *S3) Put(ctx context.Context, key string, r io.Reader) error {
+	buf := make([]byte, s.partSize)
+	n, err := io.ReadFull(r, buf)
+	switch err {
+	case nil:
+		return s.putMultipart(ctx, key, r, buf)
+	case io.EOF, io.ErrUnexpectedEOF:
+	default:
+		return err
+	}
+
+	resp, err := s.do(ctx, http.MethodPut, key, nil, nil, buf[:n])
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Size implements sabakan.ObjectStore.
+func (s *S3) Size(ctx context.Context, key string) (int64, error) {
+	resp, err := s.do(ctx, http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.ContentLength, nil
+}
+
+// Open implements sabakan.ObjectStore.
+//
+// The returned reader sends a ranged GET request for each seek.
+func (s *S3) Open(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	size, err := s.Size(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return &s3Reader{ctx: ctx, s: s, key: key, size: size}, nil
+}
+
+// Delete implements sabakan.ObjectStore.
+func (s *S3) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// URL implements sabakan.ObjectStore.  The URL is a pre-signed URL.
+func (s *S3) URL(key string, expires time.Duration) (string, error) {
+	return s.presign(s.objectURL(key, nil), expires, time.Now()), nil
+}
+
+type s3Reader struct {
+	ctx    context.Context
+	s      *S3
+	key    string
+	size   int64
+	offset int64
+	body   io.ReadCloser
+}
+
+func (r *s3Reader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.body == nil {
+		header := http.Header{"Range": {fmt.Sprintf("bytes=%d-", r.offset)}}
+		resp, err := r.s.do(r.ctx, http.MethodGet, r.key, nil, header, nil)
+		if err != nil {
+			return 0, err
+		}
+		r.body = resp.Body
+	}
+
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	if err == io.EOF && r.offset < r.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (r *s3Reader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative offset")
+	}
+
+	if offset != r.offset && r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *s3Reader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
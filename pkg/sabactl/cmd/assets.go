@@ -3,6 +3,7 @@ package cmd
 import (
 	"context"
 	"encoding/json"
+	"strconv"
 
 	"github.com/cybozu-go/well"
 	"github.com/spf13/cobra"
@@ -99,6 +100,59 @@ var assetsDeleteCmd = &cobra.Command{
 	},
 }
 
+var assetsHistoryCmd = &cobra.Command{
+	Use:   "history NAME",
+	Short: "show versions of the asset",
+	Long: `Show versions of the asset registered in sabakan.
+
+The current version comes first, followed by previous versions
+that can be restored by "sabactl assets rollback".`,
+	Args: cobra.ExactArgs(1),
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		well.Go(func(ctx context.Context) error {
+			info, err := httpApi.AssetsInfo(ctx, name)
+			if err != nil {
+				return err
+			}
+
+			e := json.NewEncoder(cmd.OutOrStdout())
+			e.SetIndent("", "  ")
+			return e.Encode(info.Versions())
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+var assetsRollbackCmd = &cobra.Command{
+	Use:   "rollback NAME ID",
+	Short: "restore a previous version of the asset",
+	Long:  `Make a previous version of the asset current.`,
+	Args:  cobra.ExactArgs(2),
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			return err
+		}
+		well.Go(func(ctx context.Context) error {
+			st, err := httpApi.AssetsRollback(ctx, name, id)
+			if err != nil {
+				return err
+			}
+
+			e := json.NewEncoder(cmd.OutOrStdout())
+			e.SetIndent("", "  ")
+			return e.Encode(st)
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
 func init() {
 	assetsUploadCmd.Flags().StringToStringVar(&assetsUploadMeta, "meta", nil, "Additional metadata for the assets as <KEY1>=<VALUE1>,<KEY2>=<VALUE2>,...")
 
@@ -106,5 +160,7 @@ func init() {
 	assetsCmd.AddCommand(assetsInfoCmd)
 	assetsCmd.AddCommand(assetsUploadCmd)
 	assetsCmd.AddCommand(assetsDeleteCmd)
+	assetsCmd.AddCommand(assetsHistoryCmd)
+	assetsCmd.AddCommand(assetsRollbackCmd)
 	rootCmd.AddCommand(assetsCmd)
 }
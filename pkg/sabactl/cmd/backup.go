@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/cybozu-go/sabakan/v3"
+	"github.com/cybozu-go/well"
+	"github.com/spf13/cobra"
+)
+
+var backupOpts struct {
+	cryptKeys      string
+	passphraseFile string
+}
+
+var restorePassphraseFile string
+
+func readPassphrase(file string) (string, error) {
+	if file == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+var backupCmd = &cobra.Command{
+	Use:   "backup FILE",
+	Short: "back up sabakan",
+	Long: `Save machines, configurations, ignition templates, assets, and images
+to FILE as a backup archive.
+
+Disk encryption keys are excluded unless --crypt-keys is "plain" or
+"encrypted".  Encrypted keys are protected with the passphrase in
+--passphrase-file.`,
+	Args: cobra.ExactArgs(1),
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		passphrase, err := readPassphrase(backupOpts.passphraseFile)
+		if err != nil {
+			return err
+		}
+		opts := &sabakan.BackupOptions{
+			CryptKeys:  backupOpts.cryptKeys,
+			Passphrase: passphrase,
+		}
+		err = opts.Validate()
+		if err != nil {
+			return err
+		}
+
+		// the archive may contain disk encryption keys
+		f, err := os.OpenFile(args[0], os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		well.Go(func(ctx context.Context) error {
+			err := httpApi.Backup(ctx, opts, f)
+			if err != nil {
+				return err
+			}
+			return f.Sync()
+		})
+		well.Stop()
+		err = well.Wait()
+		if err != nil {
+			os.Remove(args[0])
+		}
+		return err
+	},
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore FILE",
+	Short: "restore sabakan from a backup",
+	Long: `Restore sabakan from a backup archive created by "sabactl backup".
+
+Sabakan must be empty, that is, no machines, configurations, assets,
+or images must exist.  The schema version of the backup must match
+the running sabakan.`,
+	Args: cobra.ExactArgs(1),
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		passphrase, err := readPassphrase(restorePassphraseFile)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		well.Go(func(ctx context.Context) error {
+			return httpApi.Restore(ctx, f, passphrase)
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+func init() {
+	backupCmd.Flags().StringVar(&backupOpts.cryptKeys, "crypt-keys", sabakan.BackupKeysExclude, "how to save disk encryption keys: exclude, plain, or encrypted")
+	backupCmd.Flags().StringVar(&backupOpts.passphraseFile, "passphrase-file", "", "file containing the passphrase to encrypt keys")
+	restoreCmd.Flags().StringVar(&restorePassphraseFile, "passphrase-file", "", "file containing the passphrase to decrypt keys")
+
+	rootCmd.AddCommand(backupCmd)
+	rootCmd.AddCommand(restoreCmd)
+}
@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+
+	"github.com/cybozu-go/sabakan/v3"
+	"github.com/cybozu-go/well"
+	"github.com/spf13/cobra"
+)
+
+var cryptPoliciesFile string
+
+var cryptPoliciesCmd = &cobra.Command{
+	Use:   "crypt-policies",
+	Short: "manage disk encryption policies",
+	Long: `Manage disk encryption policies for sabakan-cryptsetup.
+
+KIND is either "role" or "machine".  NAME is the role or the serial
+of the machine.  The policy for a machine takes precedence over the
+policy for its role.`,
+	RunE: dummyRunFunc,
+}
+
+func cryptPolicyArgs(cmd *cobra.Command, args []string) error {
+	if err := cobra.ExactArgs(2)(cmd, args); err != nil {
+		return err
+	}
+	if !sabakan.IsValidCryptPolicyKind(args[0]) {
+		return errors.New("invalid kind: " + args[0])
+	}
+	return nil
+}
+
+func printCryptPolicy(cmd *cobra.Command, policy *sabakan.CryptPolicy) error {
+	enc := json.NewEncoder(cmd.OutOrStdout())
+	enc.SetIndent("", "  ")
+	return enc.Encode(policy)
+}
+
+var cryptPoliciesGetCmd = &cobra.Command{
+	Use:   "get KIND NAME",
+	Short: "get a disk encryption policy",
+	Long:  `Show the disk encryption policy for a role or a machine.`,
+	Args:  cryptPolicyArgs,
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		well.Go(func(ctx context.Context) error {
+			policy, err := httpApi.CryptPoliciesGet(ctx, args[0], args[1])
+			if err != nil {
+				return err
+			}
+			return printCryptPolicy(cmd, policy)
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+var cryptPoliciesSetCmd = &cobra.Command{
+	Use:   "set -f FILE KIND NAME",
+	Short: "set a disk encryption policy",
+	Long:  `Set the disk encryption policy for a role or a machine from FILE.`,
+	Args:  cryptPolicyArgs,
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		f, err := os.Open(cryptPoliciesFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		policy := new(sabakan.CryptPolicy)
+		err = json.NewDecoder(f).Decode(policy)
+		if err != nil {
+			return err
+		}
+		err = policy.Validate()
+		if err != nil {
+			return err
+		}
+
+		well.Go(func(ctx context.Context) error {
+			return httpApi.CryptPoliciesSet(ctx, args[0], args[1], policy)
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+var cryptPoliciesDeleteCmd = &cobra.Command{
+	Use:   "delete KIND NAME",
+	Short: "delete a disk encryption policy",
+	Long:  `Delete the disk encryption policy for a role or a machine.`,
+	Args:  cryptPolicyArgs,
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		well.Go(func(ctx context.Context) error {
+			return httpApi.CryptPoliciesDelete(ctx, args[0], args[1])
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+var cryptPoliciesEffectiveCmd = &cobra.Command{
+	Use:   "effective SERIAL",
+	Short: "show the disk encryption policy applied to a machine",
+	Long: `Show the disk encryption policy applied to a machine.
+
+This is the policy for the machine if exists, or the policy for its role.`,
+	Args: cobra.ExactArgs(1),
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		well.Go(func(ctx context.Context) error {
+			policy, err := httpApi.CryptPoliciesResolve(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			return printCryptPolicy(cmd, policy)
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+func init() {
+	cryptPoliciesSetCmd.Flags().StringVarP(&cryptPoliciesFile, "file", "f", "", "disk encryption policy in json")
+	cryptPoliciesSetCmd.MarkFlagRequired("file")
+
+	cryptPoliciesCmd.AddCommand(cryptPoliciesGetCmd)
+	cryptPoliciesCmd.AddCommand(cryptPoliciesSetCmd)
+	cryptPoliciesCmd.AddCommand(cryptPoliciesDeleteCmd)
+	cryptPoliciesCmd.AddCommand(cryptPoliciesEffectiveCmd)
+	rootCmd.AddCommand(cryptPoliciesCmd)
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 
 	"github.com/cybozu-go/well"
@@ -11,12 +12,41 @@ import (
 var cryptsDeleteForce bool
 
 var cryptsCmd = &cobra.Command{
-	Use:   "crypts delete",
+	Use:   "crypts",
 	Short: "manage disk encryption key",
 	Long:  `Manage disk encryption key of the machines.`,
 	RunE:  dummyRunFunc,
 }
 
+var cryptsListCmd = &cobra.Command{
+	Use:   "list [SERIAL]",
+	Short: "list encryption keys",
+	Long: `List meta data of disk encryption keys.
+
+If SERIAL is not given, this command lists keys of all machines.
+Key material is not shown.`,
+	Args: cobra.MaximumNArgs(1),
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var serial string
+		if len(args) == 1 {
+			serial = args[0]
+		}
+		well.Go(func(ctx context.Context) error {
+			infos, err := httpsApi.CryptsList(ctx, serial)
+			if err != nil {
+				return err
+			}
+
+			enc := json.NewEncoder(cmd.OutOrStdout())
+			enc.SetIndent("", "  ")
+			return enc.Encode(infos)
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
 var cryptsDeleteCmd = &cobra.Command{
 	Use:   "delete --force SERIAL",
 	Short: "delete all encryption keys of a machine",
@@ -39,6 +69,7 @@ var cryptsDeleteCmd = &cobra.Command{
 func init() {
 	cryptsDeleteCmd.Flags().BoolVar(&cryptsDeleteForce, "force", false, "forces the removal of the disk encryption key")
 
+	cryptsCmd.AddCommand(cryptsListCmd)
 	cryptsCmd.AddCommand(cryptsDeleteCmd)
 	rootCmd.AddCommand(cryptsCmd)
 }
@@ -64,11 +64,33 @@ var dhcpSetCmd = &cobra.Command{
 	},
 }
 
+var dhcpTraceCmd = &cobra.Command{
+	Use:   "trace MAC",
+	Short: "show recent DHCP transactions",
+	Long:  `Show recent DHCP transactions of a client having MAC address.`,
+	Args:  cobra.ExactArgs(1),
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		well.Go(func(ctx context.Context) error {
+			traces, err := httpApi.DHCPTrace(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			e := json.NewEncoder(cmd.OutOrStdout())
+			e.SetIndent("", "  ")
+			return e.Encode(traces)
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
 func init() {
 	dhcpSetCmd.Flags().StringVarP(&dhcpConfigFile, "file", "f", "", "DHCP configuration in json")
 	dhcpSetCmd.MarkFlagRequired("file")
 
 	dhcpCmd.AddCommand(dhcpGetCmd)
 	dhcpCmd.AddCommand(dhcpSetCmd)
+	dhcpCmd.AddCommand(dhcpTraceCmd)
 	rootCmd.AddCommand(dhcpCmd)
 }
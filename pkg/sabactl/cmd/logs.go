@@ -3,9 +3,14 @@ package cmd
 import (
 	"bytes"
 	"context"
+	"crypto/ed25519"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
+	"os"
 	"strings"
 	"time"
 
@@ -17,10 +22,14 @@ import (
 var (
 	newline = []byte("\n")
 
-	logsJSON bool
+	logsJSON  bool
+	logsDiff  bool
+	logsQuery sabakan.LogQuery
+
+	logsVerifyPublicKey string
 )
 
-func ppLog(line []byte, w io.Writer) error {
+func ppLog(line []byte, w io.Writer, diff bool) error {
 	a := new(sabakan.AuditLog)
 	err := json.Unmarshal(line, a)
 	if err != nil {
@@ -28,6 +37,16 @@ func ppLog(line []byte, w io.Writer) error {
 	}
 
 	ts := a.Timestamp.Format("Jan 02 15:04:05.000")
+	changes, isDiff := sabakan.ParseAuditDiff(a.Detail)
+	if diff && isDiff {
+		_, err = fmt.Fprintf(w, "%s %s@%s %s/%s %s\n",
+			ts, a.User, a.IP, string(a.Category), a.Instance, a.Action)
+		if err != nil {
+			return err
+		}
+		return ppDiff(changes, w)
+	}
+
 	detail := strings.Replace(a.Detail, "\n", " ", -1)
 	if len(detail) > 20 {
 		detail = detail[:20]
@@ -37,9 +56,35 @@ func ppLog(line []byte, w io.Writer) error {
 	return err
 }
 
+// ppDiff prints changes like "~ /path: old -> new".
+// Added values are prefixed with "+", and removed ones with "-".
+func ppDiff(changes []sabakan.AuditChange, w io.Writer) error {
+	for _, c := range changes {
+		path := c.Path
+		if path == "" {
+			path = "/"
+		}
+
+		var err error
+		switch {
+		case c.Old == nil:
+			_, err = fmt.Fprintf(w, "    + %s: %s\n", path, c.New)
+		case c.New == nil:
+			_, err = fmt.Fprintf(w, "    - %s: %s\n", path, c.Old)
+		default:
+			_, err = fmt.Fprintf(w, "    ~ %s: %s -> %s\n", path, c.Old, c.New)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 type logPrinter struct {
-	w   io.Writer
-	buf bytes.Buffer
+	w    io.Writer
+	diff bool
+	buf  bytes.Buffer
 }
 
 func (lp *logPrinter) Write(data []byte) (int, error) {
@@ -54,7 +99,7 @@ func (lp *logPrinter) Write(data []byte) (int, error) {
 		if err != nil {
 			return n, err
 		}
-		err = ppLog(line, lp.w)
+		err = ppLog(line, lp.w, lp.diff)
 		if err != nil {
 			return n, err
 		}
@@ -63,44 +108,153 @@ func (lp *logPrinter) Write(data []byte) (int, error) {
 	return n, nil
 }
 
+// parseLogDates parses START_DATE and END_DATE arguments.
+func parseLogDates(args []string) (since, until time.Time, err error) {
+	switch len(args) {
+	case 0:
+		// pass
+	case 2:
+		until, err = time.Parse("20060102", args[1])
+		if err != nil {
+			return
+		}
+		fallthrough
+	case 1:
+		since, err = time.Parse("20060102", args[0])
+		if err != nil {
+			return
+		}
+		if until.IsZero() {
+			until = since.Add(24 * time.Hour)
+		}
+	}
+	return
+}
+
+func loadPublicKey(file string) (ed25519.PublicKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data in " + file)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.New("not an Ed25519 public key: " + file)
+	}
+	return pub, nil
+}
+
 var logsCmd = &cobra.Command{
-	Use:   "logs [--json] [START_DATE] [END_DATE}",
+	Use:   "logs [--json|--diff] [START_DATE] [END_DATE]",
 	Short: "retrieve logs",
 	Long: `If START_DATE is given, and END_DATE is NOT given, logs
 of START_DATE are retrieved.
 
 If both of START_DATE and END_DATE are given, logs between them
-are retrieved.`,
+are retrieved.
+
+Logs can be filtered by --category, --instance, --action, --user, and --ip.
+For example, the history of a machine can be retrieved by:
+
+	sabactl logs --category machines --instance SERIAL
+
+If --diff is given, changes recorded in logs such as those of
+machines are shown line by line.`,
+	Args: cobra.MaximumNArgs(2),
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		since, until, err := parseLogDates(args)
+		if err != nil {
+			return err
+		}
+		if logsJSON && logsDiff {
+			return errors.New("--json and --diff cannot be specified together")
+		}
+		q := logsQuery
+		q.Since = since
+		q.Until = until
+		err = q.Validate()
+		if err != nil {
+			return err
+		}
+		well.Go(func(ctx context.Context) error {
+			w := cmd.OutOrStdout()
+			if !logsJSON {
+				w = &logPrinter{w: w, diff: logsDiff}
+			}
+			return httpApi.LogsGet(ctx, &q, w)
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+var logsVerifyCmd = &cobra.Command{
+	Use:   "verify [START_DATE] [END_DATE]",
+	Short: "verify the hash chain of logs",
+	Long: `Verify the hash chain of audit logs to detect gaps or modifications.
+
+START_DATE and END_DATE are interpreted as the same as "logs" command.
+If they are not given, all logs in etcd are verified, and the
+first log is anchored to the checkpoint recorded by compaction.
+
+If --public-key is given, signatures of checkpoints are verified.`,
 	Args: cobra.MaximumNArgs(2),
 
 	RunE: func(cmd *cobra.Command, args []string) error {
-		var since, until time.Time
-		switch len(args) {
-		case 0:
-			// pass
-		case 2:
-			t, err := time.Parse("20060102", args[1])
+		since, until, err := parseLogDates(args)
+		if err != nil {
+			return err
+		}
+		var pub ed25519.PublicKey
+		if logsVerifyPublicKey != "" {
+			pub, err = loadPublicKey(logsVerifyPublicKey)
 			if err != nil {
 				return err
 			}
-			until = t
-			fallthrough
-		case 1:
-			t, err := time.Parse("20060102", args[0])
+		}
+
+		well.Go(func(ctx context.Context) error {
+			// retrieve the chain first not to regard new logs as missing
+			chain, err := httpApi.LogsChain(ctx)
 			if err != nil {
 				return err
 			}
-			since = t
-			if until.IsZero() {
-				until = t.Add(24 * time.Hour)
+
+			buf := new(bytes.Buffer)
+			err = httpApi.LogsGet(ctx, &sabakan.LogQuery{Since: since, Until: until}, buf)
+			if err != nil {
+				return err
 			}
-		}
-		well.Go(func(ctx context.Context) error {
-			w := cmd.OutOrStdout()
-			if !logsJSON {
-				w = &logPrinter{w: w}
+			var logs []*sabakan.AuditLog
+			dec := json.NewDecoder(buf)
+			for dec.More() {
+				a := new(sabakan.AuditLog)
+				err = dec.Decode(a)
+				if err != nil {
+					return err
+				}
+				logs = append(logs, a)
+			}
+
+			r := sabakan.VerifyAuditChain(logs, chain, pub, since.IsZero(), until.IsZero())
+			enc := json.NewEncoder(cmd.OutOrStdout())
+			enc.SetIndent("", "  ")
+			err = enc.Encode(r)
+			if err != nil {
+				return err
 			}
-			return httpApi.LogsGet(ctx, since, until, w)
+			if !r.OK() {
+				return errors.New("audit logs are not consistent")
+			}
+			return nil
 		})
 		well.Stop()
 		return well.Wait()
@@ -109,6 +263,17 @@ are retrieved.`,
 
 func init() {
 	logsCmd.Flags().BoolVar(&logsJSON, "json", false, "show logs in JSON")
+	logsCmd.Flags().BoolVar(&logsDiff, "diff", false, "show changes recorded in logs")
+	logsCmd.Flags().StringVar((*string)(&logsQuery.Category), "category", "", "show logs of the category")
+	logsCmd.Flags().StringVar(&logsQuery.Instance, "instance", "", "show logs of the instance such as serial, asset name, or role")
+	logsCmd.Flags().StringVar(&logsQuery.Action, "action", "", "show logs of the action")
+	logsCmd.Flags().StringVar(&logsQuery.User, "user", "", "show logs of the user")
+	logsCmd.Flags().StringVar(&logsQuery.IP, "ip", "", "show logs from the IP address")
+	logsCmd.Flags().IntVar(&logsQuery.Limit, "limit", 0, "maximum number of logs; 0 means no limit")
+	logsCmd.Flags().StringVar(&logsQuery.Order, "order", sabakan.LogOrderAsc, `order of logs, "asc" or "desc"`)
+
+	logsVerifyCmd.Flags().StringVar(&logsVerifyPublicKey, "public-key", "", "PEM file of Ed25519 public key to verify checkpoints")
 
+	logsCmd.AddCommand(logsVerifyCmd)
 	rootCmd.AddCommand(logsCmd)
 }
@@ -47,12 +47,13 @@ var machinesGetCmd = &cobra.Command{
 			}
 			if machinesGetOutput == "simple" {
 				w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 1, 1, ' ', 0)
-				w.Write([]byte("Serial\tRack\tRole\tState\tIPv4\tBMC\n"))
+				w.Write([]byte("Serial\tRack\tRole\tState\tIPv4\tBMC\tBootLoop\n"))
 				for _, m := range ms {
+					bootLoop := m.Spec.Labels[sabakan.LabelBootLoop]
 					if len(m.Spec.IPv4) > 0 {
-						w.Write([]byte(fmt.Sprintf("%v\t%v\t%v\t%v\t%v\t%v\t\n", m.Spec.Serial, m.Spec.Rack, m.Spec.Role, m.Status.State, m.Spec.IPv4[0], m.Spec.BMC.Type)))
+						w.Write([]byte(fmt.Sprintf("%v\t%v\t%v\t%v\t%v\t%v\t%v\t\n", m.Spec.Serial, m.Spec.Rack, m.Spec.Role, m.Status.State, m.Spec.IPv4[0], m.Spec.BMC.Type, bootLoop)))
 					} else {
-						w.Write([]byte(fmt.Sprintf("%v\t%v\t%v\t%v\t%v\t%v\t\n", m.Spec.Serial, m.Spec.Rack, m.Spec.Role, m.Status.State, m.Spec.IPv6[0], m.Spec.BMC.Type)))
+						w.Write([]byte(fmt.Sprintf("%v\t%v\t%v\t%v\t%v\t%v\t%v\t\n", m.Spec.Serial, m.Spec.Rack, m.Spec.Role, m.Status.State, m.Spec.IPv6[0], m.Spec.BMC.Type, bootLoop)))
 					}
 				}
 				return w.Flush()
@@ -215,6 +216,7 @@ func init() {
 		"labels":           "Label name and value (--labels key=val,...)",
 		"ipv4":             "IPv4 address(s) (--ipv4 10.0.0.1,10.0.0.2,10.0.0.3...)",
 		"ipv6":             "IPv6 address(s) (--ipv6 aa::ff,bb::ff,cc::ff...)",
+		"mac":              "MAC address(s) (--mac 00:11:22:33:44:55,...)",
 		"bmc-type":         "BMC type(s) (--bmc-type iDRAC-9,IPMI-2.0...)",
 		"state":            "State(s) (--state retiring,uninitialized...)",
 		"without-serial":   "without Serial name",
@@ -223,6 +225,7 @@ func init() {
 		"without-labels":   "without Label name and value (--labels key=val,...)",
 		"without-ipv4":     "without IPv4 address",
 		"without-ipv6":     "without IPv6 address",
+		"without-mac":      "without MAC address",
 		"without-bmc-type": "without BMC type",
 		"without-state":    "without State",
 	}
@@ -1,7 +1,6 @@
 package cmd
 
 import (
-	"crypto/tls"
 	"fmt"
 	"net/http"
 	"os"
@@ -17,6 +16,9 @@ var (
 	flagServer    string
 	flagTLSServer string
 	flagInsecure  bool
+	flagTLSCert   string
+	flagTLSKey    string
+	flagToken     string
 	httpApi       *client.Client
 	httpsApi      *client.Client
 )
@@ -69,23 +71,36 @@ var rootCmd = &cobra.Command{
 			return err
 		}
 
-		httpApi, err = client.NewClient(flagServer, &http.Client{})
-		if err != nil {
-			return err
-		}
-		httpsApi, err = client.NewClient(flagTLSServer, &http.Client{
-			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{
-					InsecureSkipVerify: flagInsecure,
-				},
-			},
-		})
-		if err != nil {
-			return err
-		}
+		return setupClients()
+	},
+}
+
+// setupClients creates clients for the HTTP and HTTPS servers.
+func setupClients() error {
+	tlsConfig, err := client.NewTLSConfig(flagTLSCert, flagTLSKey, flagInsecure)
+	if err != nil {
+		return err
+	}
+	httpsApi, err = client.NewClient(flagTLSServer, &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: tlsConfig,
+		},
+	})
+	if err != nil {
+		return err
+	}
 
+	httpsApi.SetToken(flagToken)
+
+	// With a client certificate or a token, all requests go to the TLS
+	// server so that the server can authenticate the user.  Tokens are
+	// never sent to the HTTP server in cleartext.
+	if flagTLSCert != "" || flagToken != "" {
+		httpApi = httpsApi
 		return nil
-	},
+	}
+	httpApi, err = client.NewClient(flagServer, &http.Client{})
+	return err
 }
 
 // Execute executes sabactl
@@ -117,4 +132,7 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&flagServer, "server", "http://localhost:10080", "<Listen IP>:<Port number>")
 	rootCmd.PersistentFlags().StringVar(&flagTLSServer, "tls-server", "https://localhost:10443", "<Listen IP>:<Port number>")
 	rootCmd.PersistentFlags().BoolVar(&flagInsecure, "insecure", false, "Disable TLS verification")
+	rootCmd.PersistentFlags().StringVar(&flagTLSCert, "tls-cert", "", "Client certificate to authenticate to TLS server")
+	rootCmd.PersistentFlags().StringVar(&flagTLSKey, "tls-key", "", "Client key to authenticate to TLS server")
+	rootCmd.PersistentFlags().StringVar(&flagToken, "token", os.Getenv("SABAKAN_TOKEN"), "Bearer token to authenticate to sabakan")
 }
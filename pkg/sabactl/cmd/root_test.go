@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestSetupClients(t *testing.T) {
+	var mu sync.Mutex
+	var plainAuth, tlsAuth []string
+	handler := func(auth *[]string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			*auth = append(*auth, r.Header.Get("Authorization"))
+			mu.Unlock()
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte("{}"))
+		})
+	}
+	plain := httptest.NewServer(handler(&plainAuth))
+	defer plain.Close()
+	secure := httptest.NewTLSServer(handler(&tlsAuth))
+	defer secure.Close()
+
+	flagServer = plain.URL
+	flagTLSServer = secure.URL
+	flagInsecure = true
+	flagToken = "secret"
+	defer func() {
+		flagToken = ""
+	}()
+
+	err := setupClients()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	_, err = httpApi.IPAMConfigGet(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = httpsApi.IPAMConfigGet(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(plainAuth) != 0 {
+		t.Error("requests with a token should not go to the HTTP server:", plainAuth)
+	}
+	if len(tlsAuth) != 2 || tlsAuth[0] != "Bearer secret" || tlsAuth[1] != "Bearer secret" {
+		t.Error("token should be sent to the HTTPS server:", tlsAuth)
+	}
+
+	// without a token, requests go to the HTTP server
+	flagToken = ""
+	err = setupClients()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = httpApi.IPAMConfigGet(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range plainAuth {
+		if a != "" {
+			t.Error("Authorization header should not be sent to the HTTP server:", a)
+		}
+	}
+	if len(plainAuth) != 1 {
+		t.Error("request without a token should go to the HTTP server:", plainAuth)
+	}
+}
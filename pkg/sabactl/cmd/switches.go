@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/cybozu-go/sabakan/v3"
+	"github.com/cybozu-go/well"
+	"github.com/spf13/cobra"
+)
+
+var switchesSetOpts struct {
+	name      string
+	installer string
+	script    string
+}
+
+var switchesCmd = &cobra.Command{
+	Use:   "switches",
+	Short: "manage switches",
+	Long:  `Manage network switches provisioned by ONIE or ZTP.`,
+	RunE:  dummyRunFunc,
+}
+
+var switchesGetCmd = &cobra.Command{
+	Use:   "get [MAC]",
+	Short: "get switches",
+	Long: `If MAC is not given, this command lists all registered switches.
+If MAC is given, this command shows the switch having the MAC address.`,
+	Args: cobra.MaximumNArgs(1),
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		well.Go(func(ctx context.Context) error {
+			var data interface{}
+			if len(args) == 0 {
+				switches, err := httpApi.SwitchesList(ctx)
+				if err != nil {
+					return err
+				}
+				data = switches
+			} else {
+				sw, err := httpApi.SwitchesGet(ctx, args[0])
+				if err != nil {
+					return err
+				}
+				data = sw
+			}
+
+			enc := json.NewEncoder(cmd.OutOrStdout())
+			enc.SetIndent("", "  ")
+			return enc.Encode(data)
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+var switchesSetCmd = &cobra.Command{
+	Use:   "set MAC",
+	Short: "register or update a switch",
+	Long: `Register or update a switch having MAC address.
+
+--installer is the name of the asset served to ONIE as the NOS installer.
+--script is the name of the asset served to the NOS as the ZTP script.
+At least one of them is required.`,
+	Args: cobra.ExactArgs(1),
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sw := &sabakan.Switch{
+			MAC:       args[0],
+			Name:      switchesSetOpts.name,
+			Installer: switchesSetOpts.installer,
+			Script:    switchesSetOpts.script,
+		}
+		err := sw.Validate()
+		if err != nil {
+			return err
+		}
+
+		well.Go(func(ctx context.Context) error {
+			return httpApi.SwitchesSet(ctx, sw)
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+var switchesDeleteCmd = &cobra.Command{
+	Use:   "delete MAC",
+	Short: "delete a switch",
+	Long:  `Delete a switch having MAC address.`,
+	Args:  cobra.ExactArgs(1),
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		well.Go(func(ctx context.Context) error {
+			return httpApi.SwitchesDelete(ctx, args[0])
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+func init() {
+	switchesSetCmd.Flags().StringVar(&switchesSetOpts.name, "name", "", "name of the switch")
+	switchesSetCmd.Flags().StringVar(&switchesSetOpts.installer, "installer", "", "asset name of the NOS installer")
+	switchesSetCmd.Flags().StringVar(&switchesSetOpts.script, "script", "", "asset name of the ZTP script")
+
+	switchesCmd.AddCommand(switchesGetCmd)
+	switchesCmd.AddCommand(switchesSetCmd)
+	switchesCmd.AddCommand(switchesDeleteCmd)
+	rootCmd.AddCommand(switchesCmd)
+}
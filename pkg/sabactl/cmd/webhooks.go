@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+
+	"github.com/cybozu-go/sabakan/v3"
+	"github.com/cybozu-go/well"
+	"github.com/spf13/cobra"
+)
+
+var webhooksSetOpts struct {
+	url         string
+	categories  []string
+	actions     []string
+	secretFile  string
+	cloudEvents bool
+}
+
+var webhooksCmd = &cobra.Command{
+	Use:   "webhooks",
+	Short: "manage webhooks",
+	Long:  `Manage webhooks that receive audit logs.`,
+	RunE:  dummyRunFunc,
+}
+
+var webhooksGetCmd = &cobra.Command{
+	Use:   "get [NAME]",
+	Short: "get webhooks",
+	Long: `If NAME is not given, this command lists all webhooks.
+If NAME is given, this command shows the webhook.
+
+Secrets of webhooks are not shown.`,
+	Args: cobra.MaximumNArgs(1),
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		well.Go(func(ctx context.Context) error {
+			var data interface{}
+			if len(args) == 0 {
+				hooks, err := httpApi.WebhooksList(ctx)
+				if err != nil {
+					return err
+				}
+				data = hooks
+			} else {
+				hook, err := httpApi.WebhooksGet(ctx, args[0])
+				if err != nil {
+					return err
+				}
+				data = hook
+			}
+
+			enc := json.NewEncoder(cmd.OutOrStdout())
+			enc.SetIndent("", "  ")
+			return enc.Encode(data)
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+var webhooksSetCmd = &cobra.Command{
+	Use:   "set NAME",
+	Short: "register or update a webhook",
+	Long: `Register or update a webhook named NAME.
+
+Audit logs matching --category and --action are POSTed to --url.
+If they are not given, all audit logs are sent.
+
+If --secret-file is given, requests are signed with the secret in the file.
+The secret is not kept when the webhook is updated without --secret-file.`,
+	Args: cobra.ExactArgs(1),
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		hook := &sabakan.Webhook{
+			Name:        args[0],
+			URL:         webhooksSetOpts.url,
+			Actions:     webhooksSetOpts.actions,
+			CloudEvents: webhooksSetOpts.cloudEvents,
+		}
+		for _, c := range webhooksSetOpts.categories {
+			hook.Categories = append(hook.Categories, sabakan.AuditCategory(c))
+		}
+		if webhooksSetOpts.secretFile != "" {
+			data, err := os.ReadFile(webhooksSetOpts.secretFile)
+			if err != nil {
+				return err
+			}
+			hook.Secret = strings.TrimSpace(string(data))
+		}
+		err := hook.Validate()
+		if err != nil {
+			return err
+		}
+
+		well.Go(func(ctx context.Context) error {
+			return httpApi.WebhooksSet(ctx, hook)
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+var webhooksDeleteCmd = &cobra.Command{
+	Use:   "delete NAME",
+	Short: "delete a webhook",
+	Long:  `Delete a webhook named NAME.`,
+	Args:  cobra.ExactArgs(1),
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		well.Go(func(ctx context.Context) error {
+			return httpApi.WebhooksDelete(ctx, args[0])
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+func init() {
+	webhooksSetCmd.Flags().StringVar(&webhooksSetOpts.url, "url", "", "URL to which audit logs are POSTed")
+	webhooksSetCmd.Flags().StringSliceVar(&webhooksSetOpts.categories, "category", nil, "audit log category to be sent")
+	webhooksSetCmd.Flags().StringSliceVar(&webhooksSetOpts.actions, "action", nil, "audit log action to be sent")
+	webhooksSetCmd.Flags().StringVar(&webhooksSetOpts.secretFile, "secret-file", "", "file containing the secret to sign requests")
+	webhooksSetCmd.Flags().BoolVar(&webhooksSetOpts.cloudEvents, "cloudevents", false, "send audit logs in CloudEvents envelopes")
+	webhooksSetCmd.MarkFlagRequired("url")
+
+	webhooksCmd.AddCommand(webhooksGetCmd)
+	webhooksCmd.AddCommand(webhooksSetCmd)
+	webhooksCmd.AddCommand(webhooksDeleteCmd)
+	rootCmd.AddCommand(webhooksCmd)
+}
@@ -36,6 +36,12 @@ func Cryptsetup(d Disk, md *Metadata, ek, tpmKek []byte) error {
 	if err != nil {
 		return err
 	}
+	return CryptsetupKey(d, md, key)
+}
+
+// CryptsetupKey invokes cryptsetup to open crypt device with the
+// disk encryption key.
+func CryptsetupKey(d Disk, md *Metadata, key []byte) error {
 	args := []string{
 		"--hash=plain", "--key-file=-", "--cipher=" + md.Cipher(),
 		"--key-size=" + strconv.Itoa(len(key)*8),
@@ -3,6 +3,7 @@ package cmd
 import (
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -12,14 +13,41 @@ type Disk struct {
 	name       string
 	sectorSize int
 	size512    int64
+	model      string
+	paths      []string
 }
 
 // FindDisks looks up the system to find disks to be encrypted.
 func FindDisks(excludes []string) ([]Disk, error) {
-	return findDisks(excludes, "/sys/block")
+	return findDisks(excludes, "/sys/block", "/dev/disk/by-path")
 }
 
-func findDisks(excludes []string, base string) ([]Disk, error) {
+// findDiskPaths returns a map from disk names to their names in byPath directory.
+func findDiskPaths(byPath string) (map[string][]string, error) {
+	entries, err := os.ReadDir(byPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	paths := make(map[string][]string)
+	for _, e := range entries {
+		target, err := os.Readlink(filepath.Join(byPath, e.Name()))
+		if err != nil {
+			continue
+		}
+		name := filepath.Base(target)
+		paths[name] = append(paths[name], e.Name())
+	}
+	for _, p := range paths {
+		sort.Strings(p)
+	}
+	return paths, nil
+}
+
+func findDisks(excludes []string, base, byPath string) ([]Disk, error) {
 	match := func(name string) (bool, error) {
 		for _, pat := range excludes {
 			ok, err := filepath.Match(pat, name)
@@ -61,13 +89,29 @@ func findDisks(excludes []string, base string) ([]Disk, error) {
 		return strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
 	}
 
+	readString := func(name, flag string) (string, error) {
+		data, err := os.ReadFile(filepath.Join(base, name, flag))
+		if err != nil {
+			if os.IsNotExist(err) {
+				return "", nil
+			}
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+
+	diskPaths, err := findDiskPaths(byPath)
+	if err != nil {
+		return nil, err
+	}
+
 	// non-virtual disks have "device" link.
-	diskPaths, err := filepath.Glob(filepath.Join(base, "*", "device"))
+	devices, err := filepath.Glob(filepath.Join(base, "*", "device"))
 	if err != nil {
 		return nil, err
 	}
-	disks := make([]Disk, 0, len(diskPaths))
-	for _, p := range diskPaths {
+	disks := make([]Disk, 0, len(devices))
+	for _, p := range devices {
 		name := filepath.Base(filepath.Dir(p))
 		ok, _ := match(name)
 		if ok {
@@ -98,10 +142,16 @@ func findDisks(excludes []string, base string) ([]Disk, error) {
 		if err != nil {
 			return nil, err
 		}
+		model, err := readString(name, "device/model")
+		if err != nil {
+			return nil, err
+		}
 		disks = append(disks, Disk{
 			name:       name,
 			sectorSize: int(sectorSize),
 			size512:    size512,
+			model:      model,
+			paths:      diskPaths[name],
 		})
 	}
 
@@ -137,3 +187,13 @@ func (d Disk) SectorSize() int {
 func (d Disk) Size512() int64 {
 	return d.size512
 }
+
+// Model returns the model name of this disk.
+func (d Disk) Model() string {
+	return d.model
+}
+
+// Paths returns the names of this disk in /dev/disk/by-path.
+func (d Disk) Paths() []string {
+	return d.paths
+}
@@ -1,6 +1,10 @@
 package cmd
 
-import "testing"
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
 
 func TestDisk(t *testing.T) {
 	t.Parallel()
@@ -34,7 +38,7 @@ func TestDisk(t *testing.T) {
 func TestFindDisks(t *testing.T) {
 	t.Parallel()
 
-	disks, err := findDisks([]string{"sd*"}, "./testdata")
+	disks, err := findDisks([]string{"sd*"}, "./testdata", "./testdata/by-path")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -42,7 +46,7 @@ func TestFindDisks(t *testing.T) {
 		t.Error("disks should be excluded:", disks)
 	}
 
-	disks, err = findDisks(nil, "./testdata")
+	disks, err = findDisks(nil, "./testdata", "./testdata/by-path")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -62,6 +66,12 @@ func TestFindDisks(t *testing.T) {
 	if d1.Size512() != 2048 {
 		t.Error(`d1.Size512() != 2048`, d1.Size512())
 	}
+	if d1.Model() != "SAMSUNG MZ7LH960" {
+		t.Error(`d1.Model() != "SAMSUNG MZ7LH960"`, d1.Model())
+	}
+	if !reflect.DeepEqual(d1.Paths(), []string{"pci-0000:00:1f.2-ata-3", "pci-0000:00:1f.2-ata-3.0"}) {
+		t.Error(`wrong d1.Paths()`, d1.Paths())
+	}
 
 	if d2.Name() != "sdd" {
 		t.Error(`d2.Name() != "sdd"`, d2.Name())
@@ -72,4 +82,50 @@ func TestFindDisks(t *testing.T) {
 	if d2.Size512() != 2048 {
 		t.Error(`d2.Size512() != 2048`, d2.Size512())
 	}
+	if d2.Model() != "INTEL SSDPE2KX040T8" {
+		t.Error(`d2.Model() != "INTEL SSDPE2KX040T8"`, d2.Model())
+	}
+	if !reflect.DeepEqual(d2.Paths(), []string{"pci-0000:3b:00.0-scsi-0:0:1:0"}) {
+		t.Error(`wrong d2.Paths()`, d2.Paths())
+	}
+}
+
+func TestIsEmptyDisk(t *testing.T) {
+	t.Parallel()
+
+	data := make([]byte, emptyCheckSize+512)
+	empty, err := isEmptyDisk(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !empty {
+		t.Error("zero-filled disk should be empty")
+	}
+
+	empty, err = isEmptyDisk(bytes.NewReader(data[:4096]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !empty {
+		t.Error("small zero-filled disk should be empty")
+	}
+
+	data[emptyCheckSize-1] = 1
+	empty, err = isEmptyDisk(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if empty {
+		t.Error("disk having data should not be empty")
+	}
+
+	data[emptyCheckSize-1] = 0
+	data[emptyCheckSize] = 1
+	empty, err = isEmptyDisk(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !empty {
+		t.Error("data beyond the head should be ignored")
+	}
 }
@@ -1,11 +1,14 @@
 package cmd
 
 import (
+	"bytes"
 	"context"
+	"crypto/ecdh"
 	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
+	"io"
 	"net"
 	"net/http"
 	"os"
@@ -17,17 +20,33 @@ import (
 	sabakan "github.com/cybozu-go/sabakan/v3/client"
 )
 
-const maxRetry = 10
+const (
+	maxRetry = 10
+
+	// emptyCheckSize is the size of the head of disks to check emptiness.
+	emptyCheckSize = 1 << 20
+)
 
 // Driver setup crypt devices.
 type Driver struct {
 	serial  string
 	sabakan *sabakan.Client
+	keys    keyStore
 	disks   []Disk
 	cipher  string
 	keySize int
 	tpmdev  string
 
+	// recoveryKey is the public key to seal recovery slots, or nil.
+	recoveryKey *ecdh.PublicKey
+
+	// tpmPCRs is the list of PCRs to seal the TPM KEK to.
+	tpmPCRs []int
+
+	// policy variables
+	requireTPM     bool
+	formatNonEmpty bool
+
 	// status variables
 	tpmVersion TpmVersionID
 }
@@ -37,6 +56,32 @@ type Driver struct {
 // It may return nil when the serial code of the machine cannot be identified,
 // or sabakanURL is not valid.
 func NewDriver(sabakanURL, cipher string, keySize int, tpmdev string, disks []Disk) (*Driver, error) {
+	saba, err := newSabakanClient(sabakanURL)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := machineSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Driver{
+		serial:  serial,
+		sabakan: saba,
+		keys:    saba,
+		disks:   disks,
+		cipher:  cipher,
+		keySize: keySize,
+		tpmdev:  tpmdev,
+
+		formatNonEmpty: true,
+
+		tpmVersion: TpmNone,
+	}, nil
+}
+
+func newSabakanClient(sabakanURL string) (*sabakan.Client, error) {
 	crt, err := os.ReadFile(opts.caCert)
 	if err != nil {
 		return nil, err
@@ -63,36 +108,106 @@ func NewDriver(sabakanURL, cipher string, keySize int, tpmdev string, disks []Di
 	if err != nil {
 		return nil, err
 	}
+	saba.SetCryptToken(opts.token)
+	return saba, nil
+}
 
+func machineSerial() (string, error) {
 	data, err := os.ReadFile("/sys/devices/virtual/dmi/id/product_serial")
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	serial := strings.TrimSpace(string(data))
+	return strings.TrimSpace(string(data)), nil
+}
 
-	return &Driver{
-		serial:  serial,
-		sabakan: saba,
-		disks:   disks,
-		cipher:  cipher,
-		keySize: keySize,
-		tpmdev:  tpmdev,
+// SetRecoveryKey sets the public key to seal recovery slots.
+func (d *Driver) SetRecoveryKey(pub *ecdh.PublicKey) {
+	d.recoveryKey = pub
+}
 
-		tpmVersion: TpmNone,
-	}, nil
+// SetEscrow sets Escrow to store disk encryption keys in multiple
+// sabakan servers.  Recovery slots are still stored in the sabakan server.
+func (d *Driver) SetEscrow(e *Escrow) {
+	d.keys = e
+}
+
+// SetTPMPCRs sets the list of PCRs to seal the TPM KEK to.
+// If pcrs is empty, the KEK is not sealed unless it has been sealed.
+func (d *Driver) SetTPMPCRs(pcrs []int) {
+	d.tpmPCRs = pcrs
+}
+
+// applyPolicy retrieves the disk encryption policy from sabakan and
+// applies it.  If no policy is defined, the command-line flags are used.
+func (d *Driver) applyPolicy(ctx context.Context) error {
+	var retries int
+RETRY:
+	policy, err := d.sabakan.CryptPoliciesResolve(ctx, d.serial)
+	if sabakan.IsNotFound(err) {
+		log.Info("no encryption policy is defined. use command-line flags", nil)
+		return nil
+	}
+	if err != nil {
+		log.Error("failed to retrieve encryption policy from sabakan", map[string]interface{}{
+			log.FnError: err,
+			"try":       retries + 1,
+		})
+		if retries == maxRetry {
+			return err
+		}
+		retries++
+		time.Sleep(time.Duration(retries) * time.Second * 2)
+		goto RETRY
+	}
+
+	if policy.Cipher != "" {
+		d.cipher = policy.Cipher
+	}
+	if policy.KeySize != 0 {
+		d.keySize = policy.KeySize / 8
+	}
+	d.requireTPM = policy.RequireTPM
+	if policy.FormatNonEmpty != nil {
+		d.formatNonEmpty = *policy.FormatNonEmpty
+	}
+
+	disks := make([]Disk, 0, len(d.disks))
+	for _, disk := range d.disks {
+		if !policy.SelectsDisk(disk.Paths(), disk.Model(), disk.Size512()*512) {
+			log.Info("disk is not selected by encryption policy", map[string]interface{}{
+				"disk": disk.Name(),
+			})
+			continue
+		}
+		disks = append(disks, disk)
+	}
+	d.disks = disks
+
+	log.Info("encryption policy is applied", map[string]interface{}{
+		"cipher":           d.cipher,
+		"keysize":          d.keySize * 8,
+		"require_tpm":      d.requireTPM,
+		"format_non_empty": d.formatNonEmpty,
+	})
+	return nil
 }
 
 // Setup setup crypt devices.
 func (d *Driver) Setup(ctx context.Context) error {
 	var kek []byte
 
-	_, err := os.Stat(d.tpmdev)
+	err := d.applyPolicy(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stat(d.tpmdev)
 	switch {
 	case err == nil:
 		log.Info("TPM is found. disk encryption proceeds with TPM", map[string]interface{}{
 			"device": d.tpmdev,
 		})
-		kek, d.tpmVersion, err = readKeyFromTPM(d.tpmdev)
+		kek, d.tpmVersion, err = readKeyFromTPM(d.tpmdev, d.tpmPCRs)
 		if err != nil {
 			return err
 		}
@@ -104,6 +219,9 @@ func (d *Driver) Setup(ctx context.Context) error {
 	default:
 		return err
 	}
+	if d.requireTPM && d.tpmVersion != Tpm20 {
+		return errors.New("TPM 2.0 is required by encryption policy")
+	}
 
 	for _, disk := range d.disks {
 		err := d.setupDisk(ctx, disk, kek)
@@ -130,6 +248,18 @@ func (d *Driver) setupDisk(ctx context.Context, disk Disk, tpmKek []byte) error
 
 	md, err := ReadMetadata(f)
 	if err == ErrNotFound {
+		if !d.formatNonEmpty {
+			empty, err := isEmptyDisk(f)
+			if err != nil {
+				return err
+			}
+			if !empty {
+				log.Error("refuse to format non-empty disk", map[string]interface{}{
+					"disk": disk.Name(),
+				})
+				return errors.New("disk is not empty: " + disk.Name())
+			}
+		}
 		log.Info("disk is not formatted. format disk", map[string]interface{}{
 			"disk": disk.Name(),
 		})
@@ -154,12 +284,38 @@ func (d *Driver) setupDisk(ctx context.Context, disk Disk, tpmKek []byte) error
 
 	var retries int
 RETRY:
-	ek, err := d.sabakan.CryptsGet(ctx, d.serial, md.HexID())
+	ek, err := d.keys.CryptsGet(ctx, d.serial, md.HexID())
+	if _, ok := d.keys.(*Escrow); ok && sabakan.IsNotFound(err) {
+		// the key may have been stored before key escrow is enabled.
+		ek, err = d.sabakan.CryptsGet(ctx, d.serial, md.HexID())
+		switch {
+		case err == nil && shareThreshold(ek) == 0:
+			err = &rawKeyError{key: ek}
+		case err == nil:
+			// never format the disk as the shares are lost.
+			err = errors.New("too few key shares")
+		}
+	}
+	var raw *rawKeyError
+	if errors.As(err, &raw) {
+		log.Info("encryption key is not escrowed. run cryptsetup and escrow the key", map[string]interface{}{
+			"disk": disk.Name(),
+		})
+		err = Cryptsetup(disk, md, raw.key, tpmKek)
+		if err != nil {
+			return err
+		}
+		return d.escrowKey(ctx, disk, f, md, raw.key, tpmKek)
+	}
 	if err == nil {
 		log.Info("encryption key is found. run cryptsetup", map[string]interface{}{
 			"disk": disk.Name(),
 		})
-		return Cryptsetup(disk, md, ek, tpmKek)
+		err = Cryptsetup(disk, md, ek, tpmKek)
+		if err != nil {
+			return err
+		}
+		return d.ensureRecoverySlot(ctx, disk, md, ek, tpmKek)
 	}
 	if sabakan.IsNotFound(err) {
 		log.Info("encryption key is not found in sabakan. format disk", map[string]interface{}{
@@ -181,6 +337,21 @@ RETRY:
 	goto RETRY
 }
 
+// isEmptyDisk returns true if the head of the disk is filled with zeros.
+func isEmptyDisk(r io.ReaderAt) (bool, error) {
+	buf := make([]byte, emptyCheckSize)
+	n, err := r.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	for _, b := range buf[:n] {
+		if b != 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
 func (d *Driver) formatDisk(ctx context.Context, disk Disk, f *os.File, tpmKek []byte) error {
 	md, err := NewMetadata(d.cipher, d.keySize, d.tpmVersion)
 	if err != nil {
@@ -209,9 +380,105 @@ func (d *Driver) formatDisk(ctx context.Context, disk Disk, f *os.File, tpmKek [
 		return err
 	}
 
+	err = d.putKey(ctx, d.keys, disk, md.HexID(), ek)
+	if err != nil {
+		return err
+	}
+
+	if d.recoveryKey == nil {
+		return nil
+	}
+	slot, err := md.SealRecoveryKey(key, d.recoveryKey)
+	if err != nil {
+		return err
+	}
+	return d.putKey(ctx, d.sabakan, disk, md.RecoveryID(), slot)
+}
+
+// escrowKey stores shares of the key of a disk formatted before key escrow
+// is enabled.  As sabakan rejects overwriting keys, the disk is given a new
+// ID for the shares.  The key is also re-encrypted with a new key encryption
+// key so that the key stored under the old ID can no longer unlock the disk.
+//
+// The metadata is updated after the shares are stored and confirmed so that
+// the migration is retried if interrupted.
+func (d *Driver) escrowKey(ctx context.Context, disk Disk, f *os.File, md *Metadata, ek, tpmKek []byte) error {
+	key, err := md.DecryptKey(ek, tpmKek)
+	if err != nil {
+		return err
+	}
+
+	err = md.RenewID()
+	if err != nil {
+		return err
+	}
+	err = md.RenewKek()
+	if err != nil {
+		return err
+	}
+	ek, err = md.EncryptKey(key, tpmKek)
+	if err != nil {
+		return err
+	}
+
+	err = d.putKey(ctx, d.keys, disk, md.HexID(), ek)
+	if err != nil {
+		return err
+	}
+
+	stored, err := d.keys.CryptsGet(ctx, d.serial, md.HexID())
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(stored, ek) {
+		return errors.New("escrowed key mismatch")
+	}
+
+	err = md.Write(f)
+	if err != nil {
+		return err
+	}
+	return d.ensureRecoverySlot(ctx, disk, md, ek, tpmKek)
+}
+
+// ensureRecoverySlot stores the recovery slot of a disk formatted
+// before the recovery key is configured.
+func (d *Driver) ensureRecoverySlot(ctx context.Context, disk Disk, md *Metadata, ek, tpmKek []byte) error {
+	if d.recoveryKey == nil {
+		return nil
+	}
+
+	_, err := d.sabakan.CryptsGet(ctx, d.serial, md.RecoveryID())
+	if err == nil {
+		return nil
+	}
+	if !sabakan.IsNotFound(err) {
+		// the disk is already available; just warn.
+		log.Warn("failed to check recovery slot", map[string]interface{}{
+			log.FnError: err,
+			"disk":      disk.Name(),
+		})
+		return nil
+	}
+
+	log.Info("recovery slot is not found in sabakan. store it", map[string]interface{}{
+		"disk": disk.Name(),
+	})
+	key, err := md.DecryptKey(ek, tpmKek)
+	if err != nil {
+		return err
+	}
+	slot, err := md.SealRecoveryKey(key, d.recoveryKey)
+	if err != nil {
+		return err
+	}
+	return d.putKey(ctx, d.sabakan, disk, md.RecoveryID(), slot)
+}
+
+func (d *Driver) putKey(ctx context.Context, store keyStore, disk Disk, id string, data []byte) error {
 	var retries int
 RETRY:
-	err = d.sabakan.CryptsPut(ctx, d.serial, md.HexID(), ek)
+	err := store.CryptsPut(ctx, d.serial, id, data)
 	if err == nil {
 		return nil
 	}
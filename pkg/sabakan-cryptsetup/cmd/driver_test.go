@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+func TestApplyPolicy(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	models, _, clients := testEscrowServers(t, 1)
+	newDriver := func() *Driver {
+		return &Driver{
+			serial:         testSerial,
+			sabakan:        clients[0],
+			cipher:         "aes-xts-plain64",
+			keySize:        64,
+			formatNonEmpty: true,
+		}
+	}
+
+	d := newDriver()
+	err := d.applyPolicy(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.formatNonEmpty {
+		t.Error("non-empty disks should be formatted without policy")
+	}
+
+	// a policy without format-non-empty keeps the default
+	err = models[0].CryptPolicy.Put(ctx, sabakan.CryptPolicyRole, "worker", &sabakan.CryptPolicy{Cipher: "aes-cbc-essiv:sha256"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d = newDriver()
+	err = d.applyPolicy(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.cipher != "aes-cbc-essiv:sha256" {
+		t.Error("cipher should be applied:", d.cipher)
+	}
+	if !d.formatNonEmpty {
+		t.Error("non-empty disks should be formatted if the policy omits format-non-empty")
+	}
+
+	formatNonEmpty := false
+	err = models[0].CryptPolicy.Put(ctx, sabakan.CryptPolicyRole, "worker", &sabakan.CryptPolicy{FormatNonEmpty: &formatNonEmpty})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d = newDriver()
+	err = d.applyPolicy(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.formatNonEmpty {
+		t.Error("non-empty disks should not be formatted if the policy disallows")
+	}
+}
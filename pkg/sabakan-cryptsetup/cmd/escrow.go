@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sync"
+
+	"github.com/cybozu-go/log"
+	sabakan "github.com/cybozu-go/sabakan/v3/client"
+)
+
+// keyStore stores encryption keys.  *sabakan.Client implements this.
+type keyStore interface {
+	CryptsGet(ctx context.Context, serial, device string) ([]byte, error)
+	CryptsPut(ctx context.Context, serial, device string, key []byte) error
+}
+
+// Escrow stores encryption keys in multiple sabakan servers by splitting
+// them into Shamir shares.  Any threshold of the servers can reconstruct keys.
+type Escrow struct {
+	clients   []*sabakan.Client
+	threshold int
+
+	mu sync.Mutex
+	// pending holds shares not yet stored in some servers.
+	// Shares are reused on retries because servers reject different shares.
+	// They are kept only in memory and lost when the process exits.
+	pending map[string]*pendingShares
+}
+
+type pendingShares struct {
+	shares [][]byte
+	stored []bool
+}
+
+// NewEscrow creates Escrow.
+func NewEscrow(clients []*sabakan.Client, threshold int) (*Escrow, error) {
+	if threshold < 1 || threshold > len(clients) || len(clients) > maxShares {
+		return nil, fmt.Errorf("invalid threshold: %d of %d", threshold, len(clients))
+	}
+	return &Escrow{
+		clients:   clients,
+		threshold: threshold,
+		pending:   make(map[string]*pendingShares),
+	}, nil
+}
+
+func newEscrow(urls []string, threshold int) (*Escrow, error) {
+	clients := make([]*sabakan.Client, len(urls))
+	for i, u := range urls {
+		c, err := newSabakanClient(u)
+		if err != nil {
+			return nil, err
+		}
+		clients[i] = c
+	}
+	return NewEscrow(clients, threshold)
+}
+
+// rawKeyError is returned when the key is stored as is, i.e. before
+// key escrow is enabled.
+type rawKeyError struct {
+	key []byte
+}
+
+func (e *rawKeyError) Error() string {
+	return "key is not escrowed"
+}
+
+// CryptsGet retrieves shares from servers and reconstructs the key.
+//
+// If all servers respond that the key is not found, this returns
+// the error for which sabakan.IsNotFound returns true.
+//
+// If a server returns the key stored before key escrow is enabled,
+// this returns *rawKeyError having the key.
+func (e *Escrow) CryptsGet(ctx context.Context, serial, device string) ([]byte, error) {
+	var shares, raws [][]byte
+	var k int
+	var notFound, lastErr error
+	for i, c := range e.clients {
+		share, err := c.CryptsGet(ctx, serial, device)
+		if sabakan.IsNotFound(err) {
+			notFound = err
+			continue
+		}
+		if err != nil {
+			log.Warn("failed to retrieve key share", map[string]interface{}{
+				log.FnError: err,
+				"server":    i,
+			})
+			lastErr = err
+			continue
+		}
+		// use the threshold recorded in shares as it may differ
+		// from the current one.
+		t := shareThreshold(share)
+		if t == 0 {
+			raws = append(raws, share)
+			continue
+		}
+		if k != 0 && t != k {
+			log.Warn("invalid key share", map[string]interface{}{
+				"server": i,
+			})
+			lastErr = errors.New("invalid key share")
+			continue
+		}
+		k = t
+
+		shares = append(shares, share)
+		if len(shares) == k {
+			return CombineShares(shares)
+		}
+	}
+
+	if len(raws) == 1 && len(shares) == 0 {
+		return nil, &rawKeyError{key: raws[0]}
+	}
+	if len(raws) > 0 {
+		log.Warn("key shares and keys are mixed", map[string]interface{}{
+			"shares": len(shares),
+			"keys":   len(raws),
+		})
+		lastErr = errors.New("invalid key share")
+	}
+
+	if len(shares) == 0 && lastErr == nil {
+		return nil, notFound
+	}
+	if lastErr == nil {
+		// Some shares were lost.  Never report not found
+		// because the disk would be formatted.
+		lastErr = errors.New("too few key shares")
+	}
+	return nil, fmt.Errorf("found %d key shares: %w", len(shares), lastErr)
+}
+
+// CryptsPut splits the key into shares and stores them in all servers.
+// On error, the caller can retry to store shares in the remaining servers.
+//
+// Shares that are not stored are not persisted because any threshold of
+// them would reveal the key.  If the process exits before all servers have
+// shares, the remaining servers never get theirs.
+func (e *Escrow) CryptsPut(ctx context.Context, serial, device string, key []byte) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	id := path.Join(serial, device)
+	p, ok := e.pending[id]
+	if !ok {
+		shares, err := SplitSecret(key, e.threshold, len(e.clients))
+		if err != nil {
+			return err
+		}
+		p = &pendingShares{
+			shares: shares,
+			stored: make([]bool, len(shares)),
+		}
+		e.pending[id] = p
+	}
+
+	var lastErr error
+	for i, c := range e.clients {
+		if p.stored[i] {
+			continue
+		}
+		err := c.CryptsPut(ctx, serial, device, p.shares[i])
+		if err != nil {
+			log.Warn("failed to store key share", map[string]interface{}{
+				log.FnError: err,
+				"server":    i,
+			})
+			lastErr = err
+			continue
+		}
+		p.stored[i] = true
+	}
+	if lastErr != nil {
+		return lastErr
+	}
+
+	delete(e.pending, id)
+	return nil
+}
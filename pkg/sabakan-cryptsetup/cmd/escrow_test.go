@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/cybozu-go/sabakan/v3"
+	client "github.com/cybozu-go/sabakan/v3/client"
+	"github.com/cybozu-go/sabakan/v3/models/mock"
+	"github.com/cybozu-go/sabakan/v3/web"
+)
+
+const testSerial = "1234abcd"
+
+func testEscrowServers(t *testing.T, n int) ([]sabakan.Model, []*httptest.Server, []*client.Client) {
+	models := make([]sabakan.Model, n)
+	servers := make([]*httptest.Server, n)
+	clients := make([]*client.Client, n)
+	for i := range models {
+		m := mock.NewModel()
+		err := m.Machine.Register(context.Background(), []*sabakan.Machine{
+			sabakan.NewMachine(sabakan.MachineSpec{Serial: testSerial, Role: "worker"}),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		u, _ := url.Parse("http://localhost:10080")
+		us, _ := url.Parse("https://localhost:10443")
+		s := httptest.NewServer(web.NewServer(m, "", "", u, us, nil, false, nil, true))
+		t.Cleanup(s.Close)
+
+		c, err := client.NewClient(s.URL, &http.Client{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		models[i] = m
+		servers[i] = s
+		clients[i] = c
+	}
+	return models, servers, clients
+}
+
+func TestEscrow(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	models, servers, clients := testEscrowServers(t, 3)
+	e, err := NewEscrow(clients, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = e.CryptsGet(ctx, testSerial, "disk1")
+	if !client.IsNotFound(err) {
+		t.Fatal("key should not be found:", err)
+	}
+
+	key := bytes.Repeat([]byte{0xab}, 256)
+	err = e.CryptsPut(ctx, testSerial, "disk1", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// no server has the key itself
+	for i, m := range models {
+		share, err := m.Storage.GetEncryptionKey(ctx, testSerial, "disk1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if share == nil || bytes.Contains(share, key[:16]) {
+			t.Error("server has no share or the key:", i)
+		}
+	}
+
+	got, err := e.CryptsGet(ctx, testSerial, "disk1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, key) {
+		t.Error("wrong key reconstructed")
+	}
+
+	// k of n servers are enough
+	servers[0].Close()
+	got, err = e.CryptsGet(ctx, testSerial, "disk1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, key) {
+		t.Error("wrong key reconstructed without server 0")
+	}
+
+	// shares lost in some servers must not be reported as not found
+	shares, err := SplitSecret(key, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = clients[1].CryptsPut(ctx, testSerial, "disk2", shares[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = e.CryptsGet(ctx, testSerial, "disk2")
+	if err == nil || client.IsNotFound(err) {
+		t.Error("too few shares should be an error:", err)
+	}
+}
+
+func TestEscrowRetry(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	_, servers, clients := testEscrowServers(t, 3)
+	e, err := NewEscrow(clients, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// store shares while a server is down
+	down := httptest.NewUnstartedServer(servers[2].Config.Handler)
+	servers[2].Close()
+	key := bytes.Repeat([]byte{0xcd}, 64)
+	err = e.CryptsPut(ctx, testSerial, "disk1", key)
+	if err == nil {
+		t.Fatal("storing shares should fail")
+	}
+
+	// retry with the same shares after the server recovers
+	down.Start()
+	t.Cleanup(down.Close)
+	c, err := client.NewClient(down.URL, &http.Client{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.clients[2] = c
+	err = e.CryptsPut(ctx, testSerial, "disk1", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := e.CryptsGet(ctx, testSerial, "disk1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, key) {
+		t.Error("wrong key reconstructed")
+	}
+
+	_, err = NewEscrow(clients, 4)
+	if err == nil {
+		t.Error("threshold larger than servers should be rejected")
+	}
+}
+
+func TestEscrowRawKey(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	models, _, clients := testEscrowServers(t, 3)
+	e, err := NewEscrow(clients, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a key stored before key escrow is enabled
+	key := bytes.Repeat([]byte{0xef}, 64)
+	err = models[0].Storage.PutEncryptionKey(ctx, testSerial, "disk1", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = e.CryptsGet(ctx, testSerial, "disk1")
+	var raw *rawKeyError
+	if !errors.As(err, &raw) {
+		t.Fatal("raw key should be returned:", err)
+	}
+	if !bytes.Equal(raw.key, key) {
+		t.Error("wrong raw key")
+	}
+
+	// escrow the key under a new ID
+	err = e.CryptsPut(ctx, testSerial, "disk2", raw.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := e.CryptsGet(ctx, testSerial, "disk2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, key) {
+		t.Error("wrong key reconstructed")
+	}
+
+	// raw keys mixed with shares are invalid
+	err = models[1].Storage.PutEncryptionKey(ctx, testSerial, "disk3", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shares, err := SplitSecret(key, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = models[0].Storage.PutEncryptionKey(ctx, testSerial, "disk3", shares[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = e.CryptsGet(ctx, testSerial, "disk3")
+	if err == nil || errors.As(err, &raw) || client.IsNotFound(err) {
+		t.Error("mixed keys should be an error:", err)
+	}
+}
@@ -115,6 +115,29 @@ func NewMetadata(cipher string, keySize int, tpmVersion TpmVersionID) (*Metadata
 	return md, nil
 }
 
+// RenewID assigns a new random ID to this disk.
+func (m *Metadata) RenewID() error {
+	id := make([]byte, idLength)
+	_, err := rand.Read(id)
+	if err != nil {
+		return err
+	}
+	m.id = string(id)
+	return nil
+}
+
+// RenewKek assigns a new random key encryption key to this disk.
+// Keys encrypted with the old one cannot be decrypted with this metadata.
+func (m *Metadata) RenewKek() error {
+	kek := make([]byte, len(m.kek))
+	_, err := rand.Read(kek)
+	if err != nil {
+		return err
+	}
+	m.kek = string(kek)
+	return nil
+}
+
 // Write writes metadata to f.
 func (m *Metadata) Write(f *os.File) error {
 	if len(m.cipher) > maxCipherName3 {
@@ -208,3 +231,14 @@ func convertMetadata2(f *os.File, data []byte) (*Metadata, error) {
 	}
 	return md, nil
 }
+
+// readDiskMetadata reads metadata of disk.
+func readDiskMetadata(disk Disk) (*Metadata, error) {
+	f, err := os.OpenFile(disk.Device(), os.O_RDWR, 0660)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadMetadata(f)
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"bytes"
 	"encoding/hex"
 	"os"
 	"testing"
@@ -64,4 +65,37 @@ func TestMetadata(t *testing.T) {
 	if md.kek != md2.kek {
 		t.Error(`md.kek != md2.kek`, md2.kek)
 	}
+
+	// the ID is renewed without changing other fields
+	err = md.RenewID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(md.id) != idLength || md.id == md2.id {
+		t.Error(`ID should be renewed`, md.HexID())
+	}
+	if md.kek != md2.kek {
+		t.Error(`md.kek != md2.kek after RenewID`)
+	}
+
+	// keys encrypted with the old kek are not decrypted after RenewKek
+	key := bytes.Repeat([]byte{0x5a}, 64)
+	ek, err := md.EncryptKey(key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = md.RenewKek()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(md.kek) != 64 || md.kek == md2.kek {
+		t.Error(`kek should be renewed`)
+	}
+	decrypted, err := md.DecryptKey(ek, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(decrypted, key) {
+		t.Error(`old ek should not be decrypted after RenewKek`)
+	}
 }
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/cybozu-go/log"
+	"github.com/cybozu-go/well"
+	"github.com/spf13/cobra"
+)
+
+var recoverOpts struct {
+	privateKey string
+	serial     string
+}
+
+var recoverCmd = &cobra.Command{
+	Use:   "recover --private-key FILE DISK...",
+	Short: "unlock disks with the recovery private key",
+	Long: `Unlock disks with the recovery private key.
+
+This command retrieves recovery slots of DISKs from sabakan, decrypts
+disk encryption keys with the X25519 private key, and sets up encrypted
+disks.  TPM is not used.  DISK is a name in /sys/block such as "sda".`,
+	Args: cobra.MinimumNArgs(1),
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		priv, err := LoadRecoveryPrivateKey(recoverOpts.privateKey)
+		if err != nil {
+			return err
+		}
+		saba, err := newSabakanClient(opts.sabakanURL)
+		if err != nil {
+			return err
+		}
+		serial := recoverOpts.serial
+		if serial == "" {
+			serial, err = machineSerial()
+			if err != nil {
+				return err
+			}
+		}
+
+		InitModules()
+		well.Go(func(ctx context.Context) error {
+			for _, name := range args {
+				disk := Disk{name: name}
+				md, err := readDiskMetadata(disk)
+				if err != nil {
+					return err
+				}
+				slot, err := saba.CryptsGet(ctx, serial, md.RecoveryID())
+				if err != nil {
+					return err
+				}
+				key, err := md.OpenRecoveryKey(slot, priv)
+				if err != nil {
+					return err
+				}
+				err = CryptsetupKey(disk, md, key)
+				if err != nil {
+					return err
+				}
+				log.Info("recovered encrypted disk", map[string]interface{}{
+					"path": filepath.Join("/dev/mapper", disk.CryptName()),
+				})
+			}
+			return nil
+		})
+		well.Stop()
+		return well.Wait()
+	},
+}
+
+func init() {
+	recoverCmd.Flags().StringVar(&recoverOpts.privateKey, "private-key", "", "X25519 recovery private key file in PEM")
+	recoverCmd.Flags().StringVar(&recoverOpts.serial, "serial", "", "serial number of the machine where disks were encrypted")
+	recoverCmd.MarkFlagRequired("private-key")
+	rootCmd.AddCommand(recoverCmd)
+}
@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+)
+
+const (
+	recoveryMagic  = "\x80sabakan-recovery1"
+	recoveryInfo   = "sabakan-cryptsetup recovery"
+	recoverySuffix = ".recovery"
+	x25519KeySize  = 32
+	gcmNonceSize   = 12
+)
+
+// LoadRecoveryPublicKey loads an X25519 public key from a PEM file.
+//
+// The file can be generated as follows:
+//
+//	openssl genpkey -algorithm X25519 -out recovery.key
+//	openssl pkey -in recovery.key -pubout -out recovery.pub
+func LoadRecoveryPublicKey(file string) (*ecdh.PublicKey, error) {
+	der, err := readPEM(file, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+	pub, ok := key.(*ecdh.PublicKey)
+	if !ok || pub.Curve() != ecdh.X25519() {
+		return nil, errors.New("not an X25519 public key: " + file)
+	}
+	return pub, nil
+}
+
+// LoadRecoveryPrivateKey loads an X25519 private key from a PEM file.
+func LoadRecoveryPrivateKey(file string) (*ecdh.PrivateKey, error) {
+	der, err := readPEM(file, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	priv, ok := key.(*ecdh.PrivateKey)
+	if !ok || priv.Curve() != ecdh.X25519() {
+		return nil, errors.New("not an X25519 private key: " + file)
+	}
+	return priv, nil
+}
+
+func readPEM(file, typ string) ([]byte, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != typ {
+		return nil, errors.New("no " + typ + " PEM block in " + file)
+	}
+	return block.Bytes, nil
+}
+
+// RecoveryID returns the name of the recovery slot of this disk in sabakan.
+func (m *Metadata) RecoveryID() string {
+	return m.HexID() + recoverySuffix
+}
+
+func recoveryAEAD(shared, ephemeral, recipient []byte) (cipher.AEAD, error) {
+	salt := append(append([]byte(nil), ephemeral...), recipient...)
+	wrapKey, err := hkdf.Key(sha256.New, shared, salt, recoveryInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(wrapKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// SealRecoveryKey encrypts the disk encryption key with the recovery public key.
+//
+// The returned recovery slot consists of the magic bytes, an ephemeral
+// X25519 public key, a nonce, and the key sealed with AES-256-GCM.
+// The AES key is derived from the X25519 shared secret by HKDF-SHA256.
+func (m *Metadata) SealRecoveryKey(key []byte, pub *ecdh.PublicKey) ([]byte, error) {
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := ephemeral.ECDH(pub)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := recoveryAEAD(shared, ephemeral.PublicKey().Bytes(), pub.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcmNonceSize)
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	slot := []byte(recoveryMagic)
+	slot = append(slot, ephemeral.PublicKey().Bytes()...)
+	slot = append(slot, nonce...)
+	return aead.Seal(slot, nonce, key, []byte(m.id)), nil
+}
+
+// OpenRecoveryKey decrypts the disk encryption key in the recovery slot
+// with the recovery private key.
+func (m *Metadata) OpenRecoveryKey(slot []byte, priv *ecdh.PrivateKey) ([]byte, error) {
+	if !bytes.HasPrefix(slot, []byte(recoveryMagic)) {
+		return nil, errors.New("invalid recovery slot")
+	}
+	slot = slot[len(recoveryMagic):]
+	if len(slot) < x25519KeySize+gcmNonceSize {
+		return nil, errors.New("too short recovery slot")
+	}
+
+	ephemeral, err := ecdh.X25519().NewPublicKey(slot[:x25519KeySize])
+	if err != nil {
+		return nil, err
+	}
+	nonce := slot[x25519KeySize:(x25519KeySize + gcmNonceSize)]
+	sealed := slot[(x25519KeySize + gcmNonceSize):]
+
+	shared, err := priv.ECDH(ephemeral)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := recoveryAEAD(shared, ephemeral.Bytes(), priv.PublicKey().Bytes())
+	if err != nil {
+		return nil, err
+	}
+	key, err := aead.Open(nil, nonce, sealed, []byte(m.id))
+	if err != nil {
+		return nil, errors.New("failed to open recovery slot; wrong private key?")
+	}
+	if len(key) != len(m.kek) {
+		return nil, errors.New("key length mismatch in recovery slot")
+	}
+	return key, nil
+}
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestRecoveryKeys(t *testing.T, dir string) (string, string) {
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(priv.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	privFile := filepath.Join(dir, "recovery.key")
+	pubFile := filepath.Join(dir, "recovery.pub")
+	err = os.WriteFile(privFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(pubFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return privFile, pubFile
+}
+
+func TestRecovery(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	privFile, pubFile := writeTestRecoveryKeys(t, dir)
+	pub, err := LoadRecoveryPublicKey(pubFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv, err := LoadRecoveryPrivateKey(privFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = LoadRecoveryPublicKey(privFile)
+	if err == nil {
+		t.Error("private key should not be loaded as a public key")
+	}
+
+	f, err := os.Create(filepath.Join(dir, "disk"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	md, err := NewMetadata("aes-xts-plain64", 64, Tpm20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = md.Write(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tpmKek := make([]byte, 64)
+	rand.Read(tpmKek)
+	key := make([]byte, 64)
+	rand.Read(key)
+	ek, err := md.EncryptKey(key, tpmKek)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slot, err := md.SealRecoveryKey(key, pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(slot, key) {
+		t.Error("key is not encrypted")
+	}
+
+	// recover without TPM
+	md2, err := ReadMetadata(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md2.RecoveryID() != md.HexID()+".recovery" {
+		t.Error("wrong recovery ID:", md2.RecoveryID())
+	}
+	recovered, err := md2.OpenRecoveryKey(slot, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := md2.DecryptKey(ek, tpmKek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(recovered, decrypted) {
+		t.Error("recovered key differs from the disk encryption key")
+	}
+
+	other, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = md2.OpenRecoveryKey(slot, other)
+	if err == nil {
+		t.Error("recovery slot should not be opened with a wrong private key")
+	}
+
+	md3, err := NewMetadata("aes-xts-plain64", 64, Tpm20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = md3.OpenRecoveryKey(slot, priv)
+	if err == nil {
+		t.Error("recovery slot should not be opened for another disk")
+	}
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"errors"
+
+	"github.com/cybozu-go/log"
+	"github.com/spf13/cobra"
+)
+
+var resealOpts struct {
+	pcrs      string
+	pcrValues []string
+}
+
+var resealCmd = &cobra.Command{
+	Use:   "reseal [--pcrs LIST] [--pcr-value INDEX=HEX]...",
+	Short: "seal TPM key to PCR values for the next boot",
+	Long: `Seal the TPM key encryption key to PCR values for the next boot.
+
+Run this before a planned update of firmware, bootloader, or kernel
+with the expected SHA-256 PCR values after the update.  PCRs not given
+by --pcr-value are expected to have the current values.
+
+The current policy remains valid until the machine boots with the new
+PCR values, so the disks can be unlocked even if the update is rolled back.`,
+	Args: cobra.NoArgs,
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		pcrs, err := ParsePCRs(resealOpts.pcrs)
+		if err != nil {
+			return err
+		}
+		values, err := ParsePCRValues(resealOpts.pcrValues)
+		if err != nil {
+			return err
+		}
+
+		t, _, err := openTPM(opts.tpmdev)
+		if err != nil {
+			return err
+		}
+		if t == nil {
+			return errors.New("TPM 2.0 is not available")
+		}
+		defer t.Close()
+
+		err = t.reseal(pcrs, values)
+		if err != nil {
+			return err
+		}
+		log.Info("sealed TPM key encryption key for the next boot", nil)
+		return nil
+	},
+}
+
+func init() {
+	resealCmd.Flags().StringVar(&resealOpts.pcrs, "pcrs", "", "comma-separated PCRs to seal to; defaults to the current policy")
+	resealCmd.Flags().StringArrayVar(&resealOpts.pcrValues, "pcr-value", nil, "expected SHA-256 value of a PCR after the update")
+	rootCmd.AddCommand(resealCmd)
+}
@@ -18,12 +18,18 @@ const (
 )
 
 var opts struct {
-	sabakanURL string
-	cipher     string
-	tpmdev     string
-	keySize    int
-	excludes   []string
-	caCert     string
+	sabakanURL  string
+	cipher      string
+	tpmdev      string
+	keySize     int
+	excludes    []string
+	caCert      string
+	token       string
+	recoveryKey string
+	tpmPCRs     string
+
+	escrowServers   []string
+	escrowThreshold int
 }
 
 var rootCmd = &cobra.Command{
@@ -43,6 +49,13 @@ decrypt it, and setup encrypted disks automatically.`,
 		if opts.keySize%8 != 0 {
 			return errors.New("key size must be multiple of 8")
 		}
+		if len(opts.escrowServers) > 0 && (opts.escrowThreshold < 1 || opts.escrowThreshold > len(opts.escrowServers)) {
+			return fmt.Errorf("--escrow-threshold must be between 1 and the number of --escrow-server (%d)", len(opts.escrowServers))
+		}
+		pcrs, err := ParsePCRs(opts.tpmPCRs)
+		if err != nil {
+			return err
+		}
 
 		InitModules()
 		disks, err := FindDisks(opts.excludes)
@@ -53,6 +66,21 @@ decrypt it, and setup encrypted disks automatically.`,
 		if err != nil {
 			return err
 		}
+		if opts.recoveryKey != "" {
+			pub, err := LoadRecoveryPublicKey(opts.recoveryKey)
+			if err != nil {
+				return err
+			}
+			driver.SetRecoveryKey(pub)
+		}
+		driver.SetTPMPCRs(pcrs)
+		if len(opts.escrowServers) > 0 {
+			escrow, err := newEscrow(opts.escrowServers, opts.escrowThreshold)
+			if err != nil {
+				return err
+			}
+			driver.SetEscrow(escrow)
+		}
 		well.Go(driver.Setup)
 		well.Stop()
 		return well.Wait()
@@ -73,10 +101,15 @@ func init() {
 	if sabaURL == "" {
 		sabaURL = defaultSabakanURL
 	}
-	rootCmd.Flags().StringVar(&opts.sabakanURL, "server", sabaURL, "URL of sabakan server")
-	rootCmd.Flags().StringVar(&opts.tpmdev, "tpmdev", defaultTPMDev, "device file path of tpm")
+	rootCmd.PersistentFlags().StringVar(&opts.sabakanURL, "server", sabaURL, "URL of sabakan server")
+	rootCmd.PersistentFlags().StringVar(&opts.tpmdev, "tpmdev", defaultTPMDev, "device file path of tpm")
 	rootCmd.Flags().StringVar(&opts.cipher, "cipher", defaultCipher, "cipher specification")
 	rootCmd.Flags().IntVar(&opts.keySize, "keysize", defaultKeySize, "key size in bits")
 	rootCmd.Flags().StringArrayVar(&opts.excludes, "excludes", nil, `disk name patterns to be excluded, e.g. "nvme*"`)
-	rootCmd.Flags().StringVar(&opts.caCert, "cert", defaultCACert, "location of sabakan CA certificate")
+	rootCmd.PersistentFlags().StringVar(&opts.caCert, "cert", defaultCACert, "location of sabakan CA certificate")
+	rootCmd.PersistentFlags().StringVar(&opts.token, "token", os.Getenv("SABAKAN_CRYPT_TOKEN"), "per-machine token to retrieve encryption keys")
+	rootCmd.Flags().StringVar(&opts.tpmPCRs, "tpm-pcrs", "", `comma-separated PCRs to seal TPM key to, e.g. "0,2,4,7"`)
+	rootCmd.Flags().StringVar(&opts.recoveryKey, "recovery-key", "", "X25519 public key file in PEM to seal recovery slots")
+	rootCmd.Flags().StringArrayVar(&opts.escrowServers, "escrow-server", nil, "URL of sabakan server to store a share of encryption keys")
+	rootCmd.Flags().IntVar(&opts.escrowThreshold, "escrow-threshold", 0, "number of shares required to reconstruct encryption keys")
 }
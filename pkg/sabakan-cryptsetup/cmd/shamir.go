@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// Shamir's secret sharing over GF(2^8).
+//
+// A share consists of the magic bytes, the threshold, the x coordinate,
+// and the y coordinates for each byte of the secret.
+
+const (
+	shareMagic      = "\x80sabakan-share1"
+	shareHeaderSize = len(shareMagic) + 2
+	maxShares       = 255
+)
+
+var gfExp, gfLog [256]byte
+
+func init() {
+	// 3 is a generator of the multiplicative group of GF(2^8)
+	// with the reducing polynomial x^8 + x^4 + x^3 + x + 1.
+	var x byte = 1
+	for i := 0; i < 255; i++ {
+		gfExp[i] = x
+		gfLog[x] = byte(i)
+		x2 := x << 1
+		if x&0x80 != 0 {
+			x2 ^= 0x1b
+		}
+		x ^= x2
+	}
+	gfExp[255] = gfExp[0]
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[(int(gfLog[a])+int(gfLog[b]))%255]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[(int(gfLog[a])+255-int(gfLog[b]))%255]
+}
+
+// SplitSecret splits secret into n shares.  Any k of them can
+// reconstruct the secret while k-1 of them reveal nothing.
+func SplitSecret(secret []byte, k, n int) ([][]byte, error) {
+	if k < 1 || n < k || n > maxShares {
+		return nil, fmt.Errorf("invalid threshold: %d of %d", k, n)
+	}
+	if len(secret) == 0 {
+		return nil, errors.New("empty secret")
+	}
+
+	shares := make([][]byte, n)
+	for i := range shares {
+		share := make([]byte, shareHeaderSize+len(secret))
+		copy(share, shareMagic)
+		share[len(shareMagic)] = byte(k)
+		share[len(shareMagic)+1] = byte(i + 1)
+		shares[i] = share
+	}
+
+	coeffs := make([]byte, k)
+	for pos, b := range secret {
+		coeffs[0] = b
+		_, err := rand.Read(coeffs[1:])
+		if err != nil {
+			return nil, err
+		}
+		for _, share := range shares {
+			x := share[len(shareMagic)+1]
+
+			// Horner's method
+			var y byte
+			for j := k - 1; j >= 0; j-- {
+				y = gfMul(y, x) ^ coeffs[j]
+			}
+			share[shareHeaderSize+pos] = y
+		}
+	}
+	return shares, nil
+}
+
+// shareThreshold returns the threshold of share, or 0 if share is invalid.
+func shareThreshold(share []byte) int {
+	if len(share) <= shareHeaderSize || !bytes.HasPrefix(share, []byte(shareMagic)) {
+		return 0
+	}
+	return int(share[len(shareMagic)])
+}
+
+// CombineShares reconstructs the secret from shares.
+func CombineShares(shares [][]byte) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, errors.New("no shares")
+	}
+	k := shareThreshold(shares[0])
+	if k == 0 {
+		return nil, errors.New("invalid share")
+	}
+	if len(shares) < k {
+		return nil, fmt.Errorf("too few shares: %d of %d", len(shares), k)
+	}
+	shares = shares[:k]
+
+	xs := make([]byte, k)
+	for i, share := range shares {
+		if shareThreshold(share) != k || len(share) != len(shares[0]) {
+			return nil, errors.New("inconsistent shares")
+		}
+		x := share[len(shareMagic)+1]
+		if x == 0 || bytes.IndexByte(xs[:i], x) != -1 {
+			return nil, errors.New("invalid or duplicate share")
+		}
+		xs[i] = x
+	}
+
+	// Lagrange interpolation at x = 0.
+	basis := make([]byte, k)
+	for i := range xs {
+		var num, den byte = 1, 1
+		for j := range xs {
+			if i == j {
+				continue
+			}
+			num = gfMul(num, xs[j])
+			den = gfMul(den, xs[i]^xs[j])
+		}
+		basis[i] = gfDiv(num, den)
+	}
+
+	secret := make([]byte, len(shares[0])-shareHeaderSize)
+	for pos := range secret {
+		var b byte
+		for i, share := range shares {
+			b ^= gfMul(share[shareHeaderSize+pos], basis[i])
+		}
+		secret[pos] = b
+	}
+	return secret, nil
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+func TestGF256(t *testing.T) {
+	t.Parallel()
+
+	// 0x57 * 0x83 = 0xc1 in FIPS-197.
+	if gfMul(0x57, 0x83) != 0xc1 {
+		t.Errorf("gfMul(0x57, 0x83) = %#x", gfMul(0x57, 0x83))
+	}
+	for a := 1; a < 256; a++ {
+		for b := 1; b < 256; b++ {
+			if gfDiv(gfMul(byte(a), byte(b)), byte(b)) != byte(a) {
+				t.Fatalf("gfDiv(gfMul(%d, %d), %d) != %d", a, b, b, a)
+			}
+		}
+	}
+}
+
+func TestShamir(t *testing.T) {
+	t.Parallel()
+
+	secret := make([]byte, 256)
+	_, err := rand.Read(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shares, err := SplitSecret(secret, 3, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shares) != 5 {
+		t.Fatal("wrong number of shares:", len(shares))
+	}
+
+	// any 3 shares reconstruct the secret
+	for i := 0; i < 5; i++ {
+		for j := i + 1; j < 5; j++ {
+			for k := j + 1; k < 5; k++ {
+				s, err := CombineShares([][]byte{shares[k], shares[i], shares[j]})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(s, secret) {
+					t.Error("wrong secret from shares", i, j, k)
+				}
+			}
+		}
+	}
+
+	_, err = CombineShares(shares[:2])
+	if err == nil {
+		t.Error("2 shares should not reconstruct the secret")
+	}
+	_, err = CombineShares([][]byte{shares[0], shares[0], shares[1]})
+	if err == nil {
+		t.Error("duplicate shares should be rejected")
+	}
+	_, err = CombineShares([][]byte{shares[0], shares[1], shares[2][:100]})
+	if err == nil {
+		t.Error("inconsistent shares should be rejected")
+	}
+	_, err = CombineShares([][]byte{secret})
+	if err == nil {
+		t.Error("invalid share should be rejected")
+	}
+
+	shares, err = SplitSecret(secret, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := CombineShares(shares[1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(s, secret) {
+		t.Error("wrong secret from a share")
+	}
+
+	for _, c := range [][2]int{{0, 1}, {3, 2}, {1, 256}} {
+		_, err = SplitSecret(secret, c[0], c[1])
+		if err == nil {
+			t.Error("invalid threshold should be rejected:", c)
+		}
+	}
+}
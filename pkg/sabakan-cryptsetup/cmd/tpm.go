@@ -1,8 +1,17 @@
 package cmd
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"io"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/cybozu-go/log"
 	"github.com/google/go-tpm/legacy/tpm2"
@@ -13,9 +22,167 @@ import (
 const (
 	tpmKekLength = 256
 	tpmOffsetHex = 0x01000000
+
+	// KEK sealed to PCRs.
+	tpmSealedOffsetHex  = 0x01000001
+	tpmSealedHandleHex  = 0x81000100
+	tpmPendingHandleHex = 0x81000101
+	tpmSealedVersion    = 1
+	tpmWrapKeyLength    = 32
+	tpmSealedHeaderSize = 7
+	tpmSealedSize       = tpmSealedHeaderSize + gcmNonceSize + tpmKekLength + 16
+
+	maxPCR         = 23
+	pcrsPerRead    = 8
+	pcrDigestSize  = sha256.Size
+	sessionNonceSz = 16
 )
 
-var tpmOffset = tpmutil.Handle(tpmOffsetHex)
+var (
+	tpmOffset        = tpmutil.Handle(tpmOffsetHex)
+	tpmSealedOffset  = tpmutil.Handle(tpmSealedOffsetHex)
+	tpmSealedHandle  = tpmutil.Handle(tpmSealedHandleHex)
+	tpmPendingHandle = tpmutil.Handle(tpmPendingHandleHex)
+
+	srkTemplate = tpm2.Public{
+		Type:       tpm2.AlgECC,
+		NameAlg:    tpm2.AlgSHA256,
+		Attributes: tpm2.FlagStorageDefault,
+		ECCParameters: &tpm2.ECCParams{
+			Symmetric: &tpm2.SymScheme{
+				Alg:     tpm2.AlgAES,
+				KeyBits: 128,
+				Mode:    tpm2.AlgCFB,
+			},
+			CurveID: tpm2.CurveNISTP256,
+		},
+	}
+)
+
+// ParsePCRs parses a comma-separated list of PCR indices.
+// The returned list is sorted and has no duplicates.
+func ParsePCRs(s string) ([]int, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	seen := make(map[int]bool)
+	var pcrs []int
+	for _, f := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil || n < 0 || n > maxPCR {
+			return nil, errors.New("invalid PCR index: " + f)
+		}
+		if seen[n] {
+			continue
+		}
+		seen[n] = true
+		pcrs = append(pcrs, n)
+	}
+	sort.Ints(pcrs)
+	return pcrs, nil
+}
+
+// ParsePCRValues parses a list of "INDEX=HEX" strings that specify
+// expected SHA-256 PCR values.
+func ParsePCRValues(vals []string) (map[int][]byte, error) {
+	values := make(map[int][]byte)
+	for _, v := range vals {
+		fields := strings.SplitN(v, "=", 2)
+		if len(fields) != 2 {
+			return nil, errors.New("invalid PCR value: " + v)
+		}
+		n, err := strconv.Atoi(fields[0])
+		if err != nil || n < 0 || n > maxPCR {
+			return nil, errors.New("invalid PCR index: " + fields[0])
+		}
+		digest, err := hex.DecodeString(fields[1])
+		if err != nil || len(digest) != pcrDigestSize {
+			return nil, errors.New("invalid SHA-256 PCR value: " + fields[1])
+		}
+		values[n] = digest
+	}
+	return values, nil
+}
+
+// pcrDigest computes the digest of PCR values for TPM2_PolicyPCR.
+// pcrs must be sorted.
+func pcrDigest(pcrs []int, values map[int][]byte) ([]byte, error) {
+	h := sha256.New()
+	for _, n := range pcrs {
+		v, ok := values[n]
+		if !ok {
+			return nil, fmt.Errorf("no value for PCR %d", n)
+		}
+		h.Write(v)
+	}
+	return h.Sum(nil), nil
+}
+
+func pcrBitmap(pcrs []int) [3]byte {
+	var b [3]byte
+	for _, n := range pcrs {
+		b[n/8] |= 1 << (n % 8)
+	}
+	return b
+}
+
+func pcrsFromBitmap(b []byte) []int {
+	var pcrs []int
+	for n := 0; n <= maxPCR; n++ {
+		if b[n/8]&(1<<(n%8)) != 0 {
+			pcrs = append(pcrs, n)
+		}
+	}
+	return pcrs
+}
+
+// sealedKEK is the content of the NV index for the KEK sealed to PCRs.
+//
+// The KEK is encrypted with a wrapping key that is sealed to PCRs
+// as a persistent object because the KEK is too large to be sealed.
+type sealedKEK struct {
+	// current is the list of PCRs that the object at tpmSealedHandle is sealed to.
+	current []int
+	// pending is the list of PCRs that the object at tpmPendingHandle is sealed to.
+	pending []int
+	nonce   []byte
+	data    []byte
+}
+
+func (s *sealedKEK) marshal() []byte {
+	data := make([]byte, 0, tpmSealedSize)
+	current := pcrBitmap(s.current)
+	pending := pcrBitmap(s.pending)
+	data = append(data, tpmSealedVersion)
+	data = append(data, current[:]...)
+	data = append(data, pending[:]...)
+	data = append(data, s.nonce...)
+	return append(data, s.data...)
+}
+
+func unmarshalSealedKEK(data []byte) (*sealedKEK, error) {
+	if len(data) != tpmSealedSize {
+		return nil, fmt.Errorf("invalid sealed KEK size: %d", len(data))
+	}
+	if data[0] != tpmSealedVersion {
+		return nil, fmt.Errorf("unknown sealed KEK version: %d", data[0])
+	}
+	return &sealedKEK{
+		current: pcrsFromBitmap(data[1:4]),
+		pending: pcrsFromBitmap(data[4:7]),
+		nonce:   data[tpmSealedHeaderSize:(tpmSealedHeaderSize + gcmNonceSize)],
+		data:    data[(tpmSealedHeaderSize + gcmNonceSize):],
+	}, nil
+}
+
+func kekAEAD(wrapKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(wrapKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
 
 type tpmDriver struct {
 	io.ReadWriteCloser
@@ -85,7 +252,322 @@ func (t *tpmDriver) undefineNVSpace() error {
 	return tpm2.NVUndefineSpace(t, "", tpm2.HandleOwner, tpmOffset)
 }
 
-func readKeyFromTPM(device string) ([]byte, TpmVersionID, error) {
+// isUndefined returns true if err is returned for undefined handles.
+func isUndefined(err error) bool {
+	var e tpm2.HandleError
+	return errors.As(err, &e) && e.Code == tpm2.RCHandle
+}
+
+// readSealedKEK reads the sealed KEK.  This returns nil if the KEK is not sealed.
+func (t *tpmDriver) readSealedKEK() (*sealedKEK, error) {
+	_, err := tpm2.NVReadPublic(t, tpmSealedOffset)
+	if isUndefined(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := tpm2.NVReadEx(t, tpmSealedOffset, tpm2.HandleOwner, "", 0)
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalSealedKEK(data)
+}
+
+func (t *tpmDriver) writeSealedKEK(s *sealedKEK) error {
+	attr := tpm2.AttrOwnerWrite | tpm2.AttrOwnerRead
+	err := tpm2.NVDefineSpace(t, tpm2.HandleOwner, tpmSealedOffset, "", "", nil, attr, uint16(tpmSealedSize))
+	if err != nil {
+		e, ok := err.(tpm2.Error)
+		if !ok || e.Code != tpm2.RCNVDefined {
+			return err
+		}
+	}
+	return tpm2.NVWrite(t, tpm2.HandleOwner, tpmSealedOffset, "", s.marshal(), 0)
+}
+
+// readPCRs reads SHA-256 PCR values.
+func (t *tpmDriver) readPCRs(pcrs []int) (map[int][]byte, error) {
+	values := make(map[int][]byte)
+	for i := 0; i < len(pcrs); i += pcrsPerRead {
+		end := i + pcrsPerRead
+		if end > len(pcrs) {
+			end = len(pcrs)
+		}
+		vals, err := tpm2.ReadPCRs(t, tpm2.PCRSelection{Hash: tpm2.AlgSHA256, PCRs: pcrs[i:end]})
+		if err != nil {
+			return nil, err
+		}
+		for n, v := range vals {
+			values[n] = v
+		}
+	}
+	return values, nil
+}
+
+func (t *tpmDriver) startSession(typ tpm2.SessionType) (tpmutil.Handle, error) {
+	nonce := make([]byte, sessionNonceSz)
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return 0, err
+	}
+	sess, _, err := tpm2.StartAuthSession(t, tpm2.HandleNull, tpm2.HandleNull, nonce, nil, typ, tpm2.AlgNull, tpm2.AlgSHA256)
+	return sess, err
+}
+
+// policyDigest computes the policy digest for PCR values with a trial session.
+func (t *tpmDriver) policyDigest(pcrs []int, values map[int][]byte) ([]byte, error) {
+	digest, err := pcrDigest(pcrs, values)
+	if err != nil {
+		return nil, err
+	}
+
+	sess, err := t.startSession(tpm2.SessionTrial)
+	if err != nil {
+		return nil, err
+	}
+	defer tpm2.FlushContext(t, sess)
+
+	err = tpm2.PolicyPCR(t, sess, digest, tpm2.PCRSelection{Hash: tpm2.AlgSHA256, PCRs: pcrs})
+	if err != nil {
+		return nil, err
+	}
+	return tpm2.PolicyGetDigest(t, sess)
+}
+
+// sealTo seals secret to PCR values and stores it at the persistent handle.
+func (t *tpmDriver) sealTo(handle tpmutil.Handle, pcrs []int, values map[int][]byte, secret []byte) error {
+	policy, err := t.policyDigest(pcrs, values)
+	if err != nil {
+		return err
+	}
+
+	srk, _, err := tpm2.CreatePrimary(t, tpm2.HandleOwner, tpm2.PCRSelection{}, "", "", srkTemplate)
+	if err != nil {
+		return err
+	}
+	defer tpm2.FlushContext(t, srk)
+
+	priv, pub, err := tpm2.Seal(t, srk, "", "", policy, secret)
+	if err != nil {
+		return err
+	}
+	obj, _, err := tpm2.Load(t, srk, "", pub, priv)
+	if err != nil {
+		return err
+	}
+	defer tpm2.FlushContext(t, obj)
+
+	err = t.evict(handle)
+	if err != nil {
+		return err
+	}
+	return tpm2.EvictControl(t, "", tpm2.HandleOwner, obj, handle)
+}
+
+// evict removes the persistent object at handle if exists.
+func (t *tpmDriver) evict(handle tpmutil.Handle) error {
+	err := tpm2.EvictControl(t, "", tpm2.HandleOwner, handle, handle)
+	if isUndefined(err) {
+		return nil
+	}
+	return err
+}
+
+// unsealFrom unseals the persistent object at handle with current PCR values.
+func (t *tpmDriver) unsealFrom(handle tpmutil.Handle, pcrs []int) ([]byte, error) {
+	sess, err := t.startSession(tpm2.SessionPolicy)
+	if err != nil {
+		return nil, err
+	}
+	defer tpm2.FlushContext(t, sess)
+
+	err = tpm2.PolicyPCR(t, sess, nil, tpm2.PCRSelection{Hash: tpm2.AlgSHA256, PCRs: pcrs})
+	if err != nil {
+		return nil, err
+	}
+	return tpm2.UnsealWithSession(t, sess, handle, "")
+}
+
+// sealKEK seals kek to current values of pcrs.
+func (t *tpmDriver) sealKEK(kek []byte, pcrs []int) error {
+	values, err := t.readPCRs(pcrs)
+	if err != nil {
+		return err
+	}
+
+	wrapKey := make([]byte, tpmWrapKeyLength)
+	_, err = rand.Read(wrapKey)
+	if err != nil {
+		return err
+	}
+	aead, err := kekAEAD(wrapKey)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcmNonceSize)
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return err
+	}
+
+	err = t.sealTo(tpmSealedHandle, pcrs, values, wrapKey)
+	if err != nil {
+		return err
+	}
+	err = t.evict(tpmPendingHandle)
+	if err != nil {
+		return err
+	}
+	return t.writeSealedKEK(&sealedKEK{
+		current: pcrs,
+		nonce:   nonce,
+		data:    aead.Seal(nil, nonce, kek, nil),
+	})
+}
+
+// unsealWrapKey unseals the wrapping key of the sealed KEK.
+//
+// If the current object cannot be unsealed but the pending object can,
+// the pending object becomes current.
+func (t *tpmDriver) unsealWrapKey(s *sealedKEK) ([]byte, error) {
+	wrapKey, err := t.unsealFrom(tpmSealedHandle, s.current)
+	if err == nil {
+		return wrapKey, nil
+	}
+	if len(s.pending) == 0 {
+		return nil, fmt.Errorf("failed to unseal TPM key encryption key; boot chain may be tampered: %w", err)
+	}
+
+	wrapKey, err2 := t.unsealFrom(tpmPendingHandle, s.pending)
+	if err2 != nil {
+		return nil, fmt.Errorf("failed to unseal TPM key encryption key; boot chain may be tampered: %w", err)
+	}
+
+	log.Info("unsealed TPM key encryption key with the pending policy; promote it", map[string]interface{}{
+		"pcrs": s.pending,
+	})
+	values, err := t.readPCRs(s.pending)
+	if err != nil {
+		return nil, err
+	}
+	err = t.sealTo(tpmSealedHandle, s.pending, values, wrapKey)
+	if err != nil {
+		return nil, err
+	}
+	err = t.evict(tpmPendingHandle)
+	if err != nil {
+		return nil, err
+	}
+	s.current = s.pending
+	s.pending = nil
+	err = t.writeSealedKEK(s)
+	if err != nil {
+		return nil, err
+	}
+	return wrapKey, nil
+}
+
+func (t *tpmDriver) unsealKEK(s *sealedKEK) ([]byte, error) {
+	wrapKey, err := t.unsealWrapKey(s)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := kekAEAD(wrapKey)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Open(nil, s.nonce, s.data, nil)
+}
+
+// readKEK reads the KEK from TPM.
+//
+// If the KEK is stored in the NV index in plaintext and pcrs is not empty,
+// the KEK is sealed to pcrs and the NV index is removed.
+func (t *tpmDriver) readKEK(pcrs []int) ([]byte, error) {
+	s, err := t.readSealedKEK()
+	if err != nil {
+		return nil, err
+	}
+	if s != nil {
+		return t.unsealKEK(s)
+	}
+
+	kek, err := t.readKEKFromTPM()
+	if err != nil {
+		log.Info("TPM key encryption key was not found", map[string]interface{}{
+			log.FnError: err,
+		})
+		err = t.allocateNVRAM()
+		if err != nil {
+			return nil, err
+		}
+		kek, err = t.readKEKFromTPM()
+		if err != nil {
+			panic(err)
+		}
+	}
+	if len(pcrs) == 0 {
+		return kek, nil
+	}
+
+	log.Info("sealing TPM key encryption key to PCRs", map[string]interface{}{
+		"pcrs": pcrs,
+	})
+	err = t.sealKEK(kek, pcrs)
+	if err != nil {
+		return nil, err
+	}
+	err = t.undefineNVSpace()
+	if err != nil {
+		return nil, err
+	}
+	return kek, nil
+}
+
+// reseal seals the KEK to the expected PCR values for the next boot.
+//
+// The KEK is sealed to pcrs.  If pcrs is empty, PCRs of the current policy
+// are used.  Values of PCRs not in expected are the current values.
+// The current policy remains valid until the new policy is used.
+func (t *tpmDriver) reseal(pcrs []int, expected map[int][]byte) error {
+	s, err := t.readSealedKEK()
+	if err != nil {
+		return err
+	}
+	if s == nil {
+		return errors.New("TPM key encryption key is not sealed")
+	}
+	if len(pcrs) == 0 {
+		pcrs = s.current
+	}
+
+	wrapKey, err := t.unsealWrapKey(s)
+	if err != nil {
+		return err
+	}
+
+	values, err := t.readPCRs(pcrs)
+	if err != nil {
+		return err
+	}
+	for n, v := range expected {
+		if _, ok := values[n]; !ok {
+			return fmt.Errorf("PCR %d is not in the policy", n)
+		}
+		values[n] = v
+	}
+
+	err = t.sealTo(tpmPendingHandle, pcrs, values, wrapKey)
+	if err != nil {
+		return err
+	}
+	s.pending = pcrs
+	return t.writeSealedKEK(s)
+}
+
+func openTPM(device string) (*tpmDriver, TpmVersionID, error) {
 	rw, err := tpm2.OpenTPM(device)
 	if err != nil {
 		t2, err2 := tpm.OpenTPM(device)
@@ -98,25 +580,19 @@ func readKeyFromTPM(device string) ([]byte, TpmVersionID, error) {
 		}
 		return nil, TpmNone, err
 	}
+	return &tpmDriver{rw}, Tpm20, nil
+}
 
-	t := &tpmDriver{rw}
-	defer t.Close()
-
-	kek, err := t.readKEKFromTPM()
-	if err == nil {
-		return kek, Tpm20, nil
+func readKeyFromTPM(device string, pcrs []int) ([]byte, TpmVersionID, error) {
+	t, version, err := openTPM(device)
+	if t == nil {
+		return nil, version, err
 	}
+	defer t.Close()
 
-	log.Info("TPM key encryption key was not found", map[string]interface{}{
-		log.FnError: err,
-	})
-	err = t.allocateNVRAM()
+	kek, err := t.readKEK(pcrs)
 	if err != nil {
 		return nil, TpmNone, err
 	}
-	kek, err = t.readKEKFromTPM()
-	if err != nil {
-		panic(err)
-	}
 	return kek, Tpm20, nil
 }
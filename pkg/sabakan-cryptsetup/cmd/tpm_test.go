@@ -0,0 +1,209 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-tpm-tools/simulator"
+	"github.com/google/go-tpm/legacy/tpm2"
+	"github.com/google/go-tpm/tpmutil"
+)
+
+func TestParsePCRs(t *testing.T) {
+	t.Parallel()
+
+	pcrs, err := ParsePCRs("7, 0,4,2,4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pcrs, []int{0, 2, 4, 7}) {
+		t.Error("wrong PCRs:", pcrs)
+	}
+
+	pcrs, err = ParsePCRs("")
+	if err != nil || pcrs != nil {
+		t.Error("empty PCRs should be nil:", pcrs, err)
+	}
+
+	for _, s := range []string{"24", "-1", "a", "1,,2"} {
+		_, err = ParsePCRs(s)
+		if err == nil {
+			t.Error("invalid PCRs should be rejected:", s)
+		}
+	}
+}
+
+func TestParsePCRValues(t *testing.T) {
+	t.Parallel()
+
+	digest := sha256.Sum256([]byte("kernel"))
+	values, err := ParsePCRValues([]string{"9=" + hex.EncodeToString(digest[:])})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(values[9], digest[:]) {
+		t.Error("wrong PCR value:", values)
+	}
+
+	for _, v := range []string{"9", "24=" + hex.EncodeToString(digest[:]), "9=abcd", "9=xyz"} {
+		_, err = ParsePCRValues([]string{v})
+		if err == nil {
+			t.Error("invalid PCR value should be rejected:", v)
+		}
+	}
+}
+
+func TestSealedKEK(t *testing.T) {
+	t.Parallel()
+
+	s := &sealedKEK{
+		current: []int{0, 2, 4, 7},
+		pending: []int{0, 2, 4, 7, 23},
+		nonce:   bytes.Repeat([]byte{1}, gcmNonceSize),
+		data:    bytes.Repeat([]byte{2}, tpmKekLength+16),
+	}
+	data := s.marshal()
+	if len(data) != tpmSealedSize {
+		t.Fatal("wrong size:", len(data))
+	}
+
+	s2, err := unmarshalSealedKEK(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s, s2) {
+		t.Errorf("wrong sealed KEK: %#v", s2)
+	}
+
+	_, err = unmarshalSealedKEK(data[1:])
+	if err == nil {
+		t.Error("short data should be rejected")
+	}
+}
+
+func TestPCRDigest(t *testing.T) {
+	t.Parallel()
+
+	v0 := bytes.Repeat([]byte{0}, pcrDigestSize)
+	v7 := bytes.Repeat([]byte{7}, pcrDigestSize)
+	digest, err := pcrDigest([]int{0, 7}, map[int][]byte{0: v0, 7: v7, 9: v0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := sha256.Sum256(append(append([]byte(nil), v0...), v7...))
+	if !bytes.Equal(digest, expected[:]) {
+		t.Error("wrong digest")
+	}
+
+	_, err = pcrDigest([]int{0, 2}, map[int][]byte{0: v0})
+	if err == nil {
+		t.Error("missing PCR value should be an error")
+	}
+}
+
+// TestTPMSeal tests sealing with the TPM 2.0 simulator.
+func TestTPMSeal(t *testing.T) {
+	sim, err := simulator.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp := &tpmDriver{sim}
+	defer tp.Close()
+
+	// PCR 16 is the debug PCR that can be reset.
+	const testPCR = 16
+	pcrs := []int{testPCR}
+	cleanup := func() {
+		tpm2.PCRReset(tp, tpmutil.Handle(testPCR))
+		tp.evict(tpmSealedHandle)
+		tp.evict(tpmPendingHandle)
+		tpm2.NVUndefineSpace(tp, "", tpm2.HandleOwner, tpmSealedOffset)
+		tp.undefineNVSpace()
+	}
+	cleanup()
+	defer cleanup()
+
+	kek, err := tp.readKEK(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kek) != tpmKekLength {
+		t.Fatal("wrong KEK length:", len(kek))
+	}
+
+	// migrate from the plaintext NV index
+	kek2, err := tp.readKEK(pcrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(kek, kek2) {
+		t.Fatal("KEK changed by migration")
+	}
+	_, err = tp.readKEKFromTPM()
+	if err == nil {
+		t.Error("plaintext KEK remains")
+	}
+	kek2, err = tp.readKEK(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(kek, kek2) {
+		t.Fatal("KEK cannot be unsealed")
+	}
+
+	// tampered boot chain
+	extend := sha256.Sum256([]byte("tampered"))
+	err = tpm2.PCRExtend(tp, tpmutil.Handle(testPCR), tpm2.AlgSHA256, extend[:], "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tp.readKEK(nil)
+	if err == nil {
+		t.Fatal("KEK is unsealed with wrong PCR values")
+	}
+	err = tpm2.PCRReset(tp, tpmutil.Handle(testPCR))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// planned update
+	values, err := tp.readPCRs(pcrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	update := sha256.Sum256([]byte("new kernel"))
+	next := sha256.Sum256(append(values[testPCR], update[:]...))
+	err = tp.reseal(nil, map[int][]byte{testPCR: next[:]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kek2, err = tp.readKEK(nil)
+	if err != nil {
+		t.Fatal("KEK cannot be unsealed before the update:", err)
+	}
+	if !bytes.Equal(kek, kek2) {
+		t.Fatal("wrong KEK before the update")
+	}
+
+	err = tpm2.PCRExtend(tp, tpmutil.Handle(testPCR), tpm2.AlgSHA256, update[:], "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kek2, err = tp.readKEK(nil)
+	if err != nil {
+		t.Fatal("KEK cannot be unsealed after the update:", err)
+	}
+	if !bytes.Equal(kek, kek2) {
+		t.Fatal("wrong KEK after the update")
+	}
+	s, err := tp.readSealedKEK()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.pending) != 0 {
+		t.Error("pending policy is not promoted:", s.pending)
+	}
+}
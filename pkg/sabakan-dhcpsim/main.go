@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cybozu-go/log"
+	"github.com/cybozu-go/sabakan/v3/dhcpsim"
+	"github.com/cybozu-go/well"
+)
+
+var (
+	flagServer      = flag.String("server", "127.0.0.1:10067", "<IP>:<Port number> of the DHCP server")
+	flagListen      = flag.String("listen", "0.0.0.0:10067", "<IP>:<Port number> to receive replies")
+	flagClients     = flag.Int("clients", 1000, "number of simulated clients")
+	flagConcurrency = flag.Int("concurrency", 100, "number of clients running at once")
+	flagBaseMAC     = flag.String("base-mac", "02:00:00:00:00:00", "MAC address of the first client")
+	flagRelays      = flag.String("relays", "", "comma-separated relay addresses assigned to clients in turn")
+	flagTimeout     = flag.Duration("timeout", dhcpsim.DefaultTimeout, "timeout to wait for a reply")
+	flagRenew       = flag.Bool("renew", false, "renew leases")
+	flagRelease     = flag.Bool("release", false, "release leases at the end")
+	flagHTTP        = flag.Bool("http", false, "request iPXE boot and fetch boot files over HTTP")
+	flagSerials     = flag.String("serials", "", "comma-separated machine serials assigned to clients in turn")
+	flagJSON        = flag.Bool("json", false, "output the report in JSON")
+)
+
+func main() {
+	flag.Parse()
+	well.LogConfig{}.Apply()
+
+	well.Go(subMain)
+	well.Stop()
+	err := well.Wait()
+	if !well.IsSignaled(err) && err != nil {
+		log.ErrorExit(err)
+	}
+}
+
+func subMain(ctx context.Context) error {
+	baseMAC, err := net.ParseMAC(*flagBaseMAC)
+	if err != nil {
+		return err
+	}
+
+	var relays []net.IP
+	if *flagRelays != "" {
+		for _, s := range strings.Split(*flagRelays, ",") {
+			ip := net.ParseIP(s)
+			if ip == nil || ip.To4() == nil {
+				return errors.New("invalid relay address: " + s)
+			}
+			relays = append(relays, ip.To4())
+		}
+	}
+
+	var serials []string
+	if *flagSerials != "" {
+		serials = strings.Split(*flagSerials, ",")
+	}
+
+	transport, err := dhcpsim.NewSocketTransport(*flagListen, *flagServer, *flagTimeout)
+	if err != nil {
+		return err
+	}
+
+	env := well.NewEnvironment(ctx)
+	env.Go(transport.Run)
+
+	sim := &dhcpsim.Simulator{
+		Transport:   transport,
+		Clients:     *flagClients,
+		Concurrency: *flagConcurrency,
+		BaseMAC:     baseMAC,
+		RelayAddrs:  relays,
+		Renew:       *flagRenew,
+		Release:     *flagRelease,
+		IPXE:        *flagHTTP,
+		Serials:     serials,
+	}
+	if *flagHTTP {
+		sim.HTTPClient = &http.Client{Timeout: 10 * time.Minute}
+	}
+
+	report, err := sim.Run(ctx)
+	env.Cancel(nil)
+	env.Wait()
+	if err != nil {
+		return err
+	}
+
+	if *flagJSON {
+		return json.NewEncoder(os.Stdout).Encode(report)
+	}
+	return report.Write(os.Stdout)
+}
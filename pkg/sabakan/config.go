@@ -1,6 +1,10 @@
 package main
 
-import "github.com/cybozu-go/etcdutil"
+import (
+	"github.com/cybozu-go/etcdutil"
+	"github.com/cybozu-go/sabakan/v3"
+	"github.com/cybozu-go/sabakan/v3/dhcpd"
+)
 
 const (
 	defaultListenHTTP     = "0.0.0.0:10080"
@@ -14,6 +18,12 @@ const (
 	defaultServerKeyFile  = "/etc/sabakan/server.key"
 )
 
+// Backend storages
+const (
+	storageEtcd     = "etcd"
+	storageEmbedded = "embedded"
+)
+
 var (
 	defaultAllowIPs = []string{"127.0.0.1", "::1"}
 )
@@ -26,6 +36,7 @@ func newConfig() *config {
 		DHCPBind:       defaultDHCPBind,
 		IPXEPath:       defaultIPXEPath,
 		DataDir:        defaultDataDir,
+		Storage:        storageEtcd,
 		AllowIPs:       defaultAllowIPs,
 		Etcd:           etcdutil.NewConfig(defaultEtcdPrefix),
 		ServerCertFile: defaultServerCertFile,
@@ -40,6 +51,7 @@ type config struct {
 	DHCPBind          string `json:"dhcp-bind"`
 	IPXEPath          string `json:"ipxe-efi-path"`
 	DataDir           string `json:"data-dir"`
+	Storage           string `json:"storage"`
 	AdvertiseURL      string `json:"advertise-url"`
 	AdvertiseURLHTTPS string `json:"advertise-url-https"`
 
@@ -48,4 +60,40 @@ type config struct {
 	Etcd           *etcdutil.Config `json:"etcd"`
 	ServerCertFile string           `json:"server-cert"`
 	ServerKeyFile  string           `json:"server-key"`
+	ClientCAFile   string           `json:"client-ca"`
+
+	DHCPPolicy   *dhcpd.PolicyConfig   `json:"dhcp-policy"`
+	DHCPBootLoop *dhcpd.BootLoopConfig `json:"dhcp-boot-loop"`
+	RBAC         *sabakan.RBACConfig   `json:"rbac"`
+	CryptAccess  *cryptAccessConfig    `json:"crypt-access"`
+	MasterKeys   *masterKeysConfig     `json:"crypt-master-keys"`
+	Audit        *auditConfig          `json:"audit"`
+	Objects      *objectStorageConfig  `json:"object-storage"`
+}
+
+type cryptAccessConfig struct {
+	OwnerOnly                bool     `json:"owner-only"`
+	TokenSecretFile          string   `json:"token-secret-file"`
+	PreviousTokenSecretFiles []string `json:"previous-token-secret-files"`
+}
+
+type masterKeysConfig struct {
+	Current string            `json:"current"`
+	Files   map[string]string `json:"files"`
+}
+
+type auditConfig struct {
+	RetentionDays int    `json:"retention-days"`
+	ArchiveDir    string `json:"archive-dir"`
+	CheckpointKey string `json:"checkpoint-key"`
+}
+
+type objectStorageConfig struct {
+	Endpoint            string `json:"endpoint"`
+	Region              string `json:"region"`
+	Bucket              string `json:"bucket"`
+	Prefix              string `json:"prefix"`
+	AccessKeyID         string `json:"access-key-id"`
+	SecretAccessKeyFile string `json:"secret-access-key-file"`
+	Redirect            bool   `json:"redirect"`
 }
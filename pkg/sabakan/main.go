@@ -1,7 +1,12 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/ed25519"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
 	"errors"
 	"flag"
 	"net"
@@ -16,8 +21,12 @@ import (
 	"github.com/cybozu-go/log"
 	"github.com/cybozu-go/sabakan/v3"
 	"github.com/cybozu-go/sabakan/v3/dhcpd"
+	"github.com/cybozu-go/sabakan/v3/kms"
+	"github.com/cybozu-go/sabakan/v3/logarchive"
 	"github.com/cybozu-go/sabakan/v3/metrics"
+	"github.com/cybozu-go/sabakan/v3/models/embedded"
 	"github.com/cybozu-go/sabakan/v3/models/etcd"
+	"github.com/cybozu-go/sabakan/v3/objectstore"
 	"github.com/cybozu-go/sabakan/v3/web"
 	"github.com/cybozu-go/well"
 	"go.universe.tf/netboot/dhcp4"
@@ -35,6 +44,7 @@ var (
 	flagDHCPBind          = flag.String("dhcp-bind", defaultDHCPBind, "bound ip addresses and port for dhcp server")
 	flagIPXEPath          = flag.String("ipxe-efi-path", defaultIPXEPath, "path to ipxe.efi")
 	flagDataDir           = flag.String("data-dir", defaultDataDir, "directory to store files")
+	flagStorage           = flag.String("storage", storageEtcd, "backend storage: etcd or embedded")
 	flagAdvertiseURL      = flag.String("advertise-url", "", "public URL of this server")
 	flagAdvertiseURLHTTPS = flag.String("advertise-url-https", "", "public URL of this server(https)")
 	flagAllowIPs          = flag.String("allow-ips", strings.Join(defaultAllowIPs, ","), "comma-separated IPs allowed to change resources")
@@ -50,6 +60,7 @@ var (
 	flagEtcdTLSKey     = flag.String("etcd-tls-key", "", "path to my key used to identify myself to etcd servers")
 	flagSabakanTLSCert = flag.String("server-cert", defaultServerCertFile, "path to server TLS certificate of sabakan")
 	flagSabakanTLSKey  = flag.String("server-key", defaultServerKeyFile, "path to server TLS key of sabakan")
+	flagClientCA       = flag.String("client-ca", "", "path to CA bundle used to verify client certificates")
 
 	flagConfigFile = flag.String("config-file", "", "path to configuration file")
 )
@@ -90,6 +101,7 @@ func subMain(ctx context.Context) error {
 		cfg.AllowIPs = strings.Split(*flagAllowIPs, ",")
 		cfg.DHCPBind = *flagDHCPBind
 		cfg.DataDir = *flagDataDir
+		cfg.Storage = *flagStorage
 		cfg.IPXEPath = *flagIPXEPath
 		cfg.ListenHTTP = *flagHTTP
 		cfg.ListenHTTPS = *flagHTTPS
@@ -106,6 +118,7 @@ func subMain(ctx context.Context) error {
 		cfg.Etcd.TLSKeyFile = *flagEtcdTLSKey
 		cfg.ServerCertFile = *flagSabakanTLSCert
 		cfg.ServerKeyFile = *flagSabakanTLSKey
+		cfg.ClientCAFile = *flagClientCA
 	} else {
 		data, err := os.ReadFile(*flagConfigFile)
 		if err != nil {
@@ -134,14 +147,77 @@ func subMain(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+	if cfg.RBAC != nil {
+		err = cfg.RBAC.Validate()
+		if err != nil {
+			return err
+		}
+	}
 
-	c, err := etcdutil.NewClient(cfg.Etcd)
-	if err != nil {
-		return err
+	var logConfig sabakan.LogConfig
+	if cfg.Audit != nil {
+		if cfg.Audit.RetentionDays < 0 {
+			return errors.New("audit retention-days must not be negative")
+		}
+		logConfig.RetentionDays = cfg.Audit.RetentionDays
+		if cfg.Audit.ArchiveDir != "" {
+			logConfig.Archive, err = logarchive.NewDir(cfg.Audit.ArchiveDir)
+			if err != nil {
+				return err
+			}
+		}
+		if cfg.Audit.CheckpointKey != "" {
+			logConfig.CheckpointKey, err = loadCheckpointKey(cfg.Audit.CheckpointKey)
+			if err != nil {
+				return err
+			}
+		}
 	}
-	defer c.Close()
 
-	model := etcd.NewModel(c, cfg.DataDir, advertiseURL)
+	var model sabakan.Model
+	switch cfg.Storage {
+	case storageEtcd:
+		c, err := etcdutil.NewClient(cfg.Etcd)
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+
+		var masterKeys sabakan.KMS
+		if cfg.MasterKeys != nil {
+			masterKeys, err = kms.LoadLocal(cfg.MasterKeys.Current, cfg.MasterKeys.Files)
+			if err != nil {
+				return err
+			}
+		}
+
+		objectConfig, err := newObjectConfig(cfg.Objects)
+		if err != nil {
+			return err
+		}
+
+		model = etcd.NewModel(c, cfg.DataDir, advertiseURL, masterKeys, logConfig, objectConfig)
+	case storageEmbedded:
+		if cfg.MasterKeys != nil {
+			return errors.New("crypt-master-keys cannot be used with the embedded storage")
+		}
+		if cfg.Objects != nil {
+			return errors.New("object-storage cannot be used with the embedded storage")
+		}
+
+		db, err := embedded.OpenDB(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		model, err = embedded.NewModel(db, cfg.DataDir, advertiseURL, logConfig)
+		if err != nil {
+			return err
+		}
+	default:
+		return errors.New("unknown storage: " + cfg.Storage)
+	}
 
 	// update schema
 	sv, err := model.Schema.Version(ctx)
@@ -169,9 +245,24 @@ func subMain(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+	var dhcpHandler dhcpd.Handler = dhcpd.DHCPHandler{Model: model, MyURL: advertiseURL}
+	if cfg.DHCPBootLoop != nil && cfg.DHCPBootLoop.MaxBoots > 0 {
+		dhcpHandler, err = dhcpd.NewBootLoopHandler(dhcpHandler, cfg.DHCPBootLoop, model.Machine)
+		if err != nil {
+			return err
+		}
+	}
+	if cfg.DHCPPolicy != nil {
+		dhcpHandler, err = dhcpd.NewPolicyHandler(dhcpHandler, cfg.DHCPPolicy, model.Machine)
+		if err != nil {
+			return err
+		}
+	}
+	dhcpTrace := dhcpd.NewTraceBuffer(dhcpd.DefaultTraceEntries, dhcpd.DefaultTraceClients)
 	dhcpServer := dhcpd.Server{
-		Handler: dhcpd.DHCPHandler{Model: model, MyURL: advertiseURL},
+		Handler: dhcpHandler,
 		Conn:    conn,
+		Trace:   dhcpTrace,
 	}
 	env.Go(dhcpServer.Serve)
 
@@ -181,8 +272,15 @@ func subMain(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+	cryptPolicy, err := newCryptPolicy(cfg.CryptAccess)
+	if err != nil {
+		return err
+	}
 	counter := metrics.NewCounter()
 	webServer := web.NewServer(model, cfg.IPXEPath, cryptsetupPath, advertiseURL, advertiseURLHTTPS, allowedIPs, cfg.Playground, counter, false)
+	webServer.DHCPTrace = dhcpTrace
+	webServer.RBAC = cfg.RBAC
+	webServer.CryptPolicy = cryptPolicy
 	s := &well.HTTPServer{
 		Server: &http.Server{
 			Addr:    cfg.ListenHTTP,
@@ -197,11 +295,19 @@ func subMain(ctx context.Context) error {
 	}
 
 	// HTTPS API
+	tlsConfig, err := newTLSConfig(cfg.ClientCAFile)
+	if err != nil {
+		return err
+	}
 	webServerHTTPS := web.NewServer(model, cfg.IPXEPath, cryptsetupPath, advertiseURL, advertiseURLHTTPS, allowedIPs, cfg.Playground, counter, true)
+	webServerHTTPS.DHCPTrace = dhcpTrace
+	webServerHTTPS.RBAC = cfg.RBAC
+	webServerHTTPS.CryptPolicy = cryptPolicy
 	ss := &well.HTTPServer{
 		Server: &http.Server{
-			Addr:    cfg.ListenHTTPS,
-			Handler: webServerHTTPS,
+			Addr:      cfg.ListenHTTPS,
+			Handler:   webServerHTTPS,
+			TLSConfig: tlsConfig,
 		},
 		ShutdownTimeout: 3 * time.Minute,
 		Env:             env,
@@ -228,6 +334,110 @@ func subMain(ctx context.Context) error {
 	return env.Wait()
 }
 
+// newTLSConfig returns TLS configurations for the HTTPS server.
+// If caFile is given, clients may present certificates signed by the CA
+// to authenticate themselves.
+func newTLSConfig(caFile string) (*tls.Config, error) {
+	if caFile == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.New("no valid certificate in " + caFile)
+	}
+	return &tls.Config{
+		ClientCAs:  pool,
+		ClientAuth: tls.VerifyClientCertIfGiven,
+	}, nil
+}
+
+// loadCheckpointKey loads a PEM encoded PKCS #8 Ed25519 private key
+// to sign audit log checkpoints.
+func loadCheckpointKey(file string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data in " + file)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("not an Ed25519 private key: " + file)
+	}
+	return priv, nil
+}
+
+func newObjectConfig(cfg *objectStorageConfig) (etcd.ObjectConfig, error) {
+	if cfg == nil {
+		return etcd.ObjectConfig{}, nil
+	}
+	data, err := os.ReadFile(cfg.SecretAccessKeyFile)
+	if err != nil {
+		return etcd.ObjectConfig{}, err
+	}
+	store, err := objectstore.NewS3(objectstore.S3Config{
+		Endpoint:        cfg.Endpoint,
+		Region:          cfg.Region,
+		Bucket:          cfg.Bucket,
+		Prefix:          cfg.Prefix,
+		AccessKeyID:     cfg.AccessKeyID,
+		SecretAccessKey: string(bytes.TrimSpace(data)),
+	})
+	if err != nil {
+		return etcd.ObjectConfig{}, err
+	}
+	return etcd.ObjectConfig{Store: store, Redirect: cfg.Redirect}, nil
+}
+
+func newCryptPolicy(cfg *cryptAccessConfig) (*web.CryptPolicy, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	p := &web.CryptPolicy{
+		OwnerOnly: cfg.OwnerOnly,
+	}
+	if cfg.TokenSecretFile != "" {
+		secret, err := readTokenSecret(cfg.TokenSecretFile)
+		if err != nil {
+			return nil, err
+		}
+		p.TokenSecret = secret
+	}
+	if len(cfg.PreviousTokenSecretFiles) > 0 && p.TokenSecret == nil {
+		return nil, errors.New("previous-token-secret-files requires token-secret-file")
+	}
+	for _, f := range cfg.PreviousTokenSecretFiles {
+		secret, err := readTokenSecret(f)
+		if err != nil {
+			return nil, err
+		}
+		p.PreviousTokenSecrets = append(p.PreviousTokenSecrets, secret)
+	}
+	return p, nil
+}
+
+func readTokenSecret(file string) ([]byte, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	secret := bytes.TrimSpace(data)
+	if len(secret) == 0 {
+		return nil, errors.New("empty token secret in " + file)
+	}
+	return secret, nil
+}
+
 func parseAllowIPs(ips []string) ([]*net.IPNet, error) {
 	nets := make([]*net.IPNet, len(ips))
 	for i, cidr := range ips {
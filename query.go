@@ -53,6 +53,21 @@ func (q Query) Match(m *Machine) (bool, error) {
 			return false, nil
 		}
 	}
+	if mac := q["mac"]; len(mac) > 0 {
+		macs := strings.Split(mac, ",")
+		match := false
+		for _, macaddress := range macs {
+			for _, hw := range m.Spec.MACAddresses {
+				if strings.EqualFold(hw, macaddress) {
+					match = true
+					break
+				}
+			}
+		}
+		if !match {
+			return false, nil
+		}
+	}
 	if labels := q["labels"]; len(labels) > 0 {
 		queries := strings.Split(labels, ",")
 		for _, query := range queries {
@@ -151,6 +166,16 @@ func (q Query) Match(m *Machine) (bool, error) {
 			}
 		}
 	}
+	if withoutMAC := q["without-mac"]; len(withoutMAC) > 0 {
+		withoutMACs := strings.Split(withoutMAC, ",")
+		for _, wMAC := range withoutMACs {
+			for _, hw := range m.Spec.MACAddresses {
+				if strings.EqualFold(hw, wMAC) {
+					return false, nil
+				}
+			}
+		}
+	}
 	if withoutLabels := q["without-labels"]; len(withoutLabels) > 0 {
 		queries := strings.Split(withoutLabels, ",")
 		excluded := true
@@ -226,6 +251,9 @@ func (q Query) IPv4() string { return q["ipv4"] }
 // IPv6 returns value of ipv6 in the query
 func (q Query) IPv6() string { return q["ipv6"] }
 
+// MAC returns value of mac in the query
+func (q Query) MAC() string { return q["mac"] }
+
 // BMCType returns value of bmc-type in the query
 func (q Query) BMCType() string { return q["bmc-type"] }
 
@@ -283,6 +311,10 @@ func (q Query) Valid() bool {
 	if hasIPv6 := q["ipv6"]; len(hasIPv6) > 0 && len(hasWithoutIPv6) > 0 {
 		return false
 	}
+	hasWithoutMAC := q["without-mac"]
+	if hasMAC := q["mac"]; len(hasMAC) > 0 && len(hasWithoutMAC) > 0 {
+		return false
+	}
 	hasWithoutBMCType := q["without-bmc-type"]
 	if hasBMCType := q["bmc-type"]; len(hasBMCType) > 0 && len(hasWithoutBMCType) > 0 {
 		return false
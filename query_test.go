@@ -22,6 +22,8 @@ func TestMatch(t *testing.T) {
 		{Query{"ipv6": "aa::ff"}, NewMachine(MachineSpec{IPv6: []string{"aa::ff", "bb::ff"}}), true},
 		{Query{"ipv6": "aa::ff,bb::ff"}, NewMachine(MachineSpec{IPv6: []string{"aa::ff", "bb::ff"}}), true},
 		{Query{"labels": "product=R630,datacenter=us"}, NewMachine(MachineSpec{Labels: map[string]string{"product": "R630", "datacenter": "us"}}), true},
+		{Query{"mac": "00:11:22:33:44:55"}, NewMachine(MachineSpec{MACAddresses: []string{"00:11:22:33:44:55"}}), true},
+		{Query{"mac": "00:11:22:33:44:AA,00:11:22:33:44:55"}, NewMachine(MachineSpec{MACAddresses: []string{"00:11:22:33:44:aa"}}), true},
 		{Query{"state": "uninitialized"}, NewMachine(MachineSpec{}), true},
 		{Query{"bmc-type": "iDRAC-9"}, NewMachine(MachineSpec{BMC: MachineBMC{Type: "iDRAC-9"}}), true},
 		{Query{"bmc-type": "iDRAC-9,IPMI-1.0"}, NewMachine(MachineSpec{BMC: MachineBMC{Type: "iDRAC-9"}}), true},
@@ -33,6 +35,7 @@ func TestMatch(t *testing.T) {
 		{Query{"ipv6": "aa::ff"}, NewMachine(MachineSpec{IPv6: []string{"bb::ff", "cc::ff"}}), false},
 		{Query{"ipv4": "10.20.30.40"}, NewMachine(MachineSpec{}), false},
 		{Query{"ipv6": "aa::ff"}, NewMachine(MachineSpec{}), false},
+		{Query{"mac": "00:11:22:33:44:55"}, NewMachine(MachineSpec{}), false},
 		{Query{"state": "unreachable"}, NewMachine(MachineSpec{}), false},
 		{Query{"bmc-type": "IPMI-1.0"}, NewMachine(MachineSpec{BMC: MachineBMC{Type: "iDRAC-9"}}), false},
 		{Query{"without-serial": "1234"}, NewMachine(MachineSpec{Serial: "1234"}), false},
@@ -48,6 +51,7 @@ func TestMatch(t *testing.T) {
 		{Query{"without-ipv6": "aa::ff"}, NewMachine(MachineSpec{IPv6: []string{"aa::ff", "bb::ff"}}), false},
 		{Query{"without-ipv6": "aa::ff,bb::ff"}, NewMachine(MachineSpec{IPv6: []string{"aa::ff", "bb::ff"}}), false},
 		{Query{"without-labels": "product=R630,datacenter=us"}, NewMachine(MachineSpec{Labels: map[string]string{"product": "R630", "datacenter": "us"}}), false},
+		{Query{"without-mac": "00:11:22:33:44:55"}, NewMachine(MachineSpec{MACAddresses: []string{"00:11:22:33:44:55"}}), false},
 		{Query{"without-state": "uninitialized"}, NewMachine(MachineSpec{}), false},
 		{Query{"without-state": "uninitialized,retired"}, NewMachine(MachineSpec{}), false},
 		{Query{"without-bmc-type": "iDRAC-9"}, NewMachine(MachineSpec{BMC: MachineBMC{Type: "iDRAC-9"}}), false},
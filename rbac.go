@@ -0,0 +1,187 @@
+package sabakan
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+)
+
+// ErrForbidden is returned when a principal is not permitted to access a resource.
+var ErrForbidden = errors.New("forbidden")
+
+// Verbs of API access.
+const (
+	VerbRead   = "read"
+	VerbWrite  = "write"
+	VerbDelete = "delete"
+)
+
+// RBACAny matches any categories or verbs in RBACRule.
+const RBACAny = "*"
+
+// RBACRule permits verbs on audit categories.
+type RBACRule struct {
+	Categories []AuditCategory `json:"categories"`
+	Verbs      []string        `json:"verbs"`
+}
+
+func (r RBACRule) allows(cat AuditCategory, verb string) bool {
+	catOK := false
+	for _, c := range r.Categories {
+		if c == cat || c == RBACAny {
+			catOK = true
+			break
+		}
+	}
+	if !catOK {
+		return false
+	}
+	for _, v := range r.Verbs {
+		if v == verb || v == RBACAny {
+			return true
+		}
+	}
+	return false
+}
+
+// RBACPrincipal maps an identity to roles.
+//
+// A principal is authenticated by the bearer token if Token is not empty.
+// Otherwise, it is authenticated by a client certificate whose identity is Name.
+type RBACPrincipal struct {
+	Name  string   `json:"name"`
+	Token string   `json:"token,omitempty"`
+	Roles []string `json:"roles"`
+}
+
+// RBACConfig is the configuration of role-based access control.
+type RBACConfig struct {
+	// Roles is a map from role names to rules.
+	Roles map[string][]RBACRule `json:"roles"`
+
+	// Principals is a list of principals.
+	Principals []RBACPrincipal `json:"principals"`
+
+	// AnonymousRoles is a list of roles granted to requests without
+	// authenticated principals.
+	AnonymousRoles []string `json:"anonymous-roles,omitempty"`
+}
+
+// Validate validates the configuration.
+func (c *RBACConfig) Validate() error {
+	for name, rules := range c.Roles {
+		for _, r := range rules {
+			if len(r.Categories) == 0 {
+				return fmt.Errorf("role %s: no categories", name)
+			}
+			for _, v := range r.Verbs {
+				switch v {
+				case VerbRead, VerbWrite, VerbDelete, RBACAny:
+				default:
+					return fmt.Errorf("role %s: invalid verb: %s", name, v)
+				}
+			}
+		}
+	}
+
+	checkRoles := func(roles []string) error {
+		for _, role := range roles {
+			if _, ok := c.Roles[role]; !ok {
+				return errors.New("no such role: " + role)
+			}
+		}
+		return nil
+	}
+
+	names := make(map[string]bool)
+	tokens := make(map[string]bool)
+	for _, p := range c.Principals {
+		if p.Name == "" {
+			return errors.New("principal name is empty")
+		}
+		if names[p.Name] {
+			return errors.New("duplicate principal: " + p.Name)
+		}
+		names[p.Name] = true
+		if p.Token != "" {
+			if tokens[p.Token] {
+				return errors.New("duplicate token for principal: " + p.Name)
+			}
+			tokens[p.Token] = true
+		}
+		if err := checkRoles(p.Roles); err != nil {
+			return fmt.Errorf("principal %s: %v", p.Name, err)
+		}
+	}
+	return checkRoles(c.AnonymousRoles)
+}
+
+// FindPrincipal returns the principal authenticated by a client certificate
+// whose identity is name.  This returns nil if not found.
+func (c *RBACConfig) FindPrincipal(name string) *RBACPrincipal {
+	for i := range c.Principals {
+		p := &c.Principals[i]
+		if p.Token == "" && p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// FindToken returns the principal authenticated by the bearer token.
+// This returns nil if not found.
+func (c *RBACConfig) FindToken(token string) *RBACPrincipal {
+	if token == "" {
+		return nil
+	}
+	for i := range c.Principals {
+		p := &c.Principals[i]
+		if p.Token == "" {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(p.Token), []byte(token)) == 1 {
+			return p
+		}
+	}
+	return nil
+}
+
+// Allows returns true if one of roles permits verb on cat.
+func (c *RBACConfig) Allows(roles []string, cat AuditCategory, verb string) bool {
+	for _, role := range roles {
+		for _, r := range c.Roles[role] {
+			if r.allows(cat, verb) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type rbacContextKey struct{}
+
+type rbacGrant struct {
+	config *RBACConfig
+	roles  []string
+}
+
+// WithRBACRoles returns a new context that grants roles defined in config.
+// Authorize checks permissions against the roles.
+func WithRBACRoles(ctx context.Context, config *RBACConfig, roles []string) context.Context {
+	return context.WithValue(ctx, rbacContextKey{}, rbacGrant{config: config, roles: roles})
+}
+
+// Authorize returns ErrForbidden if roles granted to ctx by WithRBACRoles
+// do not permit verb on cat.  If ctx has no roles, this returns nil as
+// access control is disabled.
+func Authorize(ctx context.Context, cat AuditCategory, verb string) error {
+	g, ok := ctx.Value(rbacContextKey{}).(rbacGrant)
+	if !ok {
+		return nil
+	}
+	if g.config.Allows(g.roles, cat, verb) {
+		return nil
+	}
+	return ErrForbidden
+}
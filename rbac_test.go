@@ -0,0 +1,101 @@
+package sabakan
+
+import (
+	"context"
+	"testing"
+)
+
+func testRBACConfig() *RBACConfig {
+	return &RBACConfig{
+		Roles: map[string][]RBACRule{
+			"read-only": {
+				{Categories: []AuditCategory{RBACAny}, Verbs: []string{VerbRead}},
+			},
+			"machine-operator": {
+				{Categories: []AuditCategory{AuditMachines}, Verbs: []string{RBACAny}},
+			},
+			"image-publisher": {
+				{Categories: []AuditCategory{AuditImage, AuditAssets}, Verbs: []string{VerbWrite}},
+			},
+		},
+		Principals: []RBACPrincipal{
+			{Name: "alice", Roles: []string{"read-only", "machine-operator"}},
+			{Name: "ci", Token: "secret", Roles: []string{"image-publisher"}},
+		},
+		AnonymousRoles: []string{"read-only"},
+	}
+}
+
+func TestRBACValidate(t *testing.T) {
+	t.Parallel()
+
+	c := testRBACConfig()
+	err := c.Validate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bad := testRBACConfig()
+	bad.AnonymousRoles = []string{"crypt-admin"}
+	if bad.Validate() == nil {
+		t.Error("undefined role should be rejected")
+	}
+
+	bad = testRBACConfig()
+	bad.Roles["bad"] = []RBACRule{{Categories: []AuditCategory{AuditCrypts}, Verbs: []string{"get"}}}
+	if bad.Validate() == nil {
+		t.Error("invalid verb should be rejected")
+	}
+
+	bad = testRBACConfig()
+	bad.Principals = append(bad.Principals, RBACPrincipal{Name: "bob", Token: "secret"})
+	if bad.Validate() == nil {
+		t.Error("duplicate token should be rejected")
+	}
+}
+
+func TestRBACAuthorize(t *testing.T) {
+	t.Parallel()
+
+	c := testRBACConfig()
+	if p := c.FindPrincipal("alice"); p == nil || p.Name != "alice" {
+		t.Error("alice is not found:", p)
+	}
+	if p := c.FindPrincipal("ci"); p != nil {
+		t.Error("principals with token must not be found by name:", p)
+	}
+	if p := c.FindToken("secret"); p == nil || p.Name != "ci" {
+		t.Error("ci is not found:", p)
+	}
+	if p := c.FindToken("wrong"); p != nil {
+		t.Error("wrong token should not match:", p)
+	}
+
+	cases := []struct {
+		roles   []string
+		cat     AuditCategory
+		verb    string
+		allowed bool
+	}{
+		{[]string{"read-only"}, AuditCrypts, VerbRead, true},
+		{[]string{"read-only"}, AuditMachines, VerbWrite, false},
+		{[]string{"read-only", "machine-operator"}, AuditMachines, VerbDelete, true},
+		{[]string{"image-publisher"}, AuditImage, VerbWrite, true},
+		{[]string{"image-publisher"}, AuditImage, VerbDelete, false},
+		{nil, AuditIPAM, VerbRead, false},
+	}
+	for _, tc := range cases {
+		ctx := WithRBACRoles(context.Background(), c, tc.roles)
+		err := Authorize(ctx, tc.cat, tc.verb)
+		if tc.allowed && err != nil {
+			t.Errorf("%v should be allowed to %s %s: %v", tc.roles, tc.verb, tc.cat, err)
+		}
+		if !tc.allowed && err != ErrForbidden {
+			t.Errorf("%v should be forbidden to %s %s", tc.roles, tc.verb, tc.cat)
+		}
+	}
+
+	if err := Authorize(context.Background(), AuditCrypts, VerbDelete); err != nil {
+		t.Error("access control should be disabled without roles:", err)
+	}
+}
@@ -0,0 +1,35 @@
+package sabakan
+
+import "errors"
+
+// Switch represents a network switch provisioned by ONIE or ZTP.
+type Switch struct {
+	// MAC is the MAC address of the management port of the switch.
+	MAC string `json:"mac"`
+
+	// Name is a human readable name of the switch.
+	Name string `json:"name,omitempty"`
+
+	// Installer is the name of the asset served to ONIE as the NOS installer.
+	Installer string `json:"installer,omitempty"`
+
+	// Script is the name of the asset served to the NOS as the ZTP script.
+	Script string `json:"script,omitempty"`
+}
+
+// Validate validates and normalizes the fields of the switch.
+func (s *Switch) Validate() error {
+	mac, err := NormalizeMACAddress(s.MAC)
+	if err != nil {
+		return errors.New("invalid MAC address: " + s.MAC)
+	}
+	s.MAC = mac
+
+	if s.Name != "" && !IsValidLabelValue(s.Name) {
+		return errors.New("invalid switch name: " + s.Name)
+	}
+	if s.Installer == "" && s.Script == "" {
+		return errors.New("either installer or script is required")
+	}
+	return nil
+}
@@ -4,4 +4,4 @@ package sabakan
 const Version = "3.1.6"
 
 // SchemaVersion is the schema version
-const SchemaVersion = "3"
+const SchemaVersion = "4"
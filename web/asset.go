@@ -37,7 +37,17 @@ func (s Server) handleAssets(w http.ResponseWriter, r *http.Request) {
 		}
 		renderError(r.Context(), w, APIErrBadRequest)
 	case "PUT":
-		s.handleAssetsPut(w, r, name)
+		switch len(params) {
+		case 1:
+			s.handleAssetsPut(w, r, name)
+			return
+		case 2:
+			if params[1] == "rollback" {
+				s.handleAssetsRollback(w, r, name)
+				return
+			}
+		}
+		renderError(r.Context(), w, APIErrBadRequest)
 	case "DELETE":
 		s.handleAssetsDelete(w, r, name)
 	default:
@@ -72,8 +82,30 @@ func (h assetHandler) Redirect(u string) {
 	http.Redirect(h.w, h.r, u, http.StatusFound)
 }
 
+func assetVersion(r *http.Request) (int, bool, error) {
+	v := r.URL.Query().Get("version")
+	if len(v) == 0 {
+		return 0, false, nil
+	}
+	id, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, false, err
+	}
+	return id, true, nil
+}
+
 func (s Server) handleAssetsGet(w http.ResponseWriter, r *http.Request, name string) {
-	err := s.Model.Asset.Get(r.Context(), name, assetHandler{w, r})
+	id, ok, err := assetVersion(r)
+	if err != nil {
+		renderError(r.Context(), w, BadRequest("invalid version: "+err.Error()))
+		return
+	}
+
+	if ok {
+		err = s.Model.Asset.GetVersion(r.Context(), name, id, assetHandler{w, r})
+	} else {
+		err = s.Model.Asset.Get(r.Context(), name, assetHandler{w, r})
+	}
 	if err == sabakan.ErrNotFound {
 		renderError(r.Context(), w, APIErrNotFound)
 		return
@@ -165,3 +197,31 @@ func (s Server) handleAssetsDelete(w http.ResponseWriter, r *http.Request, name
 		renderError(r.Context(), w, InternalServerError(err))
 	}
 }
+
+func (s Server) handleAssetsRollback(w http.ResponseWriter, r *http.Request, name string) {
+	id, ok, err := assetVersion(r)
+	if err != nil {
+		renderError(r.Context(), w, BadRequest("invalid version: "+err.Error()))
+		return
+	}
+	if !ok {
+		renderError(r.Context(), w, BadRequest("version is required"))
+		return
+	}
+
+	err = s.Model.Asset.Rollback(r.Context(), name, id)
+	if err == sabakan.ErrNotFound {
+		renderError(r.Context(), w, APIErrNotFound)
+		return
+	}
+	if err != nil {
+		renderError(r.Context(), w, InternalServerError(err))
+		return
+	}
+
+	status := &sabakan.AssetStatus{
+		Status: http.StatusOK,
+		ID:     id,
+	}
+	renderJSON(w, status, status.Status)
+}
@@ -322,10 +322,85 @@ func testHandleAssetsDelete(t *testing.T) {
 	}
 }
 
+func testHandleAssetsRollback(t *testing.T) {
+	t.Parallel()
+
+	m := mock.NewModel()
+	handler := newTestServer(m)
+
+	st1, err := m.Asset.Put(context.Background(), "foo", "text/plain", nil, nil, strings.NewReader("bar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.Asset.Put(context.Background(), "foo", "text/plain", nil, nil, strings.NewReader("baz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/api/v1/assets/foo?version="+strconv.Itoa(st1.ID), nil)
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatal("w.Code != http.StatusOK:", w.Code)
+	}
+	if w.Body.String() != "bar" {
+		t.Error("unexpected content:", w.Body.String())
+	}
+	if w.Header().Get("X-Sabakan-Asset-ID") != strconv.Itoa(st1.ID) {
+		t.Error("unexpected ID:", w.Header().Get("X-Sabakan-Asset-ID"))
+	}
+
+	for _, q := range []string{"abc", "100"} {
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest("GET", "/api/v1/assets/foo?version="+q, nil)
+		handler.ServeHTTP(w, r)
+		if w.Code == http.StatusOK {
+			t.Error("version should not be found:", q)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("PUT", "/api/v1/assets/foo/rollback", nil)
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Error("w.Code != http.StatusBadRequest:", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("PUT", "/api/v1/assets/foo/rollback?version=100", nil)
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Error("w.Code != http.StatusNotFound:", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("PUT", "/api/v1/assets/foo/rollback?version="+strconv.Itoa(st1.ID), nil)
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatal("w.Code != http.StatusOK:", w.Code)
+	}
+	var status sabakan.AssetStatus
+	err = json.NewDecoder(w.Body).Decode(&status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.ID != st1.ID {
+		t.Error("unexpected status:", status)
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/api/v1/assets/foo", nil)
+	handler.ServeHTTP(w, r)
+	if w.Body.String() != "bar" {
+		t.Error("asset is not rolled back:", w.Body.String())
+	}
+}
+
 func TestHandleAssets(t *testing.T) {
 	t.Run("GetIndex", testHandleAssetsGetIndex)
 	t.Run("GetInfo", testHandleAssetsGetInfo)
 	t.Run("Get", testHandleAssetsGet)
 	t.Run("Put", testHandleAssetsPut)
 	t.Run("Delete", testHandleAssetsDelete)
+	t.Run("Rollback", testHandleAssetsRollback)
 }
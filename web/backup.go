@@ -0,0 +1,61 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+func (s Server) handleBackup(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.handleBackupGet(w, r)
+	case http.MethodPut:
+		s.handleBackupPut(w, r)
+	default:
+		renderError(r.Context(), w, APIErrBadMethod)
+	}
+}
+
+func (s Server) handleBackupGet(w http.ResponseWriter, r *http.Request) {
+	opts := &sabakan.BackupOptions{
+		CryptKeys:  r.FormValue("crypt-keys"),
+		Passphrase: r.Header.Get("X-Sabakan-Backup-Passphrase"),
+	}
+	err := opts.Validate()
+	if err != nil {
+		renderError(r.Context(), w, BadRequest(err.Error()))
+		return
+	}
+
+	mode := opts.CryptKeys
+	if mode == "" {
+		mode = sabakan.BackupKeysExclude
+	}
+	err = s.Model.Log.Record(r.Context(), sabakan.AuditBackup, "", "backup", "crypt-keys="+mode)
+	if err != nil {
+		renderError(r.Context(), w, InternalServerError(err))
+		return
+	}
+
+	w.Header().Set("content-type", "application/tar")
+	err = sabakan.WriteBackup(r.Context(), s.Model, opts, w)
+	if err != nil {
+		renderError(r.Context(), w, InternalServerError(err))
+	}
+}
+
+func (s Server) handleBackupPut(w http.ResponseWriter, r *http.Request) {
+	err := sabakan.RestoreBackup(r.Context(), s.Model, r.Body, r.Header.Get("X-Sabakan-Backup-Passphrase"))
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusOK)
+	case err == sabakan.ErrConflicted:
+		renderError(r.Context(), w, APIErrConflict)
+	case errors.Is(err, sabakan.ErrBadRequest):
+		renderError(r.Context(), w, BadRequest(err.Error()))
+	default:
+		renderError(r.Context(), w, InternalServerError(err))
+	}
+}
@@ -0,0 +1,202 @@
+package web
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cybozu-go/sabakan/v3"
+	"github.com/cybozu-go/sabakan/v3/models/mock"
+)
+
+func testBackupGet(t *testing.T) {
+	t.Parallel()
+
+	m := mock.NewModel()
+	handler := newTestServer(m)
+	testWithIPAM(t, m)
+	err := m.Machine.Register(context.Background(), []*sabakan.Machine{
+		sabakan.NewMachine(sabakan.MachineSpec{Serial: "1234", Role: "worker"}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.Storage.PutEncryptionKey(context.Background(), "1234", "disk1", []byte("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/api/v1/backup?crypt-keys=encrypted", nil)
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Error("encrypting keys without passphrase should be rejected:", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/api/v1/backup?crypt-keys=foo", nil)
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Error("invalid crypt-keys should be rejected:", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/api/v1/backup?crypt-keys=plain", nil)
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatal("w.Code != http.StatusOK:", w.Code)
+	}
+	if a := testLastAuditLog(t, m); a.Category != sabakan.AuditBackup || a.Action != "backup" || a.Detail != "crypt-keys=plain" {
+		t.Error("backup is not recorded:", a)
+	}
+
+	files := make(map[string][]byte)
+	var names []string
+	tr := tar.NewReader(w.Body)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+		files[hdr.Name] = data
+	}
+	if len(names) != 3 || names[0] != "backup.json" {
+		t.Fatal("unexpected members:", names)
+	}
+
+	var header sabakan.BackupHeader
+	err = json.Unmarshal(files["backup.json"], &header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Version != sabakan.BackupFormatVersion || header.Schema != sabakan.SchemaVersion ||
+		header.CryptKeys != sabakan.BackupKeysPlain {
+		t.Errorf("unexpected header: %#v", header)
+	}
+
+	var keys []*sabakan.BackupCryptKey
+	err = json.Unmarshal(files["crypt-keys.json"], &keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].Serial != "1234" || string(keys[0].Key) != "key" {
+		t.Error("unexpected keys:", keys)
+	}
+
+	// keys are excluded by default
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/api/v1/backup", nil)
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatal("w.Code != http.StatusOK:", w.Code)
+	}
+	if bytes.Contains(w.Body.Bytes(), []byte("crypt-keys.json")) {
+		t.Error("keys should be excluded")
+	}
+}
+
+func testBackupPut(t *testing.T) {
+	t.Parallel()
+
+	src := mock.NewModel()
+	testWithIPAM(t, src)
+	err := src.Machine.Register(context.Background(), []*sabakan.Machine{
+		sabakan.NewMachine(sabakan.MachineSpec{Serial: "1234", Role: "worker"}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = src.Storage.PutEncryptionKey(context.Background(), "1234", "disk1", []byte("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"asset1", "asset2"} {
+		_, err = src.Asset.Put(context.Background(), name, "text/plain", nil, nil, strings.NewReader("content of "+name))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	buf := new(bytes.Buffer)
+	opts := &sabakan.BackupOptions{CryptKeys: sabakan.BackupKeysEncrypted, Passphrase: "secret"}
+	err = sabakan.WriteBackup(context.Background(), src, opts, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := buf.Bytes()
+
+	m := mock.NewModel()
+	handler := newTestServer(m)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("PUT", "/api/v1/backup", strings.NewReader("not a tar"))
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Error("broken archive should be rejected:", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("PUT", "/api/v1/backup", bytes.NewReader(archive))
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Error("encrypted keys without passphrase should be rejected:", w.Code)
+	}
+
+	// a restore failing with a corrupted asset is undone
+	corrupted := bytes.Replace(archive, []byte("content of asset2"), []byte("corrupted asset2!"), 1)
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("PUT", "/api/v1/backup", bytes.NewReader(corrupted))
+	r.Header.Set("X-Sabakan-Backup-Passphrase", "secret")
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusInternalServerError {
+		t.Error("corrupted asset should not be restored:", w.Code)
+	}
+	if _, err := m.Machine.Get(context.Background(), "1234"); err != sabakan.ErrNotFound {
+		t.Error("machine should be removed after a failed restore:", err)
+	}
+	if assets, _ := m.Asset.GetIndex(context.Background()); len(assets) != 0 {
+		t.Error("assets should be removed after a failed restore:", assets)
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("PUT", "/api/v1/backup", bytes.NewReader(archive))
+	r.Header.Set("X-Sabakan-Backup-Passphrase", "secret")
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatal("w.Code != http.StatusOK:", w.Code, w.Body.String())
+	}
+
+	key, err := m.Storage.GetEncryptionKey(context.Background(), "1234", "disk1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(key) != "key" {
+		t.Error("key is not restored:", string(key))
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("PUT", "/api/v1/backup", bytes.NewReader(archive))
+	r.Header.Set("X-Sabakan-Backup-Passphrase", "secret")
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusConflict {
+		t.Error("non-empty model should not be restored:", w.Code)
+	}
+}
+
+func TestBackup(t *testing.T) {
+	t.Run("Get", testBackupGet)
+	t.Run("Put", testBackupPut)
+}
@@ -0,0 +1,110 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+func (s Server) handleCryptPolicies(w http.ResponseWriter, r *http.Request) {
+	params := strings.Split(r.URL.Path[len("/api/v1/crypt-policies/"):], "/")
+	if len(params) != 2 || len(params[1]) == 0 {
+		renderError(r.Context(), w, APIErrBadRequest)
+		return
+	}
+
+	kind, name := params[0], params[1]
+	if kind == "effective" {
+		if r.Method != "GET" {
+			renderError(r.Context(), w, APIErrBadMethod)
+			return
+		}
+		s.handleCryptPoliciesResolve(w, r, name)
+		return
+	}
+
+	if !sabakan.IsValidCryptPolicyKind(kind) {
+		renderError(r.Context(), w, BadRequest("invalid kind: "+kind))
+		return
+	}
+	if kind == sabakan.CryptPolicyRole && !sabakan.IsValidRole(name) {
+		renderError(r.Context(), w, BadRequest("invalid role: "+name))
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		s.handleCryptPoliciesGet(w, r, kind, name)
+	case "PUT":
+		s.handleCryptPoliciesPut(w, r, kind, name)
+	case "DELETE":
+		s.handleCryptPoliciesDelete(w, r, kind, name)
+	default:
+		renderError(r.Context(), w, APIErrBadMethod)
+	}
+}
+
+func (s Server) handleCryptPoliciesGet(w http.ResponseWriter, r *http.Request, kind, name string) {
+	policy, err := s.Model.CryptPolicy.Get(r.Context(), kind, name)
+	if err == sabakan.ErrNotFound {
+		renderError(r.Context(), w, APIErrNotFound)
+		return
+	}
+	if err != nil {
+		renderError(r.Context(), w, InternalServerError(err))
+		return
+	}
+	renderJSON(w, policy, http.StatusOK)
+}
+
+func (s Server) handleCryptPoliciesPut(w http.ResponseWriter, r *http.Request, kind, name string) {
+	policy := new(sabakan.CryptPolicy)
+	err := json.NewDecoder(r.Body).Decode(policy)
+	if err != nil {
+		renderError(r.Context(), w, BadRequest(err.Error()))
+		return
+	}
+
+	err = policy.Validate()
+	if err != nil {
+		renderError(r.Context(), w, BadRequest(err.Error()))
+		return
+	}
+
+	err = s.Model.CryptPolicy.Put(r.Context(), kind, name, policy)
+	if err != nil {
+		renderError(r.Context(), w, InternalServerError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s Server) handleCryptPoliciesDelete(w http.ResponseWriter, r *http.Request, kind, name string) {
+	err := s.Model.CryptPolicy.Delete(r.Context(), kind, name)
+	if err == sabakan.ErrNotFound {
+		renderError(r.Context(), w, APIErrNotFound)
+		return
+	}
+	if err != nil {
+		renderError(r.Context(), w, InternalServerError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s Server) handleCryptPoliciesResolve(w http.ResponseWriter, r *http.Request, serial string) {
+	policy, err := s.Model.CryptPolicy.Resolve(r.Context(), serial)
+	if err == sabakan.ErrNotFound {
+		renderError(r.Context(), w, APIErrNotFound)
+		return
+	}
+	if err != nil {
+		renderError(r.Context(), w, InternalServerError(err))
+		return
+	}
+	renderJSON(w, policy, http.StatusOK)
+}
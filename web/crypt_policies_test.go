@@ -0,0 +1,159 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cybozu-go/sabakan/v3"
+	"github.com/cybozu-go/sabakan/v3/models/mock"
+	"github.com/google/go-cmp/cmp"
+)
+
+func testCryptPoliciesPut(t *testing.T) {
+	t.Parallel()
+
+	m := mock.NewModel()
+	handler := newTestServer(m)
+
+	cases := []struct {
+		path   string
+		body   string
+		status int
+	}{
+		{"role/worker", `{"disks": [{"path": "pci-*-nvme-*"}], "require-tpm": true}`, http.StatusCreated},
+		{"machine/1234", `{"cipher": "aes-xts-plain64", "keysize": 256}`, http.StatusCreated},
+		{"role/worker", `{"keysize": 100}`, http.StatusBadRequest},
+		{"role/worker", `{"disks": [{"model": "[a-"}]}`, http.StatusBadRequest},
+		{"role/work%20er", `{}`, http.StatusBadRequest},
+		{"rack/1", `{}`, http.StatusBadRequest},
+		{"role/worker/1", `{}`, http.StatusBadRequest},
+		{"role/", `{}`, http.StatusBadRequest},
+		{"role/worker", `{`, http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("PUT", "/api/v1/crypt-policies/"+c.path, strings.NewReader(c.body))
+		handler.ServeHTTP(w, r)
+
+		resp := w.Result()
+		if resp.StatusCode != c.status {
+			t.Error("unexpected status for", c.path, c.body, resp.StatusCode)
+		}
+	}
+
+	p, err := m.CryptPolicy.Get(context.Background(), sabakan.CryptPolicyRole, "worker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &sabakan.CryptPolicy{
+		Disks:      []sabakan.DiskSelector{{Path: "pci-*-nvme-*"}},
+		RequireTPM: true,
+	}
+	if !cmp.Equal(p, expected) {
+		t.Error("wrong policy stored:", cmp.Diff(p, expected))
+	}
+}
+
+func testCryptPoliciesGet(t *testing.T) {
+	t.Parallel()
+
+	m := mock.NewModel()
+	handler := newTestServer(m)
+	ctx := context.Background()
+
+	err := m.Machine.Register(ctx, []*sabakan.Machine{
+		sabakan.NewMachine(sabakan.MachineSpec{Serial: "1", Role: "worker"}),
+		sabakan.NewMachine(sabakan.MachineSpec{Serial: "2", Role: "worker"}),
+		sabakan.NewMachine(sabakan.MachineSpec{Serial: "3", Role: "boot"}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rolePolicy := &sabakan.CryptPolicy{Cipher: "aes-xts-plain64"}
+	machinePolicy := &sabakan.CryptPolicy{KeySize: 256}
+	err = m.CryptPolicy.Put(ctx, sabakan.CryptPolicyRole, "worker", rolePolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.CryptPolicy.Put(ctx, sabakan.CryptPolicyMachine, "2", machinePolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		path     string
+		status   int
+		expected *sabakan.CryptPolicy
+	}{
+		{"role/worker", http.StatusOK, rolePolicy},
+		{"role/boot", http.StatusNotFound, nil},
+		{"machine/2", http.StatusOK, machinePolicy},
+		{"machine/1", http.StatusNotFound, nil},
+		{"effective/1", http.StatusOK, rolePolicy},
+		{"effective/2", http.StatusOK, machinePolicy},
+		{"effective/3", http.StatusNotFound, nil},
+		{"effective/4", http.StatusNotFound, nil},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/api/v1/crypt-policies/"+c.path, nil)
+		handler.ServeHTTP(w, r)
+
+		resp := w.Result()
+		if resp.StatusCode != c.status {
+			t.Error("unexpected status for", c.path, resp.StatusCode)
+			continue
+		}
+		if c.expected == nil {
+			continue
+		}
+		p := new(sabakan.CryptPolicy)
+		err = json.NewDecoder(resp.Body).Decode(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !cmp.Equal(p, c.expected) {
+			t.Error("wrong policy for", c.path, cmp.Diff(p, c.expected))
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("PUT", "/api/v1/crypt-policies/effective/1", strings.NewReader("{}"))
+	handler.ServeHTTP(w, r)
+	if w.Result().StatusCode != http.StatusMethodNotAllowed {
+		t.Error("effective policy should not be writable:", w.Result().StatusCode)
+	}
+}
+
+func testCryptPoliciesDelete(t *testing.T) {
+	t.Parallel()
+
+	m := mock.NewModel()
+	handler := newTestServer(m)
+
+	err := m.CryptPolicy.Put(context.Background(), sabakan.CryptPolicyRole, "worker", &sabakan.CryptPolicy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, status := range []int{http.StatusOK, http.StatusNotFound} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("DELETE", "/api/v1/crypt-policies/role/worker", nil)
+		handler.ServeHTTP(w, r)
+
+		resp := w.Result()
+		if resp.StatusCode != status {
+			t.Error("unexpected status:", resp.StatusCode, status)
+		}
+	}
+}
+
+func TestCryptPolicies(t *testing.T) {
+	t.Run("Put", testCryptPoliciesPut)
+	t.Run("Get", testCryptPoliciesGet)
+	t.Run("Delete", testCryptPoliciesDelete)
+}
@@ -1,7 +1,11 @@
 package web
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"io"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
@@ -11,6 +15,107 @@ import (
 	"github.com/cybozu-go/well"
 )
 
+// HeaderCryptToken is the HTTP header name to present a per-machine token
+// to retrieve disk encryption keys.
+const HeaderCryptToken = "X-Sabakan-Crypt-Token"
+
+// CryptPolicy restricts retrieval of disk encryption keys.
+type CryptPolicy struct {
+	// OwnerOnly restricts GET /api/v1/crypts/<serial>/<path> to the machine
+	// identified by its IPv4 addresses, DHCP lease, or per-machine token.
+	OwnerOnly bool
+
+	// TokenSecret is the secret to issue per-machine tokens.
+	// If empty, tokens are not issued.
+	TokenSecret []byte
+
+	// PreviousTokenSecrets are secrets used to issue tokens before.
+	// Tokens issued with them are still accepted during rotation.
+	PreviousTokenSecrets [][]byte
+}
+
+func tokenWithSecret(secret []byte, serial string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(serial))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Token returns the per-machine token for the machine.
+// This returns an empty string if tokens are not issued.
+func (p *CryptPolicy) Token(serial string) string {
+	if p == nil || len(p.TokenSecret) == 0 {
+		return ""
+	}
+	return tokenWithSecret(p.TokenSecret, serial)
+}
+
+func (p *CryptPolicy) validToken(serial, token string) bool {
+	expected := p.Token(serial)
+	if expected == "" || token == "" {
+		return false
+	}
+	if hmac.Equal([]byte(expected), []byte(token)) {
+		return true
+	}
+	for _, secret := range p.PreviousTokenSecrets {
+		if hmac.Equal([]byte(tokenWithSecret(secret, serial)), []byte(token)) {
+			return true
+		}
+	}
+	return false
+}
+
+// isMachineRequest returns true if the request comes from the machine,
+// i.e. the remote address is one of the IPv4 addresses of the machine
+// or leased to one of its MAC addresses.
+func (s Server) isMachineRequest(r *http.Request, m *sabakan.Machine) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	for _, a := range m.Spec.IPv4 {
+		if ip.Equal(net.ParseIP(a)) {
+			return true
+		}
+	}
+
+	if len(m.Spec.MACAddresses) == 0 || ip.To4() == nil {
+		return false
+	}
+	owner, err := s.Model.DHCP.LeaseOwner(r.Context(), ip)
+	if err != nil {
+		return false
+	}
+	for _, mac := range m.Spec.MACAddresses {
+		if mac == owner.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// canGetEncryptionKey returns true if the request is permitted to
+// retrieve disk encryption keys of the machine.
+func (s Server) canGetEncryptionKey(r *http.Request, serial string) bool {
+	if s.CryptPolicy == nil || !s.CryptPolicy.OwnerOnly {
+		return true
+	}
+	if s.CryptPolicy.validToken(serial, r.Header.Get(HeaderCryptToken)) {
+		return true
+	}
+
+	m, err := s.Model.Machine.Get(r.Context(), serial)
+	if err != nil {
+		return false
+	}
+	return s.isMachineRequest(r, m)
+}
+
 func (s Server) handleCrypts(w http.ResponseWriter, r *http.Request) {
 	params := strings.Split(r.URL.Path[len("/api/v1/crypts/"):], "/")
 
@@ -21,6 +126,10 @@ func (s Server) handleCrypts(w http.ResponseWriter, r *http.Request) {
 
 	switch r.Method {
 	case "GET":
+		if len(params) == 1 {
+			s.handleCryptsList(w, r, params[0])
+			return
+		}
 		s.handleCryptsGet(w, r, params)
 		return
 	case "PUT":
@@ -34,6 +143,27 @@ func (s Server) handleCrypts(w http.ResponseWriter, r *http.Request) {
 	renderError(r.Context(), w, APIErrBadMethod)
 }
 
+func (s Server) handleCryptsIndex(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		renderError(r.Context(), w, APIErrBadMethod)
+		return
+	}
+	s.handleCryptsList(w, r, "")
+}
+
+func (s Server) handleCryptsList(w http.ResponseWriter, r *http.Request, serial string) {
+	infos, err := s.Model.Storage.ListEncryptionKeys(r.Context(), serial)
+	if err == sabakan.ErrNotFound {
+		renderError(r.Context(), w, APIErrNotFound)
+		return
+	} else if err != nil {
+		renderError(r.Context(), w, InternalServerError(err))
+		return
+	}
+
+	renderJSON(w, infos, http.StatusOK)
+}
+
 func (s Server) handleCryptsGet(w http.ResponseWriter, r *http.Request, params []string) {
 	if len(params) != 2 {
 		renderError(r.Context(), w, APIErrBadRequest)
@@ -43,6 +173,17 @@ func (s Server) handleCryptsGet(w http.ResponseWriter, r *http.Request, params [
 	serial := params[0]
 	p := params[1]
 
+	if !s.canGetEncryptionKey(r, serial) {
+		err := s.Model.Log.Record(r.Context(), sabakan.AuditCrypts, serial, "deny", "GET "+r.URL.Path)
+		if err != nil {
+			fields := well.FieldsFromContext(r.Context())
+			fields[log.FnError] = err.Error()
+			log.Error("failed to record a denied request", fields)
+		}
+		renderError(r.Context(), w, APIErrForbidden)
+		return
+	}
+
 	key, err := s.Model.Storage.GetEncryptionKey(r.Context(), serial, p)
 	if err != nil {
 		renderError(r.Context(), w, InternalServerError(err))
@@ -1,15 +1,19 @@
 package web
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
+	"net/http"
 	"net/http/httptest"
 	"path"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/cybozu-go/sabakan/v3"
 	"github.com/cybozu-go/sabakan/v3/models/mock"
@@ -282,9 +286,203 @@ func testCryptsDelete(t *testing.T) {
 	}
 }
 
+func testCryptsGetOwnerOnly(t *testing.T) {
+	ctx := context.Background()
+	m := mock.NewModel()
+	testWithIPAM(t, m)
+	handler := Server{
+		Model:     m,
+		TLSServer: true,
+		CryptPolicy: &CryptPolicy{
+			OwnerOnly:            true,
+			TokenSecret:          []byte("secret"),
+			PreviousTokenSecrets: [][]byte{[]byte("old")},
+		},
+	}
+	oldPolicy := &CryptPolicy{TokenSecret: []byte("old")}
+	otherPolicy := &CryptPolicy{TokenSecret: []byte("other")}
+
+	mac := "02:00:00:00:00:01"
+	err := m.Machine.Register(ctx, []*sabakan.Machine{
+		sabakan.NewMachine(sabakan.MachineSpec{Serial: "1", IPv4: []string{"10.69.0.4"}, MACAddresses: []string{mac}}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.Storage.PutEncryptionKey(ctx, "1", "disk", []byte("aaa"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hw, _ := net.ParseMAC(mac)
+	leased, err := m.DHCP.Lease(ctx, net.ParseIP("10.69.0.195"), hw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		remote   string
+		token    string
+		expected int
+	}{
+		{"10.69.0.4", "", http.StatusOK},
+		{leased.String(), "", http.StatusOK},
+		{"192.0.2.1", handler.CryptPolicy.Token("1"), http.StatusOK},
+		{"192.0.2.1", "", http.StatusForbidden},
+		{"192.0.2.1", handler.CryptPolicy.Token("2"), http.StatusForbidden},
+		{"192.0.2.1", oldPolicy.Token("1"), http.StatusOK},
+		{"192.0.2.1", oldPolicy.Token("2"), http.StatusForbidden},
+		{"192.0.2.1", otherPolicy.Token("1"), http.StatusForbidden},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/api/v1/crypts/1/disk", nil)
+		r.RemoteAddr = c.remote + ":12345"
+		if c.token != "" {
+			r.Header.Set(HeaderCryptToken, c.token)
+		}
+		handler.ServeHTTP(w, r)
+		if w.Result().StatusCode != c.expected {
+			t.Error("wrong status code for", c.remote, ", expects:", c.expected, ", actual:", w.Result().StatusCode)
+		}
+	}
+
+	a := testLastAuditLog(t, m)
+	if a.Category != sabakan.AuditCrypts || a.Action != "deny" || a.Instance != "1" {
+		t.Error("denial is not recorded:", a)
+	}
+}
+
+func testCryptsList(t *testing.T) {
+	ctx := context.Background()
+	m := mock.NewModel()
+	handler := Server{Model: m, TLSServer: true}
+
+	err := m.Machine.Register(ctx, []*sabakan.Machine{
+		sabakan.NewMachine(sabakan.MachineSpec{Serial: "1"}),
+		sabakan.NewMachine(sabakan.MachineSpec{Serial: "2"}),
+		sabakan.NewMachine(sabakan.MachineSpec{Serial: "3"}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range [][2]string{{"1", "path-a"}, {"1", "path-b"}, {"2", "path-a"}} {
+		err = m.Storage.PutEncryptionKey(ctx, k[0], k[1], []byte("secret-key"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testData := []struct {
+		path   string
+		status int
+		keys   []string
+	}{
+		{"/api/v1/crypts/1", 200, []string{"1/path-a", "1/path-b"}},
+		{"/api/v1/crypts/3", 200, []string{}},
+		{"/api/v1/crypts", 200, []string{"1/path-a", "1/path-b", "2/path-a"}},
+		{"/api/v1/crypts/4", 404, nil},
+	}
+
+	for _, td := range testData {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", td.path, nil)
+		handler.ServeHTTP(w, r)
+		resp := w.Result()
+
+		if resp.StatusCode != td.status {
+			t.Error("wrong status code for", td.path, ", expects:", td.status, ", actual:", resp.StatusCode)
+			continue
+		}
+		if td.status != 200 {
+			continue
+		}
+
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(data, []byte("secret-key")) {
+			t.Error("key material is returned:", string(data))
+		}
+
+		var infos []*sabakan.EncryptionKeyInfo
+		err = json.Unmarshal(data, &infos)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys := make([]string, len(infos))
+		for i, info := range infos {
+			keys[i] = info.Serial + "/" + info.Path
+			if info.CreatedAt.IsZero() || info.Revision == 0 {
+				t.Error("no meta data:", info)
+			}
+		}
+		if !reflect.DeepEqual(keys, td.keys) {
+			t.Error("wrong keys for", td.path, ", expects:", td.keys, ", actual:", keys)
+		}
+	}
+
+	handler2 := newTestServer(m)
+	handler2.TLSServer = true
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("DELETE", "/api/v1/crypts", nil)
+	handler2.ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Error("wrong status code for DELETE /api/v1/crypts:", w.Code)
+	}
+}
+
+func testCryptsGraphQL(t *testing.T) {
+	ctx := context.Background()
+	m := mock.NewModel()
+	handler := newTestServer(m)
+
+	err := m.Machine.Register(ctx, []*sabakan.Machine{
+		sabakan.NewMachine(sabakan.MachineSpec{Serial: "1"}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.Storage.PutEncryptionKey(ctx, "1", "path-a", []byte("secret-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"query": "{ machine(serial: \"1\") { encryptionKeys { path createdAt revision } } }"}`
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/graphql", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	handler.ServeHTTP(w, r)
+
+	var resp struct {
+		Data struct {
+			Machine struct {
+				EncryptionKeys []struct {
+					Path      string    `json:"path"`
+					CreatedAt time.Time `json:"createdAt"`
+					Revision  int64     `json:"revision"`
+				} `json:"encryptionKeys"`
+			} `json:"machine"`
+		} `json:"data"`
+	}
+	err = json.NewDecoder(w.Body).Decode(&resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := resp.Data.Machine.EncryptionKeys
+	if len(keys) != 1 || keys[0].Path != "path-a" || keys[0].CreatedAt.IsZero() || keys[0].Revision == 0 {
+		t.Error("wrong encryption keys:", keys)
+	}
+}
+
 func TestCrypts(t *testing.T) {
 	t.Run("HTTP", testCryptsHTTP)
 	t.Run("Get", testCryptsGet)
+	t.Run("List", testCryptsList)
+	t.Run("GraphQL", testCryptsGraphQL)
+	t.Run("GetOwnerOnly", testCryptsGetOwnerOnly)
 	t.Run("Put", testCryptsPut)
 	t.Run("Delete", testCryptsDelete)
 }
@@ -2,6 +2,7 @@ package web
 
 import (
 	"encoding/json"
+	"net"
 	"net/http"
 
 	"github.com/cybozu-go/sabakan/v3"
@@ -52,3 +53,23 @@ func (s Server) handleConfigDHCPPut(w http.ResponseWriter, r *http.Request) {
 	}
 	renderJSON(w, nil, http.StatusOK)
 }
+
+func (s Server) handleDHCPDebug(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		renderError(r.Context(), w, APIErrBadMethod)
+		return
+	}
+	if s.DHCPTrace == nil {
+		renderError(r.Context(), w, APIErrNotFound)
+		return
+	}
+
+	p := r.URL.Path[len("/api/v1/dhcp/debug/"):]
+	mac, err := net.ParseMAC(p)
+	if err != nil {
+		renderError(r.Context(), w, BadRequest("invalid MAC address: "+p))
+		return
+	}
+
+	renderJSON(w, s.DHCPTrace.Get(mac), http.StatusOK)
+}
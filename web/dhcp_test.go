@@ -3,6 +3,8 @@ package web
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
@@ -10,7 +12,9 @@ import (
 	"testing"
 
 	"github.com/cybozu-go/sabakan/v3"
+	"github.com/cybozu-go/sabakan/v3/dhcpd"
 	"github.com/cybozu-go/sabakan/v3/models/mock"
+	"go.universe.tf/netboot/dhcp4"
 )
 
 func testConfigDHCPGet(t *testing.T) {
@@ -109,3 +113,48 @@ func TestConfigDHCP(t *testing.T) {
 	t.Run("Get", testConfigDHCPGet)
 	t.Run("Put", testConfigDHCPPut)
 }
+
+func TestDHCPDebug(t *testing.T) {
+	m := mock.NewModel()
+	handler := newTestServer(m)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/api/v1/dhcp/debug/00:11:22:33:44:55", nil)
+	handler.ServeHTTP(w, r)
+	if w.Result().StatusCode != http.StatusNotFound {
+		t.Error("resp.StatusCode != http.StatusNotFound:", w.Result().StatusCode)
+	}
+
+	handler.DHCPTrace = dhcpd.NewTraceBuffer(2, 2)
+	hw, _ := net.ParseMAC("00:11:22:33:44:55")
+	handler.DHCPTrace.Record(&dhcp4.Packet{
+		Type:          dhcp4.MsgDiscover,
+		TransactionID: []byte{0, 0, 0, 1},
+		HardwareAddr:  hw,
+		Options:       dhcp4.Options{},
+	}, "eth0", nil, errors.New("no lease"))
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/api/v1/dhcp/debug/00-11-22-33-44-55", nil)
+	handler.ServeHTTP(w, r)
+
+	resp := w.Result()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal("resp.StatusCode != http.StatusOK:", resp.StatusCode)
+	}
+	var traces []*sabakan.DHCPTrace
+	err := json.NewDecoder(resp.Body).Decode(&traces)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(traces) != 1 || traces[0].TransactionID != 1 || traces[0].Error != "no lease" {
+		t.Errorf("wrong traces: %#v", traces)
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/api/v1/dhcp/debug/00:11", nil)
+	handler.ServeHTTP(w, r)
+	if w.Result().StatusCode != http.StatusBadRequest {
+		t.Error("resp.StatusCode != http.StatusBadRequest:", w.Result().StatusCode)
+	}
+}
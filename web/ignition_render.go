@@ -48,7 +48,13 @@ func (s Server) handleIgnitions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ign, err := s.renderIgnition(tmpl, m)
+	// The token is issued only to the machine itself.
+	var cryptToken string
+	if token := s.CryptPolicy.Token(serial); token != "" && s.isMachineRequest(r, m) {
+		cryptToken = token
+	}
+
+	ign, err := s.renderIgnition(tmpl, m, cryptToken)
 	if err != nil {
 		renderError(r.Context(), w, InternalServerError(err))
 		return
@@ -57,13 +63,16 @@ func (s Server) handleIgnitions(w http.ResponseWriter, r *http.Request) {
 	renderJSON(w, ign, http.StatusOK)
 }
 
-func (s Server) renderIgnition(tmpl *sabakan.IgnitionTemplate, m *sabakan.Machine) (interface{}, error) {
+// renderIgnition renders the ignition template for the machine.
+// cryptToken is rendered by CryptToken function.
+func (s Server) renderIgnition(tmpl *sabakan.IgnitionTemplate, m *sabakan.Machine, cryptToken string) (interface{}, error) {
 	myURL := s.MyURL.String()
 	myURLHTTPS := s.MyURLHTTPS.String()
 
 	tmplFuncs := template.FuncMap{
 		"MyURL":      func() string { return myURL },
 		"MyURLHTTPS": func() string { return myURLHTTPS },
+		"CryptToken": func() string { return cryptToken },
 		"Metadata": func(key string) (interface{}, error) {
 			val, ok := tmpl.Metadata[key]
 			if !ok {
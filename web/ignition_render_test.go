@@ -168,7 +168,7 @@ ExecStart=/bin/echo {{ add .Spec.Rack 10 }}
 	}
 
 	s := newTestServer(m)
-	rendered, err := s.renderIgnition(tmpl, mc)
+	rendered, err := s.renderIgnition(tmpl, mc, "")
 	if err != nil {
 		t.Fatal(err)
 	}
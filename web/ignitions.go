@@ -116,6 +116,6 @@ func (s Server) validateIgnitionTemplate(tmpl *sabakan.IgnitionTemplate) error {
 	})
 	ipam.GenerateIP(mc)
 
-	_, err = s.renderIgnition(tmpl, mc)
+	_, err = s.renderIgnition(tmpl, mc, "")
 	return err
 }
@@ -168,6 +168,22 @@ func testHandleImagesPut(t *testing.T) {
 		t.Fatal("resp.StatusCore != http.StatusCreated:", resp.StatusCode)
 	}
 
+	// uploading the same image again is allowed
+	archive = newTestImage("abcd", "efgh")
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("PUT", "/api/v1/images/coreos/1234", archive)
+	handler.ServeHTTP(w, r)
+
+	resp = w.Result()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatal("resp.StatusCore != http.StatusCreated:", resp.StatusCode)
+	}
+
+	// but uploading a deleted image is not
+	err := m.Image.Delete(context.Background(), "coreos", "1234")
+	if err != nil {
+		t.Fatal(err)
+	}
 	archive = newTestImage("abcd", "efgh")
 	w = httptest.NewRecorder()
 	r = httptest.NewRequest("PUT", "/api/v1/images/coreos/1234", archive)
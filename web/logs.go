@@ -2,7 +2,10 @@ package web
 
 import (
 	"net/http"
+	"strconv"
 	"time"
+
+	"github.com/cybozu-go/sabakan/v3"
 )
 
 func parseDate(v string) (time.Time, error) {
@@ -30,9 +33,46 @@ func (s Server) handleLogs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	q := &sabakan.LogQuery{
+		Since:    since,
+		Until:    until,
+		Category: sabakan.AuditCategory(r.FormValue("category")),
+		Instance: r.FormValue("instance"),
+		Action:   r.FormValue("action"),
+		User:     r.FormValue("user"),
+		IP:       r.FormValue("ip"),
+		Order:    r.FormValue("order"),
+	}
+	if v := r.FormValue("limit"); len(v) > 0 {
+		q.Limit, err = strconv.Atoi(v)
+		if err != nil {
+			renderError(r.Context(), w, BadRequest(err.Error()))
+			return
+		}
+	}
+	err = q.Validate()
+	if err != nil {
+		renderError(r.Context(), w, BadRequest(err.Error()))
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	err = s.Model.Log.Dump(r.Context(), since, until, w)
+	err = s.Model.Log.Query(r.Context(), q, w)
 	if err != nil {
 		renderError(r.Context(), w, InternalServerError(err))
 	}
 }
+
+func (s Server) handleLogsChain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		renderError(r.Context(), w, APIErrBadMethod)
+		return
+	}
+
+	chain, err := s.Model.Log.Chain(r.Context())
+	if err != nil {
+		renderError(r.Context(), w, InternalServerError(err))
+		return
+	}
+	renderJSON(w, chain, http.StatusOK)
+}
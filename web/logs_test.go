@@ -1,7 +1,9 @@
 package web
 
 import (
+	"bytes"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -80,4 +82,71 @@ func TestLogs(t *testing.T) {
 	if resp.StatusCode != http.StatusOK {
 		t.Error(`resp.StatusCode != http.StatusOK`, resp.StatusCode)
 	}
+
+	cases := []struct {
+		query  string
+		status int
+		count  int
+	}{
+		{"category=ipam&action=put", http.StatusOK, 1},
+		{"category=machines", http.StatusOK, 0},
+		{"instance=config&order=desc&limit=1", http.StatusOK, 1},
+		{"user=nobody", http.StatusOK, 0},
+		{"limit=-1", http.StatusBadRequest, 0},
+		{"limit=a", http.StatusBadRequest, 0},
+		{"order=random", http.StatusBadRequest, 0},
+	}
+	for _, c := range cases {
+		r = httptest.NewRequest("GET", "/api/v1/logs?"+c.query, nil)
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		resp = w.Result()
+		if resp.StatusCode != c.status {
+			t.Error("unexpected status for", c.query, resp.StatusCode)
+			continue
+		}
+		if c.status != http.StatusOK {
+			continue
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count := bytes.Count(body, []byte("\n")); count != c.count {
+			t.Error("unexpected number of logs for", c.query, count)
+		}
+	}
+}
+
+func TestLogsChain(t *testing.T) {
+	t.Parallel()
+
+	m := mock.NewModel()
+	handler := newTestServer(m)
+
+	r := httptest.NewRequest("GET", "/api/v1/logs/chain", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	resp := w.Result()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal("request failed with " + http.StatusText(resp.StatusCode))
+	}
+	chain := new(sabakan.AuditChain)
+	err := json.NewDecoder(resp.Body).Decode(chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chain.Head != nil || chain.Checkpoints == nil {
+		t.Error("unexpected chain:", chain)
+	}
+
+	r = httptest.NewRequest("PUT", "/api/v1/logs/chain", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	resp = w.Result()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Error("unexpected status:", resp.StatusCode)
+	}
 }
@@ -61,6 +61,14 @@ func (s Server) handleMachinesPost(w http.ResponseWriter, r *http.Request) {
 			renderError(r.Context(), w, BadRequest("BMC type contains invalid character"))
 			return
 		}
+		for i, mac := range m.MACAddresses {
+			normalized, err := sabakan.NormalizeMACAddress(mac)
+			if err != nil {
+				renderError(r.Context(), w, BadRequest("invalid MAC address: "+mac))
+				return
+			}
+			m.MACAddresses[i] = normalized
+		}
 		m.IPv4 = nil
 		m.IPv6 = nil
 	}
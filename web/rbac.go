@@ -0,0 +1,119 @@
+package web
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/cybozu-go/log"
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+// bearerToken returns the bearer token in Authorization header.
+// Tokens sent over plain HTTP are ignored as they may have been sniffed.
+func bearerToken(r *http.Request) string {
+	if r.TLS == nil {
+		return ""
+	}
+	h := r.Header.Get("Authorization")
+	if !strings.HasPrefix(h, "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(h[len("Bearer "):])
+}
+
+// authenticate returns the user name and the RBAC principal authenticated
+// by the client certificate or the bearer token.
+//
+// This returns an empty user name if the request is not authenticated.
+func (s Server) authenticate(r *http.Request) (string, *sabakan.RBACPrincipal) {
+	if cert := clientCertificate(r); cert != nil {
+		user := clientIdentity(cert)
+		if s.RBAC == nil {
+			return user, nil
+		}
+		return user, s.RBAC.FindPrincipal(user)
+	}
+
+	if s.RBAC == nil {
+		return "", nil
+	}
+	p := s.RBAC.FindToken(bearerToken(r))
+	if p == nil {
+		return "", nil
+	}
+	return p.Name, p
+}
+
+// apiCategory returns the audit category of API path p.
+// p must not contain "/api/v1/" prefix.
+func apiCategory(p string) sabakan.AuditCategory {
+	switch {
+	case p == "assets" || strings.HasPrefix(p, "assets/"):
+		return sabakan.AuditAssets
+	case p == "backup":
+		return sabakan.AuditBackup
+	case strings.HasPrefix(p, "boot/ignitions/") || strings.HasPrefix(p, "ignitions/"):
+		return sabakan.AuditIgnition
+	case strings.HasPrefix(p, "boot/ztp/") || p == "switches" || strings.HasPrefix(p, "switches/"):
+		return sabakan.AuditSwitches
+	case strings.HasPrefix(p, "boot/") || p == "cryptsetup" || strings.HasPrefix(p, "kernel_params/"):
+		return sabakan.AuditIPXE
+	case p == "config/dhcp" || strings.HasPrefix(p, "dhcp/"):
+		return sabakan.AuditDHCP
+	case p == "config/ipam":
+		return sabakan.AuditIPAM
+	case p == "crypts" || strings.HasPrefix(p, "crypts/"):
+		return sabakan.AuditCrypts
+	case strings.HasPrefix(p, "crypt-policies/"):
+		return sabakan.AuditCryptPolicy
+	case p == "images/coreos" || strings.HasPrefix(p, "images/coreos/"):
+		return sabakan.AuditImage
+	case p == "logs" || strings.HasPrefix(p, "logs/"):
+		return sabakan.AuditLogs
+	case strings.HasPrefix(p, "machines"), strings.HasPrefix(p, "state/"),
+		strings.HasPrefix(p, "labels/"), strings.HasPrefix(p, "retire-date/"):
+		return sabakan.AuditMachines
+	case p == "webhooks" || strings.HasPrefix(p, "webhooks/"):
+		return sabakan.AuditWebhooks
+	}
+	return ""
+}
+
+// apiVerb returns the RBAC verb of HTTP method.
+func apiVerb(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead:
+		return sabakan.VerbRead
+	case http.MethodDelete:
+		return sabakan.VerbDelete
+	}
+	return sabakan.VerbWrite
+}
+
+// authorize checks RBAC permissions for API path p.
+// If the request is denied, this records it in the audit log, renders
+// an error, and returns false.
+func (s Server) authorize(w http.ResponseWriter, r *http.Request, p string) bool {
+	cat := apiCategory(p)
+	if cat == "" {
+		// unknown APIs result in 404.
+		return true
+	}
+
+	ctx := r.Context()
+	err := sabakan.Authorize(ctx, cat, apiVerb(r.Method))
+	if err == nil {
+		return true
+	}
+
+	err = s.Model.Log.Record(ctx, cat, p, "deny", r.Method+" "+r.URL.Path)
+	if err != nil {
+		log.Error("failed to record a denied request", map[string]interface{}{
+			log.FnError: err,
+			"path":      r.URL.Path,
+			"method":    r.Method,
+		})
+	}
+	renderError(ctx, w, APIErrForbidden)
+	return false
+}
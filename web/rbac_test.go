@@ -0,0 +1,167 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cybozu-go/sabakan/v3"
+	"github.com/cybozu-go/sabakan/v3/models/mock"
+)
+
+func testNewRBACServer(m sabakan.Model) *Server {
+	s := newTestServer(m)
+	s.RBAC = &sabakan.RBACConfig{
+		Roles: map[string][]sabakan.RBACRule{
+			"read-only": {
+				{Categories: []sabakan.AuditCategory{sabakan.RBACAny}, Verbs: []string{sabakan.VerbRead}},
+			},
+			"machine-operator": {
+				{Categories: []sabakan.AuditCategory{sabakan.AuditMachines}, Verbs: []string{sabakan.RBACAny}},
+			},
+		},
+		Principals: []sabakan.RBACPrincipal{
+			{Name: "operator", Token: "secret", Roles: []string{"read-only", "machine-operator"}},
+		},
+		AnonymousRoles: []string{"read-only"},
+	}
+	return s
+}
+
+func testLastAuditLog(t *testing.T, m sabakan.Model) *sabakan.AuditLog {
+	buf := new(bytes.Buffer)
+	q := &sabakan.LogQuery{Limit: 1, Order: sabakan.LogOrderDesc}
+	err := m.Log.Query(context.Background(), q, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := new(sabakan.AuditLog)
+	err = json.Unmarshal(buf.Bytes(), a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func testRBACREST(t *testing.T) {
+	t.Parallel()
+
+	m := mock.NewModel()
+	testWithIPAM(t, m)
+	handler := testNewRBACServer(m)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/api/v1/config/ipam", nil)
+	handler.ServeHTTP(w, r)
+	if w.Result().StatusCode != http.StatusOK {
+		t.Error("anonymous read should be allowed:", w.Result().StatusCode)
+	}
+
+	machines := `[{"serial": "1234abcd", "rack": 1, "role": "boot", "bmc": {"type": "iDRAC-9"}}]`
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("POST", "/api/v1/machines", strings.NewReader(machines))
+	r.Header.Set(HeaderSabactlUser, "mallory")
+	handler.ServeHTTP(w, r)
+	if w.Result().StatusCode != http.StatusForbidden {
+		t.Fatal("anonymous write should be forbidden:", w.Result().StatusCode)
+	}
+
+	a := testLastAuditLog(t, m)
+	if a.Action != "deny" || a.Category != sabakan.AuditMachines || a.User != "mallory" {
+		t.Error("denial is not recorded:", a)
+	}
+	if a.Detail != "POST /api/v1/machines" {
+		t.Error("wrong detail:", a.Detail)
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("POST", "/api/v1/machines", strings.NewReader(machines))
+	r.Header.Set("Authorization", "Bearer secret")
+	handler.ServeHTTP(w, r)
+	if w.Result().StatusCode != http.StatusForbidden {
+		t.Fatal("token over HTTP should be ignored:", w.Result().StatusCode)
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("POST", "https://localhost/api/v1/machines", strings.NewReader(machines))
+	r.Header.Set("Authorization", "Bearer secret")
+	handler.ServeHTTP(w, r)
+	if w.Result().StatusCode != http.StatusCreated {
+		t.Fatal("machine-operator should be allowed to register machines:", w.Result().StatusCode)
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("DELETE", "https://localhost/api/v1/machines/1234abcd", nil)
+	r.Header.Set("Authorization", "Bearer wrong")
+	handler.ServeHTTP(w, r)
+	if w.Result().StatusCode != http.StatusForbidden {
+		t.Fatal("wrong token should be treated as anonymous:", w.Result().StatusCode)
+	}
+}
+
+func testRBACGraphQL(t *testing.T) {
+	t.Parallel()
+
+	m := mock.NewModel()
+	handler := testNewRBACServer(m)
+
+	body := `{"query": "mutation { setMachineState(serial: \"1234\", state: RETIRING) { state } }"}`
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/graphql", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	handler.ServeHTTP(w, r)
+
+	var resp struct {
+		Errors []struct {
+			Extensions map[string]interface{} `json:"extensions"`
+		} `json:"errors"`
+	}
+	err := json.NewDecoder(w.Body).Decode(&resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Errors) != 1 || resp.Errors[0].Extensions["type"] != "FORBIDDEN" {
+		t.Fatal("mutation should be forbidden:", resp.Errors)
+	}
+
+	a := testLastAuditLog(t, m)
+	if a.Action != "deny" || a.Instance != "1234" {
+		t.Error("denial is not recorded:", a)
+	}
+}
+
+func testAPICategory(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]sabakan.AuditCategory{
+		"assets/foo":                        sabakan.AuditAssets,
+		"backup":                            sabakan.AuditBackup,
+		"boot/ipxe.efi":                     sabakan.AuditIPXE,
+		"boot/ignitions/1234/1.0.0":         sabakan.AuditIgnition,
+		"boot/ztp/00:11:22:33:44:55/script": sabakan.AuditSwitches,
+		"crypts":                            sabakan.AuditCrypts,
+		"crypts/1234/disk":                  sabakan.AuditCrypts,
+		"crypt-policies/role/worker":        sabakan.AuditCryptPolicy,
+		"labels/1234/foo":                   sabakan.AuditMachines,
+		"logs":                              sabakan.AuditLogs,
+		"logs/chain":                        sabakan.AuditLogs,
+		"webhooks":                          sabakan.AuditWebhooks,
+		"webhooks/hook1":                    sabakan.AuditWebhooks,
+		"unknown":                           "",
+	}
+	for p, expected := range cases {
+		if cat := apiCategory(p); cat != expected {
+			t.Errorf("apiCategory(%q) = %q, expected %q", p, cat, expected)
+		}
+	}
+}
+
+func TestRBAC(t *testing.T) {
+	t.Run("REST", testRBACREST)
+	t.Run("GraphQL", testRBACGraphQL)
+	t.Run("Category", testAPICategory)
+}
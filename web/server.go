@@ -2,6 +2,7 @@ package web
 
 import (
 	"context"
+	"crypto/x509"
 	"net"
 	"net/http"
 	"net/url"
@@ -15,6 +16,7 @@ import (
 	"github.com/99designs/gqlgen/graphql/handler/transport"
 	"github.com/99designs/gqlgen/graphql/playground"
 	"github.com/cybozu-go/sabakan/v3"
+	"github.com/cybozu-go/sabakan/v3/dhcpd"
 	"github.com/cybozu-go/sabakan/v3/gql/graph"
 	"github.com/cybozu-go/sabakan/v3/gql/graph/generated"
 	"github.com/cybozu-go/sabakan/v3/metrics"
@@ -55,6 +57,9 @@ type Server struct {
 	CryptSetup     string
 	AllowedRemotes []*net.IPNet
 	Counter        *metrics.APICounter
+	DHCPTrace      *dhcpd.TraceBuffer
+	RBAC           *sabakan.RBACConfig
+	CryptPolicy    *CryptPolicy
 
 	graphQL    http.Handler
 	playground http.HandlerFunc
@@ -118,7 +123,7 @@ func (s Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if r.URL.Path == "/graphql" {
-		s.graphQL.ServeHTTP(w, r)
+		s.graphQL.ServeHTTP(w, r.WithContext(s.auditContext(r)))
 		return
 	}
 
@@ -141,21 +146,50 @@ func (s Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s Server) serveHTTPS(w http.ResponseWriter, r *http.Request) {
-	if strings.HasPrefix(r.URL.Path, "/api/v1/") {
+	if r.URL.Path == "/api/v1/crypts" || strings.HasPrefix(r.URL.Path, "/api/v1/crypts/") {
 		s.handleAPIV1HTTPS(w, r)
 		return
 	}
-	renderError(r.Context(), w, APIErrNotFound)
+	s.serveHTTP(w, r)
+}
+
+// clientCertificate returns the verified client certificate of the request.
+// This returns nil if the client did not present a certificate.
+func clientCertificate(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return r.TLS.VerifiedChains[0][0]
 }
 
-func auditContext(r *http.Request) context.Context {
+// clientIdentity returns the user name authenticated by the client certificate.
+func clientIdentity(cert *x509.Certificate) string {
+	if len(cert.Subject.CommonName) > 0 {
+		return cert.Subject.CommonName
+	}
+	return cert.Subject.String()
+}
+
+func (s Server) auditContext(r *http.Request) context.Context {
 	ctx := r.Context()
 
-	u := r.Header.Get(HeaderSabactlUser)
-	if len(u) > 0 {
+	// The user name in the header is self-declared, so the authenticated
+	// identity takes precedence.
+	user, principal := s.authenticate(r)
+	if len(user) > 0 {
+		ctx = context.WithValue(ctx, sabakan.AuditKeyUser, user)
+	} else if u := r.Header.Get(HeaderSabactlUser); len(u) > 0 {
 		ctx = context.WithValue(ctx, sabakan.AuditKeyUser, u)
 	}
 
+	if s.RBAC != nil {
+		roles := s.RBAC.AnonymousRoles
+		if principal != nil {
+			roles = principal.Roles
+		}
+		ctx = sabakan.WithRBACRoles(ctx, s.RBAC, roles)
+	}
+
 	ip, _, _ := net.SplitHostPort(r.RemoteAddr)
 	if len(ip) > 0 {
 		ctx = context.WithValue(ctx, sabakan.AuditKeyIP, ip)
@@ -178,31 +212,46 @@ func (s Server) handleAPIV1(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	r = r.WithContext(auditContext(r))
+	r = r.WithContext(s.auditContext(r))
+	if !s.authorize(w, r, p) {
+		return
+	}
 
 	switch {
 	case p == "assets" || strings.HasPrefix(p, "assets/"):
 		s.handleAssets(w, r)
+	case p == "backup":
+		s.handleBackup(w, r)
 	case p == "boot/ipxe.efi":
 		http.ServeFile(w, r, s.IPXEFirmware)
 	case strings.HasPrefix(p, "boot/coreos/"):
 		s.handleCoreOS(w, r)
 	case strings.HasPrefix(p, "boot/ignitions/"):
 		s.handleIgnitions(w, r)
+	case strings.HasPrefix(p, "boot/ztp/"):
+		s.handleZTP(w, r)
 	case p == "config/dhcp":
 		s.handleConfigDHCP(w, r)
+	case strings.HasPrefix(p, "dhcp/debug/"):
+		s.handleDHCPDebug(w, r)
 	case p == "config/ipam":
 		s.handleConfigIPAM(w, r)
 	case p == "cryptsetup":
 		s.handleCryptSetup(w, r)
+	case strings.HasPrefix(p, "crypt-policies/"):
+		s.handleCryptPolicies(w, r)
 	case strings.HasPrefix(p, "ignitions/"):
 		s.handleIgnitionTemplates(w, r)
 	case p == "images/coreos" || strings.HasPrefix(p, "images/coreos/"):
 		s.handleImages(w, r)
 	case p == "logs":
 		s.handleLogs(w, r)
+	case p == "logs/chain":
+		s.handleLogsChain(w, r)
 	case strings.HasPrefix(p, "machines"):
 		s.handleMachines(w, r)
+	case p == "switches" || strings.HasPrefix(p, "switches/"):
+		s.handleSwitches(w, r)
 	case strings.HasPrefix(p, "state/"):
 		s.handleState(w, r)
 	case strings.HasPrefix(p, "labels/"):
@@ -211,6 +260,8 @@ func (s Server) handleAPIV1(w http.ResponseWriter, r *http.Request) {
 		s.handleRetireDate(w, r)
 	case strings.HasPrefix(p, "kernel_params/"):
 		s.handleKernelParams(w, r)
+	case p == "webhooks" || strings.HasPrefix(p, "webhooks/"):
+		s.handleWebhooks(w, r)
 	default:
 		renderError(r.Context(), w, APIErrNotFound)
 	}
@@ -224,9 +275,14 @@ func (s Server) handleAPIV1HTTPS(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	r = r.WithContext(auditContext(r))
+	r = r.WithContext(s.auditContext(r))
+	if !s.authorize(w, r, p) {
+		return
+	}
 
 	switch {
+	case p == "crypts":
+		s.handleCryptsIndex(w, r)
 	case strings.HasPrefix(p, "crypts/"):
 		s.handleCrypts(w, r)
 	default:
@@ -237,12 +293,16 @@ func (s Server) handleAPIV1HTTPS(w http.ResponseWriter, r *http.Request) {
 // hasPermission returns true if the request has a permission to the resource
 func (s Server) hasPermission(r *http.Request) bool {
 	p := r.URL.Path[len("/api/v1/"):]
-	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+	// backups may contain disk encryption keys
+	if (r.Method == http.MethodGet || r.Method == http.MethodHead) && p != "backup" {
 		return true
 	}
 	if strings.HasPrefix(p, "crypts/") && r.Method != http.MethodDelete {
 		return true
 	}
+	if user, _ := s.authenticate(r); len(user) > 0 {
+		return true
+	}
 	rhost, _, err := net.SplitHostPort(r.RemoteAddr)
 	if rhost == "" || err != nil {
 		return false
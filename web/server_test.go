@@ -1,9 +1,9 @@
 package web
 
 import (
-	"bytes"
-	"context"
-	"encoding/json"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"fmt"
 	"net"
 	"net/http"
@@ -11,7 +11,6 @@ import (
 	"net/url"
 	"strings"
 	"testing"
-	"time"
 
 	"github.com/cybozu-go/sabakan/v3"
 	"github.com/cybozu-go/sabakan/v3/metrics"
@@ -54,6 +53,7 @@ func testHandlePermission(t *testing.T) {
 		{"10.69.0.4", "GET", "/api/v1/crypts/1234/abc"},
 		{"10.69.0.4", "PUT", "/api/v1/crypts/1234/abc"},
 		{"10.69.0.4", "GET", "/api/v1/boot/coreos/kernel"},
+		{"127.0.0.1", "GET", "/api/v1/backup"},
 	}
 	for _, c := range cases {
 		remote := c.remote + ":11111"
@@ -71,6 +71,8 @@ func testHandlePermission(t *testing.T) {
 		{"10.69.0.4", "POST", "/api/v1/config/ipam"},
 		{"10.69.0.4", "PUT", "/api/v1/images/coreos/123.456"},
 		{"10.69.0.4", "DELETE", "/api/v1/crypts/1234"},
+		{"10.69.0.4", "GET", "/api/v1/backup"},
+		{"10.69.0.4", "PUT", "/api/v1/backup"},
 	}
 	for _, c := range cases {
 		remote := c.remote + ":11111"
@@ -112,18 +114,7 @@ func testAuditContext(t *testing.T) {
 		t.Fatal("request failed with " + http.StatusText(resp.StatusCode))
 	}
 
-	buf := new(bytes.Buffer)
-	err := m.Log.Dump(context.Background(), time.Time{}, time.Time{}, buf)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	a := new(sabakan.AuditLog)
-	err = json.Unmarshal(buf.Bytes(), a)
-	if err != nil {
-		t.Fatal(err)
-	}
-
+	a := testLastAuditLog(t, m)
 	if a.IP != "192.0.2.1" {
 		t.Error(`a.IP != "192.0.2.1"`, a.IP)
 	}
@@ -139,20 +130,66 @@ func testAuditContext(t *testing.T) {
 	r.Header.Set(HeaderSabactlUser, "cybozu")
 	handler.ServeHTTP(w, r)
 
-	buf.Reset()
-	err = m.Log.Dump(context.Background(), time.Time{}, time.Time{}, buf)
-	if err != nil {
-		t.Fatal(err)
+	a = testLastAuditLog(t, m)
+	if a.User != "cybozu" {
+		t.Error(`a.User != "cybozu"`, a.User)
 	}
+}
 
-	a = new(sabakan.AuditLog)
-	err = json.Unmarshal(buf.Bytes(), a)
-	if err != nil {
-		t.Fatal(err)
+func testClientCertificate(t *testing.T) {
+	t.Parallel()
+
+	m := mock.NewModel()
+	handler := newTestServer(m)
+	handler.TLSServer = true
+	handler.AllowedRemotes = nil
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "alice", Organization: []string{"cybozu"}}}
+	state := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "https://example.com/api/v1/switches", nil)
+	handler.ServeHTTP(w, r)
+	if w.Result().StatusCode != http.StatusOK {
+		t.Error("APIs other than crypts should be served over TLS:", w.Result().StatusCode)
 	}
 
-	if a.User != "cybozu" {
-		t.Error(`a.User != "cybozu"`, a.User)
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("PUT", "https://example.com/api/v1/labels/1234", strings.NewReader(`{"foo": "bar"}`))
+	handler.ServeHTTP(w, r)
+	if w.Result().StatusCode != http.StatusForbidden {
+		t.Error("request without client certificate should be forbidden:", w.Result().StatusCode)
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("PUT", "https://example.com/api/v1/config/ipam", strings.NewReader(`{
+   "max-nodes-in-rack": 28,
+   "node-ipv4-pool": "10.69.0.0/20",
+   "node-ipv4-range-size": 6,
+   "node-ipv4-range-mask": 26,
+   "node-ip-per-node": 3,
+   "node-index-offset": 3,
+   "node-gateway-offset": 1,
+   "bmc-ipv4-pool": "10.72.16.0/20",
+   "bmc-ipv4-range-size": 5,
+   "bmc-ipv4-range-mask": 20,
+   "bmc-ipv4-gateway-offset": 1
+}`))
+	r.TLS = state
+	r.Header.Set(HeaderSabactlUser, "mallory")
+	handler.ServeHTTP(w, r)
+	if w.Result().StatusCode != http.StatusOK {
+		t.Fatal("request with client certificate failed:", w.Result().StatusCode)
+	}
+
+	a := testLastAuditLog(t, m)
+	if a.User != "alice" {
+		t.Error(`a.User != "alice"`, a.User)
+	}
+
+	cert = &x509.Certificate{Subject: pkix.Name{Organization: []string{"cybozu"}}}
+	if id := clientIdentity(cert); id != "O=cybozu" {
+		t.Error(`id != "O=cybozu"`, id)
 	}
 }
 
@@ -185,5 +222,6 @@ func TestServeHTTP(t *testing.T) {
 	t.Run("APIV1", testHandleAPIV1)
 	t.Run("Permission", testHandlePermission)
 	t.Run("AuditContext", testAuditContext)
+	t.Run("ClientCertificate", testClientCertificate)
 	t.Run("APICounter", testAPICounter)
 }
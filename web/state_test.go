@@ -68,7 +68,7 @@ func testStatePutFromUninitialized(t *testing.T) {
 	testData := []testTransition{
 		{"uninitialized", 200},
 		{"healthy", 200},
-		{"unhealthy", 500},
+		{"unhealthy", 200},
 		{"unreachable", 500},
 		{"updating", 500},
 		{"retiring", 200},
@@ -0,0 +1,102 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+func (s Server) handleSwitches(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/api/v1/switches" {
+		if r.Method != "GET" {
+			renderError(r.Context(), w, APIErrBadMethod)
+			return
+		}
+		s.handleSwitchesList(w, r)
+		return
+	}
+
+	params := strings.Split(r.URL.Path[len("/api/v1/switches/"):], "/")
+	if len(params) != 1 {
+		renderError(r.Context(), w, APIErrBadRequest)
+		return
+	}
+	mac, err := sabakan.NormalizeMACAddress(params[0])
+	if err != nil {
+		renderError(r.Context(), w, BadRequest("invalid MAC address: "+params[0]))
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		s.handleSwitchesGet(w, r, mac)
+	case "PUT":
+		s.handleSwitchesPut(w, r, mac)
+	case "DELETE":
+		s.handleSwitchesDelete(w, r, mac)
+	default:
+		renderError(r.Context(), w, APIErrBadMethod)
+	}
+}
+
+func (s Server) handleSwitchesList(w http.ResponseWriter, r *http.Request) {
+	switches, err := s.Model.Switch.GetAll(r.Context())
+	if err != nil {
+		renderError(r.Context(), w, InternalServerError(err))
+		return
+	}
+	renderJSON(w, switches, http.StatusOK)
+}
+
+func (s Server) handleSwitchesGet(w http.ResponseWriter, r *http.Request, mac string) {
+	sw, err := s.Model.Switch.Get(r.Context(), mac)
+	if err == sabakan.ErrNotFound {
+		renderError(r.Context(), w, APIErrNotFound)
+		return
+	}
+	if err != nil {
+		renderError(r.Context(), w, InternalServerError(err))
+		return
+	}
+	renderJSON(w, sw, http.StatusOK)
+}
+
+func (s Server) handleSwitchesPut(w http.ResponseWriter, r *http.Request, mac string) {
+	sw := new(sabakan.Switch)
+	err := json.NewDecoder(r.Body).Decode(sw)
+	if err != nil {
+		renderError(r.Context(), w, BadRequest(err.Error()))
+		return
+	}
+	sw.MAC = mac
+
+	err = sw.Validate()
+	if err != nil {
+		renderError(r.Context(), w, BadRequest(err.Error()))
+		return
+	}
+
+	err = s.Model.Switch.Put(r.Context(), sw)
+	if err != nil {
+		renderError(r.Context(), w, InternalServerError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s Server) handleSwitchesDelete(w http.ResponseWriter, r *http.Request, mac string) {
+	err := s.Model.Switch.Delete(r.Context(), mac)
+	if err == sabakan.ErrNotFound {
+		renderError(r.Context(), w, APIErrNotFound)
+		return
+	}
+	if err != nil {
+		renderError(r.Context(), w, InternalServerError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,167 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cybozu-go/sabakan/v3"
+	"github.com/cybozu-go/sabakan/v3/models/mock"
+)
+
+func testSwitchesPut(t *testing.T) {
+	t.Parallel()
+
+	m := mock.NewModel()
+	handler := newTestServer(m)
+
+	cases := []struct {
+		mac    string
+		body   string
+		status int
+	}{
+		{"00-11-22-33-44-55", `{"name": "leaf1", "installer": "onie-installer.bin"}`, http.StatusCreated},
+		{"00:11:22:33:44:66", `{"script": "ztp.sh"}`, http.StatusCreated},
+		{"00:11:22:33:44:77", `{"name": "leaf3"}`, http.StatusBadRequest},
+		{"00:11:22:33:44:88", `{"name": "leaf/4", "script": "ztp.sh"}`, http.StatusBadRequest},
+		{"00:11:22", `{"script": "ztp.sh"}`, http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("PUT", "/api/v1/switches/"+c.mac, strings.NewReader(c.body))
+		handler.ServeHTTP(w, r)
+
+		resp := w.Result()
+		if resp.StatusCode != c.status {
+			t.Error("unexpected status for", c.mac, resp.StatusCode)
+		}
+	}
+
+	sw, err := m.Switch.Get(context.Background(), "00:11:22:33:44:55")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sw.Name != "leaf1" || sw.Installer != "onie-installer.bin" {
+		t.Error("wrong switch stored:", sw)
+	}
+}
+
+func testSwitchesGet(t *testing.T) {
+	t.Parallel()
+
+	m := mock.NewModel()
+	handler := newTestServer(m)
+
+	sw := &sabakan.Switch{MAC: "00:11:22:33:44:55", Name: "leaf1", Script: "ztp.sh"}
+	err := m.Switch.Put(context.Background(), sw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/api/v1/switches", nil)
+	handler.ServeHTTP(w, r)
+
+	resp := w.Result()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal("resp.StatusCode != http.StatusOK:", resp.StatusCode)
+	}
+	var switches []*sabakan.Switch
+	err = json.NewDecoder(resp.Body).Decode(&switches)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(switches) != 1 || *switches[0] != *sw {
+		t.Error("wrong switches:", switches)
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/api/v1/switches/00:11:22:33:44:66", nil)
+	handler.ServeHTTP(w, r)
+
+	resp = w.Result()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Error("resp.StatusCode != http.StatusNotFound:", resp.StatusCode)
+	}
+}
+
+func testSwitchesDelete(t *testing.T) {
+	t.Parallel()
+
+	m := mock.NewModel()
+	handler := newTestServer(m)
+
+	err := m.Switch.Put(context.Background(), &sabakan.Switch{MAC: "00:11:22:33:44:55", Script: "ztp.sh"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, status := range []int{http.StatusOK, http.StatusNotFound} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("DELETE", "/api/v1/switches/00:11:22:33:44:55", nil)
+		handler.ServeHTTP(w, r)
+
+		resp := w.Result()
+		if resp.StatusCode != status {
+			t.Error("unexpected status:", resp.StatusCode, status)
+		}
+	}
+}
+
+func testSwitchesZTP(t *testing.T) {
+	t.Parallel()
+
+	m := mock.NewModel()
+	handler := newTestServer(m)
+
+	_, err := m.Asset.Put(context.Background(), "ztp.sh", "text/x-shellscript", nil, nil, strings.NewReader("#!/bin/sh\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.Switch.Put(context.Background(), &sabakan.Switch{MAC: "00:11:22:33:44:55", Script: "ztp.sh"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/api/v1/boot/ztp/00:11:22:33:44:55/script", nil)
+	handler.ServeHTTP(w, r)
+
+	resp := w.Result()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal("resp.StatusCode != http.StatusOK:", resp.StatusCode)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "#!/bin/sh\n" {
+		t.Error("wrong content:", string(data))
+	}
+
+	for _, p := range []string{
+		"/api/v1/boot/ztp/00:11:22:33:44:55/installer",
+		"/api/v1/boot/ztp/00:11:22:33:44:66/script",
+		"/api/v1/boot/ztp/00:11:22:33:44:55/foo",
+	} {
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest("GET", p, nil)
+		handler.ServeHTTP(w, r)
+
+		resp = w.Result()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Error("resp.StatusCode != http.StatusNotFound:", p, resp.StatusCode)
+		}
+	}
+}
+
+func TestSwitches(t *testing.T) {
+	t.Run("Put", testSwitchesPut)
+	t.Run("Get", testSwitchesGet)
+	t.Run("Delete", testSwitchesDelete)
+	t.Run("ZTP", testSwitchesZTP)
+}
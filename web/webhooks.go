@@ -0,0 +1,107 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+func (s Server) handleWebhooks(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/api/v1/webhooks" {
+		if r.Method != "GET" {
+			renderError(r.Context(), w, APIErrBadMethod)
+			return
+		}
+		s.handleWebhooksList(w, r)
+		return
+	}
+
+	params := strings.Split(r.URL.Path[len("/api/v1/webhooks/"):], "/")
+	if len(params) != 1 {
+		renderError(r.Context(), w, APIErrBadRequest)
+		return
+	}
+	name := params[0]
+	if !sabakan.IsValidWebhookName(name) {
+		renderError(r.Context(), w, BadRequest("invalid webhook name: "+name))
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		s.handleWebhooksGet(w, r, name)
+	case "PUT":
+		s.handleWebhooksPut(w, r, name)
+	case "DELETE":
+		s.handleWebhooksDelete(w, r, name)
+	default:
+		renderError(r.Context(), w, APIErrBadMethod)
+	}
+}
+
+func (s Server) handleWebhooksList(w http.ResponseWriter, r *http.Request) {
+	hooks, err := s.Model.Webhook.GetAll(r.Context())
+	if err != nil {
+		renderError(r.Context(), w, InternalServerError(err))
+		return
+	}
+	// secrets are write-only
+	for _, hook := range hooks {
+		hook.Secret = ""
+	}
+	renderJSON(w, hooks, http.StatusOK)
+}
+
+func (s Server) handleWebhooksGet(w http.ResponseWriter, r *http.Request, name string) {
+	hook, err := s.Model.Webhook.Get(r.Context(), name)
+	if err == sabakan.ErrNotFound {
+		renderError(r.Context(), w, APIErrNotFound)
+		return
+	}
+	if err != nil {
+		renderError(r.Context(), w, InternalServerError(err))
+		return
+	}
+	hook.Secret = ""
+	renderJSON(w, hook, http.StatusOK)
+}
+
+func (s Server) handleWebhooksPut(w http.ResponseWriter, r *http.Request, name string) {
+	hook := new(sabakan.Webhook)
+	err := json.NewDecoder(r.Body).Decode(hook)
+	if err != nil {
+		renderError(r.Context(), w, BadRequest(err.Error()))
+		return
+	}
+	hook.Name = name
+
+	err = hook.Validate()
+	if err != nil {
+		renderError(r.Context(), w, BadRequest(err.Error()))
+		return
+	}
+
+	err = s.Model.Webhook.Put(r.Context(), hook)
+	if err != nil {
+		renderError(r.Context(), w, InternalServerError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s Server) handleWebhooksDelete(w http.ResponseWriter, r *http.Request, name string) {
+	err := s.Model.Webhook.Delete(r.Context(), name)
+	if err == sabakan.ErrNotFound {
+		renderError(r.Context(), w, APIErrNotFound)
+		return
+	}
+	if err != nil {
+		renderError(r.Context(), w, InternalServerError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
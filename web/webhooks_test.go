@@ -0,0 +1,144 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cybozu-go/sabakan/v3"
+	"github.com/cybozu-go/sabakan/v3/models/mock"
+	"github.com/google/go-cmp/cmp"
+)
+
+func testWebhooksPut(t *testing.T) {
+	t.Parallel()
+
+	m := mock.NewModel()
+	handler := newTestServer(m)
+
+	cases := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"hook1", `{"url": "https://example.com/hooks", "categories": ["machines"], "secret": "xyz"}`, http.StatusCreated},
+		{"hook2", `{"url": "http://example.com/", "actions": ["put", "delete"], "cloudevents": true}`, http.StatusCreated},
+		{"hook3", `{"url": "ftp://example.com/"}`, http.StatusBadRequest},
+		{"hook4", `{"url": "http://example.com/", "categories": [""]}`, http.StatusBadRequest},
+		{"Hook5", `{"url": "http://example.com/"}`, http.StatusBadRequest},
+		{"hook6", `{"url": `, http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("PUT", "/api/v1/webhooks/"+c.name, strings.NewReader(c.body))
+		handler.ServeHTTP(w, r)
+
+		resp := w.Result()
+		if resp.StatusCode != c.status {
+			t.Error("unexpected status for", c.name, resp.StatusCode)
+		}
+	}
+
+	hook, err := m.Webhook.Get(context.Background(), "hook1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &sabakan.Webhook{
+		Name:       "hook1",
+		URL:        "https://example.com/hooks",
+		Categories: []sabakan.AuditCategory{sabakan.AuditMachines},
+		Secret:     "xyz",
+	}
+	if !cmp.Equal(hook, expected) {
+		t.Error("wrong webhook stored:", cmp.Diff(hook, expected))
+	}
+}
+
+func testWebhooksGet(t *testing.T) {
+	t.Parallel()
+
+	m := mock.NewModel()
+	handler := newTestServer(m)
+
+	hook := &sabakan.Webhook{Name: "hook1", URL: "https://example.com/", Secret: "xyz"}
+	err := m.Webhook.Put(context.Background(), hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/api/v1/webhooks", nil)
+	handler.ServeHTTP(w, r)
+
+	resp := w.Result()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal("resp.StatusCode != http.StatusOK:", resp.StatusCode)
+	}
+	var hooks []*sabakan.Webhook
+	err = json.NewDecoder(resp.Body).Decode(&hooks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []*sabakan.Webhook{{Name: "hook1", URL: "https://example.com/"}}
+	if !cmp.Equal(hooks, expected) {
+		t.Error("wrong webhooks:", cmp.Diff(hooks, expected))
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/api/v1/webhooks/hook1", nil)
+	handler.ServeHTTP(w, r)
+
+	resp = w.Result()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal("resp.StatusCode != http.StatusOK:", resp.StatusCode)
+	}
+	got := new(sabakan.Webhook)
+	err = json.NewDecoder(resp.Body).Decode(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Secret != "" {
+		t.Error("secret should not be returned")
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/api/v1/webhooks/hook2", nil)
+	handler.ServeHTTP(w, r)
+
+	resp = w.Result()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Error("resp.StatusCode != http.StatusNotFound:", resp.StatusCode)
+	}
+}
+
+func testWebhooksDelete(t *testing.T) {
+	t.Parallel()
+
+	m := mock.NewModel()
+	handler := newTestServer(m)
+
+	err := m.Webhook.Put(context.Background(), &sabakan.Webhook{Name: "hook1", URL: "https://example.com/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, status := range []int{http.StatusOK, http.StatusNotFound} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("DELETE", "/api/v1/webhooks/hook1", nil)
+		handler.ServeHTTP(w, r)
+
+		resp := w.Result()
+		if resp.StatusCode != status {
+			t.Error("unexpected status:", resp.StatusCode, status)
+		}
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	t.Run("Put", testWebhooksPut)
+	t.Run("Get", testWebhooksGet)
+	t.Run("Delete", testWebhooksDelete)
+}
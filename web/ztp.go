@@ -0,0 +1,54 @@
+package web
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/cybozu-go/sabakan/v3"
+)
+
+// handleZTP serves the installer or the ZTP script registered for a switch.
+//
+//	GET /api/v1/boot/ztp/{mac}/installer
+//	GET /api/v1/boot/ztp/{mac}/script
+func (s Server) handleZTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		renderError(r.Context(), w, APIErrBadMethod)
+		return
+	}
+
+	params := strings.Split(r.URL.Path[len("/api/v1/boot/ztp/"):], "/")
+	if len(params) != 2 {
+		renderError(r.Context(), w, APIErrNotFound)
+		return
+	}
+	mac, err := sabakan.NormalizeMACAddress(params[0])
+	if err != nil {
+		renderError(r.Context(), w, BadRequest("invalid MAC address: "+params[0]))
+		return
+	}
+
+	sw, err := s.Model.Switch.Get(r.Context(), mac)
+	if err == sabakan.ErrNotFound {
+		renderError(r.Context(), w, APIErrNotFound)
+		return
+	}
+	if err != nil {
+		renderError(r.Context(), w, InternalServerError(err))
+		return
+	}
+
+	var name string
+	switch params[1] {
+	case "installer":
+		name = sw.Installer
+	case "script":
+		name = sw.Script
+	}
+	if name == "" {
+		renderError(r.Context(), w, APIErrNotFound)
+		return
+	}
+
+	s.handleAssetsGet(w, r, name)
+}
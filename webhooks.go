@@ -0,0 +1,112 @@
+package sabakan
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"regexp"
+)
+
+// HTTP headers of webhook requests.
+const (
+	// WebhookSignatureHeader carries the HMAC-SHA256 signature of the body.
+	WebhookSignatureHeader = "X-Sabakan-Signature"
+
+	// WebhookDeliveryHeader carries the unique ID of the audit log entry.
+	// Receivers can use it to ignore redelivered entries.
+	WebhookDeliveryHeader = "X-Sabakan-Delivery"
+)
+
+var reValidWebhookName = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// IsValidWebhookName returns true if name is valid as a webhook name.
+func IsValidWebhookName(name string) bool {
+	return reValidWebhookName.MatchString(name)
+}
+
+// Webhook is a subscription to audit logs.
+//
+// Audit log entries matching the subscription are POSTed to URL in order.
+type Webhook struct {
+	// Name is the name of the subscription.
+	Name string `json:"name"`
+
+	// URL is the http or https URL to which entries are POSTed.
+	URL string `json:"url"`
+
+	// Categories selects entries by category.  If empty, all categories are selected.
+	Categories []AuditCategory `json:"categories,omitempty"`
+
+	// Actions selects entries by action.  If empty, all actions are selected.
+	Actions []string `json:"actions,omitempty"`
+
+	// Secret is the key to sign requests with HMAC-SHA256.
+	// If empty, requests are not signed.
+	Secret string `json:"secret,omitempty"`
+
+	// CloudEvents wraps entries in CloudEvents envelopes.
+	CloudEvents bool `json:"cloudevents,omitempty"`
+}
+
+// Validate validates the webhook.
+func (h *Webhook) Validate() error {
+	if !IsValidWebhookName(h.Name) {
+		return errors.New("invalid webhook name: " + h.Name)
+	}
+	u, err := url.Parse(h.URL)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("invalid webhook URL: " + h.URL)
+	}
+	for _, c := range h.Categories {
+		if c == "" {
+			return errors.New("empty category")
+		}
+	}
+	for _, a := range h.Actions {
+		if a == "" {
+			return errors.New("empty action")
+		}
+	}
+	return nil
+}
+
+// Match returns true if the webhook subscribes to the audit log entry.
+func (h *Webhook) Match(a *AuditLog) bool {
+	if len(h.Categories) > 0 {
+		var found bool
+		for _, c := range h.Categories {
+			if c == a.Category {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(h.Actions) > 0 {
+		var found bool
+		for _, act := range h.Actions {
+			if act == a.Action {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// SignWebhookPayload returns the value of WebhookSignatureHeader for body.
+func SignWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,69 @@
+package sabakan
+
+import "testing"
+
+func TestWebhookValidate(t *testing.T) {
+	t.Parallel()
+
+	valid := []Webhook{
+		{Name: "hook1", URL: "http://example.com/"},
+		{Name: "a", URL: "https://example.com:8443/hooks", Secret: "xyz", CloudEvents: true},
+		{Name: "hook-2", URL: "https://example.com/", Categories: []AuditCategory{AuditMachines}, Actions: []string{"put"}},
+	}
+	for _, h := range valid {
+		if err := h.Validate(); err != nil {
+			t.Error("webhook should be valid:", h, err)
+		}
+	}
+
+	invalid := []Webhook{
+		{URL: "http://example.com/"},
+		{Name: "Hook", URL: "http://example.com/"},
+		{Name: "hook-", URL: "http://example.com/"},
+		{Name: "hook", URL: ""},
+		{Name: "hook", URL: "ftp://example.com/"},
+		{Name: "hook", URL: "/hooks"},
+		{Name: "hook", URL: "http://example.com/", Categories: []AuditCategory{""}},
+		{Name: "hook", URL: "http://example.com/", Actions: []string{""}},
+	}
+	for _, h := range invalid {
+		if err := h.Validate(); err == nil {
+			t.Error("webhook should be invalid:", h)
+		}
+	}
+}
+
+func TestWebhookMatch(t *testing.T) {
+	t.Parallel()
+
+	a := &AuditLog{Category: AuditMachines, Action: "state"}
+
+	cases := []struct {
+		hook     Webhook
+		expected bool
+	}{
+		{Webhook{}, true},
+		{Webhook{Categories: []AuditCategory{AuditMachines}}, true},
+		{Webhook{Categories: []AuditCategory{AuditAssets, AuditMachines}}, true},
+		{Webhook{Categories: []AuditCategory{AuditAssets}}, false},
+		{Webhook{Actions: []string{"put", "state"}}, true},
+		{Webhook{Actions: []string{"delete"}}, false},
+		{Webhook{Categories: []AuditCategory{AuditMachines}, Actions: []string{"delete"}}, false},
+	}
+	for _, c := range cases {
+		if c.hook.Match(a) != c.expected {
+			t.Error("unexpected result:", c.hook, !c.expected)
+		}
+	}
+}
+
+func TestSignWebhookPayload(t *testing.T) {
+	t.Parallel()
+
+	// RFC 4231 test case 2
+	sig := SignWebhookPayload("Jefe", []byte("what do ya want for nothing?"))
+	expected := "sha256=5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"
+	if sig != expected {
+		t.Error("unexpected signature:", sig)
+	}
+}